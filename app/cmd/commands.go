@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	swagger "mobileSongLibrary/gates/apiservice"
+	"mobileSongLibrary/gates/auth"
+	"mobileSongLibrary/gates/enricher"
+	"mobileSongLibrary/gates/storage"
+	"mobileSongLibrary/gates/transfer"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// runCommand выполняет подкоманду и возвращает код выхода
+func runCommand(name string, args []string, db *storage.DB, client swagger.ClientInterface, log *slog.Logger) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch name {
+	case "import":
+		err = runImport(ctx, args, db, client, log)
+	case "export":
+		err = runExport(ctx, args, db)
+	case "useradd":
+		err = runUserAdd(ctx, args, db)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, available commands: import, export, useradd\n", name)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, name+":", err)
+		return 1
+	}
+	return 0
+}
+
+// runImport импортирует песни из CSV или NDJSON файла:
+// app import -file songs.csv [-format csv] [-map Artist=group,Title=song] [-dry-run] [-enrich] [-report errors.csv]
+func runImport(ctx context.Context, args []string, db *storage.DB, client swagger.ClientInterface, log *slog.Logger) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := flags.String("file", "", "CSV or NDJSON file to import, - for stdin")
+	format := flags.String("format", "", "csv, ndjson, m3u8, xspf or pls, guessed from file extension if empty")
+	mapping := flags.String("map", "", "CSV column mapping, e.g. Artist=group,Title=song")
+	dryRun := flags.Bool("dry-run", false, "only validate the file, do not write anything")
+	enrich := flags.Bool("enrich", false, "fill empty fields from the info API")
+	reportPath := flags.String("report", "", "write rows that failed to import to this CSV file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	opts := transfer.ImportOptions{Format: *format, DryRun: *dryRun, Enrich: *enrich}
+	if opts.Format == "" {
+		opts.Format = transfer.FormatFromName(*file)
+	}
+	var err error
+	if opts.Mapping, err = transfer.ParseMapping(*mapping); err != nil {
+		return err
+	}
+
+	var input io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+
+	report, err := transfer.NewImporter(db, enricher.New(client, log), log).Import(ctx, input, opts)
+	if err != nil {
+		return err
+	}
+	if *reportPath != "" {
+		f, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err = transfer.WriteErrorReport(f, report); err != nil {
+			return err
+		}
+	}
+
+	report.Errors = nil //подробности в файле отчёта или в логах, в консоль выводим только итог
+	return json.NewEncoder(os.Stdout).Encode(report)
+}
+
+// runExport выгружает библиотеку в CSV, NDJSON или JSON:
+// app export -format csv -out library.csv [-group Muse] [-song ...] [-text ...] [-album ...] [-tags genre:rock,...] [-exclude-tags ...] [-sort -play_count] [-link ...] [-release-date 16.07.2006]
+func runExport(ctx context.Context, args []string, db *storage.DB) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", transfer.FormatCSV, "csv, ndjson, json, m3u8, xspf or pls")
+	out := flags.String("out", "-", "output file, - for stdout")
+	var filter domain.SongFilter
+	flags.StringVar(&filter.GroupName, "group", "", "export only this group")
+	flags.StringVar(&filter.SongName, "song", "", "export only this song")
+	flags.StringVar(&filter.Text, "text", "", "export only songs containing this text")
+	flags.StringVar(&filter.Album, "album", "", "export only songs of this album")
+	tags := flags.String("tags", "", "export only songs with all of these comma separated tags, e.g. genre:rock,mood:chill")
+	excludeTags := flags.String("exclude-tags", "", "export only songs with none of these comma separated tags")
+	sort := flags.String("sort", "", "extra sort keys before group and song, e.g. -play_count")
+	link := flags.String("link", "", "export only songs with this link")
+	releaseDate := flags.String("release-date", "", "export only songs released on this date, e.g. 16.07.2006")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	filter.Link = domain.Link(*link)
+	var err error
+	if filter.Tags, err = domain.SplitTags(*tags); err != nil {
+		return fmt.Errorf("invalid -tags: %w", err)
+	}
+	if filter.ExcludeTags, err = domain.SplitTags(*excludeTags); err != nil {
+		return fmt.Errorf("invalid -exclude-tags: %w", err)
+	}
+	if filter.Sort, err = domain.ParseSort(*sort); err != nil {
+		return fmt.Errorf("invalid -sort: %w", err)
+	}
+	if *releaseDate != "" {
+		date, err := domain.ParseCustomDate(*releaseDate)
+		if err != nil {
+			return fmt.Errorf("invalid -release-date: %w", err)
+		}
+		filter.ReleaseDate = date
+	}
+
+	var output io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		output = f
+	}
+	buffered := bufio.NewWriter(output)
+	encoder, err := transfer.NewEncoder(*format, buffered)
+	if err != nil {
+		return err
+	}
+	if err = db.StreamLibrary(ctx, filter, encoder.Encode); err != nil {
+		return err
+	}
+	if err = encoder.Close(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// runUserAdd создаёт пользователя, пароль берётся из флага или первой строки stdin:
+// app useradd -username admin [-password secret] [-roles admin]
+func runUserAdd(ctx context.Context, args []string, db *storage.DB) error {
+	flags := flag.NewFlagSet("useradd", flag.ContinueOnError)
+	username := flags.String("username", "", "login of the new user")
+	password := flags.String("password", "", "password of the new user, read from stdin if empty")
+	roleList := flags.String("roles", string(domain.RoleListener), "comma separated roles: listener, editor, admin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	roles, err := domain.ParseRoles(strings.Split(*roleList, ","))
+	if err != nil {
+		return err
+	}
+	creds := domain.Credentials{Username: *username, Password: *password}
+	if creds.Password == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		creds.Password = strings.TrimRight(line, "\r\n")
+	}
+	if err = creds.Validate(); err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword(creds.Password)
+	if err != nil {
+		return err
+	}
+	user, err := db.CreateUser(ctx, creds.Username, hash, roles...)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(user)
+}
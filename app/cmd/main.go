@@ -1,18 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" //драйвер postgres
 	goose "github.com/pressly/goose/v3"
 	swagger "mobileSongLibrary/gates/apiservice"
+	"mobileSongLibrary/gates/auth"
+	"mobileSongLibrary/gates/charts"
+	"mobileSongLibrary/gates/events"
+	"mobileSongLibrary/gates/outbox"
+	"mobileSongLibrary/gates/plays"
 	"mobileSongLibrary/gates/server"
+	"mobileSongLibrary/gates/similar"
 	"mobileSongLibrary/gates/storage"
+	_ "mobileSongLibrary/gates/storage/migrations" //Go-миграции регистрируются в goose при импорте
+	"mobileSongLibrary/gates/webhooks"
 	"mobileSongLibrary/internal/config"
 	"mobileSongLibrary/internal/logger"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 //@title mobileSongLibrary
@@ -22,6 +35,10 @@ import (
 //@host localhost:8080
 //@BasePath /
 
+//@securityDefinitions.apikey BearerAuth
+//@in header
+//@name Authorization
+
 func main() {
 	const op = "cmd.main"
 	//Считываем конфиг
@@ -43,32 +60,82 @@ func main() {
 	}
 	db := storage.NewDB(conn, log) //переменная базы данных
 
-	//накатываем миграцию
+	//путь к миграциям
 	migrationsPath := os.Getenv("MIGRATIONS_PATH") //для докера
 	if migrationsPath == "" {
 		migrationsPath = "./gates\\storage\\migrations"
 	}
 
-	//накатываем миграцию
-	err = goose.Down(conn.DB, migrationsPath)
+	//инициализируем сваггер
+	restServerAddr := cfg.Rest.Host + ":" + cfg.Rest.Port
+	client, err := swagger.NewClient("http://" + restServerAddr)
+	if err != nil {
+		panic(err)
+	}
+
+	//подкоманды командной строки, например: app import -file songs.csv
+	if len(os.Args) > 1 {
+		err = goose.Up(conn.DB, migrationsPath)
+		if err != nil {
+			panic(err)
+		}
+		os.Exit(runCommand(os.Args[1], os.Args[2:], db, client, log))
+	}
+
+	//накатываем миграции. Откатывать последнюю при старте нельзя: вместе с ней пропадут её данные
 	err = goose.Up(conn.DB, migrationsPath)
 	if err != nil {
 		panic(err)
 	}
-	//инициализируем сваггер
-	restServerAddr := cfg.Rest.Host + ":" + cfg.Rest.Port
-	client, err := swagger.NewClient("http://" + restServerAddr)
+
+	//ключи подписи токенов берутся из конфига, сервис работает без внешнего провайдера
+	authenticator, err := auth.New(cfg.Auth, cfg.Env, db, log)
 	if err != nil {
 		panic(err)
 	}
 
+	//прослушивания пишутся в бд пачками в фоне
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	recorder := plays.New(db, cfg.Plays, log)
+	go recorder.Run(ctx)
+	//снимки чартов пересчитываются в фоне
+	go charts.New(db, cfg.Charts, log).Run(ctx)
+	//индекс похожих песен строится в фоне и перестраивается, когда библиотека меняется
+	recommender := similar.New(db, cfg.Similar, log)
+	go recommender.Run(ctx)
+	//события об изменениях библиотеки доставляются из outbox во внешние системы
+	if cfg.Outbox.Enabled {
+		sinks, err := outbox.NewSinks(cfg.Outbox.Sinks, db)
+		if err != nil {
+			panic(err)
+		}
+		//события раскладываются по подпискам на вебхуки и отправляются подписчикам отдельно
+		if cfg.Webhooks.Enabled {
+			sinks = append(sinks, webhooks.NewFanout(db))
+			go webhooks.New(db, cfg.Webhooks, log).Run(ctx)
+		}
+		go outbox.New(db, sinks, cfg.Outbox, log).Run(ctx)
+	}
+	//поток изменений по SSE читает те же события из outbox и раздаёт их подключённым клиентам
+	hub := events.New(db, cfg.Events, log)
+	go hub.Run(ctx)
+
 	router := chi.NewRouter()
-	_ = server.NewServer(router, db, log, client, cfg)
+	_ = server.NewServer(router, db, log, client, cfg, authenticator, recorder, recommender, hub)
 
 	log.Info("Starting server at port: " + cfg.Rest.Port)
-	err = http.ListenAndServe(restServerAddr, router)
-	if err != nil {
+	httpServer := &http.Server{Addr: restServerAddr, Handler: router}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+	err = httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		panic(err)
-		return
 	}
+	//при остановке дописываем прослушивания, которые ещё в очереди
+	recorder.Wait()
 }
@@ -15,58 +15,77 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/library": {
+        "/admin/audit": {
             "get": {
-                "description": "Возвращает список всех песен с возможностью фильтрации через заголовки",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает записи журнала аудита, новые первыми: кто, когда и откуда добавил, изменил, перенёс или удалил песню, переименовал, слил или удалил группу, с состоянием до и после.\nЗаписи пишутся в одной транзакции с изменением и не меняются. В JSON по умолчанию отдаётся 50 записей, выгрузка в csv и ndjson без limit отдаёт все записи по фильтру",
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson"
                 ],
                 "tags": [
-                    "Library"
+                    "Admin"
                 ],
-                "summary": "Получить всю библиотеку песен",
+                "summary": "Журнал аудита",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Название группы",
-                        "name": "group",
-                        "in": "header"
+                        "description": "Логин автора",
+                        "name": "user",
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Название песни",
-                        "name": "song",
-                        "in": "header"
+                        "description": "Действие: song.*, lyrics.*, group.*, album.*, playlist.*, user.*, apikey.* или webhook.*, например song.update или user.roles",
+                        "name": "action",
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Часть текста песни",
-                        "name": "text",
-                        "in": "header"
+                        "description": "Ключ объекта, song:\u003cгруппа\u003e/\u003cпесня\u003e или group:\u003cгруппа\u003e, * на конце ищет по началу ключа",
+                        "name": "target",
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Ссылка на песню",
-                        "name": "link",
-                        "in": "header"
+                        "description": "Id запроса из заголовка X-Request-Id",
+                        "name": "request_id",
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "Дата релиза в формате 16.07.2006",
-                        "name": "release_date",
-                        "in": "header"
+                        "description": "Не раньше, RFC 3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Раньше, RFC 3339",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json, csv или ndjson (по умолчанию json)",
+                        "name": "format",
+                        "in": "query"
                     },
                     {
                         "type": "integer",
                         "description": "Лимит выдачи",
                         "name": "limit",
-                        "in": "header"
+                        "in": "query"
                     },
                     {
                         "type": "integer",
                         "description": "Смещение выдачи",
                         "name": "offset",
-                        "in": "header"
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -75,7 +94,7 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/domain.Song"
+                                "$ref": "#/definitions/domain.AuditEntry"
                             }
                         }
                     },
@@ -85,6 +104,18 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права audit:read",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
                     "500": {
                         "description": "Ошибка сервера",
                         "schema": {
@@ -94,9 +125,58 @@ const docTemplate = `{
                 }
             }
         },
-        "/renamegroup": {
-            "patch": {
-                "description": "Изменяет название музыкальной группы",
+        "/admin/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает всех пользователей с ролями. Требует право users:manage (роль admin)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Список пользователей",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.User"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Недостаточно прав",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Заводит пользователя с паролем и ролями (listener, editor, admin), без ролей пользователь получает listener. Требует право users:manage",
                 "consumes": [
                     "application/json"
                 ],
@@ -104,25 +184,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Groups"
+                    "Admin"
                 ],
-                "summary": "Переименовать группу",
+                "summary": "Создать пользователя",
                 "parameters": [
                     {
-                        "description": "Старое и новое название группы",
-                        "name": "groupRename",
+                        "description": "Логин, пароль и роли",
+                        "name": "user",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/server.groupRename"
+                            "$ref": "#/definitions/domain.UserRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "Группа успешно переименована",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/domain.User"
                         }
                     },
                     "400": {
@@ -131,6 +211,24 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Недостаточно прав",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Пользователь уже есть",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Ошибка сервера",
                         "schema": {
@@ -140,50 +238,47 @@ const docTemplate = `{
                 }
             }
         },
-        "/song": {
-            "get": {
-                "description": "Возвращает данные о песне с пагинацией текста",
+        "/admin/users/{id}": {
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отключает или включает пользователя. Отключённый пользователь не может войти, его refresh токены отзываются, а выданные access токены и API-ключи сразу перестают проходить проверку прав. Требует право users:manage",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Songs"
+                    "Admin"
                 ],
-                "summary": "Получить информацию о песне",
+                "summary": "Изменить пользователя",
                 "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Название группы",
-                        "name": "group",
-                        "in": "header",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Название песни",
-                        "name": "song",
-                        "in": "header",
-                        "required": true
-                    },
                     {
                         "type": "integer",
-                        "description": "Номер страницы (по умолчанию 1)",
-                        "name": "page",
-                        "in": "header"
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Количество куплетов на странице (по умолчанию 2)",
-                        "name": "size",
-                        "in": "header"
+                        "description": "Изменения",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.UserPatch"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/domain.User"
                         }
                     },
                     "400": {
@@ -192,6 +287,30 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Недостаточно прав",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Нельзя отключить самого себя",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Ошибка сервера",
                         "schema": {
@@ -199,9 +318,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "post": {
-                "description": "Добавляет новую песню в библиотеку",
+            }
+        },
+        "/admin/users/{id}/roles": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Заменяет роли пользователя целиком: listener читает библиотеку, editor ещё и меняет её, admin удаляет, переименовывает группы, импортирует и управляет пользователями. Изменения действуют сразу. Требует право users:manage",
                 "consumes": [
                     "application/json"
                 ],
@@ -209,29 +335,60 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Songs"
+                    "Admin"
                 ],
-                "summary": "Добавить новую песню",
+                "summary": "Назначить роли",
                 "parameters": [
                     {
-                        "description": "Данные новой песни",
-                        "name": "song",
+                        "type": "integer",
+                        "description": "id пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Новый набор ролей",
+                        "name": "roles",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/domain.Song"
+                            "$ref": "#/definitions/domain.RolesRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Песня успешно добавлена",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/domain.User"
                         }
                     },
                     "400": {
-                        "description": "Некорректный запрос",
+                        "description": "Неизвестная роль",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Недостаточно прав",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Пользователь не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Нельзя снять роль admin с самого себя",
                         "schema": {
                             "type": "string"
                         }
@@ -243,9 +400,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Удаляет песню по названию и группе",
+            }
+        },
+        "/albums": {
+            "post": {
+                "description": "Создаёт альбом группы (type: lp, ep, single, compilation) вместе с трек-листом. Песни трек-листа должны уже быть в библиотеке, по умолчанию они ищутся в группе альбома и стоят на первом диске",
                 "consumes": [
                     "application/json"
                 ],
@@ -253,29 +412,35 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Songs"
+                    "Albums"
                 ],
-                "summary": "Удалить песню",
+                "summary": "Создать альбом",
                 "parameters": [
                     {
-                        "description": "Название группы и песни для удаления",
-                        "name": "song",
+                        "description": "Альбом и трек-лист",
+                        "name": "album",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/domain.Song"
+                            "$ref": "#/definitions/domain.Album"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Успешное удаление",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/domain.Album"
                         }
                     },
                     "400": {
-                        "description": "Некорректный запрос",
+                        "description": "Некорректный запрос или песни нет в библиотеке",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "У группы уже есть альбом с таким названием",
                         "schema": {
                             "type": "string"
                         }
@@ -287,39 +452,42 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "patch": {
-                "description": "Обновляет данные о песне, кроме её названия",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/albums/{id}": {
+            "get": {
+                "description": "Возвращает альбом с трек-листом по порядку дисков и треков",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Songs"
+                    "Albums"
                 ],
-                "summary": "Обновить информацию о песне",
+                "summary": "Получить альбом",
                 "parameters": [
                     {
-                        "description": "Обновлённые данные песни",
-                        "name": "song",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/domain.Song"
-                        }
+                        "type": "integer",
+                        "description": "id альбома",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Песня успешно обновлена",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/domain.Album"
                         }
                     },
                     "400": {
-                        "description": "Некорректный запрос",
+                        "description": "Некорректный id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Альбом не найден",
                         "schema": {
                             "type": "string"
                         }
@@ -331,40 +499,4747 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "domain.Song": {
-            "type": "object",
-            "properties": {
-                "group": {
-                    "type": "string"
-                },
-                "link": {
-                    "type": "string"
-                },
-                "release_date": {
-                    "type": "string"
-                },
-                "song": {
-                    "type": "string"
-                },
-                "text": {
-                    "type": "string"
-                }
-            }
-        },
-        "server.groupRename": {
-            "type": "object",
-            "properties": {
-                "new_name": {
-                    "type": "string"
+            },
+            "delete": {
+                "description": "Удаляет альбом, песни остаются в библиотеке. If-Match не обязателен, но если передан - проверяется",
+                "tags": [
+                    "Albums"
+                ],
+                "summary": "Удалить альбом",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id альбома",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag альбома",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Альбом удалён",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Альбом не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Альбом уже был изменён кем-то другим",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Меняет непустые поля альбома. Если передан tracks, трек-лист заменяется целиком (пустой массив очищает альбом). If-Match не обязателен, но если передан - проверяется",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Albums"
+                ],
+                "summary": "Изменить альбом",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id альбома",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag альбома",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Изменённые поля",
+                        "name": "album",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.Album"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Album"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос или песни нет в библиотеке",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Альбом не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "У группы уже есть альбом с таким названием",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Альбом уже был изменён кем-то другим",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/keys": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает действующие API-ключи текущего пользователя, без самих ключей",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Список API-ключей",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.APIKey"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создаёт долгоживущий API-ключ текущего пользователя для сервисных клиентов. Ключ возвращается только в этом ответе, передавать его нужно в заголовке X-API-Key. Создать ключ можно только войдя по паролю, не другим ключом",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Создать API-ключ",
+                "parameters": [
+                    {
+                        "description": "Название и срок действия",
+                        "name": "key",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.APIKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/domain.APIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Запрос пришёл с API-ключом",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/keys/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отзывает API-ключ текущего пользователя, запросы с ним сразу перестают проходить",
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Отозвать API-ключ",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id ключа",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Ключ отозван",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Ключ не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/login": {
+            "post": {
+                "description": "Проверяет логин и пароль и выдаёт короткоживущий access токен (JWT) и refresh токен для его обновления",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Войти",
+                "parameters": [
+                    {
+                        "description": "Логин и пароль",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.Credentials"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.TokenPair"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Неверный логин или пароль",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/logout": {
+            "post": {
+                "description": "Отзывает refresh токен. Уже выданный access токен действует до конца своего срока",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Выйти",
+                "parameters": [
+                    {
+                        "description": "Refresh токен",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.refreshRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Токен отозван",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/me": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает, от чьего имени выполняется запрос и как он аутентифицирован (jwt или api_key) и с какими ролями",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Текущий пользователь",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Principal"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/refresh": {
+            "post": {
+                "description": "Меняет refresh токен на новую пару токенов. Refresh токен одноразовый, повторное использование отзывает все токены пользователя",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Auth"
+                ],
+                "summary": "Обновить токены",
+                "parameters": [
+                    {
+                        "description": "Refresh токен",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.refreshRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.TokenPair"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Токен недействителен",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/charts": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает самые популярные песни за период по прослушиваниям и добавлениям в избранное. Вес события падает вдвое за четверть периода, добавление в избранное весит как 3 прослушивания.\nЧарт берётся из последнего снимка, который фоновая задача пересчитывает раз в charts.refresh_interval. Места считаются внутри фильтра по группе и жанру, rank_change - изменение места относительно предыдущего снимка",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Charts"
+                ],
+                "summary": "Чарт",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "day, week или month, по умолчанию week",
+                        "name": "window",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Только песни группы",
+                        "name": "group",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Только песни с тегом genre:\u003cgenre\u003e",
+                        "name": "genre",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько мест вернуть, по умолчанию 50",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Chart"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Чарт ещё не посчитан",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/events": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Server-Sent Events: каждое добавление, изменение, перенос и удаление песни, переименование, слияние и удаление группы приходит событием с id, типом (song.create, group.rename, ...) и JSON как в outbox. Параметр group (можно несколько раз) оставляет события только этих групп, перенос и переименование приходят обеим группам. После обрыва клиент переподключается с Last-Event-ID (или last_event_id) и получает пропущенные события из журнала. Если журнал их уже не хранит, приходит событие reset и клиенту нужно перечитать /library. Каждые events.heartbeat приходит комментарий \": ping\". Клиент, который не успевает принимать события, отключается и должен переподключиться с Last-Event-ID",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Events"
+                ],
+                "summary": "Поток изменений библиотеки",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Фильтр по группам",
+                        "name": "group",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id последнего полученного события, если нельзя передать заголовок",
+                        "name": "last_event_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id последнего полученного события",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Поток событий",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права library:read",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Поток ещё не готов, повторите позже",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/export": {
+            "get": {
+                "description": "Потоково выгружает песни в CSV, NDJSON, JSON или плейлистом M3U8, XSPF, PLS для медиаплееров (песни без ссылки в плейлист не попадают). Фильтры те же, что у /library, их можно передать заголовками или query параметрами",
+                "produces": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apple.mpegurl",
+                    "application/xspf+xml",
+                    "audio/x-scpls"
+                ],
+                "tags": [
+                    "Library"
+                ],
+                "summary": "Выгрузка библиотеки",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "csv, ndjson, json, m3u8, xspf или pls (по умолчанию json)",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название группы",
+                        "name": "group",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название песни",
+                        "name": "song",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Часть текста песни",
+                        "name": "text",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ссылка на песню",
+                        "name": "link",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название альбома",
+                        "name": "album",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Дата релиза в формате 16.07.2006",
+                        "name": "release_date",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Сортировка перед группой и песней, например -play_count",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Лимит выдачи",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Смещение выдачи",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.Song"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/groups": {
+            "get": {
+                "description": "Возвращает группы по алфавиту с карточкой, количеством песен и альбомов, годом первого и последнего релиза. Общее количество найденных групп отдаётся в заголовке X-Total-Count",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Groups"
+                ],
+                "summary": "Список групп",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Часть названия группы",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько групп вернуть",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько групп пропустить",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.Group"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Создаёт карточку группы. Песен у группы может ещё не быть",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Groups"
+                ],
+                "summary": "Создать карточку группы",
+                "parameters": [
+                    {
+                        "description": "Карточка группы",
+                        "name": "group",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.GroupProfile"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Group"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Карточка группы уже есть",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/groups/merge": {
+            "post": {
+                "description": "Переносит все песни группы source в группу target. Одноимённые песни разрешаются стратегией strategy (keep-target, keep-source, keep-newest), для отдельных песен её можно переопределить в overrides",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Groups"
+                ],
+                "summary": "Слить две группы",
+                "parameters": [
+                    {
+                        "description": "Какую группу и куда сливать",
+                        "name": "merge",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.GroupMerge"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.MergeResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Группа source не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/groups/{name}": {
+            "get": {
+                "description": "Возвращает карточку группы (страна, год основания, жанры, участники, описание) и сводку по её песням и альбомам",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Groups"
+                ],
+                "summary": "Карточка группы",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Group"
+                        }
+                    },
+                    "404": {
+                        "description": "Группа не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удаляет карточку группы. С mode=refuse (по умолчанию) группа с песнями не удаляется, с mode=cascade удаляются и все её песни и альбомы",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Groups"
+                ],
+                "summary": "Удалить группу",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "refuse или cascade",
+                        "name": "mode",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сколько песен удалено",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Группа не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "У группы есть песни",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Меняет непустые поля карточки, пустой массив genres или members очищает его. Название меняется через /renamegroup. Если карточки ещё нет, а песни у группы есть, карточка создаётся. If-Match не обязателен, но если передан - проверяется",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Groups"
+                ],
+                "summary": "Изменить карточку группы",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag карточки",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Изменяемые поля карточки",
+                        "name": "group",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.GroupProfile"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Group"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Группа не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Карточка уже была изменена кем-то другим",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/groups/{name}/albums": {
+            "get": {
+                "description": "Возвращает альбомы группы по дате выхода вместе с трек-листами",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Albums"
+                ],
+                "summary": "Дискография группы",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.Album"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/groups/{name}/tags": {
+            "post": {
+                "description": "Добавляет группе теги вида namespace:value. Теги группы действуют на все её песни в фильтрах и фасетах",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tags"
+                ],
+                "summary": "Добавить теги группе",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Теги, group и song не нужны",
+                        "name": "tags",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.TagsRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.tagsResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Группа не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Снимает теги с группы, а значит и со всех её песен. Собственные теги песен не меняются",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tags"
+                ],
+                "summary": "Снять теги с группы",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Теги, group и song не нужны",
+                        "name": "tags",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.TagsRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.tagsResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Группа не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/import": {
+            "post": {
+                "description": "Потоково читает CSV (с заголовком), NDJSON или плейлист M3U8/XSPF/PLS из multipart поля file и добавляет или обновляет песни. Ошибки отдельных строк не прерывают импорт и попадают в отчёт",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "Library"
+                ],
+                "summary": "Импорт песен из файла",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "CSV, NDJSON, M3U8, XSPF или PLS файл",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "csv, ndjson, m3u8, xspf или pls, по умолчанию по расширению файла",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Маппинг колонок CSV, например Artist=group,Title=song",
+                        "name": "mapping",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Только проверить файл, ничего не записывая",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Дополнять пустые поля через внешний API",
+                        "name": "enrich",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "csv - вернуть файл с ошибками вместо JSON отчёта",
+                        "name": "report",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/transfer.ImportReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/library": {
+            "get": {
+                "description": "Возвращает список всех песен с возможностью фильтрации через заголовки (или одноимённые query параметры).\nЕсли передан facets, ответ - объект {songs, facets}, где для каждого пространства тегов посчитано, сколько песен выборки (без учёта пагинации) помечено каждым тегом",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Library"
+                ],
+                "summary": "Получить всю библиотеку песен",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы",
+                        "name": "group",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название песни",
+                        "name": "song",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Часть текста песни",
+                        "name": "text",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ссылка на песню",
+                        "name": "link",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название альбома",
+                        "name": "album",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Дата релиза в формате 16.07.2006",
+                        "name": "release_date",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Теги через запятую, песня должна иметь все: genre:rock,mood:chill",
+                        "name": "tags",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Теги через запятую, песня не должна иметь ни одного",
+                        "name": "exclude_tags",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Сортировка через запятую: group, song, release_date, play_count, last_played, минус - по убыванию (-play_count)",
+                        "name": "sort",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Пространства тегов через запятую (genre,mood), для которых посчитать фасеты",
+                        "name": "facets",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Лимит выдачи",
+                        "name": "limit",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Смещение выдачи",
+                        "name": "offset",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.Song"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/library/duplicates": {
+            "get": {
+                "description": "Группирует песни, которые скорее всего являются одной песней: одинаковое или отличающееся опечаткой название одной группы без пометок издания ((Remastered 2011), - Live), одинаковая ссылка, одинаковый или почти одинаковый текст. Каждой группе выставляется оценка от 0 до 1, песни в отчёте приходят без текста",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Library"
+                ],
+                "summary": "Отчёт о возможных дублях",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "Минимальная оценка группы (по умолчанию 0)",
+                        "name": "min_score",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимальное количество групп",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.duplicatesReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/library/duplicates/merge": {
+            "post": {
+                "description": "Сливает песню drop в песню keep: пустые поля keep заполняются данными drop, после чего drop удаляется. Текст и LRC берутся вместе с одной стороны: у drop только если у keep нет ни того, ни другого",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Library"
+                ],
+                "summary": "Слить пару дублей",
+                "parameters": [
+                    {
+                        "description": "Какую песню оставить и какую слить в неё",
+                        "name": "pair",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.SongPair"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Song"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/favorites": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает избранные песни текущего пользователя, последние добавленные первыми",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Plays"
+                ],
+                "summary": "Избранное",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Сколько песен вернуть, по умолчанию 50",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько песен пропустить",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.Favorite"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Добавляет песню в избранное текущего пользователя, повторное добавление ничего не меняет",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Plays"
+                ],
+                "summary": "Добавить в избранное",
+                "parameters": [
+                    {
+                        "description": "Группа и песня",
+                        "name": "song",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.FavoriteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Песня в избранном",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Убирает песню из избранного текущего пользователя",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Plays"
+                ],
+                "summary": "Убрать из избранного",
+                "parameters": [
+                    {
+                        "description": "Группа и песня",
+                        "name": "song",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.FavoriteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Песня убрана из избранного",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песни нет в избранном",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/history": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает прослушивания текущего пользователя, последние первыми",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Plays"
+                ],
+                "summary": "История прослушиваний",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Сколько записей вернуть, по умолчанию 50",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько записей пропустить",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.Play"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/playlists": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает плейлисты по названию с количеством песен, без самих песен",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Playlists"
+                ],
+                "summary": "Список плейлистов",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.Playlist"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создаёт пустой плейлист, песни добавляются через /playlists/{id}/items",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Playlists"
+                ],
+                "summary": "Создать плейлист",
+                "parameters": [
+                    {
+                        "description": "Название и описание",
+                        "name": "playlist",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.Playlist"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Playlist"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/playlists/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает плейлист с песнями по порядку. id записи нужен, чтобы убрать или переставить её. С параметром format плейлист отдаётся файлом m3u8, xspf или pls для плеера, песни без ссылки в файл не попадают",
+                "produces": [
+                    "application/json",
+                    "audio/x-mpegurl",
+                    "application/xspf+xml",
+                    "audio/x-scpls"
+                ],
+                "tags": [
+                    "Playlists"
+                ],
+                "summary": "Получить плейлист",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id плейлиста",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "m3u8",
+                            "xspf",
+                            "pls"
+                        ],
+                        "type": "string",
+                        "description": "Формат файла",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Playlist"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный id или неизвестный формат",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Плейлист не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаляет плейлист, песни остаются в библиотеке. If-Match не обязателен, но если передан - проверяется",
+                "tags": [
+                    "Playlists"
+                ],
+                "summary": "Удалить плейлист",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id плейлиста",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag плейлиста",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Плейлист удалён",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Плейлист не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Плейлист уже был изменён кем-то другим",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Меняет непустые name и description. If-Match не обязателен, но если передан - проверяется",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Playlists"
+                ],
+                "summary": "Переименовать плейлист",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id плейлиста",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag плейлиста",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Новые название и описание",
+                        "name": "playlist",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.Playlist"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Playlist"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Плейлист не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Плейлист уже был изменён кем-то другим",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/playlists/{id}/items": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Добавляет песню из библиотеки на место index (с 0), без index - в конец. Одну песню можно добавить несколько раз",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Playlists"
+                ],
+                "summary": "Добавить песню в плейлист",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id плейлиста",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Песня и место",
+                        "name": "item",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.PlaylistAdd"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Playlist"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Плейлист или песня не найдены",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/playlists/{id}/items/{item}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Убирает запись item из плейлиста, порядок остальных записей не меняется",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Playlists"
+                ],
+                "summary": "Убрать песню из плейлиста",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id плейлиста",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id записи",
+                        "name": "item",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Playlist"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Плейлист или запись не найдены",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/playlists/{id}/items/{item}/move": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Переносит запись item на место index (с 0). index больше длины плейлиста переносит запись в конец",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Playlists"
+                ],
+                "summary": "Переставить песню в плейлисте",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id плейлиста",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id записи",
+                        "name": "item",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Новое место",
+                        "name": "move",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.PlaylistMove"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Playlist"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Плейлист или запись не найдены",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/renamegroup": {
+            "patch": {
+                "description": "Изменяет название музыкальной группы у всех её песен в одной транзакции",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Groups"
+                ],
+                "summary": "Переименовать группу",
+                "parameters": [
+                    {
+                        "description": "Старое и новое название группы",
+                        "name": "groupRename",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.groupRename"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Группа успешно переименована",
+                        "schema": {
+                            "$ref": "#/definitions/server.groupRenameResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Группа не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "У новой группы уже есть песни с такими названиями",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/song": {
+            "get": {
+                "description": "Возвращает данные о песне с пагинацией текста по частям. У каждой части в sections есть тип (verse, chorus, bridge...) и номер, повтор припева отмечен repeat.\nЯзык текста выбирается по параметру lang или заголовку Accept-Language, если перевода нет - отдаётся оригинал. Для перевода в original_sections лежат те же части оригинала",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Songs"
+                ],
+                "summary": "Получить информацию о песне",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы",
+                        "name": "group",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название песни",
+                        "name": "song",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Номер страницы, от 1 (по умолчанию 1)",
+                        "name": "page",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Количество частей текста на странице, от 1 (по умолчанию 2)",
+                        "name": "size",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Языки текста в формате Accept-Language, например de, en;q=0.8",
+                        "name": "lang",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Используется если не передан lang",
+                        "name": "Accept-Language",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag уже имеющейся у клиента версии",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "304": {
+                        "description": "Песня не изменилась",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Добавляет новую песню в библиотеку, с полем album песня ставится последним треком этого альбома группы. Можно передать синхронизированный текст в поле lrc, тогда пустой text будет выведен из него",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Songs"
+                ],
+                "summary": "Добавить новую песню",
+                "parameters": [
+                    {
+                        "description": "Данные новой песни",
+                        "name": "song",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.Song"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Песня успешно добавлена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Такая песня уже есть в группе",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удаляет песню по названию и группе",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Songs"
+                ],
+                "summary": "Удалить песню",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag песни, полученный из GET /song",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Название группы и песни для удаления",
+                        "name": "song",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.Song"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Успешное удаление",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Песня уже была изменена кем-то другим",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "428": {
+                        "description": "Не передан If-Match",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Обновляет данные о песне, кроме её названия. Поле lrc проверяется, пустой text выводится из него. Требует заголовок If-Match с ETag из GET /song",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Songs"
+                ],
+                "summary": "Обновить информацию о песне",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag песни, полученный из GET /song",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Обновлённые данные песни",
+                        "name": "song",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.Song"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Песня успешно обновлена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Песня уже была изменена кем-то другим",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "428": {
+                        "description": "Не передан If-Match",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/song/lyrics": {
+            "get": {
+                "description": "Отдаёт текст песни с метками времени для режима караоке: исходный LRC или JSON, где у каждой строки есть время начала в миллисекундах (offset уже учтён)",
+                "produces": [
+                    "application/json",
+                    "text/plain"
+                ],
+                "tags": [
+                    "Songs"
+                ],
+                "summary": "Синхронизированный текст песни",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы (или query параметр group)",
+                        "name": "group",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название песни (или query параметр song)",
+                        "name": "song",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "lrc или json (по умолчанию json)",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag уже имеющейся у клиента версии",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.songLyrics"
+                        }
+                    },
+                    "304": {
+                        "description": "Песня не изменилась",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена или у неё нет синхронизированного текста",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/song/move": {
+            "post": {
+                "description": "Атомарно меняет название и/или группу песни, все ссылки на песню сохраняются. If-Match необязателен, но если передан - проверяется",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Songs"
+                ],
+                "summary": "Переименовать песню или перенести её в другую группу",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag песни, полученный из GET /song",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Текущие и новые группа и название песни",
+                        "name": "move",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.SongMove"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.Song"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Песня с таким названием в группе уже есть",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "412": {
+                        "description": "Песня уже была изменена кем-то другим",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/song/play": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Записывает прослушивание песни текущим пользователем. Прослушивания пишутся в бд пачками, поэтому в истории и счётчиках появляются с задержкой до plays.flush_interval",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Plays"
+                ],
+                "summary": "Отметить прослушивание",
+                "parameters": [
+                    {
+                        "description": "Песня и клиент",
+                        "name": "play",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.PlayRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Прослушивание принято",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Очередь прослушиваний переполнена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/song/similar": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает песни, похожие на заданную, по убыванию сходства. Сходство складывается из tf-idf близости текстов, общих тегов, той же группы и близкого года релиза, в reasons перечислено, что совпало.\nИндекс текстов строится в фоне и перестраивается, когда библиотека меняется, поэтому только что добавленные песни появляются в выдаче с задержкой до similar.refresh_interval",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Library"
+                ],
+                "summary": "Похожие песни",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Название группы (или query параметр group)",
+                        "name": "group",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Название песни (или query параметр song)",
+                        "name": "song",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Сколько песен вернуть, по умолчанию 10, не больше 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.SimilarSong"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Индекс ещё строится",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/song/tags": {
+            "post": {
+                "description": "Добавляет песне теги вида namespace:value (genre:rock, mood:chill). Возвращает собственные теги песни, без тегов группы",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tags"
+                ],
+                "summary": "Добавить теги песне",
+                "parameters": [
+                    {
+                        "description": "Песня и теги",
+                        "name": "tags",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.TagsRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.tagsResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Снимает с песни её теги. Теги группы так снять нельзя, они снимаются с группы. Возвращает оставшиеся собственные теги песни",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tags"
+                ],
+                "summary": "Снять теги с песни",
+                "parameters": [
+                    {
+                        "description": "Песня и теги",
+                        "name": "tags",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.TagsRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.tagsResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/song/translation": {
+            "put": {
+                "description": "Сохраняет текст песни на языке lang (BCP-47, например en или pt-BR). Если original = true, язык становится языком оригинала и текст песни заменяется этим текстом",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Songs"
+                ],
+                "summary": "Добавить или заменить перевод текста песни",
+                "parameters": [
+                    {
+                        "description": "Песня, язык и текст",
+                        "name": "translation",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.SongTranslation"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Перевод заменён",
+                        "schema": {
+                            "$ref": "#/definitions/server.translationResult"
+                        }
+                    },
+                    "201": {
+                        "description": "Перевод добавлен",
+                        "schema": {
+                            "$ref": "#/definitions/server.translationResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удаляет текст песни на языке lang. Текст самой песни не меняется, даже если удаляется язык оригинала",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Songs"
+                ],
+                "summary": "Удалить перевод текста песни",
+                "parameters": [
+                    {
+                        "description": "Песня и язык",
+                        "name": "translation",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/server.translationDelete"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Перевод удалён",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Песня или перевод не найдены",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/songs:batch": {
+            "post": {
+                "description": "Принимает массив песен {group, song}, обогащает их через внешний API параллельно и вставляет пачками, по транзакции на пачку. Для каждой песни возвращается статус: created, duplicate, enrichment_failed, invalid или failed (пачку не удалось записать, песня не добавлена и её можно отправить повторно)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Songs"
+                ],
+                "summary": "Добавить много песен разом",
+                "parameters": [
+                    {
+                        "description": "Песни для добавления",
+                        "name": "songs",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.SongRef"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.batchResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Слишком много песен или слишком большое тело запроса",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает подписки текущего пользователя без секретов",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Список подписок на вебхуки",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.WebhookSubscription"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhooks:manage",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Подписывает url на события об изменениях песен и групп. event_types - типы событий song.create, song.update, song.delete, song.move, group.rename, group.merge, group.delete, пустой - все события, пустой groups - события всех групп. Каждая доставка подписывается HMAC-SHA256 от \"\u003cX-Webhook-Timestamp\u003e.\u003cтело\u003e\" секретом подписки и приходит в заголовке X-Webhook-Signature как sha256=\u003chex\u003e. Если secret не задан, он генерируется. Секрет возвращается только в этом ответе. Адреса в localhost и внутренних сетях (loopback, частные, link-local) отклоняются, если не включён webhooks.allow_private",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Создать подписку на вебхуки",
+                "parameters": [
+                    {
+                        "description": "Адрес, фильтры и секрет",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.WebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/domain.WebhookSubscription"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhooks:manage",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает подписку текущего пользователя. У отключённой подписки в disabled_reason указано почему",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Подписка на вебхуки",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.WebhookSubscription"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhooks:manage",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Удаляет подписку вместе с журналом доставок, ждущие доставки не уйдут",
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Удалить подписку на вебхуки",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Подписка удалена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhooks:manage",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Меняет переданные поля подписки. Пустой массив event_types или groups снимает фильтр. enabled=true включает подписку, отключённую после череды неудачных доставок, и сбрасывает счётчик ошибок. Новый secret возвращается в ответе",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Изменить подписку на вебхуки",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Изменяемые поля",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/domain.WebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/domain.WebhookSubscription"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhooks:manage",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает доставки подписки, новые первыми: статус, число попыток, код последнего ответа и ошибку",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Журнал доставок подписки",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы, по умолчанию 50",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Смещение",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/domain.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhooks:manage",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries/{delivery}/redeliver": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Ставит в очередь новую доставку того же события, с тем же телом и новым X-Webhook-Id. Исходная доставка остаётся в журнале. Отключённой подписке доставка уйдёт, когда её включат",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhooks"
+                ],
+                "summary": "Повторить доставку",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "id подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "id доставки",
+                        "name": "delivery",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/domain.WebhookDelivery"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный id",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет токена или API-ключа",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Нет права webhooks:manage",
+                        "schema": {
+                            "$ref": "#/definitions/auth.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка или доставка не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "auth.Problem": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string"
+                },
+                "instance": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "description": "только в ответе на создание",
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "начало ключа, чтобы его можно было узнать в списке",
+                    "type": "string"
+                }
+            }
+        },
+        "domain.APIKeyRequest": {
+            "type": "object",
+            "properties": {
+                "expires_in_days": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.Album": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "release_date": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "tracks": {
+                    "description": "по порядку: диск, номер трека",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.Track"
+                    }
+                },
+                "type": {
+                    "$ref": "#/definitions/domain.AlbumType"
+                }
+            }
+        },
+        "domain.AlbumType": {
+            "type": "string",
+            "enum": [
+                "lp",
+                "ep",
+                "single",
+                "compilation"
+            ],
+            "x-enum-varnames": [
+                "AlbumLP",
+                "AlbumEP",
+                "AlbumSingle",
+                "AlbumCompilation"
+            ]
+        },
+        "domain.AuditAction": {
+            "type": "string",
+            "enum": [
+                "song.create",
+                "song.update",
+                "song.delete",
+                "song.move",
+                "group.rename",
+                "group.merge",
+                "group.delete",
+                "song.merge",
+                "song.tags",
+                "lyrics.put",
+                "lyrics.delete",
+                "group.create",
+                "group.update",
+                "group.tags",
+                "album.create",
+                "album.update",
+                "album.delete",
+                "playlist.create",
+                "playlist.update",
+                "playlist.items",
+                "playlist.delete",
+                "user.create",
+                "user.update",
+                "user.roles",
+                "apikey.create",
+                "apikey.revoke",
+                "webhook.create",
+                "webhook.update",
+                "webhook.delete"
+            ],
+            "x-enum-varnames": [
+                "AuditSongCreate",
+                "AuditSongUpdate",
+                "AuditSongDelete",
+                "AuditSongMove",
+                "AuditGroupRename",
+                "AuditGroupMerge",
+                "AuditGroupDelete",
+                "AuditSongMerge",
+                "AuditSongTags",
+                "AuditLyricsPut",
+                "AuditLyricsDelete",
+                "AuditGroupCreate",
+                "AuditGroupUpdate",
+                "AuditGroupTags",
+                "AuditAlbumCreate",
+                "AuditAlbumUpdate",
+                "AuditAlbumDelete",
+                "AuditPlaylistCreate",
+                "AuditPlaylistUpdate",
+                "AuditPlaylistItems",
+                "AuditPlaylistDelete",
+                "AuditUserCreate",
+                "AuditUserUpdate",
+                "AuditUserRoles",
+                "AuditAPIKeyCreate",
+                "AuditAPIKeyRevoke",
+                "AuditWebhookCreate",
+                "AuditWebhookUpdate",
+                "AuditWebhookDelete"
+            ]
+        },
+        "domain.AuditEntry": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "$ref": "#/definitions/domain.AuditAction"
+                },
+                "after": {
+                    "type": "object"
+                },
+                "before": {
+                    "type": "object"
+                },
+                "client_ip": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "target": {
+                    "description": "ключ того, что изменилось: song:\u003cгруппа\u003e/\u003cпесня\u003e, group:\u003cгруппа\u003e, album:\u003cid\u003e и т.д.",
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.Chart": {
+            "type": "object",
+            "properties": {
+                "computed_at": {
+                    "type": "string"
+                },
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.ChartEntry"
+                    }
+                },
+                "previous_at": {
+                    "description": "когда посчитан снимок, с которым сравниваются места",
+                    "type": "string"
+                },
+                "window": {
+                    "$ref": "#/definitions/domain.ChartWindow"
+                }
+            }
+        },
+        "domain.ChartEntry": {
+            "type": "object",
+            "properties": {
+                "favorites": {
+                    "type": "integer"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "new": {
+                    "description": "в предыдущем снимке песни не было",
+                    "type": "boolean"
+                },
+                "plays": {
+                    "type": "integer"
+                },
+                "previous_rank": {
+                    "description": "место в предыдущем снимке с тем же фильтром",
+                    "type": "integer"
+                },
+                "rank": {
+                    "type": "integer"
+                },
+                "rank_change": {
+                    "description": "на сколько мест песня поднялась, отрицательное - опустилась",
+                    "type": "integer"
+                },
+                "score": {
+                    "type": "number"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.ChartWindow": {
+            "type": "string",
+            "enum": [
+                "day",
+                "week",
+                "month"
+            ],
+            "x-enum-varnames": [
+                "ChartDay",
+                "ChartWeek",
+                "ChartMonth"
+            ]
+        },
+        "domain.Credentials": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.DuplicateGroup": {
+            "type": "object",
+            "properties": {
+                "reasons": {
+                    "description": "title, link, lyrics",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "score": {
+                    "description": "от 0 до 1, насколько мы уверены что это дубли",
+                    "type": "number"
+                },
+                "songs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.Song"
+                    }
+                }
+            }
+        },
+        "domain.Favorite": {
+            "type": "object",
+            "properties": {
+                "added_at": {
+                    "type": "string"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.FavoriteRequest": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.Group": {
+            "type": "object",
+            "properties": {
+                "albums": {
+                    "type": "integer"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "first_release_year": {
+                    "type": "integer"
+                },
+                "formed_year": {
+                    "type": "integer"
+                },
+                "genres": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "last_release_year": {
+                    "type": "integer"
+                },
+                "members": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "songs": {
+                    "type": "integer"
+                },
+                "tags": {
+                    "description": "теги группы, действуют на все её песни",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "domain.GroupMerge": {
+            "type": "object",
+            "properties": {
+                "overrides": {
+                    "description": "стратегии для отдельных песен, названия сравниваются по ключу",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/domain.MergeStrategy"
+                    }
+                },
+                "source": {
+                    "type": "string"
+                },
+                "strategy": {
+                    "description": "стратегия по умолчанию для всех конфликтов",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/domain.MergeStrategy"
+                        }
+                    ]
+                },
+                "target": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.GroupProfile": {
+            "type": "object",
+            "properties": {
+                "country": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "formed_year": {
+                    "type": "integer"
+                },
+                "genres": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "members": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.LyricLine": {
+            "type": "object",
+            "properties": {
+                "start_ms": {
+                    "description": "когда строка начинается, offset уже учтён",
+                    "type": "integer"
+                },
+                "text": {
+                    "description": "пустая строка - пауза между куплетами",
+                    "type": "string"
+                }
+            }
+        },
+        "domain.MergeConflict": {
+            "type": "object",
+            "properties": {
+                "kept": {
+                    "description": "source или target",
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                },
+                "strategy": {
+                    "$ref": "#/definitions/domain.MergeStrategy"
+                }
+            }
+        },
+        "domain.MergeResult": {
+            "type": "object",
+            "properties": {
+                "conflicts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.MergeConflict"
+                    }
+                },
+                "moved": {
+                    "type": "integer"
+                }
+            }
+        },
+        "domain.MergeStrategy": {
+            "type": "string",
+            "enum": [
+                "keep-target",
+                "keep-source",
+                "keep-newest"
+            ],
+            "x-enum-comments": {
+                "KeepNewest": "остаётся песня, которую обновляли последней",
+                "KeepSource": "остаётся песня сливаемой группы",
+                "KeepTarget": "остаётся песня группы, в которую сливаем"
+            },
+            "x-enum-varnames": [
+                "KeepTarget",
+                "KeepSource",
+                "KeepNewest"
+            ]
+        },
+        "domain.Play": {
+            "type": "object",
+            "properties": {
+                "client": {
+                    "type": "string"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "played_at": {
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.PlayRequest": {
+            "type": "object",
+            "properties": {
+                "client": {
+                    "description": "название приложения, если пустое - берётся User-Agent",
+                    "type": "string"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.Playlist": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "items": {
+                    "description": "по порядку",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.PlaylistItem"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "songs": {
+                    "description": "сколько песен в плейлисте",
+                    "type": "integer"
+                }
+            }
+        },
+        "domain.PlaylistAdd": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.PlaylistItem": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.PlaylistMove": {
+            "type": "object",
+            "properties": {
+                "index": {
+                    "type": "integer"
+                }
+            }
+        },
+        "domain.Principal": {
+            "type": "object",
+            "properties": {
+                "api_key_id": {
+                    "description": "если запрос пришёл с API-ключом",
+                    "type": "integer"
+                },
+                "method": {
+                    "description": "jwt или api_key",
+                    "type": "string"
+                },
+                "roles": {
+                    "description": "роли из бд на момент запроса",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.Role"
+                    }
+                },
+                "user_id": {
+                    "type": "integer"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.Role": {
+            "type": "string",
+            "enum": [
+                "listener",
+                "editor",
+                "admin"
+            ],
+            "x-enum-comments": {
+                "RoleAdmin": "удаление, переименование групп, импорт, управление пользователями и журнал аудита",
+                "RoleEditor": "добавление и изменение песен, альбомов, групп, тегов и плейлистов",
+                "RoleListener": "чтение библиотеки"
+            },
+            "x-enum-varnames": [
+                "RoleListener",
+                "RoleEditor",
+                "RoleAdmin"
+            ]
+        },
+        "domain.RolesRequest": {
+            "type": "object",
+            "properties": {
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "domain.SimilarSong": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "reasons": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "score": {
+                    "type": "number"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.Song": {
+            "type": "object",
+            "properties": {
+                "album": {
+                    "description": "при добавлении песня попадает в конец этого альбома группы",
+                    "type": "string"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "last_played": {
+                    "description": "когда слушали в последний раз",
+                    "type": "string"
+                },
+                "link": {
+                    "type": "string"
+                },
+                "lrc": {
+                    "description": "синхронизированный текст в формате LRC",
+                    "type": "string"
+                },
+                "play_count": {
+                    "description": "сколько раз песню слушали, см. POST /song/play",
+                    "type": "integer"
+                },
+                "release_date": {
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                },
+                "tags": {
+                    "description": "теги песни вместе с тегами её группы, меняются через /song/tags",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.SongMove": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "new_group": {
+                    "description": "пусто - группа не меняется",
+                    "type": "string"
+                },
+                "new_song": {
+                    "description": "пусто - название не меняется",
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.SongPair": {
+            "type": "object",
+            "properties": {
+                "drop": {
+                    "$ref": "#/definitions/domain.SongRef"
+                },
+                "keep": {
+                    "$ref": "#/definitions/domain.SongRef"
+                }
+            }
+        },
+        "domain.SongRef": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.SongTranslation": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "lang": {
+                    "type": "string"
+                },
+                "original": {
+                    "description": "это язык оригинала, текст песни тоже будет заменён",
+                    "type": "boolean"
+                },
+                "song": {
+                    "type": "string"
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.TagsRequest": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "description": "для тегов песни",
+                    "type": "string"
+                },
+                "song": {
+                    "description": "для тегов песни",
+                    "type": "string"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "domain.TokenPair": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "description": "через сколько секунд истечёт access_token",
+                    "type": "integer"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.Track": {
+            "type": "object",
+            "properties": {
+                "disc": {
+                    "description": "по умолчанию 1",
+                    "type": "integer"
+                },
+                "group": {
+                    "description": "по умолчанию группа альбома",
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                },
+                "track": {
+                    "type": "integer"
+                }
+            }
+        },
+        "domain.User": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.Role"
+                    }
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.UserPatch": {
+            "type": "object",
+            "properties": {
+                "disabled": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "domain.UserRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "integer"
+                },
+                "event_type": {
+                    "$ref": "#/definitions/domain.AuditAction"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "description": "только у ждущих доставок",
+                    "type": "string"
+                },
+                "redelivery_of": {
+                    "type": "integer"
+                },
+                "response_status": {
+                    "description": "код последнего ответа получателя",
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "pending, delivered или failed",
+                    "type": "string"
+                },
+                "subscription_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "domain.WebhookRequest": {
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "description": "true включает отключённую подписку и сбрасывает счётчик ошибок",
+                    "type": "boolean"
+                },
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "groups": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "domain.WebhookSubscription": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "disabled_reason": {
+                    "type": "string"
+                },
+                "enabled": {
+                    "description": "подписка отключается сама после disable_after неудачных попыток подряд",
+                    "type": "boolean"
+                },
+                "event_types": {
+                    "description": "пусто - все события",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.AuditAction"
+                    }
+                },
+                "failures": {
+                    "description": "неудачных попыток подряд",
+                    "type": "integer"
+                },
+                "groups": {
+                    "description": "пусто - события всех групп",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "secret": {
+                    "description": "отдаётся только при создании и смене секрета",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.batchItemResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "song": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.batchResult": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.batchItemResult"
+                    }
+                }
+            }
+        },
+        "server.duplicatesReport": {
+            "type": "object",
+            "properties": {
+                "groups": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.DuplicateGroup"
+                    }
+                }
+            }
+        },
+        "server.groupRename": {
+            "type": "object",
+            "properties": {
+                "new_name": {
+                    "type": "string"
                 },
                 "old_name": {
                     "type": "string"
                 }
             }
+        },
+        "server.groupRenameResult": {
+            "type": "object",
+            "properties": {
+                "moved": {
+                    "description": "сколько песен перенесено под новое название",
+                    "type": "integer"
+                }
+            }
+        },
+        "server.refreshRequest": {
+            "type": "object",
+            "properties": {
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.songLyrics": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/domain.LyricLine"
+                    }
+                },
+                "offset_ms": {
+                    "description": "значение тега offset",
+                    "type": "integer"
+                },
+                "song": {
+                    "type": "string"
+                },
+                "tags": {
+                    "description": "ar, ti, al, by, length...",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.tagsResult": {
+            "type": "object",
+            "properties": {
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "server.translationDelete": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "lang": {
+                    "type": "string"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        },
+        "server.translationResult": {
+            "type": "object",
+            "properties": {
+                "aligned": {
+                    "description": "частей столько же, сколько в оригинале, и их можно показывать рядом",
+                    "type": "boolean"
+                },
+                "lang": {
+                    "type": "string"
+                },
+                "original": {
+                    "type": "boolean"
+                },
+                "sections": {
+                    "description": "на сколько частей разобран текст",
+                    "type": "integer"
+                }
+            }
+        },
+        "transfer.ImportReport": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/transfer.RowError"
+                    }
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "updated": {
+                    "type": "integer"
+                }
+            }
+        },
+        "transfer.RowError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "group": {
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
+                },
+                "song": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
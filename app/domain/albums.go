@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrAlbumNotFound = errors.New("album not found")
+var ErrAlbumConflict = errors.New("album with the same title already exists in the group")
+
+// Типы альбомов
+type AlbumType string
+
+const (
+	AlbumLP          AlbumType = "lp"
+	AlbumEP          AlbumType = "ep"
+	AlbumSingle      AlbumType = "single"
+	AlbumCompilation AlbumType = "compilation"
+)
+
+func (t AlbumType) Validate() error {
+	switch t {
+	case AlbumLP, AlbumEP, AlbumSingle, AlbumCompilation:
+		return nil
+	}
+	return fmt.Errorf("unknown album type %q, expected lp, ep, single or compilation", t)
+}
+
+// Album альбом группы. В сборнике (compilation) могут быть песни других групп
+type Album struct {
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	GroupName   GroupName  `json:"group"`
+	ReleaseDate CustomDate `json:"release_date,omitempty"`
+	Type        AlbumType  `json:"type,omitempty"`
+	Tracks      []Track    `json:"tracks,omitempty"` // по порядку: диск, номер трека
+	Version     int        `json:"-"`
+}
+
+// Track песня на альбоме
+type Track struct {
+	Disc      int       `json:"disc,omitempty"` // по умолчанию 1
+	Number    int       `json:"track"`
+	GroupName GroupName `json:"group,omitempty"` // по умолчанию группа альбома
+	SongName  SongName  `json:"song"`
+}
+
+// Validate проверяет альбом для создания и заполняет значения по умолчанию
+func (a *Album) Validate() error {
+	if a.Title == "" {
+		return errors.New("title is required")
+	}
+	if a.GroupName == "" {
+		return errors.New("group is required")
+	}
+	if a.Type == "" {
+		a.Type = AlbumLP
+	}
+	if err := a.Type.Validate(); err != nil {
+		return err
+	}
+	return a.validateTracks()
+}
+
+// ValidatePatch проверяет изменение альбома: пустые поля не меняются, Tracks != nil заменяет весь трек-лист
+func (a *Album) ValidatePatch() error {
+	if a.Type != "" {
+		if err := a.Type.Validate(); err != nil {
+			return err
+		}
+	}
+	if a.Title == "" && a.GroupName == "" && a.ReleaseDate.IsZero() && a.Type == "" && a.Tracks == nil {
+		return ErrCantReplaceWithEmptyRows
+	}
+	return a.validateTracks()
+}
+
+func (a *Album) validateTracks() error {
+	slots := make(map[[2]int]struct{}, len(a.Tracks))
+	songs := make(map[[2]string]struct{}, len(a.Tracks))
+	for i := range a.Tracks {
+		track := &a.Tracks[i]
+		if track.Disc == 0 {
+			track.Disc = 1
+		}
+		if track.GroupName == "" {
+			track.GroupName = a.GroupName
+		}
+		if track.SongName == "" {
+			return fmt.Errorf("track %d: song is required", i+1)
+		}
+		if track.Disc < 1 || track.Number < 1 {
+			return fmt.Errorf("track %d: disc and track numbers must be positive", i+1)
+		}
+		slot := [2]int{track.Disc, track.Number}
+		if _, ok := slots[slot]; ok {
+			return fmt.Errorf("track %d: disc %d track %d is used twice", i+1, track.Disc, track.Number)
+		}
+		slots[slot] = struct{}{}
+		song := [2]string{NormalizeKey(string(track.GroupName)), NormalizeKey(string(track.SongName))}
+		if _, ok := songs[song]; ok {
+			return fmt.Errorf("track %d: song %q is used twice", i+1, track.SongName)
+		}
+		songs[song] = struct{}{}
+	}
+	return nil
+}
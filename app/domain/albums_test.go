@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAlbumValidate(t *testing.T) {
+	album := Album{Title: "Black Holes and Revelations", GroupName: "Muse", Tracks: []Track{
+		{Number: 1, SongName: "Take a Bow"},
+		{Number: 2, SongName: "Starlight"},
+		{Disc: 2, Number: 1, GroupName: "Muse", SongName: "Supermassive Black Hole"},
+	}}
+	require.NoError(t, album.Validate())
+	require.Equal(t, AlbumLP, album.Type)
+	require.Equal(t, 1, album.Tracks[0].Disc)
+	require.Equal(t, GroupName("Muse"), album.Tracks[1].GroupName)
+
+	for name, broken := range map[string]Album{
+		"no title":   {GroupName: "Muse"},
+		"bad type":   {Title: "Origin of Symmetry", GroupName: "Muse", Type: "bootleg"},
+		"same slot":  {Title: "Absolution", GroupName: "Muse", Tracks: []Track{{Number: 1, SongName: "Intro"}, {Number: 1, SongName: "Apocalypse Please"}}},
+		"same song":  {Title: "Absolution", GroupName: "Muse", Tracks: []Track{{Number: 1, SongName: "Hysteria"}, {Number: 2, SongName: "HYSTERIA"}}},
+		"zero track": {Title: "Absolution", GroupName: "Muse", Tracks: []Track{{SongName: "Hysteria"}}},
+	} {
+		require.Error(t, broken.Validate(), name)
+	}
+
+	patch := Album{}
+	require.ErrorIs(t, patch.ValidatePatch(), ErrCantReplaceWithEmptyRows)
+	patch.Tracks = []Track{}
+	require.NoError(t, patch.ValidatePatch()) //пустой трек-лист - очистить альбом
+}
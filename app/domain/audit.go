@@ -0,0 +1,157 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AuditAction что именно изменилось
+type AuditAction string
+
+const (
+	AuditSongCreate  AuditAction = "song.create"
+	AuditSongUpdate  AuditAction = "song.update"
+	AuditSongDelete  AuditAction = "song.delete"
+	AuditSongMove    AuditAction = "song.move"
+	AuditGroupRename AuditAction = "group.rename"
+	AuditGroupMerge  AuditAction = "group.merge"
+	AuditGroupDelete AuditAction = "group.delete"
+
+	// Действия ниже пишутся только в журнал аудита, событий о них нет
+	AuditSongMerge      AuditAction = "song.merge"
+	AuditSongTags       AuditAction = "song.tags"
+	AuditLyricsPut      AuditAction = "lyrics.put"
+	AuditLyricsDelete   AuditAction = "lyrics.delete"
+	AuditGroupCreate    AuditAction = "group.create"
+	AuditGroupUpdate    AuditAction = "group.update"
+	AuditGroupTags      AuditAction = "group.tags"
+	AuditAlbumCreate    AuditAction = "album.create"
+	AuditAlbumUpdate    AuditAction = "album.update"
+	AuditAlbumDelete    AuditAction = "album.delete"
+	AuditPlaylistCreate AuditAction = "playlist.create"
+	AuditPlaylistUpdate AuditAction = "playlist.update"
+	AuditPlaylistItems  AuditAction = "playlist.items"
+	AuditPlaylistDelete AuditAction = "playlist.delete"
+	AuditUserCreate     AuditAction = "user.create"
+	AuditUserUpdate     AuditAction = "user.update"
+	AuditUserRoles      AuditAction = "user.roles"
+	AuditAPIKeyCreate   AuditAction = "apikey.create"
+	AuditAPIKeyRevoke   AuditAction = "apikey.revoke"
+	AuditWebhookCreate  AuditAction = "webhook.create"
+	AuditWebhookUpdate  AuditAction = "webhook.update"
+	AuditWebhookDelete  AuditAction = "webhook.delete"
+)
+
+// EventTypes действия, о которых кроме записи в журнале публикуется событие в outbox
+var EventTypes = []AuditAction{AuditSongCreate, AuditSongUpdate, AuditSongDelete, AuditSongMove, AuditGroupRename, AuditGroupMerge, AuditGroupDelete}
+
+// AuditActions все действия, которые пишутся в журнал
+var AuditActions = append(append([]AuditAction{}, EventTypes...),
+	AuditSongMerge, AuditSongTags, AuditLyricsPut, AuditLyricsDelete, AuditGroupCreate, AuditGroupUpdate, AuditGroupTags,
+	AuditAlbumCreate, AuditAlbumUpdate, AuditAlbumDelete, AuditPlaylistCreate, AuditPlaylistUpdate, AuditPlaylistItems, AuditPlaylistDelete,
+	AuditUserCreate, AuditUserUpdate, AuditUserRoles, AuditAPIKeyCreate, AuditAPIKeyRevoke, AuditWebhookCreate, AuditWebhookUpdate, AuditWebhookDelete)
+
+// ParseAuditAction проверяет название действия из фильтра
+func ParseAuditAction(s string) (AuditAction, error) {
+	for _, action := range AuditActions {
+		if string(action) == s {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("unknown audit action %q", s)
+}
+
+// ParseEventType проверяет тип события из фильтра подписки
+func ParseEventType(s string) (AuditAction, error) {
+	for _, action := range EventTypes {
+		if string(action) == s {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("unknown event type %q", s)
+}
+
+// Actor кто и откуда выполняет изменение. Хранилище пишет его в журнал аудита в одной транзакции с изменением
+type Actor struct {
+	UserID    int64  // 0 - изменение без пользователя, когда аутентификация выключена
+	Username  string // пусто у изменений без пользователя
+	RequestID string
+	ClientIP  string
+}
+
+type actorKey struct{}
+
+// WithActor кладёт в контекст того, кто выполняет изменение
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom достаёт из контекста того, кто выполняет изменение. Без него изменение пишется в журнал без автора
+func ActorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// AuditEntry запись журнала аудита. Журнал только пополняется, менять и удалять записи нельзя
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	UserID    *int64          `json:"user_id,omitempty"`
+	Username  string          `json:"username,omitempty"`
+	Action    AuditAction     `json:"action"`
+	Target    string          `json:"target"` // ключ того, что изменилось: song:<группа>/<песня>, group:<группа>, album:<id> и т.д.
+	Before    json.RawMessage `json:"before,omitempty" swaggertype:"object"`
+	After     json.RawMessage `json:"after,omitempty" swaggertype:"object"`
+	RequestID string          `json:"request_id,omitempty"`
+	ClientIP  string          `json:"client_ip,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditFilter фильтр журнала аудита, пустые поля не фильтруют
+type AuditFilter struct {
+	Username  string
+	Action    AuditAction
+	Target    string // точный ключ или начало ключа с * на конце, например song:muse/*
+	RequestID string
+	From      time.Time
+	To        time.Time
+	Limit     int // 0 - без ограничения
+	Offset    int
+}
+
+// SongTarget ключ песни в журнале аудита, не зависит от регистра и написания названий
+func SongTarget(group GroupName, song SongName) string {
+	return "song:" + NormalizeKey(string(group)) + "/" + NormalizeKey(string(song))
+}
+
+// GroupTarget ключ группы в журнале аудита
+func GroupTarget(group GroupName) string {
+	return "group:" + NormalizeKey(string(group))
+}
+
+// AlbumTarget ключ альбома в журнале аудита
+func AlbumTarget(id int64) string {
+	return "album:" + strconv.FormatInt(id, 10)
+}
+
+// PlaylistTarget ключ плейлиста в журнале аудита
+func PlaylistTarget(id int64) string {
+	return "playlist:" + strconv.FormatInt(id, 10)
+}
+
+// UserTarget ключ пользователя в журнале аудита
+func UserTarget(id int64) string {
+	return "user:" + strconv.FormatInt(id, 10)
+}
+
+// APIKeyTarget ключ API-ключа в журнале аудита
+func APIKeyTarget(id int64) string {
+	return "apikey:" + strconv.FormatInt(id, 10)
+}
+
+// WebhookTarget ключ подписки на вебхуки в журнале аудита
+func WebhookTarget(id int64) string {
+	return "webhook:" + strconv.FormatInt(id, 10)
+}
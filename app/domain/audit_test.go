@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAuditTargetsAndActor(t *testing.T) {
+	require.Equal(t, "song:muse/supermassive black hole", SongTarget(" MUSE", "Supermassive  Black Hole"))
+	require.Equal(t, "group:muse", GroupTarget("Muse "))
+	require.Equal(t, "playlist:7", PlaylistTarget(7))
+
+	action, err := ParseAuditAction("group.rename")
+	require.NoError(t, err)
+	require.Equal(t, AuditGroupRename, action)
+	_, err = ParseAuditAction("song.play")
+	require.Error(t, err)
+	// о действиях только для журнала событий нет, подписаться на них нельзя
+	_, err = ParseAuditAction("user.roles")
+	require.NoError(t, err)
+	_, err = ParseEventType("user.roles")
+	require.Error(t, err)
+
+	require.Equal(t, Actor{}, ActorFrom(context.Background()))
+	ctx := WithActor(context.Background(), Actor{Username: "admin", RequestID: "req-1"})
+	require.Equal(t, "req-1", ActorFrom(ctx).RequestID)
+}
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrChartNotReady = errors.New("chart is not computed yet")
+
+// ChartWindow за какой период считается чарт
+type ChartWindow string
+
+const (
+	ChartDay   ChartWindow = "day"
+	ChartWeek  ChartWindow = "week"
+	ChartMonth ChartWindow = "month"
+)
+
+// ChartWindows все периоды, фоновая задача пересчитывает каждый
+var ChartWindows = []ChartWindow{ChartDay, ChartWeek, ChartMonth}
+
+// FavoriteWeight во сколько раз добавление в избранное весит больше одного прослушивания
+const FavoriteWeight = 3.0
+
+// ParseChartWindow проверяет период чарта, пустой - неделя
+func ParseChartWindow(s string) (ChartWindow, error) {
+	if s == "" {
+		return ChartWeek, nil
+	}
+	for _, w := range ChartWindows {
+		if string(w) == s {
+			return w, nil
+		}
+	}
+	return "", fmt.Errorf("unknown chart window %q, expected day, week or month", s)
+}
+
+// Duration длина периода: события старше в чарт не попадают
+func (w ChartWindow) Duration() time.Duration {
+	switch w {
+	case ChartDay:
+		return 24 * time.Hour
+	case ChartMonth:
+		return 30 * 24 * time.Hour
+	default:
+		return 7 * 24 * time.Hour
+	}
+}
+
+// HalfLife за сколько вес события падает вдвое. Свежие прослушивания важнее старых, поэтому чарт показывает, что набирает популярность
+func (w ChartWindow) HalfLife() time.Duration {
+	return w.Duration() / 4
+}
+
+// ChartEntry место песни в чарте
+type ChartEntry struct {
+	Rank         int       `json:"rank"`
+	PreviousRank *int      `json:"previous_rank,omitempty"` // место в предыдущем снимке с тем же фильтром
+	RankChange   int       `json:"rank_change"`             // на сколько мест песня поднялась, отрицательное - опустилась
+	New          bool      `json:"new,omitempty"`           // в предыдущем снимке песни не было
+	GroupName    GroupName `json:"group"`
+	SongName     SongName  `json:"song"`
+	Score        float64   `json:"score"`
+	Plays        int64     `json:"plays"`
+	Favorites    int64     `json:"favorites"`
+}
+
+// SetPrevious заполняет изменение места по месту в предыдущем снимке, nil - песни там не было
+func (e *ChartEntry) SetPrevious(previous *int) {
+	e.PreviousRank = previous
+	e.New = previous == nil
+	e.RankChange = 0
+	if previous != nil {
+		e.RankChange = *previous - e.Rank
+	}
+}
+
+// Chart снимок чарта
+type Chart struct {
+	Window     ChartWindow  `json:"window"`
+	ComputedAt time.Time    `json:"computed_at"`
+	PreviousAt *time.Time   `json:"previous_at,omitempty"` // когда посчитан снимок, с которым сравниваются места
+	Entries    []ChartEntry `json:"entries"`
+}
+
+// ChartQuery какой чарт нужен: период и необязательные фильтры по группе и жанру (тегу genre:)
+type ChartQuery struct {
+	Window ChartWindow
+	Group  string
+	Genre  string
+	Limit  int
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseChartWindow(t *testing.T) {
+	w, err := ParseChartWindow("")
+	require.NoError(t, err)
+	require.Equal(t, ChartWeek, w)
+	w, err = ParseChartWindow("day")
+	require.NoError(t, err)
+	require.Less(t, w.HalfLife(), w.Duration())
+
+	_, err = ParseChartWindow("year")
+	require.Error(t, err)
+}
+
+func TestChartEntrySetPrevious(t *testing.T) {
+	entry := ChartEntry{Rank: 2}
+	previous := 5
+	entry.SetPrevious(&previous)
+	require.Equal(t, 3, entry.RankChange)
+	require.False(t, entry.New)
+
+	entry = ChartEntry{Rank: 1}
+	entry.SetPrevious(nil)
+	require.True(t, entry.New)
+	require.Zero(t, entry.RankChange)
+}
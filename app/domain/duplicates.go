@@ -0,0 +1,373 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Причины, по которым песни считаются возможными дублями
+const (
+	DuplicateTitle  = "title"  // одно и то же или почти одно и то же название без пометок вроде (Remastered 2011) или - Live
+	DuplicateLink   = "link"   // одинаковая ссылка
+	DuplicateLyrics = "lyrics" // одинаковый или почти одинаковый текст
+)
+
+const (
+	shingleSize      = 4    // сколько слов в одном шингле
+	lyricsSimilarity = 0.8  // минимальное сходство текстов по Жаккару
+	commonShingle    = 50   // шингл встречающийся в стольких песнях считается общей фразой и не учитывается
+	titleSimilarity  = 0.85 // минимальное сходство названий одной группы: 1 - расстояние Левенштейна / длина длинного
+	commonTrigram    = 100  // триграмма встречающаяся в стольких названиях группы не используется для поиска кандидатов
+	titleScore       = 0.6  // уверенность что песни дубли при совпадении названия, для похожих названий умножается на сходство
+	linkScore        = 0.8  // ... при совпадении ссылки
+	lyricsScore      = 0.95 // ... при полностью совпавшем тексте, для похожих текстов умножается на сходство
+)
+
+// Пометки изданий, которые не делают песню другой песней
+var versionMarkers = []string{
+	"remaster", "live", "version", "edit", "mono", "stereo", "demo", "acoustic",
+	"deluxe", "bonus", "single", "album", "mix", "feat", "ft.", "explicit", "clean",
+}
+
+var titleSuffix = regexp.MustCompile(`\s*(\([^()]*\)|\[[^\[\]]*\]|\s-\s.*)$`)
+
+// BaseTitle ключ названия песни без пометок издания: "Song (Remastered 2011)" и "Song - Live" дают "song"
+func BaseTitle(song SongName) string {
+	title := NormalizeKey(string(song))
+	for {
+		loc := titleSuffix.FindStringIndex(title)
+		if loc == nil || loc[0] == 0 || !hasVersionMarker(title[loc[0]:]) {
+			return title
+		}
+		title = strings.TrimSpace(title[:loc[0]])
+	}
+}
+
+func hasVersionMarker(suffix string) bool {
+	for _, marker := range versionMarkers {
+		if strings.Contains(suffix, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// lyricsWords текст песни в виде слов без регистра и пунктуации
+func lyricsWords(text string) []string {
+	return strings.FieldsFunc(NormalizeKey(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+}
+
+// LyricsHash отпечаток текста песни, не зависящий от регистра, пунктуации и переносов строк
+func LyricsHash(text string) string {
+	words := lyricsWords(text)
+	if len(words) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join(words, " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// lyricsShingles множество шинглов по shingleSize слов. Шинглы хранятся хэшами, чтобы отчёт по большой
+// библиотеке не держал в памяти все тексты
+func lyricsShingles(text string) map[uint64]struct{} {
+	words := lyricsWords(text)
+	shingles := make(map[uint64]struct{})
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleSize], " ")))
+		shingles[h.Sum64()] = struct{}{}
+	}
+	return shingles
+}
+
+// titleTrigrams триграммы слов названия как в pg_trgm: каждое слово дополняется двумя пробелами слева и одним справа.
+// По общим триграммам ищутся кандидаты в похожие названия
+func titleTrigrams(title string) map[string]struct{} {
+	trigrams := make(map[string]struct{})
+	for _, word := range strings.FieldsFunc(title, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			trigrams[string(runes[i:i+3])] = struct{}{}
+		}
+	}
+	return trigrams
+}
+
+// titleNumbers числа из названия: "Part 1" и "Part 2" похожи по буквам, но это разные песни
+func titleNumbers(title string) string {
+	return strings.Join(strings.FieldsFunc(title, func(r rune) bool { return !unicode.IsDigit(r) }), " ")
+}
+
+// titleSimilarityOf сходство названий по расстоянию Левенштейна в рунах: "supermasive black hole" и
+// "supermassive black hole" дают 0.96, а "front to back" и "back to front" из тех же слов - меньше половины
+func titleSimilarityOf(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 0
+	}
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
+
+// DuplicateGroup группа песен, которые скорее всего являются одной и той же песней
+type DuplicateGroup struct {
+	Score   float64  `json:"score"`   // от 0 до 1, насколько мы уверены что это дубли
+	Reasons []string `json:"reasons"` // title, link, lyrics
+	Songs   []Song   `json:"songs"`
+}
+
+// SongPair пара песен для слияния: Drop сливается в Keep
+type SongPair struct {
+	Keep SongRef `json:"keep"`
+	Drop SongRef `json:"drop"`
+}
+
+// SongRef ссылка на песню по группе и названию
+type SongRef struct {
+	GroupName GroupName `json:"group"`
+	SongName  SongName  `json:"song"`
+}
+
+func (p SongPair) Validate() error {
+	if p.Keep.GroupName == "" || p.Keep.SongName == "" || p.Drop.GroupName == "" || p.Drop.SongName == "" {
+		return errors.New("keep and drop songs are required")
+	}
+	if NormalizeKey(string(p.Keep.GroupName)) == NormalizeKey(string(p.Drop.GroupName)) &&
+		NormalizeKey(string(p.Keep.SongName)) == NormalizeKey(string(p.Drop.SongName)) {
+		return errors.New("keep and drop must be different songs")
+	}
+	return nil
+}
+
+// DuplicateFinder собирает песни по одной и ищет среди них дубли. Для каждой песни хранятся только ключи
+// и шинглы текста, сам текст не хранится, поэтому библиотеку можно читать потоком
+type DuplicateFinder struct {
+	songs    []Song
+	parent   []int
+	scores   map[[2]int]float64
+	reasons  map[[2]int]map[string]struct{}
+	shingles []map[uint64]struct{}
+	titles   map[string][]int // ключ группы + название без пометок -> песни
+	groups   map[string][]int // ключ группы -> песни, среди них ищутся похожие названия
+	links    map[string][]int
+	lyrics   map[string][]int
+}
+
+func NewDuplicateFinder() *DuplicateFinder {
+	return &DuplicateFinder{
+		scores:  make(map[[2]int]float64),
+		reasons: make(map[[2]int]map[string]struct{}),
+		titles:  make(map[string][]int),
+		groups:  make(map[string][]int),
+		links:   make(map[string][]int),
+		lyrics:  make(map[string][]int),
+	}
+}
+
+// Add добавляет песню. В отчёт она попадёт без текста, LRC и частей
+func (f *DuplicateFinder) Add(song Song) {
+	i := len(f.songs)
+	group := NormalizeKey(string(song.GroupName))
+	title := group + "\x00" + BaseTitle(song.SongName)
+	f.titles[title] = append(f.titles[title], i)
+	f.groups[group] = append(f.groups[group], i)
+	if song.Link != "" {
+		f.links[string(song.Link)] = append(f.links[string(song.Link)], i)
+	}
+	if hash := LyricsHash(song.Text); hash != "" {
+		f.lyrics[hash] = append(f.lyrics[hash], i)
+	}
+	f.shingles = append(f.shingles, lyricsShingles(song.Text))
+	song.Text, song.LRC, song.Sections = "", "", nil
+	f.songs = append(f.songs, song)
+	f.parent = append(f.parent, i)
+}
+
+func (f *DuplicateFinder) find(i int) int {
+	for f.parent[i] != i {
+		f.parent[i] = f.parent[f.parent[i]]
+		i = f.parent[i]
+	}
+	return i
+}
+
+// link записывает улику что песни i и j дубли с уверенностью score
+func (f *DuplicateFinder) link(i, j int, reason string, score float64) {
+	if i == j {
+		return
+	}
+	if i > j {
+		i, j = j, i
+	}
+	pair := [2]int{i, j}
+	if score > f.scores[pair] {
+		f.scores[pair] = score
+	}
+	if f.reasons[pair] == nil {
+		f.reasons[pair] = make(map[string]struct{})
+	}
+	f.reasons[pair][reason] = struct{}{}
+	f.parent[f.find(i)] = f.find(j)
+}
+
+// linkBuckets связывает все песни, попавшие в одну корзину
+func (f *DuplicateFinder) linkBuckets(buckets map[string][]int, reason string, score float64) {
+	for _, bucket := range buckets {
+		for _, j := range bucket[1:] {
+			f.link(bucket[0], j, reason, score)
+		}
+	}
+}
+
+// linkSimilarLyrics связывает песни с почти одинаковым текстом.
+// Кандидаты ищутся через общие шинглы, поэтому все пары песен не перебираются
+func (f *DuplicateFinder) linkSimilarLyrics() {
+	index := make(map[uint64][]int)
+	for i, shingles := range f.shingles {
+		for shingle := range shingles {
+			index[shingle] = append(index[shingle], i)
+		}
+	}
+	shared := make(map[[2]int]int)
+	for _, ids := range index {
+		if len(ids) < 2 || len(ids) > commonShingle {
+			continue
+		}
+		for a := 0; a < len(ids); a++ {
+			for b := a + 1; b < len(ids); b++ {
+				shared[[2]int{ids[a], ids[b]}]++
+			}
+		}
+	}
+	for pair, common := range shared {
+		union := len(f.shingles[pair[0]]) + len(f.shingles[pair[1]]) - common
+		if similarity := float64(common) / float64(union); similarity >= lyricsSimilarity {
+			f.link(pair[0], pair[1], DuplicateLyrics, lyricsScore*similarity)
+		}
+	}
+}
+
+// linkSimilarTitles связывает песни одной группы с похожими названиями, например с опечаткой.
+// Кандидаты - пары с общей нечастой триграммой, для них считается сходство по расстоянию Левенштейна
+func (f *DuplicateFinder) linkSimilarTitles() {
+	for _, ids := range f.groups {
+		if len(ids) < 2 {
+			continue
+		}
+		titles := make(map[int]string, len(ids))
+		index := make(map[string][]int)
+		for _, i := range ids {
+			titles[i] = BaseTitle(f.songs[i].SongName)
+			for trigram := range titleTrigrams(titles[i]) {
+				index[trigram] = append(index[trigram], i)
+			}
+		}
+		checked := make(map[[2]int]bool)
+		for _, candidates := range index {
+			if len(candidates) < 2 || len(candidates) > commonTrigram {
+				continue
+			}
+			for a := 0; a < len(candidates); a++ {
+				for b := a + 1; b < len(candidates); b++ {
+					i, j := candidates[a], candidates[b]
+					if checked[[2]int{i, j}] {
+						continue
+					}
+					checked[[2]int{i, j}] = true
+					// одинаковые названия уже связаны через корзины, разные числа - разные песни
+					if titles[i] == titles[j] || titleNumbers(titles[i]) != titleNumbers(titles[j]) {
+						continue
+					}
+					if similarity := titleSimilarityOf(titles[i], titles[j]); similarity >= titleSimilarity {
+						f.link(i, j, DuplicateTitle, titleScore*similarity)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Groups возвращает найденные группы дублей, отсортированные по убыванию уверенности
+func (f *DuplicateFinder) Groups() []DuplicateGroup {
+	f.linkBuckets(f.titles, DuplicateTitle, titleScore)
+	f.linkBuckets(f.links, DuplicateLink, linkScore)
+	f.linkBuckets(f.lyrics, DuplicateLyrics, lyricsScore)
+	f.linkSimilarTitles()
+	f.linkSimilarLyrics()
+
+	// Собираем группы: уверенность группы растёт с каждой независимой уликой
+	members := make(map[int][]int)
+	for i := range f.songs {
+		root := f.find(i)
+		members[root] = append(members[root], i)
+	}
+	evidence := make(map[int]float64)
+	reasons := make(map[int]map[string]struct{})
+	for pair, score := range f.scores {
+		root := f.find(pair[0])
+		evidence[root] = 1 - (1-evidence[root])*(1-score)
+		if reasons[root] == nil {
+			reasons[root] = make(map[string]struct{})
+		}
+		for reason := range f.reasons[pair] {
+			reasons[root][reason] = struct{}{}
+		}
+	}
+
+	var groups []DuplicateGroup
+	for root, ids := range members {
+		if len(ids) < 2 {
+			continue
+		}
+		group := DuplicateGroup{Score: evidence[root]}
+		for reason := range reasons[root] {
+			group.Reasons = append(group.Reasons, reason)
+		}
+		sort.Strings(group.Reasons)
+		for _, i := range ids {
+			group.Songs = append(group.Songs, f.songs[i])
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Score != groups[j].Score {
+			return groups[i].Score > groups[j].Score
+		}
+		return groups[i].Songs[0].SongName < groups[j].Songs[0].SongName
+	})
+	return groups
+}
+
+// FindDuplicates ищет возможные дубли: песни одной группы с одинаковым или похожим названием без пометок издания,
+// песни с одинаковой ссылкой и песни с одинаковым или почти одинаковым текстом. Группы отсортированы по убыванию уверенности
+func FindDuplicates(songs []Song) []DuplicateGroup {
+	f := NewDuplicateFinder()
+	for _, song := range songs {
+		f.Add(song)
+	}
+	return f.Groups()
+}
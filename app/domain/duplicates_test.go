@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBaseTitle(t *testing.T) {
+	cases := map[SongName]string{
+		"Here Comes the Sun (Remastered 2011)":    "here comes the sun",
+		"Here Comes the Sun - Live":               "here comes the sun",
+		"Hysteria [Live at Wembley] (Remastered)": "hysteria",
+		"Uprising (feat. Nobody)":                 "uprising",
+		"Knights of Cydonia":                      "knights of cydonia",
+		"(Don't Fear) The Reaper":                 "(don't fear) the reaper",
+		"Song 2 (Blur)":                           "song 2 (blur)",
+	}
+	for title, base := range cases {
+		require.Equal(t, base, BaseTitle(title), title)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	lyrics := "Ooh baby, don't you know I suffer?\nOoh baby, can you hear me moan?\nYou caught me under false pretenses\nHow long before you let me go?"
+	songs := []Song{
+		{GroupName: "Muse", SongName: "Supermassive Black Hole", Link: "https://youtu.be/a"},
+		{GroupName: "muse", SongName: "Supermassive Black Hole (Remastered 2011)", Link: "https://youtu.be/b"},
+		{GroupName: "Muse", SongName: "Supermassive Black Hole - Live", Link: "https://youtu.be/a"},
+		{GroupName: "Buku", SongName: "Front to Back", Text: lyrics},
+		{GroupName: "Buku", SongName: "Back to Front", Text: "OOH BABY don't you know I suffer\n\nOoh baby can you hear me moan\nYou caught me under false pretenses\nHow long before you let me go"},
+		{GroupName: "Muse", SongName: "Uprising", Link: "https://youtu.be/c", Text: "Paranoia is in bloom"},
+	}
+
+	groups := FindDuplicates(songs)
+	require.Len(t, groups, 2)
+
+	require.Equal(t, []string{DuplicateLyrics}, groups[0].Reasons)
+	require.Len(t, groups[0].Songs, 2)
+
+	require.Equal(t, []string{DuplicateLink, DuplicateTitle}, groups[1].Reasons)
+	require.Len(t, groups[1].Songs, 3)
+	require.Greater(t, groups[1].Score, linkScore)
+}
+
+func TestFindDuplicatesSimilarTitles(t *testing.T) {
+	songs := []Song{
+		{GroupName: "Muse", SongName: "Supermassive Black Hole"},
+		{GroupName: "Muse", SongName: "Supermasive Black Hole (Live)"},
+		{GroupName: "Radiohead", SongName: "Supermasive Black Hole"}, // другая группа
+		{GroupName: "Muse", SongName: "Exogenesis: Symphony Part 1"},
+		{GroupName: "Muse", SongName: "Exogenesis: Symphony Part 2"}, // отличается только номером части
+		{GroupName: "Buku", SongName: "Front to Back"},
+		{GroupName: "Buku", SongName: "Back to Front"}, // те же слова в другом порядке
+	}
+
+	groups := FindDuplicates(songs)
+	require.Len(t, groups, 1)
+	require.Equal(t, []string{DuplicateTitle}, groups[0].Reasons)
+	require.Len(t, groups[0].Songs, 2)
+	require.Equal(t, GroupName("Muse"), groups[0].Songs[0].GroupName)
+	require.Equal(t, GroupName("Muse"), groups[0].Songs[1].GroupName)
+	require.Less(t, groups[0].Score, titleScore)
+	require.Greater(t, groups[0].Score, titleScore*titleSimilarity)
+}
+
+func TestTitleSimilarity(t *testing.T) {
+	require.Equal(t, 1.0, titleSimilarityOf("hysteria", "hysteria"))
+	require.InDelta(t, 0.956, titleSimilarityOf("supermasive black hole", "supermassive black hole"), 0.001)
+	require.Less(t, titleSimilarityOf("front to back", "back to front"), 0.5)
+	require.Equal(t, 0.0, titleSimilarityOf("", ""))
+}
@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event событие об изменении библиотеки для внешних потребителей. Пишется в outbox в одной транзакции с изменением
+// и доставляется хотя бы один раз, поэтому потребители должны отбрасывать повторы по ID
+type Event struct {
+	ID            int64           `json:"id"`
+	Type          AuditAction     `json:"type"` // то же, что действие в журнале аудита
+	Target        string          `json:"target"`
+	GroupName     GroupName       `json:"group"`                    // группа после изменения, у удалений - группа удалённого
+	PreviousGroup GroupName       `json:"previous_group,omitempty"` // прежняя группа при переименовании, переносе и слиянии
+	Before        json.RawMessage `json:"before,omitempty" swaggertype:"object"`
+	After         json.RawMessage `json:"after,omitempty" swaggertype:"object"`
+	RequestID     string          `json:"request_id,omitempty"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Attempts      int             `json:"-"` // сколько раз событие уже пытались доставить, включая текущую попытку
+}
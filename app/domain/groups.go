@@ -0,0 +1,82 @@
+package domain
+
+import "errors"
+
+var ErrGroupNotFound = errors.New("group not found")
+var ErrGroupConflict = errors.New("group already has songs with the same names")
+
+// MergeStrategy определяет какая из двух одноимённых песен остаётся при слиянии групп
+type MergeStrategy string
+
+const (
+	KeepTarget MergeStrategy = "keep-target" // остаётся песня группы, в которую сливаем
+	KeepSource MergeStrategy = "keep-source" // остаётся песня сливаемой группы
+	KeepNewest MergeStrategy = "keep-newest" // остаётся песня, которую обновляли последней
+)
+
+func (m MergeStrategy) Validate() error {
+	switch m {
+	case KeepTarget, KeepSource, KeepNewest:
+		return nil
+	}
+	return errors.New("unknown merge strategy: " + string(m))
+}
+
+// GroupMerge запрос на слияние группы Source в группу Target
+type GroupMerge struct {
+	Source    string                     `json:"source"`
+	Target    string                     `json:"target"`
+	Strategy  MergeStrategy              `json:"strategy"`            // стратегия по умолчанию для всех конфликтов
+	Overrides map[SongName]MergeStrategy `json:"overrides,omitempty"` // стратегии для отдельных песен, названия сравниваются по ключу
+}
+
+func (g *GroupMerge) Validate() error {
+	if g.Source == "" || g.Target == "" {
+		return errors.New("source and target are required")
+	}
+	if NormalizeKey(g.Source) == NormalizeKey(g.Target) {
+		return errors.New("source and target are the same group, use /renamegroup to change its spelling")
+	}
+	if g.Strategy == "" {
+		g.Strategy = KeepTarget
+	}
+	if err := g.Strategy.Validate(); err != nil {
+		return err
+	}
+	// Песни сравниваются по ключу, поэтому "Hysteria" и "hysteria " - одна и та же песня
+	overrides := make(map[string]MergeStrategy, len(g.Overrides))
+	for song, strategy := range g.Overrides {
+		if err := strategy.Validate(); err != nil {
+			return err
+		}
+		key := NormalizeKey(string(song))
+		if prev, ok := overrides[key]; ok && prev != strategy {
+			return errors.New("conflicting overrides for song: " + string(song))
+		}
+		overrides[key] = strategy
+	}
+	return nil
+}
+
+// StrategyFor возвращает стратегию для конкретной песни, override ищется по ключу названия
+func (g GroupMerge) StrategyFor(song SongName) MergeStrategy {
+	key := NormalizeKey(string(song))
+	for name, strategy := range g.Overrides {
+		if NormalizeKey(string(name)) == key {
+			return strategy
+		}
+	}
+	return g.Strategy
+}
+
+// MergeConflict описывает как был разрешён конфликт одноимённых песен
+type MergeConflict struct {
+	SongName SongName      `json:"song"`
+	Strategy MergeStrategy `json:"strategy"`
+	Kept     string        `json:"kept"` // source или target
+}
+
+type MergeResult struct {
+	Moved     int             `json:"moved"`
+	Conflicts []MergeConflict `json:"conflicts"`
+}
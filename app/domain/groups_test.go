@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGroupMergeOverrides(t *testing.T) {
+	merge := GroupMerge{
+		Source:    "Muse",
+		Target:    "MUSE (band)",
+		Overrides: map[SongName]MergeStrategy{" HYSTERIA ": KeepSource},
+	}
+	require.NoError(t, merge.Validate())
+	require.Equal(t, KeepTarget, merge.Strategy)
+
+	// override находится по ключу названия, а не по точному написанию
+	require.Equal(t, KeepSource, merge.StrategyFor("Hysteria"))
+	require.Equal(t, KeepSource, merge.StrategyFor("hysteria"))
+	require.Equal(t, KeepTarget, merge.StrategyFor("Uprising"))
+
+	// два написания одной песни с разными стратегиями
+	merge.Overrides = map[SongName]MergeStrategy{"Hysteria": KeepSource, "hysteria": KeepNewest}
+	require.Error(t, merge.Validate())
+}
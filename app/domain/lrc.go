@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidLRC = errors.New("invalid LRC")
+
+// [mm:ss], [mm:ss.xx], [mm:ss.xxx] и встречающийся в некоторых плеерах [mm:ss:xx]
+var lrcTimestamp = regexp.MustCompile(`^\[(\d{1,3}):(\d{2})(?:[.:](\d{1,3}))?\]`)
+
+// [ar:Muse], [offset:+500] и прочие теги метаданных
+var lrcTag = regexp.MustCompile(`^\[([A-Za-z#]+):(.*)\]$`)
+
+// LyricLine строка синхронизированного текста
+type LyricLine struct {
+	StartMs int64  `json:"start_ms"` // когда строка начинается, offset уже учтён
+	Text    string `json:"text"`     // пустая строка - пауза между куплетами
+}
+
+// LRC разобранный текст в формате LRC
+type LRC struct {
+	Tags     map[string]string `json:"tags,omitempty"`      // ar, ti, al, by, length...
+	OffsetMs int64             `json:"offset_ms,omitempty"` // значение тега offset
+	Lines    []LyricLine       `json:"lines"`
+}
+
+// ParseLRC разбирает и проверяет LRC. У строки может быть несколько меток времени ([00:12.00][01:30.00]припев),
+// тогда она попадает в текст несколько раз. Строки сортируются по времени
+func ParseLRC(text string) (LRC, error) {
+	lrc := LRC{Tags: make(map[string]string)}
+	text = strings.TrimPrefix(strings.ReplaceAll(text, "\r\n", "\n"), "\ufeff")
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var starts []int64
+		rest := line
+		for {
+			match := lrcTimestamp.FindStringSubmatch(rest)
+			if match == nil {
+				break
+			}
+			start, err := parseLRCTime(match[1], match[2], match[3])
+			if err != nil {
+				return LRC{}, fmt.Errorf("%w: line %d: %s", ErrInvalidLRC, n+1, err)
+			}
+			starts = append(starts, start)
+			rest = rest[len(match[0]):]
+		}
+		if len(starts) > 0 {
+			for _, start := range starts {
+				lrc.Lines = append(lrc.Lines, LyricLine{StartMs: start, Text: strings.TrimSpace(rest)})
+			}
+			continue
+		}
+
+		tag := lrcTag.FindStringSubmatch(line)
+		if tag == nil {
+			return LRC{}, fmt.Errorf("%w: line %d: expected [mm:ss.xx] timestamp or [tag:value]", ErrInvalidLRC, n+1)
+		}
+		name, value := strings.ToLower(tag[1]), strings.TrimSpace(tag[2])
+		if name == "offset" {
+			offset, err := strconv.ParseInt(strings.TrimPrefix(value, "+"), 10, 64)
+			if err != nil {
+				return LRC{}, fmt.Errorf("%w: line %d: offset must be milliseconds, got %q", ErrInvalidLRC, n+1, value)
+			}
+			lrc.OffsetMs = offset
+			continue
+		}
+		lrc.Tags[name] = value
+	}
+	if len(lrc.Lines) == 0 {
+		return LRC{}, fmt.Errorf("%w: no timed lines", ErrInvalidLRC)
+	}
+
+	// Положительный offset значит что текст должен появиться раньше
+	for i := range lrc.Lines {
+		lrc.Lines[i].StartMs = max(lrc.Lines[i].StartMs-lrc.OffsetMs, 0)
+	}
+	sort.SliceStable(lrc.Lines, func(i, j int) bool {
+		return lrc.Lines[i].StartMs < lrc.Lines[j].StartMs
+	})
+	if len(lrc.Tags) == 0 {
+		lrc.Tags = nil
+	}
+	return lrc, nil
+}
+
+// parseLRCTime переводит минуты, секунды и доли секунды в миллисекунды. Доли из двух цифр - сотые, из трёх - тысячные
+func parseLRCTime(minutes, seconds, fraction string) (int64, error) {
+	mins, _ := strconv.ParseInt(minutes, 10, 64)
+	secs, _ := strconv.ParseInt(seconds, 10, 64)
+	if secs >= 60 {
+		return 0, fmt.Errorf("seconds must be less than 60, got %d", secs)
+	}
+	var ms int64
+	if fraction != "" {
+		ms, _ = strconv.ParseInt(fraction, 10, 64)
+		for i := len(fraction); i < 3; i++ {
+			ms *= 10
+		}
+	}
+	return (time.Duration(mins)*time.Minute + time.Duration(secs)*time.Second).Milliseconds() + ms, nil
+}
+
+// PlainText текст без меток времени. Пустые строки LRC (паузы) становятся разделителями куплетов,
+// как в обычном тексте песни
+func (l LRC) PlainText() string {
+	var verses []string
+	var verse []string
+	for _, line := range l.Lines {
+		if line.Text == "" {
+			if len(verse) > 0 {
+				verses = append(verses, strings.Join(verse, "\n"))
+				verse = nil
+			}
+			continue
+		}
+		verse = append(verse, line.Text)
+	}
+	if len(verse) > 0 {
+		verses = append(verses, strings.Join(verse, "\n"))
+	}
+	return strings.Join(verses, "\n\n")
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const supermassiveLRC = `[ar:Muse]
+[ti:Supermassive Black Hole]
+[offset:+500]
+
+[00:17.50]Ooh baby, don't you know I suffer?
+[00:21.00]Ooh baby, can you hear me moan?
+[00:25.00]
+[00:26.000][01:30.5]Ooh, you set my soul alight
+`
+
+func TestParseLRC(t *testing.T) {
+	lrc, err := ParseLRC(supermassiveLRC)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"ar": "Muse", "ti": "Supermassive Black Hole"}, lrc.Tags)
+	require.Equal(t, int64(500), lrc.OffsetMs)
+	require.Equal(t, []LyricLine{
+		{StartMs: 17000, Text: "Ooh baby, don't you know I suffer?"},
+		{StartMs: 20500, Text: "Ooh baby, can you hear me moan?"},
+		{StartMs: 24500, Text: ""},
+		{StartMs: 25500, Text: "Ooh, you set my soul alight"},
+		{StartMs: 90000, Text: "Ooh, you set my soul alight"},
+	}, lrc.Lines)
+	require.Equal(t, "Ooh baby, don't you know I suffer?\nOoh baby, can you hear me moan?\n\n"+
+		"Ooh, you set my soul alight\nOoh, you set my soul alight", lrc.PlainText())
+}
+
+func TestParseLRCInvalid(t *testing.T) {
+	for name, text := range map[string]string{
+		"no timestamp":  "[00:01.00]first\nsecond",
+		"bad seconds":   "[00:75.00]line",
+		"bad offset":    "[offset:soon]\n[00:01.00]line",
+		"no timed line": "[ar:Muse]\n[ti:Uprising]",
+		"empty":         "",
+	} {
+		_, err := ParseLRC(text)
+		require.ErrorIs(t, err, ErrInvalidLRC, name)
+	}
+}
+
+// LRC должен проверяться вместе с песней, а пустой текст - выводиться из него
+func TestSongValidateLRC(t *testing.T) {
+	song := Song{GroupName: "Muse", SongName: "Supermassive Black Hole", LRC: supermassiveLRC}
+	require.NoError(t, song.Validate())
+	require.Contains(t, song.Text, "Ooh baby, can you hear me moan?\n\nOoh")
+
+	song = Song{GroupName: "Muse", SongName: "Uprising", Text: "своё", LRC: "[00:01.00]line"}
+	require.NoError(t, song.Validate())
+	require.Equal(t, "своё", song.Text)
+
+	song.LRC = "not lrc"
+	require.ErrorIs(t, song.Validate(), ErrInvalidLRC)
+}
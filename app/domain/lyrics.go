@@ -0,0 +1,185 @@
+package domain
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Типы частей песни
+type SectionType string
+
+const (
+	SectionVerse      SectionType = "verse"
+	SectionChorus     SectionType = "chorus"
+	SectionPreChorus  SectionType = "pre-chorus"
+	SectionBridge     SectionType = "bridge"
+	SectionIntro      SectionType = "intro"
+	SectionOutro      SectionType = "outro"
+	SectionInstrument SectionType = "instrumental"
+)
+
+// Section часть текста песни: куплет, припев, бридж...
+type Section struct {
+	Type   SectionType `json:"type"`
+	Index  int         `json:"index"`            // номер среди частей того же типа, с 1. Повтор припева получает номер исходного припева
+	Label  string      `json:"label,omitempty"`  // метка из текста, например "Verse 2"
+	Repeat bool        `json:"repeat,omitempty"` // часть повторяет уже встречавшуюся
+	Text   string      `json:"text"`
+}
+
+// Метка части на отдельной строке: [Chorus], [Verse 2], (Припев), Chorus:, [Chorus: Matt Bellamy], [Chorus x2]
+var sectionLabel = regexp.MustCompile(`^(?:\[([^\[\]]+)\]|\(([^()]+)\)|([\p{L}][\p{L} -]*\d*)\s*:)$`)
+
+var labelNumber = regexp.MustCompile(`\d+`)
+
+// Слова меток и соответствующие им типы, сравниваются с началом метки без регистра
+var sectionWords = []struct {
+	word string
+	typ  SectionType
+}{
+	{"pre-chorus", SectionPreChorus},
+	{"prechorus", SectionPreChorus},
+	{"pre chorus", SectionPreChorus},
+	{"предприпев", SectionPreChorus},
+	{"chorus", SectionChorus},
+	{"refrain", SectionChorus},
+	{"hook", SectionChorus},
+	{"припев", SectionChorus},
+	{"verse", SectionVerse},
+	{"куплет", SectionVerse},
+	{"bridge", SectionBridge},
+	{"бридж", SectionBridge},
+	{"intro", SectionIntro},
+	{"вступление", SectionIntro},
+	{"outro", SectionOutro},
+	{"концовка", SectionOutro},
+	{"instrumental", SectionInstrument},
+	{"solo", SectionInstrument},
+	{"проигрыш", SectionInstrument},
+}
+
+// parseSectionLabel распознаёт строку-метку части. ok = false если строка обычный текст
+func parseSectionLabel(line string) (label string, typ SectionType, number int, ok bool) {
+	match := sectionLabel.FindStringSubmatch(line)
+	if match == nil {
+		return "", "", 0, false
+	}
+	label = strings.TrimSpace(match[1] + match[2] + match[3])
+	name := strings.ToLower(label)
+	if before, _, found := strings.Cut(name, ":"); found { //[Chorus: исполнитель]
+		name = strings.TrimSpace(before)
+	}
+	for _, w := range sectionWords {
+		if strings.HasPrefix(name, w.word) {
+			if n := labelNumber.FindString(name[len(w.word):]); n != "" && !strings.Contains(name, "x"+n) {
+				number, _ = strconv.Atoi(n)
+			}
+			return label, w.typ, number, true
+		}
+	}
+	return "", "", 0, false
+}
+
+// NormalizeLineEndings приводит \r\n и \r к \n и убирает пробелы в конце строк
+func NormalizeLineEndings(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, func(r rune) bool { return r == ' ' || r == '\t' })
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rawSection часть до определения типа
+type rawSection struct {
+	label  string
+	typ    SectionType
+	number int
+	lines  []string
+}
+
+// ParseLyrics разбивает текст песни на части. Части разделяются пустыми строками или метками вроде [Chorus].
+// Части без метки, текст которых встречается больше одного раза, считаются припевом, остальные - куплетами.
+// Метка без текста ([Chorus] после первого припева) повторяет последнюю часть того же типа
+func ParseLyrics(text string) []Section {
+	var raws []rawSection
+	var current *rawSection
+	flush := func() {
+		if current != nil && (len(current.lines) > 0 || current.typ != "") {
+			raws = append(raws, *current)
+		}
+		current = nil
+	}
+	for _, line := range strings.Split(NormalizeLineEndings(text), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if current != nil && len(current.lines) > 0 {
+				flush()
+			}
+			continue
+		}
+		if label, typ, number, ok := parseSectionLabel(line); ok {
+			flush()
+			current = &rawSection{label: label, typ: typ, number: number}
+			continue
+		}
+		if current == nil {
+			current = &rawSection{}
+		}
+		current.lines = append(current.lines, line)
+	}
+	flush()
+
+	// Сколько раз встречается каждый блок текста, повторяющиеся блоки без метки - припев
+	counts := make(map[string]int)
+	for _, raw := range raws {
+		if len(raw.lines) > 0 {
+			counts[NormalizeKey(strings.Join(raw.lines, "\n"))]++
+		}
+	}
+
+	sections := make([]Section, 0, len(raws))
+	seen := make(map[string]Section) // первое появление блока текста
+	last := make(map[SectionType]Section)
+	ordinals := make(map[SectionType]int)
+	for _, raw := range raws {
+		body := strings.Join(raw.lines, "\n")
+		if body == "" { //метка без текста - повтор
+			if prev, ok := last[raw.typ]; ok {
+				prev.Label, prev.Repeat = raw.label, true
+				sections = append(sections, prev)
+			} else {
+				ordinals[raw.typ]++
+				sections = append(sections, Section{Type: raw.typ, Index: ordinals[raw.typ], Label: raw.label})
+			}
+			continue
+		}
+
+		key := NormalizeKey(body)
+		if first, ok := seen[key]; ok && (raw.typ == "" || raw.typ == first.Type) {
+			first.Label, first.Repeat = raw.label, true
+			sections = append(sections, first)
+			continue
+		}
+
+		section := Section{Type: raw.typ, Label: raw.label, Text: body}
+		if section.Type == "" {
+			section.Type = SectionVerse
+			if counts[key] > 1 {
+				section.Type = SectionChorus
+			}
+		}
+		ordinals[section.Type]++
+		section.Index = ordinals[section.Type]
+		if raw.number > 0 {
+			section.Index = raw.number
+			ordinals[section.Type] = max(ordinals[section.Type], raw.number)
+		}
+		seen[key] = section
+		last[section.Type] = section
+		sections = append(sections, section)
+	}
+	return sections
+}
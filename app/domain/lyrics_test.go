@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// Повторяющийся блок без меток должен стать припевом, \r\n не должен ломать разбиение
+func TestParseLyricsUnlabeled(t *testing.T) {
+	text := "Ooh baby, don't you know I suffer?\r\nOoh baby, can you hear me moan?\r\n\r\n" +
+		"Oh, I thought I was a fool for no one\r\nOh baby, I'm a fool for you\r\n\r\n\r\n" +
+		"Ooh baby, don't you know I suffer?\r\nOoh baby, can you hear me moan?  \r\n\r\n" +
+		"You set my soul alight\r\n"
+	sections := ParseLyrics(text)
+	require.Len(t, sections, 4)
+	require.Equal(t, Section{Type: SectionChorus, Index: 1, Text: "Ooh baby, don't you know I suffer?\nOoh baby, can you hear me moan?"}, sections[0])
+	require.Equal(t, Section{Type: SectionVerse, Index: 1, Text: "Oh, I thought I was a fool for no one\nOh baby, I'm a fool for you"}, sections[1])
+	require.Equal(t, SectionChorus, sections[2].Type)
+	require.Equal(t, 1, sections[2].Index)
+	require.True(t, sections[2].Repeat)
+	require.Equal(t, Section{Type: SectionVerse, Index: 2, Text: "You set my soul alight"}, sections[3])
+}
+
+func TestParseLyricsLabels(t *testing.T) {
+	text := `[Intro]
+Ooh
+
+[Verse 1]
+Paranoia is in bloom
+[Chorus: Matt Bellamy]
+They will not force us
+They will stop degrading us
+
+Verse 2:
+Another promise, another seed
+[Pre-Chorus]
+Interchanging mind control
+[Chorus]
+
+(Припев)
+Они не заставят нас`
+	sections := ParseLyrics(text)
+	types := make([]SectionType, len(sections))
+	for i, s := range sections {
+		types[i] = s.Type
+	}
+	require.Equal(t, []SectionType{SectionIntro, SectionVerse, SectionChorus, SectionVerse, SectionPreChorus, SectionChorus, SectionChorus}, types)
+	require.Equal(t, "Verse 2", sections[3].Label)
+	require.Equal(t, 2, sections[3].Index)
+	require.Equal(t, "Chorus: Matt Bellamy", sections[2].Label)
+
+	// [Chorus] без текста повторяет предыдущий припев
+	require.True(t, sections[5].Repeat)
+	require.Equal(t, sections[2].Text, sections[5].Text)
+	require.Equal(t, 1, sections[5].Index)
+	require.Equal(t, 2, sections[6].Index)
+}
+
+func TestParseLyricsEmpty(t *testing.T) {
+	require.Empty(t, ParseLyrics(""))
+	require.Empty(t, ParseLyrics("\r\n\r\n"))
+}
@@ -8,6 +8,10 @@ import (
 )
 
 var ErrCantReplaceWithEmptyRows = errors.New("Can't replace any felds with no info")
+var ErrSongNotFound = errors.New("song not found")
+var ErrVersionMismatch = errors.New("song version mismatch")
+var ErrSongConflict = errors.New("song with the same name already exists in the group")
+var ErrSongExists = errors.New("song already exists")
 
 type GroupName string
 type SongName string
@@ -15,11 +19,19 @@ type Link string
 type CustomDate time.Time
 
 type Song struct {
+	ID          int64      `json:"-"` // стабильный ключ песни, не меняется при переименовании
 	GroupName   GroupName  `json:"group"`
 	SongName    SongName   `json:"song"`
 	ReleaseDate CustomDate `json:"release_date,omitempty"`
 	Text        string     `json:"text,omitempty"`
 	Link        Link       `json:"link,omitempty"`
+	LRC         string     `json:"lrc,omitempty"`         // синхронизированный текст в формате LRC
+	Album       string     `json:"album,omitempty"`       // при добавлении песня попадает в конец этого альбома группы
+	Tags        []Tag      `json:"tags,omitempty"`        // теги песни вместе с тегами её группы, меняются через /song/tags
+	PlayCount   int64      `json:"play_count,omitempty"`  // сколько раз песню слушали, см. POST /song/play
+	LastPlayed  *time.Time `json:"last_played,omitempty"` // когда слушали в последний раз
+	Sections    []Section  `json:"-"`                     // Text разобранный на части, см. ParseLyrics
+	Version     int        `json:"-"`                     // версия строки, отдаётся клиенту через ETag
 }
 
 // Структура реализующая фильтры
@@ -29,17 +41,58 @@ type SongFilter struct {
 	ReleaseDate CustomDate `db:"release_date" json:"release_date,omitempty"`
 	Text        string     `db:"text" json:"text,omitempty"`
 	Link        Link       `db:"link" json:"link,omitempty"`
+	Album       string     `json:"album,omitempty"`        // название альбома группы
+	Tags        []Tag      `json:"tags,omitempty"`         // песня должна иметь все эти теги (свои или группы)
+	ExcludeTags []Tag      `json:"exclude_tags,omitempty"` // песня не должна иметь ни одного из этих тегов
+	Sort        []SortKey  `json:"-"`                      // порядок выдачи, без сортировки порядок не определён
 	Limit       int        `json:"limit,omitempty"`
 	Offset      int        `json:"offset,omitempty"`
 }
 
 func (s *Song) Validate() error {
-	if s.GroupName == "" {
+	// Название из одних пробелов даёт пустой ключ, по нему песню потом не найти
+	if NormalizeKey(string(s.GroupName)) == "" {
 		return errors.New("group_name is required")
 	}
-	if s.SongName == "" {
+	if NormalizeKey(string(s.SongName)) == "" {
 		return errors.New("song_name is required")
 	}
+	if s.LRC != "" {
+		lrc, err := ParseLRC(s.LRC)
+		if err != nil {
+			return err
+		}
+		if s.Text == "" { //обычный текст выводим из LRC, если его не передали
+			s.Text = lrc.PlainText()
+		}
+	}
+	return nil
+}
+
+// SongMove запрос на переименование песни и/или перенос её в другую группу
+type SongMove struct {
+	GroupName    GroupName `json:"group"`
+	SongName     SongName  `json:"song"`
+	NewGroupName GroupName `json:"new_group,omitempty"` // пусто - группа не меняется
+	NewSongName  SongName  `json:"new_song,omitempty"`  // пусто - название не меняется
+}
+
+func (m *SongMove) Validate() error {
+	if m.GroupName == "" {
+		return errors.New("group_name is required")
+	}
+	if m.SongName == "" {
+		return errors.New("song_name is required")
+	}
+	if m.NewGroupName == "" {
+		m.NewGroupName = m.GroupName
+	}
+	if m.NewSongName == "" {
+		m.NewSongName = m.SongName
+	}
+	if m.NewGroupName == m.GroupName && m.NewSongName == m.SongName {
+		return errors.New("new_group or new_song must differ from current")
+	}
 	return nil
 }
 
@@ -55,6 +108,10 @@ func ParseCustomDate(dateStr string) (CustomDate, error) {
 // Процесс маршализации и демаршализации json для даты
 const customDateFormat = "02.01.2006"
 
+func (cd CustomDate) IsZero() bool {
+	return time.Time(cd).IsZero()
+}
+
 func (cd CustomDate) MarshalJSON() ([]byte, error) {
 	t := time.Time(cd)
 	return []byte(fmt.Sprintf("\"%s\"", t.Format(customDateFormat))), nil
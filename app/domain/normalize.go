@@ -0,0 +1,14 @@
+package domain
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+)
+
+// NormalizeKey приводит название группы или песни к каноничному ключу: NFKC, case folding,
+// обрезка пробелов по краям и схлопывание пробелов внутри. "Muse" и " MUSE " дают один и тот же ключ
+func NormalizeKey(name string) string {
+	key := cases.Fold().String(norm.NFKC.String(name)) //Caser хранит состояние, один на все горутины делить нельзя
+	return strings.Join(strings.Fields(key), " ")
+}
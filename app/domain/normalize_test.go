@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	cases := map[string]string{
+		"Muse":                      "muse",
+		" MUSE ":                    "muse",
+		"Supermassive  Black\tHole": "supermassive black hole",
+		"supermassive black hole":   "supermassive black hole",
+		"Ｍｕｓｅ":                      "muse", // полноширинные символы
+		"Straße":                    "strasse",
+		"Front to Back (Remix)":     "front to back (remix)",
+	}
+	for name, key := range cases {
+		require.Equal(t, key, NormalizeKey(name), name)
+	}
+}
+
+func TestSongValidateBlankNames(t *testing.T) {
+	// Пробелы не делают название непустым: ключ у такой песни был бы пустым
+	for _, song := range []Song{
+		{GroupName: "   ", SongName: "Uprising"},
+		{GroupName: "Muse", SongName: "\t 　"},
+	} {
+		require.Error(t, song.Validate(), song)
+	}
+	song := Song{GroupName: " Muse ", SongName: "Uprising"}
+	require.NoError(t, song.Validate())
+}
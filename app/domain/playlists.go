@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrPlaylistNotFound = errors.New("playlist not found")
+var ErrPlaylistItemNotFound = errors.New("playlist item not found")
+
+const maxPlaylistNameLength = 255
+
+// Playlist пользовательский плейлист. Песни в нём ссылаются на стабильный id песни,
+// поэтому переживают переименование песни и группы
+type Playlist struct {
+	ID          int64          `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Songs       int            `json:"songs"`           // сколько песен в плейлисте
+	Items       []PlaylistItem `json:"items,omitempty"` // по порядку
+	Version     int            `json:"-"`
+}
+
+// PlaylistItem песня в плейлисте. Одна песня может быть в плейлисте несколько раз, запись различается по id
+type PlaylistItem struct {
+	ID        int64     `json:"id"`
+	GroupName GroupName `json:"group"`
+	SongName  SongName  `json:"song"`
+}
+
+// PlaylistAdd песня, которую нужно добавить в плейлист. Index - куда вставить (с 0), по умолчанию в конец
+type PlaylistAdd struct {
+	GroupName GroupName `json:"group"`
+	SongName  SongName  `json:"song"`
+	Index     *int      `json:"index,omitempty"`
+}
+
+// PlaylistMove новое место записи в плейлисте, с 0. Index больше длины плейлиста переносит запись в конец
+type PlaylistMove struct {
+	Index int `json:"index"`
+}
+
+// Validate проверяет плейлист для создания
+func (p *Playlist) Validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(p.Name) > maxPlaylistNameLength {
+		return errors.New("name is too long")
+	}
+	return nil
+}
+
+// ValidatePatch проверяет изменение плейлиста: меняются только непустые name и description
+func (p *Playlist) ValidatePatch() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" && p.Description == "" {
+		return ErrCantReplaceWithEmptyRows
+	}
+	if len(p.Name) > maxPlaylistNameLength {
+		return errors.New("name is too long")
+	}
+	return nil
+}
+
+func (a *PlaylistAdd) Validate() error {
+	if a.GroupName == "" {
+		return errors.New("group_name is required")
+	}
+	if a.SongName == "" {
+		return errors.New("song_name is required")
+	}
+	if a.Index != nil && *a.Index < 0 {
+		return errors.New("index must not be negative")
+	}
+	return nil
+}
+
+func (m *PlaylistMove) Validate() error {
+	if m.Index < 0 {
+		return errors.New("index must not be negative")
+	}
+	return nil
+}
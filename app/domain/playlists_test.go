@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPlaylistValidate(t *testing.T) {
+	playlist := Playlist{Name: "  Road trip "}
+	require.NoError(t, playlist.Validate())
+	require.Equal(t, "Road trip", playlist.Name)
+
+	require.Error(t, (&Playlist{Name: "   "}).Validate())
+	require.ErrorIs(t, (&Playlist{}).ValidatePatch(), ErrCantReplaceWithEmptyRows)
+	require.NoError(t, (&Playlist{Description: "songs for the car"}).ValidatePatch())
+
+	index := -1
+	require.Error(t, (&PlaylistAdd{GroupName: "Muse", SongName: "Starlight", Index: &index}).Validate())
+	require.Error(t, (&PlaylistMove{Index: -1}).Validate())
+}
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrFavoriteNotFound = errors.New("song is not in favorites")
+var ErrPlayQueueFull = errors.New("play queue is full")
+
+const maxClientLength = 64
+
+// Play одно прослушивание песни
+type Play struct {
+	UserID    int64     `json:"-"` // 0 - прослушивание без пользователя, когда аутентификация выключена
+	SongID    int64     `json:"-"`
+	GroupName GroupName `json:"group"`
+	SongName  SongName  `json:"song"`
+	Client    string    `json:"client,omitempty"`
+	PlayedAt  time.Time `json:"played_at"`
+}
+
+// PlayRequest событие прослушивания от клиента
+type PlayRequest struct {
+	GroupName GroupName `json:"group"`
+	SongName  SongName  `json:"song"`
+	Client    string    `json:"client,omitempty"` // название приложения, если пустое - берётся User-Agent
+}
+
+func (p *PlayRequest) Validate() error {
+	if p.GroupName == "" {
+		return errors.New("group_name is required")
+	}
+	if p.SongName == "" {
+		return errors.New("song_name is required")
+	}
+	p.Client = strings.TrimSpace(p.Client)
+	if utf8.RuneCountInString(p.Client) > maxClientLength {
+		p.Client = string([]rune(p.Client)[:maxClientLength])
+	}
+	return nil
+}
+
+// PlayStats сколько раз песню слушали и когда в последний раз
+type PlayStats struct {
+	PlayCount  int64
+	LastPlayed *time.Time
+}
+
+// Favorite песня в избранном пользователя
+type Favorite struct {
+	GroupName GroupName `json:"group"`
+	SongName  SongName  `json:"song"`
+	AddedAt   time.Time `json:"added_at"`
+}
+
+// FavoriteRequest песня, которую добавляют в избранное или убирают из него
+type FavoriteRequest struct {
+	GroupName GroupName `json:"group"`
+	SongName  SongName  `json:"song"`
+}
+
+func (f *FavoriteRequest) Validate() error {
+	if f.GroupName == "" {
+		return errors.New("group_name is required")
+	}
+	if f.SongName == "" {
+		return errors.New("song_name is required")
+	}
+	return nil
+}
+
+// Ключи сортировки библиотеки
+const (
+	SortGroup       = "group"
+	SortSong        = "song"
+	SortReleaseDate = "release_date"
+	SortPlayCount   = "play_count"
+	SortLastPlayed  = "last_played"
+)
+
+var sortKeys = []string{SortGroup, SortSong, SortReleaseDate, SortPlayCount, SortLastPlayed}
+
+// SortKey ключ сортировки библиотеки
+type SortKey struct {
+	Key  string
+	Desc bool
+}
+
+// ParseSort разбирает сортировку вида -play_count,group: ключи через запятую, минус - по убыванию
+func ParseSort(s string) ([]SortKey, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var keys []SortKey
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		key := SortKey{Key: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		known := false
+		for _, k := range sortKeys {
+			known = known || k == key.Key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown sort key %q, expected one of %s", part, strings.Join(sortKeys, ", "))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
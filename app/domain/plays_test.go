@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	keys, err := ParseSort("-play_count, group")
+	require.NoError(t, err)
+	require.Equal(t, []SortKey{{Key: SortPlayCount, Desc: true}, {Key: SortGroup}}, keys)
+
+	keys, err = ParseSort("")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	_, err = ParseSort("-id")
+	require.Error(t, err)
+	_, err = ParseSort("group,")
+	require.Error(t, err)
+}
+
+func TestPlayRequestValidate(t *testing.T) {
+	req := PlayRequest{GroupName: "Muse", SongName: "Uprising", Client: " " + strings.Repeat("я", 100)}
+	require.NoError(t, req.Validate())
+	require.Equal(t, maxClientLength, len([]rune(req.Client)))
+
+	require.Error(t, (&PlayRequest{GroupName: "Muse"}).Validate())
+}
@@ -0,0 +1,111 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrGroupExists = errors.New("group profile already exists")
+var ErrGroupNotEmpty = errors.New("group still has songs")
+
+// GroupProfile карточка группы для страницы исполнителя
+type GroupProfile struct {
+	Name        GroupName `json:"name"`
+	Country     string    `json:"country,omitempty"`
+	FormedYear  int       `json:"formed_year,omitempty"`
+	Genres      []string  `json:"genres,omitempty"`
+	Members     []string  `json:"members,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Version     int       `json:"-"`
+}
+
+// GroupStats сводка по песням и альбомам группы
+type GroupStats struct {
+	Songs            int `json:"songs"`
+	Albums           int `json:"albums"`
+	FirstReleaseYear int `json:"first_release_year,omitempty"`
+	LastReleaseYear  int `json:"last_release_year,omitempty"`
+}
+
+// Group группа вместе с карточкой и сводкой. Группа может быть только в песнях, без карточки, и наоборот
+type Group struct {
+	GroupProfile
+	GroupStats
+	Tags []Tag `json:"tags,omitempty"` // теги группы, действуют на все её песни
+}
+
+// GroupFilter поиск и пагинация списка групп
+type GroupFilter struct {
+	Query  string // часть названия без учёта регистра
+	Limit  int
+	Offset int
+}
+
+// Что делать с песнями при удалении группы
+type GroupDeleteMode string
+
+const (
+	DeleteRefuse  GroupDeleteMode = "refuse"  // не удалять группу, если у неё есть песни
+	DeleteCascade GroupDeleteMode = "cascade" // удалить группу вместе с песнями и альбомами
+)
+
+func (m GroupDeleteMode) Validate() error {
+	switch m {
+	case DeleteRefuse, DeleteCascade:
+		return nil
+	}
+	return fmt.Errorf("unknown delete mode %q, expected refuse or cascade", m)
+}
+
+// Validate проверяет карточку для создания
+func (p *GroupProfile) Validate() error {
+	if strings.TrimSpace(string(p.Name)) == "" {
+		return errors.New("name is required")
+	}
+	return p.validateFields()
+}
+
+// ValidatePatch проверяет изменение карточки: пустые поля не меняются, пустой массив genres или members очищает его
+func (p *GroupProfile) ValidatePatch() error {
+	if p.Name != "" {
+		return errors.New("name can't be changed here, use /renamegroup")
+	}
+	if p.Country == "" && p.FormedYear == 0 && p.Genres == nil && p.Members == nil && p.Description == "" {
+		return ErrCantReplaceWithEmptyRows
+	}
+	return p.validateFields()
+}
+
+func (p *GroupProfile) validateFields() error {
+	if p.FormedYear != 0 && (p.FormedYear < 1000 || p.FormedYear > time.Now().Year()) {
+		return fmt.Errorf("formed_year %d is out of range", p.FormedYear)
+	}
+	p.Country = strings.TrimSpace(p.Country)
+	p.Genres = uniqueNames(p.Genres)
+	p.Members = uniqueNames(p.Members)
+	return nil
+}
+
+// uniqueNames убирает пустые значения и повторы (без учёта регистра), сохраняя порядок. nil остаётся nil
+func uniqueNames(names []string) []string {
+	if names == nil {
+		return nil
+	}
+	result := make([]string, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := NormalizeKey(name)
+		if key == "" {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		result = append(result, name)
+	}
+	return result
+}
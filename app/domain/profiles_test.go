@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGroupProfileValidate(t *testing.T) {
+	profile := GroupProfile{Name: "Muse", FormedYear: 1994, Genres: []string{"Alternative rock", " alternative ROCK ", "", "Art rock"}}
+	require.NoError(t, profile.Validate())
+	require.Equal(t, []string{"Alternative rock", "Art rock"}, profile.Genres)
+	require.Nil(t, profile.Members)
+
+	require.Error(t, (&GroupProfile{}).Validate())
+	require.Error(t, (&GroupProfile{Name: "Muse", FormedYear: 3000}).Validate())
+
+	require.ErrorIs(t, (&GroupProfile{}).ValidatePatch(), ErrCantReplaceWithEmptyRows)
+	require.Error(t, (&GroupProfile{Name: "Muse UK"}).ValidatePatch())
+	require.NoError(t, (&GroupProfile{Members: []string{}}).ValidatePatch()) //пустой массив очищает состав
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+var ErrForbidden = errors.New("forbidden")
+
+// Role роль пользователя. Роли вложены: editor может всё, что listener, admin - всё, что editor
+type Role string
+
+const (
+	RoleListener Role = "listener" // чтение библиотеки
+	RoleEditor   Role = "editor"   // добавление и изменение песен, альбомов, групп, тегов и плейлистов
+	RoleAdmin    Role = "admin"    // удаление, переименование групп, импорт, управление пользователями и журнал аудита
+)
+
+// Permission право, которое требует маршрут
+type Permission string
+
+const (
+	PermRead  Permission = "library:read"
+	PermEdit  Permission = "library:edit"
+	PermAdmin Permission = "library:admin"
+	PermUsers Permission = "users:manage"
+	PermAudit Permission = "audit:read"
+	PermHooks Permission = "webhooks:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleListener: {PermRead},
+	RoleEditor:   {PermRead, PermEdit, PermHooks},
+	RoleAdmin:    {PermRead, PermEdit, PermAdmin, PermUsers, PermAudit, PermHooks},
+}
+
+// Roles все роли от младшей к старшей
+var Roles = []Role{RoleListener, RoleEditor, RoleAdmin}
+
+// ParseRole проверяет название роли
+func ParseRole(s string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := rolePermissions[role]; !ok {
+		return "", fmt.Errorf("%w %q, expected one of listener, editor, admin", ErrInvalidRole, s)
+	}
+	return role, nil
+}
+
+// ParseRoles разбирает список ролей, убирая повторы
+func ParseRoles(values []string) ([]Role, error) {
+	roles := make([]Role, 0, len(values))
+	seen := make(map[Role]bool, len(values))
+	for _, value := range values {
+		role, err := ParseRole(value)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// Can есть ли у роли право perm
+func (r Role) Can(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed есть ли право perm хотя бы у одной из ролей
+func Allowed(roles []Role, perm Permission) bool {
+	for _, role := range roles {
+		if role.Can(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// RolesRequest полный новый набор ролей пользователя
+type RolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// UserRequest новый пользователь с ролями, по умолчанию listener
+type UserRequest struct {
+	Credentials
+	Roles []string `json:"roles"`
+}
+
+// UserPatch изменение учётной записи, nil - поле не меняется
+type UserPatch struct {
+	Disabled *bool `json:"disabled"`
+}
@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRoles(t *testing.T) {
+	roles, err := ParseRoles([]string{"Editor", " listener", "editor"})
+	require.NoError(t, err)
+	require.Equal(t, []Role{RoleEditor, RoleListener}, roles)
+	require.True(t, Allowed(roles, PermEdit))
+	require.False(t, Allowed(roles, PermAdmin))
+	require.True(t, RoleAdmin.Can(PermUsers))
+	require.True(t, RoleAdmin.Can(PermAudit))
+	require.False(t, RoleEditor.Can(PermAudit))
+	require.True(t, RoleEditor.Can(PermHooks))
+	require.False(t, RoleListener.Can(PermHooks))
+	require.False(t, Allowed(nil, PermRead))
+
+	_, err = ParseRoles([]string{"root"})
+	require.ErrorIs(t, err, ErrInvalidRole)
+}
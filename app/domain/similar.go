@@ -0,0 +1,13 @@
+package domain
+
+import "errors"
+
+var ErrSimilarNotReady = errors.New("similarity index is not built yet")
+
+// SimilarSong похожая песня и почему она похожа: lyrics, tags, group, era
+type SimilarSong struct {
+	GroupName GroupName `json:"group"`
+	SongName  SongName  `json:"song"`
+	Score     float64   `json:"score"`
+	Reasons   []string  `json:"reasons"`
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidTag = errors.New("invalid tag")
+
+const maxTagLength = 64
+
+// Tag тег вида "пространство:значение", например genre:rock или mood:chill. Хранится в нормализованном виде
+type Tag string
+
+// TagCount сколько песен из выборки помечено тегом
+type TagCount struct {
+	Tag   Tag `json:"tag"`
+	Count int `json:"count"`
+}
+
+// ParseTag проверяет и нормализует тег: регистр и лишние пробелы не важны, пространство имён обязательно
+// и состоит из латиницы, цифр, '-' и '_'. Запятая в теге запрещена, ею разделяются теги в фильтрах
+func ParseTag(raw string) (Tag, error) {
+	namespace, value, ok := strings.Cut(NormalizeKey(raw), ":")
+	namespace, value = strings.TrimSpace(namespace), strings.TrimSpace(value)
+	if !ok || namespace == "" || value == "" {
+		return "", fmt.Errorf("%w %q: expected namespace:value, e.g. genre:rock", ErrInvalidTag, raw)
+	}
+	for _, r := range namespace {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", fmt.Errorf("%w %q: namespace may contain only a-z, 0-9, '-' and '_'", ErrInvalidTag, raw)
+		}
+	}
+	if strings.Contains(value, ",") {
+		return "", fmt.Errorf("%w %q: comma is not allowed", ErrInvalidTag, raw)
+	}
+	tag := Tag(namespace + ":" + value)
+	if len(tag) > maxTagLength {
+		return "", fmt.Errorf("%w %q: longer than %d bytes", ErrInvalidTag, raw, maxTagLength)
+	}
+	return tag, nil
+}
+
+// ParseTags разбирает список тегов, убирая повторы
+func ParseTags(raw []string) ([]Tag, error) {
+	tags := make([]Tag, 0, len(raw))
+	seen := make(map[Tag]struct{}, len(raw))
+	for _, r := range raw {
+		tag, err := ParseTag(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// SplitTags разбирает теги, перечисленные через запятую, как они приходят в фильтрах. Пустая строка - нет тегов
+func SplitTags(raw string) ([]Tag, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	return ParseTags(strings.Split(raw, ","))
+}
+
+func (t Tag) Namespace() string {
+	namespace, _, _ := strings.Cut(string(t), ":")
+	return namespace
+}
+
+func (t Tag) Value() string {
+	_, value, _ := strings.Cut(string(t), ":")
+	return value
+}
+
+// TagsRequest теги, которые нужно добавить или снять
+type TagsRequest struct {
+	GroupName GroupName `json:"group,omitempty"` // для тегов песни
+	SongName  SongName  `json:"song,omitempty"`  // для тегов песни
+	Tags      []string  `json:"tags"`
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	tag, err := ParseTag("  Genre: Post  Rock ")
+	require.NoError(t, err)
+	require.Equal(t, Tag("genre:post rock"), tag)
+	require.Equal(t, "genre", tag.Namespace())
+	require.Equal(t, "post rock", tag.Value())
+
+	for _, broken := range []string{"rock", ":rock", "genre:", "жанр:рок", "genre:rock,pop"} {
+		_, err = ParseTag(broken)
+		require.ErrorIs(t, err, ErrInvalidTag, broken)
+	}
+	_, err = ParseTag("mood:рок") //значение может быть на любом языке
+	require.NoError(t, err)
+
+	tags, err := SplitTags("genre:rock, mood:chill,GENRE:Rock")
+	require.NoError(t, err)
+	require.Equal(t, []Tag{"genre:rock", "mood:chill"}, tags)
+	tags, err = SplitTags(" ")
+	require.NoError(t, err)
+	require.Nil(t, tags)
+}
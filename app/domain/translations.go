@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/text/language"
+)
+
+var ErrTranslationNotFound = errors.New("translation not found")
+var ErrInvalidLanguage = errors.New("invalid language tag")
+
+// Lyrics текст песни на одном языке
+type Lyrics struct {
+	Lang     string    `json:"lang"`     // BCP-47 тег, например en или pt-BR. und - язык оригинала неизвестен
+	Original bool      `json:"original"` // текст на языке оригинала
+	Text     string    `json:"text"`
+	Sections []Section `json:"-"`
+}
+
+// SongTranslation запрос на добавление или замену текста песни на одном языке
+type SongTranslation struct {
+	GroupName GroupName `json:"group"`
+	SongName  SongName  `json:"song"`
+	Lang      string    `json:"lang"`
+	Text      string    `json:"text"`
+	Original  bool      `json:"original,omitempty"` // это язык оригинала, текст песни тоже будет заменён
+}
+
+func (t *SongTranslation) Validate() error {
+	if t.GroupName == "" {
+		return errors.New("group_name is required")
+	}
+	if t.SongName == "" {
+		return errors.New("song_name is required")
+	}
+	if t.Text == "" {
+		return errors.New("text is required")
+	}
+	lang, err := CanonicalLang(t.Lang)
+	if err != nil {
+		return err
+	}
+	t.Lang = lang
+	return nil
+}
+
+// CanonicalLang проверяет BCP-47 тег и приводит его к каноничному виду: "EN-us" -> "en-US"
+func CanonicalLang(lang string) (string, error) {
+	tag, err := language.Parse(lang)
+	if err != nil || tag == language.Und {
+		return "", fmt.Errorf("%w: %q", ErrInvalidLanguage, lang)
+	}
+	return tag.String(), nil
+}
+
+// NegotiateLyrics выбирает текст по предпочтениям клиента в формате Accept-Language ("de-CH, en;q=0.8").
+// Первым в available должен идти оригинал: он возвращается, если предпочтения пустые, битые или ни один язык не подошёл
+func NegotiateLyrics(available []Lyrics, preferences string) Lyrics {
+	if len(available) == 0 {
+		return Lyrics{}
+	}
+	if preferences == "" || len(available) == 1 {
+		return available[0]
+	}
+	wanted, _, err := language.ParseAcceptLanguage(preferences)
+	if err != nil || len(wanted) == 0 {
+		return available[0]
+	}
+	supported := make([]language.Tag, len(available))
+	for i, lyrics := range available {
+		supported[i] = language.Make(lyrics.Lang)
+	}
+	_, index, confidence := language.NewMatcher(supported).Match(wanted...)
+	if confidence == language.No {
+		return available[0]
+	}
+	return available[index]
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNegotiateLyrics(t *testing.T) {
+	available := []Lyrics{
+		{Lang: "ru", Original: true, Text: "Группа крови на рукаве"},
+		{Lang: "en", Text: "Blood type on my sleeve"},
+		{Lang: "pt-BR", Text: "Tipo sanguíneo na manga"},
+	}
+	for preferences, want := range map[string]string{
+		"":                     "ru",
+		"en":                   "en",
+		"de-CH, en;q=0.8":      "en",
+		"pt":                   "pt-BR",
+		"en-GB":                "en",
+		"fr":                   "ru", //такого перевода нет - оригинал
+		"ru;q=0.5, en;q=0.9":   "en",
+		"not a language;;q=x,": "ru",
+	} {
+		require.Equal(t, want, NegotiateLyrics(available, preferences).Lang, preferences)
+	}
+	require.Equal(t, Lyrics{}, NegotiateLyrics(nil, "en"))
+}
+
+func TestSongTranslationValidate(t *testing.T) {
+	tr := SongTranslation{GroupName: "Кино", SongName: "Группа крови", Lang: "EN-us", Text: "Blood type"}
+	require.NoError(t, tr.Validate())
+	require.Equal(t, "en-US", tr.Lang)
+
+	tr.Lang = "english please"
+	require.ErrorIs(t, tr.Validate(), ErrInvalidLanguage)
+	tr.Lang = "und"
+	require.ErrorIs(t, tr.Validate(), ErrInvalidLanguage)
+}
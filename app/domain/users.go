@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+var ErrUserExists = errors.New("user already exists")
+var ErrInvalidCredentials = errors.New("invalid username or password")
+var ErrInvalidToken = errors.New("invalid or expired token")
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+const minPasswordLength = 8
+
+// User учётная запись. Пароль хранится только в виде хэша и наружу не отдаётся
+type User struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	Disabled  bool      `json:"disabled,omitempty"`
+	Roles     []Role    `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Способы, которыми клиент подтвердил, кто он
+const (
+	AuthJWT    = "jwt"
+	AuthAPIKey = "api_key"
+)
+
+// Principal тот, от чьего имени выполняется запрос: пользователь по JWT или сервисный клиент по API-ключу пользователя
+type Principal struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Method   string `json:"method"`               // jwt или api_key
+	APIKeyID int64  `json:"api_key_id,omitempty"` // если запрос пришёл с API-ключом
+	Roles    []Role `json:"roles"`                // роли из бд на момент запроса
+}
+
+// Credentials логин и пароль
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Validate проверяет логин и пароль для создания пользователя. Логин хранится в нижнем регистре
+func (c *Credentials) Validate() error {
+	c.Username = strings.ToLower(strings.TrimSpace(c.Username))
+	if c.Username == "" {
+		return errors.New("username is required")
+	}
+	if strings.ContainsAny(c.Username, " \t\n:") {
+		return errors.New("username must not contain spaces or ':'")
+	}
+	if utf8.RuneCountInString(c.Password) < minPasswordLength {
+		return errors.New("password must be at least 8 characters long")
+	}
+	if len(c.Password) > 72 { //bcrypt учитывает только первые 72 байта
+		return errors.New("password must be at most 72 bytes long")
+	}
+	return nil
+}
+
+// TokenPair ответ на вход и обновление токенов
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // через сколько секунд истечёт access_token
+	RefreshToken string `json:"refresh_token"`
+}
+
+// APIKey долгоживущий ключ сервисного клиента. Сам ключ показывается один раз при создании, хранится только хэш
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`        // начало ключа, чтобы его можно было узнать в списке
+	Key        string     `json:"key,omitempty"` // только в ответе на создание
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// APIKeyRequest запрос на создание API-ключа. ExpiresIn в днях, 0 - бессрочный
+type APIKeyRequest struct {
+	Name      string `json:"name"`
+	ExpiresIn int    `json:"expires_in_days,omitempty"`
+}
+
+func (r *APIKeyRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.ExpiresIn < 0 {
+		return errors.New("expires_in_days must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCredentialsValidate(t *testing.T) {
+	creds := Credentials{Username: " Admin ", Password: "correct horse"}
+	require.NoError(t, creds.Validate())
+	require.Equal(t, "admin", creds.Username)
+
+	for name, broken := range map[string]Credentials{
+		"no username":    {Password: "correct horse"},
+		"space in login": {Username: "john doe", Password: "correct horse"},
+		"short password": {Username: "admin", Password: "1234567"},
+	} {
+		require.Error(t, broken.Validate(), name)
+	}
+}
@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+var ErrPrivateWebhookTarget = errors.New("webhook url must point to a public address")
+
+// sharedAddressSpace 100.64.0.0/10, адреса провайдеров и облаков, в том числе их сервисы метаданных
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicAddr можно ли отправлять вебхуки на адрес addr. Loopback, частные, link-local, multicast и нулевые адреса
+// закрыты: иначе подписка позволит заставить сервис ходить во внутреннюю сеть
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() && !addr.IsInterfaceLocalMulticast() && !addr.IsMulticast() &&
+		!addr.IsUnspecified() && !sharedAddressSpace.Contains(addr) && !(addr.Is4() && addr.As4()[0] == 0)
+}
+
+const minWebhookSecretLength = 16
+
+// Состояния доставки вебхука
+const (
+	DeliveryPending   = "pending"   // ждёт отправки или повтора
+	DeliveryDelivered = "delivered" // получатель ответил 2xx
+	DeliveryFailed    = "failed"    // попытки кончились или подписка отключена
+)
+
+// WebhookSubscription подписка на события об изменениях библиотеки. Каждая доставка подписывается HMAC-SHA256 её секретом
+type WebhookSubscription struct {
+	ID             int64         `json:"id"`
+	URL            string        `json:"url"`
+	EventTypes     []AuditAction `json:"event_types"`      // пусто - все события
+	Groups         []GroupName   `json:"groups"`           // пусто - события всех групп
+	Secret         string        `json:"secret,omitempty"` // отдаётся только при создании и смене секрета
+	Enabled        bool          `json:"enabled"`          // подписка отключается сама после disable_after неудачных попыток подряд
+	Failures       int           `json:"failures"`         // неудачных попыток подряд
+	DisabledReason string        `json:"disabled_reason,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// WebhookRequest создание или изменение подписки. При изменении пустые поля не меняются,
+// пустой secret при создании генерируется
+type WebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types,omitempty"`
+	Groups     []string `json:"groups,omitempty"`
+	Secret     string   `json:"secret,omitempty"`
+	Enabled    *bool    `json:"enabled,omitempty"` // true включает отключённую подписку и сбрасывает счётчик ошибок
+}
+
+// Validate проверяет подписку для создания. allowPrivate разрешает адреса во внутренней сети, см. PublicAddr
+func (r *WebhookRequest) Validate(allowPrivate bool) error {
+	if r.URL == "" {
+		return errors.New("url is required")
+	}
+	return r.ValidatePatch(allowPrivate)
+}
+
+// ValidatePatch проверяет непустые поля подписки. Имя хоста здесь не резолвится: адрес, в который оно превратится
+// при отправке, проверяет dispatcher
+func (r *WebhookRequest) ValidatePatch(allowPrivate bool) error {
+	if r.URL != "" {
+		u, err := url.Parse(r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an absolute http or https URL")
+		}
+		if !allowPrivate && !publicHost(u.Hostname()) {
+			return ErrPrivateWebhookTarget
+		}
+	}
+	for _, t := range r.EventTypes {
+		if _, err := ParseEventType(t); err != nil {
+			return err
+		}
+	}
+	for i, group := range r.Groups {
+		r.Groups[i] = strings.TrimSpace(group)
+		if r.Groups[i] == "" {
+			return errors.New("groups must not contain empty names")
+		}
+	}
+	if r.Secret != "" && len(r.Secret) < minWebhookSecretLength {
+		return fmt.Errorf("secret must be at least %d characters", minWebhookSecretLength)
+	}
+	return nil
+}
+
+// publicHost хост url - не localhost и не закрытый IP-адрес
+func publicHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return PublicAddr(addr)
+	}
+	return true
+}
+
+// WebhookDelivery одна доставка события подписке. Повторная доставка вручную создаёт новую запись со ссылкой на исходную
+type WebhookDelivery struct {
+	ID             int64       `json:"id"`
+	SubscriptionID int64       `json:"subscription_id"`
+	EventID        int64       `json:"event_id"`
+	EventType      AuditAction `json:"event_type"`
+	Status         string      `json:"status"` // pending, delivered или failed
+	Attempts       int         `json:"attempts"`
+	ResponseStatus int         `json:"response_status,omitempty"` // код последнего ответа получателя
+	LastError      string      `json:"last_error,omitempty"`
+	RedeliveryOf   *int64      `json:"redelivery_of,omitempty"`
+	NextAttemptAt  *time.Time  `json:"next_attempt_at,omitempty"` // только у ждущих доставок
+	CreatedAt      time.Time   `json:"created_at"`
+	DeliveredAt    *time.Time  `json:"delivered_at,omitempty"`
+}
+
+// PendingDelivery доставка, взятая на отправку, вместе с адресом и секретом подписки
+type PendingDelivery struct {
+	WebhookDelivery
+	URL     string
+	Secret  string
+	Payload []byte // событие в JSON, как его получит подписчик
+}
+
+// DeliveryResult итог одной попытки доставки
+type DeliveryResult struct {
+	ID             int64
+	ResponseStatus int           // 0 - ответа не было
+	Error          string        // пусто - доставлено
+	RetryIn        time.Duration // через сколько повторить, 0 - больше не пытаться
+}
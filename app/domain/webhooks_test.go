@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/netip"
+	"testing"
+)
+
+func TestWebhookRequestValidate(t *testing.T) {
+	req := WebhookRequest{URL: "https://partner.example/hook", EventTypes: []string{"song.update"}, Groups: []string{" Muse "}}
+	require.NoError(t, req.Validate(false))
+	require.Equal(t, []string{"Muse"}, req.Groups)
+
+	require.Error(t, (&WebhookRequest{}).Validate(false))
+	require.NoError(t, (&WebhookRequest{}).ValidatePatch(false))
+	require.Error(t, (&WebhookRequest{URL: "ftp://partner.example"}).Validate(false))
+	require.Error(t, (&WebhookRequest{URL: "/hook"}).Validate(false))
+	require.Error(t, (&WebhookRequest{URL: "http://partner.example", EventTypes: []string{"song.play"}}).Validate(false))
+	require.Error(t, (&WebhookRequest{URL: "http://partner.example", Groups: []string{" "}}).Validate(false))
+	require.Error(t, (&WebhookRequest{URL: "http://partner.example", Secret: "short"}).Validate(false))
+}
+
+func TestWebhookRequestPrivateTargets(t *testing.T) {
+	for _, target := range []string{
+		"http://localhost:8080/hook", "http://api.localhost/hook", "http://127.0.0.1/hook", "http://10.1.2.3/hook",
+		"http://192.168.0.10/hook", "http://169.254.169.254/latest/meta-data", "http://100.100.100.200/hook",
+		"http://0.0.0.0/hook", "http://[::1]/hook", "http://[fd00::1]/hook", "http://[fe80::1]/hook", "http://[::ffff:127.0.0.1]/hook",
+	} {
+		require.ErrorIs(t, (&WebhookRequest{URL: target}).Validate(false), ErrPrivateWebhookTarget, target)
+		require.ErrorIs(t, (&WebhookRequest{URL: target}).ValidatePatch(false), ErrPrivateWebhookTarget, target)
+		require.NoError(t, (&WebhookRequest{URL: target}).Validate(true), target)
+	}
+	require.NoError(t, (&WebhookRequest{URL: "https://93.184.216.34/hook"}).Validate(false))
+	require.True(t, PublicAddr(netip.MustParseAddr("2606:4700::1111")))
+	require.False(t, PublicAddr(netip.MustParseAddr("172.16.5.4")))
+}
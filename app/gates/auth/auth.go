@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix начало всех API-ключей, по нему middleware отличает ключ от JWT в заголовке Authorization
+const APIKeyPrefix = "msl_"
+
+// Store хранилище пользователей, refresh токенов и API-ключей. Токены и ключи передаются только в виде хэшей
+type Store interface {
+	UserCredentials(ctx context.Context, username string) (domain.User, string, error)
+	SaveRefreshToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(ctx context.Context, oldHash string, newHash string, expiresAt time.Time) (domain.User, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+	APIKeyPrincipal(ctx context.Context, keyHash string) (domain.Principal, error)
+	UserRoles(ctx context.Context, userID int64) ([]domain.Role, error)
+}
+
+// Authenticator выдаёт и проверяет токены. Подпись и проверка идут локальным ключом из конфига
+type Authenticator struct {
+	store      Store
+	method     jwt.SigningMethod
+	signKey    interface{}
+	verifyKey  interface{}
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	enabled    bool
+	publicRead bool
+	log        *slog.Logger
+}
+
+// claims содержимое access токена
+type claims struct {
+	Username string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// exampleSigningKey ключ, который раньше лежал в config.yaml. Он публичный, токены с ним подделает кто угодно
+const exampleSigningKey = "local-dev-signing-key-change-me"
+
+// envLocal окружение разработчика, только в нём можно работать без ключа подписи
+const envLocal = "local"
+
+// dummyHash хэш для сравнения, когда пользователя нет: вход для несуществующего логина занимает столько же времени
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("mobileSongLibrary"), bcrypt.DefaultCost)
+
+// New создаёт Authenticator. Ключ подписи задаётся через AUTH_SIGNING_KEY или AUTH_PRIVATE_KEY_FILE, без него
+// сервис с включённой аутентификацией запускается только в окружении local и подписывает токены случайным ключом
+func New(cfg config.Auth, env string, store Store, log *slog.Logger) (*Authenticator, error) {
+	const op = "gates.auth.New"
+
+	a := &Authenticator{
+		store:      store,
+		issuer:     cfg.Issuer,
+		accessTTL:  cfg.AccessTTL,
+		refreshTTL: cfg.RefreshTTL,
+		enabled:    cfg.Enabled,
+		publicRead: cfg.PublicRead,
+		log:        log,
+	}
+	switch {
+	case cfg.PrivateKeyFile != "":
+		pem, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read auth private key")
+		}
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse auth private key, expected Ed25519 PEM")
+		}
+		a.method, a.signKey, a.verifyKey = jwt.SigningMethodEdDSA, key, key.(ed25519.PrivateKey).Public()
+	case cfg.SigningKey == exampleSigningKey:
+		return nil, errors.New("auth.signing_key is the example key from config.yaml, set your own secret in AUTH_SIGNING_KEY")
+	case cfg.SigningKey != "":
+		a.method, a.signKey, a.verifyKey = jwt.SigningMethodHS256, []byte(cfg.SigningKey), []byte(cfg.SigningKey)
+	case cfg.Enabled && env != envLocal:
+		return nil, errors.New("AUTH_SIGNING_KEY or AUTH_PRIVATE_KEY_FILE is required when auth is enabled")
+	default:
+		// ключа нет, вход всё равно работает, но токены не переживут перезапуск
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		a.method, a.signKey, a.verifyKey = jwt.SigningMethodHS256, secret, secret
+		log.Warn(op, "no signing key is configured, using a random key", "")
+	}
+	if a.accessTTL <= 0 || a.refreshTTL <= 0 {
+		return nil, errors.New("auth.access_ttl and auth.refresh_ttl must be positive")
+	}
+	return a, nil
+}
+
+// HashPassword bcrypt хэш пароля для хранения
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// HashToken sha256 refresh токена или API-ключа. В отличие от паролей у них достаточно энтропии, медленный хэш не нужен
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// NewAPIKey создаёт новый API-ключ: сам ключ (показывается клиенту один раз), его начало для списка ключей и хэш для хранения
+func NewAPIKey() (key string, prefix string, hash string, err error) {
+	secret, err := randomToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + secret
+	return key, key[:len(APIKeyPrefix)+6], HashToken(key), nil
+}
+
+// Login проверяет логин и пароль и выдаёт пару токенов
+func (a *Authenticator) Login(ctx context.Context, creds domain.Credentials) (domain.TokenPair, error) {
+	user, hash, err := a.store.UserCredentials(ctx, strings.ToLower(strings.TrimSpace(creds.Username)))
+	if errors.Is(err, domain.ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(creds.Password))
+		return domain.TokenPair{}, domain.ErrInvalidCredentials
+	}
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(creds.Password)) != nil || user.Disabled {
+		return domain.TokenPair{}, domain.ErrInvalidCredentials
+	}
+
+	refresh, err := randomToken()
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	if err = a.store.SaveRefreshToken(ctx, user.ID, HashToken(refresh), time.Now().Add(a.refreshTTL)); err != nil {
+		return domain.TokenPair{}, err
+	}
+	return a.tokenPair(user, refresh)
+}
+
+// Refresh меняет refresh токен на новую пару токенов. Старый refresh токен после этого недействителен
+func (a *Authenticator) Refresh(ctx context.Context, refreshToken string) (domain.TokenPair, error) {
+	if refreshToken == "" {
+		return domain.TokenPair{}, domain.ErrInvalidToken
+	}
+	refresh, err := randomToken()
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	user, err := a.store.RotateRefreshToken(ctx, HashToken(refreshToken), HashToken(refresh), time.Now().Add(a.refreshTTL))
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	return a.tokenPair(user, refresh)
+}
+
+// Logout отзывает refresh токен. Выданные access токены действуют до истечения срока
+func (a *Authenticator) Logout(ctx context.Context, refreshToken string) error {
+	return a.store.RevokeRefreshToken(ctx, HashToken(refreshToken))
+}
+
+func (a *Authenticator) tokenPair(user domain.User, refresh string) (domain.TokenPair, error) {
+	access, err := a.IssueAccessToken(user)
+	if err != nil {
+		return domain.TokenPair{}, err
+	}
+	return domain.TokenPair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(a.accessTTL.Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
+
+// IssueAccessToken подписывает короткоживущий access токен пользователя
+func (a *Authenticator) IssueAccessToken(user domain.User) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(a.method, claims{
+		Username: user.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    a.issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(a.accessTTL)),
+			ID:        id,
+		},
+	})
+	return token.SignedString(a.signKey)
+}
+
+// VerifyAccessToken проверяет подпись, срок и издателя access токена
+func (a *Authenticator) VerifyAccessToken(token string) (domain.Principal, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(*jwt.Token) (interface{}, error) {
+		return a.verifyKey, nil
+	}, jwt.WithValidMethods([]string{a.method.Alg()}), jwt.WithIssuer(a.issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return domain.Principal{}, fmt.Errorf("%w: %s", domain.ErrInvalidToken, err)
+	}
+	userID, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil {
+		return domain.Principal{}, fmt.Errorf("%w: bad subject", domain.ErrInvalidToken)
+	}
+	return domain.Principal{UserID: userID, Username: c.Username, Method: domain.AuthJWT}, nil
+}
+
+// VerifyAPIKey находит пользователя по API-ключу
+func (a *Authenticator) VerifyAPIKey(ctx context.Context, key string) (domain.Principal, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return domain.Principal{}, domain.ErrInvalidToken
+	}
+	return a.store.APIKeyPrincipal(ctx, HashToken(key))
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// memStore хранилище в памяти для тестов
+type memStore struct {
+	hash    string
+	tokens  map[string]bool // хэш refresh токена -> отозван
+	apiKeys map[string]domain.Principal
+	roles   map[int64][]domain.Role
+}
+
+func (m *memStore) UserCredentials(_ context.Context, username string) (domain.User, string, error) {
+	if username != "admin" {
+		return domain.User{}, "", domain.ErrUserNotFound
+	}
+	return domain.User{ID: 1, Username: "admin"}, m.hash, nil
+}
+
+func (m *memStore) SaveRefreshToken(_ context.Context, _ int64, tokenHash string, _ time.Time) error {
+	m.tokens[tokenHash] = false
+	return nil
+}
+
+func (m *memStore) RotateRefreshToken(_ context.Context, oldHash string, newHash string, _ time.Time) (domain.User, error) {
+	revoked, ok := m.tokens[oldHash]
+	if !ok || revoked {
+		return domain.User{}, domain.ErrInvalidToken
+	}
+	m.tokens[oldHash] = true
+	m.tokens[newHash] = false
+	return domain.User{ID: 1, Username: "admin"}, nil
+}
+
+func (m *memStore) RevokeRefreshToken(_ context.Context, tokenHash string) error {
+	m.tokens[tokenHash] = true
+	return nil
+}
+
+func (m *memStore) APIKeyPrincipal(_ context.Context, keyHash string) (domain.Principal, error) {
+	principal, ok := m.apiKeys[keyHash]
+	if !ok {
+		return principal, domain.ErrInvalidToken
+	}
+	return principal, nil
+}
+
+func (m *memStore) UserRoles(_ context.Context, userID int64) ([]domain.Role, error) {
+	return m.roles[userID], nil
+}
+
+func newTestAuth(t *testing.T, cfg config.Auth) (*Authenticator, *memStore) {
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	store := &memStore{hash: hash, tokens: map[string]bool{}, apiKeys: map[string]domain.Principal{}, roles: map[int64][]domain.Role{}}
+	if cfg.AccessTTL == 0 {
+		cfg.AccessTTL = time.Minute
+	}
+	cfg.RefreshTTL = time.Hour
+	cfg.Issuer = "test"
+	a, err := New(cfg, "prod", store, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	require.NoError(t, err)
+	return a, store
+}
+
+func TestLoginRefresh(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAuth(t, config.Auth{Enabled: true, SigningKey: "secret"})
+
+	_, err := a.Login(ctx, domain.Credentials{Username: "admin", Password: "wrong password"})
+	require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+	_, err = a.Login(ctx, domain.Credentials{Username: "nobody", Password: "correct horse"})
+	require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+
+	pair, err := a.Login(ctx, domain.Credentials{Username: " Admin", Password: "correct horse"})
+	require.NoError(t, err)
+	principal, err := a.VerifyAccessToken(pair.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, domain.Principal{UserID: 1, Username: "admin", Method: domain.AuthJWT}, principal)
+
+	// refresh токен одноразовый
+	next, err := a.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	_, err = a.Refresh(ctx, pair.RefreshToken)
+	require.ErrorIs(t, err, domain.ErrInvalidToken)
+	require.NoError(t, a.Logout(ctx, next.RefreshToken))
+	_, err = a.Refresh(ctx, next.RefreshToken)
+	require.ErrorIs(t, err, domain.ErrInvalidToken)
+
+	// токен, подписанный другим ключом, не принимается
+	other, _ := newTestAuth(t, config.Auth{Enabled: true, SigningKey: "another secret"})
+	_, err = other.VerifyAccessToken(pair.AccessToken)
+	require.ErrorIs(t, err, domain.ErrInvalidToken)
+}
+
+func TestAccessTokenExpires(t *testing.T) {
+	a, _ := newTestAuth(t, config.Auth{Enabled: true, SigningKey: "secret"})
+	a.accessTTL = -time.Minute
+	_, err := a.VerifyAccessToken(mustToken(t, a))
+	require.ErrorIs(t, err, domain.ErrInvalidToken)
+}
+
+func mustToken(t *testing.T, a *Authenticator) string {
+	token, err := a.IssueAccessToken(domain.User{ID: 1, Username: "admin"})
+	require.NoError(t, err)
+	return token
+}
+
+func TestMiddleware(t *testing.T) {
+	a, store := newTestAuth(t, config.Auth{Enabled: true, SigningKey: "secret"})
+	key, prefix, hash, err := NewAPIKey()
+	require.NoError(t, err)
+	require.Equal(t, key[:len(prefix)], prefix)
+	store.apiKeys[hash] = domain.Principal{UserID: 2, Username: "importer", Method: domain.AuthAPIKey, APIKeyID: 7}
+
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFrom(r.Context())
+		w.Write([]byte(principal.Username))
+	}))
+	do := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodDelete, "/song").Code)
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/library", "Authorization", "Bearer garbage").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/auth/login").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/swagger/index.html").Code)
+
+	w := do(http.MethodDelete, "/song", "Authorization", "Bearer "+mustToken(t, a))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "admin", w.Body.String())
+	w = do(http.MethodDelete, "/song", "X-API-Key", key)
+	require.Equal(t, "importer", w.Body.String())
+	w = do(http.MethodDelete, "/song", "Authorization", "Bearer "+key)
+	require.Equal(t, "importer", w.Body.String())
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/library", "X-API-Key", "msl_revoked").Code)
+
+	// с public_read читать можно без токена, но не менять
+	a.publicRead = true
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/library").Code)
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodPatch, "/song").Code)
+}
+
+func TestSigningKeyRequired(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	cfg := config.Auth{Enabled: true, AccessTTL: time.Minute, RefreshTTL: time.Hour}
+
+	_, err := New(cfg, "prod", &memStore{}, log)
+	require.Error(t, err)
+	//локально без ключа токены подписываются случайным ключом
+	_, err = New(cfg, "local", &memStore{}, log)
+	require.NoError(t, err)
+
+	cfg.SigningKey = "local-dev-signing-key-change-me"
+	_, err = New(cfg, "prod", &memStore{}, log)
+	require.Error(t, err)
+	_, err = New(cfg, "local", &memStore{}, log)
+	require.Error(t, err)
+}
+
+func TestEdDSAKeyFile(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "auth.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	a, _ := newTestAuth(t, config.Auth{Enabled: true, PrivateKeyFile: path})
+	principal, err := a.VerifyAccessToken(mustToken(t, a))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), principal.UserID)
+
+	// HS256 токен с тем же издателем не подходит ключу EdDSA
+	hs, _ := newTestAuth(t, config.Auth{Enabled: true, SigningKey: "secret"})
+	_, err = a.VerifyAccessToken(mustToken(t, hs))
+	require.ErrorIs(t, err, domain.ErrInvalidToken)
+}
+
+func TestRequire(t *testing.T) {
+	a, store := newTestAuth(t, config.Auth{Enabled: true, SigningKey: "secret"})
+	store.roles[1] = []domain.Role{domain.RoleEditor}
+
+	do := func(perm domain.Permission, method string, principal *domain.Principal) *httptest.ResponseRecorder {
+		handler := a.Require(perm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ := PrincipalFrom(r.Context())
+			w.Write([]byte(principal.Username))
+		}))
+		r := httptest.NewRequest(method, "/song", nil)
+		if principal != nil {
+			r = r.WithContext(WithPrincipal(r.Context(), *principal))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	editor := &domain.Principal{UserID: 1, Username: "admin", Method: domain.AuthJWT}
+
+	require.Equal(t, http.StatusOK, do(domain.PermRead, http.MethodGet, editor).Code)
+	require.Equal(t, http.StatusOK, do(domain.PermEdit, http.MethodPatch, editor).Code)
+	w := do(domain.PermAdmin, http.MethodDelete, editor)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), `"status":403`)
+
+	// роли читаются на каждый запрос, отнятая роль действует сразу
+	store.roles[1] = nil
+	require.Equal(t, http.StatusForbidden, do(domain.PermRead, http.MethodGet, editor).Code)
+
+	// анонимный запрос доходит сюда только при public_read или выключенной аутентификации
+	require.Equal(t, http.StatusUnauthorized, do(domain.PermRead, http.MethodGet, nil).Code)
+	a.publicRead = true
+	require.Equal(t, http.StatusOK, do(domain.PermRead, http.MethodGet, nil).Code)
+	require.Equal(t, http.StatusUnauthorized, do(domain.PermUsers, http.MethodGet, nil).Code)
+	a.enabled = false
+	require.Equal(t, http.StatusOK, do(domain.PermAdmin, http.MethodDelete, nil).Code)
+}
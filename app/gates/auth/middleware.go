@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"mobileSongLibrary/domain"
+	"net/http"
+	"strings"
+)
+
+type principalKey struct{}
+
+// publicPaths пути, доступные без аутентификации
+var publicPaths = []string{"/auth/login", "/auth/refresh", "/auth/logout", "/swagger/"}
+
+var errNoCredentials = errors.New("no credentials")
+
+// WithPrincipal кладёт в контекст того, кто выполняет запрос
+func WithPrincipal(ctx context.Context, principal domain.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom достаёт из контекста того, кто выполняет запрос. false - запрос анонимный
+func PrincipalFrom(ctx context.Context) (domain.Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(domain.Principal)
+	return principal, ok
+}
+
+// Middleware проверяет access токен (Authorization: Bearer <jwt>) или API-ключ (X-API-Key: msl_... или Authorization: Bearer msl_...)
+// и кладёт найденного Principal в контекст запроса. Запрос без учётных данных пропускается только к публичным путям,
+// а если включён public_read - ещё и на чтение. Неверные учётные данные всегда дают 401
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	const op = "gates.auth.Middleware"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.authenticate(r)
+		switch {
+		case err == nil:
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		case errors.Is(err, errNoCredentials) && a.isPublic(r):
+			next.ServeHTTP(w, r)
+		case errors.Is(err, errNoCredentials) || errors.Is(err, domain.ErrInvalidToken):
+			a.log.Debug(op, "unauthorized request to "+r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mobileSongLibrary"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		default:
+			a.log.Error(op, "failed to authenticate", err)
+			http.Error(w, "Failed to authenticate: "+err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (domain.Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.VerifyAPIKey(r.Context(), key)
+	}
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return domain.Principal{}, errNoCredentials
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return domain.Principal{}, domain.ErrInvalidToken
+	}
+	if strings.HasPrefix(token, APIKeyPrefix) {
+		return a.VerifyAPIKey(r.Context(), token)
+	}
+	return a.VerifyAccessToken(token)
+}
+
+func (a *Authenticator) isPublic(r *http.Request) bool {
+	if !a.enabled {
+		return true
+	}
+	if a.publicRead && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		return true
+	}
+	for _, path := range publicPaths {
+		if r.URL.Path == path || strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path) {
+			return true
+		}
+	}
+	return false
+}
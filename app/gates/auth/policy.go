@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"encoding/json"
+	"mobileSongLibrary/domain"
+	"net/http"
+)
+
+// Problem ответ об ошибке в формате application/problem+json (RFC 9457)
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// WriteProblem отдаёт ошибку в формате application/problem+json
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	})
+}
+
+// Require middleware маршрута, который требует право perm. Роли берутся из бд на каждый запрос,
+// поэтому их изменение и отключение пользователя действуют сразу, без перевыпуска токенов.
+// Найденные роли кладутся в Principal в контексте. Отказ пишется в лог вместе с тем, кому отказано
+func (a *Authenticator) Require(perm domain.Permission) func(http.Handler) http.Handler {
+	const op = "gates.auth.Require"
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFrom(r.Context())
+			if !ok {
+				// Middleware уже пропустил анонимный запрос: аутентификация выключена или это чтение при public_read
+				if !a.enabled || a.publicRead && perm == domain.PermRead {
+					next.ServeHTTP(w, r)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer realm="mobileSongLibrary"`)
+				WriteProblem(w, r, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			roles, err := a.store.UserRoles(r.Context(), principal.UserID)
+			if err != nil {
+				a.log.Error(op, "failed to load roles", err)
+				WriteProblem(w, r, http.StatusInternalServerError, "failed to load roles")
+				return
+			}
+			principal.Roles = roles
+			if !domain.Allowed(roles, perm) {
+				a.log.Warn(op, "permission denied", principal.Username,
+					"user_id", principal.UserID, "method", principal.Method, "api_key_id", principal.APIKeyID,
+					"permission", perm, "request", r.Method+" "+r.URL.Path)
+				WriteProblem(w, r, http.StatusForbidden, "permission "+string(perm)+" is required")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package charts
+
+import (
+	"context"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"time"
+)
+
+// Store куда сохраняются снимки чартов
+type Store interface {
+	RefreshChart(ctx context.Context, window domain.ChartWindow, now time.Time, keep int) error
+}
+
+// Job фоновая задача, которая пересчитывает снимки всех чартов при старте и затем раз в RefreshInterval.
+// Чтение чарта берёт готовый снимок и не трогает таблицы прослушиваний и избранного
+type Job struct {
+	store    Store
+	log      *slog.Logger
+	interval time.Duration
+	keep     int
+	now      func() time.Time
+}
+
+func New(store Store, cfg config.Charts, log *slog.Logger) *Job {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 10 * time.Minute
+	}
+	if cfg.Keep < 2 {
+		cfg.Keep = 2 //для изменения места нужен предыдущий снимок
+	}
+	return &Job{store: store, log: log, interval: cfg.RefreshInterval, keep: cfg.Keep, now: time.Now}
+}
+
+// Run пересчитывает чарты, пока не отменён ctx
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		j.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh пересчитывает все периоды. Ошибка одного периода не мешает остальным
+func (j *Job) Refresh(ctx context.Context) {
+	const op = "gates.charts.Refresh"
+
+	now := j.now()
+	for _, window := range domain.ChartWindows {
+		if err := j.store.RefreshChart(ctx, window, now, j.keep); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			j.log.Error(op, "failed to refresh chart "+string(window), err)
+		}
+	}
+}
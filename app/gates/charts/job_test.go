@@ -0,0 +1,59 @@
+package charts
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memStore struct {
+	mu        sync.Mutex
+	refreshed []domain.ChartWindow
+	keep      int
+	failDay   bool
+}
+
+func (m *memStore) RefreshChart(_ context.Context, window domain.ChartWindow, _ time.Time, keep int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keep = keep
+	if m.failDay && window == domain.ChartDay {
+		return errors.New("db is down")
+	}
+	m.refreshed = append(m.refreshed, window)
+	return nil
+}
+
+func (m *memStore) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.refreshed)
+}
+
+func TestJobRefreshesAllWindows(t *testing.T) {
+	store := &memStore{failDay: true}
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	job := New(store, config.Charts{RefreshInterval: 10 * time.Millisecond, Keep: 1}, log)
+
+	// ошибка дневного чарта не мешает остальным
+	job.Refresh(context.Background())
+	require.Equal(t, []domain.ChartWindow{domain.ChartWeek, domain.ChartMonth}, store.refreshed)
+	require.Equal(t, 2, store.keep)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		job.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return store.count() >= 6 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
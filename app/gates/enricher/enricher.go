@@ -0,0 +1,74 @@
+package enricher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	swagger "mobileSongLibrary/gates/apiservice"
+	"net/http"
+)
+
+// ErrEnrichment внешний API не смог дополнить песню
+var ErrEnrichment = errors.New("failed to enrich song")
+
+// songInfo ответ /info. Поля album нет в спецификации API, но некоторые провайдеры его отдают
+type songInfo struct {
+	swagger.SongDetail
+	Album string `json:"album,omitempty"`
+}
+
+// Enricher дополняет песню датой релиза, текстом и ссылкой из внешнего API /info
+type Enricher struct {
+	client swagger.ClientInterface
+	log    *slog.Logger
+}
+
+func New(client swagger.ClientInterface, log *slog.Logger) *Enricher {
+	return &Enricher{client: client, log: log}
+}
+
+// Enrich запрашивает /info и заполняет песню ответом. Все ошибки оборачивают ErrEnrichment
+func (e *Enricher) Enrich(ctx context.Context, song domain.Song) (domain.Song, error) {
+	const op = "gates.enricher.Enrich"
+
+	// Запрос к внешнему API
+	e.log.Debug(op, "Request parameters: group=", string(song.GroupName), "song=", string(song.SongName))
+	response, err := e.client.GetInfo(ctx, &swagger.GetInfoParams{Group: string(song.GroupName), Song: string(song.SongName)})
+	if err != nil {
+		e.log.Error(op, "failed to get info: ", err)
+		return song, fmt.Errorf("%w: %s", ErrEnrichment, err)
+	}
+	defer response.Body.Close()
+
+	// Проверка на успешный статус-код API
+	if response.StatusCode != http.StatusOK {
+		e.log.Error(op, "got unexpected status code: ", response.Status)
+		return song, fmt.Errorf("%w: unexpected status code: %s", ErrEnrichment, response.Status)
+	}
+
+	// Декодирование ответа API
+	var songDetail songInfo
+	if err := json.NewDecoder(response.Body).Decode(&songDetail); err != nil {
+		e.log.Error(op, "failed to decode API response: ", err)
+		return song, fmt.Errorf("%w: failed to decode API response: %s", ErrEnrichment, err)
+	}
+
+	// Заполнение данных из API
+	releaseDate, err := domain.ParseCustomDate(songDetail.ReleaseDate)
+	if err != nil {
+		e.log.Error(op, "failed to parse release date", err)
+		return song, fmt.Errorf("%w: failed to parse release date: %s", ErrEnrichment, err)
+	}
+	song.Link = domain.Link(songDetail.Link)
+	if song.LRC == "" { //если пришёл LRC, текст уже выведен из него и должен с ним совпадать
+		song.Text = songDetail.Text
+	}
+	song.ReleaseDate = releaseDate
+	if song.Album == "" {
+		song.Album = songDetail.Album
+	}
+	return song, nil
+}
@@ -0,0 +1,287 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// pageSize сколько событий читается из журнала за раз
+const pageSize = 500
+
+// ErrUnavailable хаб ещё не прочитал журнал или уже остановлен
+var ErrUnavailable = errors.New("event stream is not available")
+
+// ErrLogExpired события после Last-Event-ID уже удалены из журнала, клиенту нужно перечитать библиотеку
+var ErrLogExpired = errors.New("events after last event id are no longer retained")
+
+// Store журнал событий. События пишет само хранилище в outbox в транзакциях изменений
+type Store interface {
+	GetEventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.Event, error)
+	EventLogBounds(ctx context.Context) (first int64, last int64, err error)
+}
+
+// Hub читает новые события из журнала и раздаёт их подписчикам по порядку id. Подписчик, который не успевает
+// забирать события и набрал buffer непрочитанных, отключается: после переподключения он догонит своё из журнала
+type Hub struct {
+	store    Store
+	log      *slog.Logger
+	interval time.Duration
+	buffer   int
+	grace    time.Duration
+
+	mu       sync.Mutex
+	ready    bool
+	closed   bool
+	cursor   int64 // последнее разосланное событие
+	gapSince time.Time
+	clients  map[*Subscription]struct{}
+}
+
+func New(store Store, cfg config.Events, log *slog.Logger) *Hub {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 500 * time.Millisecond
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = 256
+	}
+	if cfg.GapGrace < 0 {
+		cfg.GapGrace = 0
+	}
+	return &Hub{
+		store:    store,
+		log:      log,
+		interval: cfg.PollInterval,
+		buffer:   cfg.Buffer,
+		grace:    cfg.GapGrace,
+		clients:  make(map[*Subscription]struct{}),
+	}
+}
+
+// Run раздаёт события, пока не отменён ctx, после чего отключает всех подписчиков
+func (h *Hub) Run(ctx context.Context) {
+	const op = "gates.events.Run"
+
+	defer h.stop()
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			read, err := h.Poll(ctx)
+			if err != nil && ctx.Err() == nil {
+				h.log.Error(op, "failed to read events", err)
+			}
+			if err != nil || read < pageSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll читает события после последнего разосланного и раздаёт их. Первый вызов только запоминает конец журнала.
+// id событий выдаются при вставке, а видны они после коммита, поэтому событие может появиться позже следующего за ним.
+// На пропуске в id хаб ждёт до gap_grace, после чего считает, что транзакция откатилась. Возвращает сколько событий прочитано
+func (h *Hub) Poll(ctx context.Context) (int, error) {
+	if !h.isReady() {
+		_, last, err := h.store.EventLogBounds(ctx)
+		if err != nil {
+			return 0, err
+		}
+		h.mu.Lock()
+		h.cursor, h.ready = last, true
+		h.mu.Unlock()
+		return 0, nil
+	}
+
+	h.mu.Lock()
+	cursor := h.cursor
+	h.mu.Unlock()
+	events, err := h.store.GetEventsAfter(ctx, cursor, pageSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		if event.ID != cursor+1 {
+			if h.gapSince.IsZero() {
+				h.gapSince = time.Now()
+			}
+			if time.Since(h.gapSince) < h.grace {
+				return 0, nil
+			}
+		}
+		h.gapSince = time.Time{}
+		h.publish(event)
+		cursor = event.ID
+	}
+	return len(events), nil
+}
+
+// Subscribe подписывает на события групп groups, пустой groups - всех групп. Через подписку придут события после
+// возвращённого id, более ранние при необходимости берутся из журнала через Replay
+func (h *Hub) Subscribe(groups []domain.GroupName) (*Subscription, int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.ready || h.closed {
+		return nil, 0, ErrUnavailable
+	}
+	ch := make(chan domain.Event, h.buffer)
+	sub := &Subscription{C: ch, ch: ch, hub: h, groups: groupKeys(groups)}
+	h.clients[sub] = struct{}{}
+	return sub, h.cursor, nil
+}
+
+// Replay отдаёт fn события из журнала с id в (afterID, upTo], подходящие подписке. Если часть этих событий
+// уже удалена из журнала, возвращает ErrLogExpired не вызывая fn
+func (h *Hub) Replay(ctx context.Context, sub *Subscription, afterID int64, upTo int64, fn func(domain.Event) error) error {
+	if afterID >= upTo {
+		return nil
+	}
+	first, _, err := h.store.EventLogBounds(ctx)
+	if err != nil {
+		return err
+	}
+	if first == 0 || first > afterID+1 {
+		return ErrLogExpired
+	}
+	for afterID < upTo {
+		events, err := h.store.GetEventsAfter(ctx, afterID, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		for _, event := range events {
+			if event.ID > upTo {
+				return nil
+			}
+			afterID = event.ID
+			if !sub.Matches(event) {
+				continue
+			}
+			if err = fn(event); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Clients сколько подписчиков сейчас подключено
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+func (h *Hub) isReady() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ready
+}
+
+// publish раздаёт событие подписчикам не дожидаясь их. Подписчик с полным буфером отключается
+func (h *Hub) publish(event domain.Event) {
+	const op = "gates.events.publish"
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cursor = event.ID
+	for sub := range h.clients {
+		if !sub.Matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped = true
+			h.remove(sub)
+			h.log.Warn(op, "dropped slow client", event.ID)
+		}
+	}
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.clients[sub]; ok {
+		delete(h.clients, sub)
+		close(sub.ch)
+	}
+}
+
+func (h *Hub) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.clients {
+		h.remove(sub)
+	}
+}
+
+// Subscription подписка одного клиента. C закрывается, когда клиента отключили или хаб остановлен
+type Subscription struct {
+	C       <-chan domain.Event
+	ch      chan domain.Event
+	hub     *Hub
+	groups  map[string]bool
+	dropped bool
+}
+
+// Matches подходит ли событие под фильтр групп. Событие переноса подходит обеим группам
+func (s *Subscription) Matches(event domain.Event) bool {
+	if len(s.groups) == 0 {
+		return true
+	}
+	if s.groups[domain.NormalizeKey(string(event.GroupName))] {
+		return true
+	}
+	return event.PreviousGroup != "" && s.groups[domain.NormalizeKey(string(event.PreviousGroup))]
+}
+
+// Dropped отключён ли клиент за то, что не успевал забирать события
+func (s *Subscription) Dropped() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.dropped
+}
+
+// Close отписывает клиента
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+func groupKeys(groups []domain.GroupName) map[string]bool {
+	keys := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		keys[domain.NormalizeKey(string(group))] = true
+	}
+	return keys
+}
+
+// Format событие в формате text/event-stream: id для Last-Event-ID, тип события и событие в JSON
+func Format(event domain.Event) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("id: " + strconv.FormatInt(event.ID, 10) + "\n")
+	buf.WriteString("event: " + string(event.Type) + "\n")
+	buf.WriteString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,222 @@
+package events
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore журнал событий в памяти, события в нём могут идти с пропусками id
+type memStore struct {
+	mu     sync.Mutex
+	events []domain.Event
+}
+
+func (m *memStore) add(id int64, group domain.GroupName) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, domain.Event{ID: id, Type: domain.AuditSongUpdate, GroupName: group})
+}
+
+func (m *memStore) GetEventsAfter(_ context.Context, afterID int64, limit int) ([]domain.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []domain.Event
+	for _, event := range m.events {
+		if event.ID > afterID && len(result) < limit {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+func (m *memStore) EventLogBounds(context.Context) (int64, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.events) == 0 {
+		return 0, 0, nil
+	}
+	return m.events[0].ID, m.events[len(m.events)-1].ID, nil
+}
+
+func testLog() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+func newHub(t *testing.T, store *memStore, cfg config.Events) *Hub {
+	hub := New(store, cfg, testLog())
+	_, _, err := hub.Subscribe(nil)
+	require.ErrorIs(t, err, ErrUnavailable)
+	_, err = hub.Poll(context.Background())
+	require.NoError(t, err)
+	return hub
+}
+
+func received(sub *Subscription) []int64 {
+	var ids []int64
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, event.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestHubFiltersByGroup(t *testing.T) {
+	store := &memStore{}
+	store.add(1, "Muse")
+	hub := newHub(t, store, config.Events{})
+
+	all, cursor, err := hub.Subscribe(nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), cursor)
+	muse, _, err := hub.Subscribe([]domain.GroupName{" MUSE"})
+	require.NoError(t, err)
+
+	store.add(2, "Muse")
+	store.add(3, "Queen")
+	store.mu.Lock()
+	store.events = append(store.events, domain.Event{ID: 4, Type: domain.AuditGroupRename, GroupName: "Muse!", PreviousGroup: "muse"})
+	store.mu.Unlock()
+	read, err := hub.Poll(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, read)
+
+	require.Equal(t, []int64{2, 3, 4}, received(all))
+	require.Equal(t, []int64{2, 4}, received(muse)) //переименование приходит и старой группе
+
+	muse.Close()
+	require.Equal(t, 1, hub.Clients())
+}
+
+func TestHubWaitsForGapThenSkipsIt(t *testing.T) {
+	store := &memStore{}
+	hub := newHub(t, store, config.Events{GapGrace: 50 * time.Millisecond})
+	sub, _, err := hub.Subscribe(nil)
+	require.NoError(t, err)
+
+	//событие 2 ещё не закоммичено, 3 ждёт его
+	store.add(1, "Muse")
+	store.add(3, "Muse")
+	_, err = hub.Poll(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, received(sub))
+
+	store.mu.Lock()
+	store.events = []domain.Event{{ID: 1}, {ID: 2}, {ID: 3}}
+	store.mu.Unlock()
+	_, err = hub.Poll(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int64{2, 3}, received(sub))
+
+	//транзакция события 5 откатилась, после gap_grace 6 уходит без него
+	store.add(6, "Muse")
+	_, err = hub.Poll(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, received(sub))
+	time.Sleep(60 * time.Millisecond)
+	_, err = hub.Poll(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int64{6}, received(sub))
+}
+
+func TestHubDropsSlowClient(t *testing.T) {
+	store := &memStore{}
+	hub := newHub(t, store, config.Events{Buffer: 2})
+	slow, _, err := hub.Subscribe(nil)
+	require.NoError(t, err)
+	fast, _, err := hub.Subscribe(nil)
+	require.NoError(t, err)
+
+	for id := int64(1); id <= 3; id++ {
+		store.add(id, "Muse")
+		_, err = hub.Poll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, []int64{id}, received(fast))
+	}
+	require.Equal(t, []int64{1, 2}, received(slow)) //канал закрыт после второго события
+	require.True(t, slow.Dropped())
+	require.False(t, fast.Dropped())
+	require.Equal(t, 1, hub.Clients())
+}
+
+func TestHubReplay(t *testing.T) {
+	store := &memStore{}
+	for id := int64(1); id <= 5; id++ {
+		group := domain.GroupName("Muse")
+		if id%2 == 0 {
+			group = "Queen"
+		}
+		store.add(id, group)
+	}
+	hub := newHub(t, store, config.Events{})
+	sub, cursor, err := hub.Subscribe([]domain.GroupName{"queen"})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), cursor)
+
+	var ids []int64
+	collect := func(event domain.Event) error {
+		ids = append(ids, event.ID)
+		return nil
+	}
+	require.NoError(t, hub.Replay(context.Background(), sub, 1, cursor, collect))
+	require.Equal(t, []int64{2, 4}, ids)
+
+	//события 1 и 2 удалены из журнала
+	store.mu.Lock()
+	store.events = store.events[2:]
+	store.mu.Unlock()
+	require.ErrorIs(t, hub.Replay(context.Background(), sub, 1, cursor, collect), ErrLogExpired)
+	require.NoError(t, hub.Replay(context.Background(), sub, 2, cursor, collect))
+}
+
+func TestHubStopClosesSubscriptions(t *testing.T) {
+	store := &memStore{}
+	hub := New(store, config.Events{PollInterval: time.Millisecond}, testLog())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(done)
+	}()
+	var sub *Subscription
+	require.Eventually(t, func() bool {
+		var err error
+		sub, _, err = hub.Subscribe(nil)
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	store.add(1, "Muse")
+	event := <-sub.C
+	require.Equal(t, int64(1), event.ID)
+
+	cancel()
+	<-done
+	_, ok := <-sub.C
+	require.False(t, ok)
+	require.False(t, sub.Dropped())
+	_, _, err := hub.Subscribe(nil)
+	require.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestFormat(t *testing.T) {
+	chunk, err := Format(domain.Event{ID: 42, Type: domain.AuditGroupRename, GroupName: "Muse"})
+	require.NoError(t, err)
+	lines := strings.Split(string(chunk), "\n")
+	require.Equal(t, "id: 42", lines[0])
+	require.Equal(t, "event: group.rename", lines[1])
+	require.True(t, strings.HasPrefix(lines[2], `data: {"id":42`))
+	require.True(t, strings.HasSuffix(string(chunk), "\n\n"))
+}
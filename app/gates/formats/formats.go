@@ -0,0 +1,109 @@
+// Package formats кодирует песни в плейлисты для медиаплееров (M3U8, XSPF, PLS) и читает их обратно
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mobileSongLibrary/domain"
+	"strings"
+)
+
+const (
+	M3U8 = "m3u8"
+	XSPF = "xspf"
+	PLS  = "pls"
+)
+
+var ErrUnknownFormat = errors.New("unknown playlist format")
+
+// Encoder пишет песни в плейлист по одной. Песни без ссылки пропускаются - плееру нечего с ними делать
+type Encoder interface {
+	Encode(song domain.Song) error
+	// Close дописывает хвост плейлиста и сбрасывает буферы
+	Close() error
+}
+
+// IsPlaylist проверяет что формат - один из форматов плейлистов
+func IsPlaylist(format string) bool {
+	switch format {
+	case M3U8, XSPF, PLS:
+		return true
+	}
+	return false
+}
+
+// NewEncoder создаёт Encoder плейлиста с названием title
+func NewEncoder(format string, w io.Writer, title string) (Encoder, error) {
+	switch format {
+	case M3U8:
+		return newM3U8Encoder(w, title), nil
+	case XSPF:
+		return newXSPFEncoder(w, title), nil
+	case PLS:
+		return newPLSEncoder(w), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// Decode читает плейлист и вызывает fn для каждой песни
+func Decode(format string, r io.Reader, fn func(domain.Song) error) error {
+	switch format {
+	case M3U8:
+		return DecodeM3U8(r, fn)
+	case XSPF:
+		return DecodeXSPF(r, fn)
+	case PLS:
+		return DecodePLS(r, fn)
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// ContentType MIME тип плейлиста
+func ContentType(format string) string {
+	switch format {
+	case M3U8:
+		return "application/vnd.apple.mpegurl"
+	case XSPF:
+		return "application/xspf+xml"
+	case PLS:
+		return "audio/x-scpls"
+	}
+	return "application/octet-stream"
+}
+
+// FormatFromName угадывает формат плейлиста по расширению файла
+func FormatFromName(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".m3u8"), strings.HasSuffix(name, ".m3u"):
+		return M3U8
+	case strings.HasSuffix(name, ".xspf"):
+		return XSPF
+	case strings.HasSuffix(name, ".pls"):
+		return PLS
+	}
+	return ""
+}
+
+// displayTitle название записи для плеера: "Группа - Песня"
+func displayTitle(song domain.Song) string {
+	if song.GroupName == "" {
+		return string(song.SongName)
+	}
+	return string(song.GroupName) + " - " + string(song.SongName)
+}
+
+// splitTitle обратное displayTitle: группа отделяется по первому " - ", остальное считается названием песни
+func splitTitle(title string) (domain.GroupName, domain.SongName) {
+	group, song, ok := strings.Cut(strings.TrimSpace(title), " - ")
+	if !ok {
+		return "", domain.SongName(strings.TrimSpace(title))
+	}
+	return domain.GroupName(strings.TrimSpace(group)), domain.SongName(strings.TrimSpace(song))
+}
+
+// oneLine убирает переводы строк, которые сломали бы строчные форматы
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
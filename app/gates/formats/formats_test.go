@@ -0,0 +1,90 @@
+package formats
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"mobileSongLibrary/domain"
+	"strings"
+	"testing"
+)
+
+var playlistSongs = []domain.Song{
+	{GroupName: "Muse", SongName: "Supermassive Black Hole", Link: "https://www.youtube.com/watch?v=Xsp3_a-PMTw"},
+	{GroupName: "Daft Punk", SongName: "One More Time - Radio Edit", Link: "https://example.com/one?more=time&x=<1>"},
+	{GroupName: "Buku", SongName: "Front to Back"}, //без ссылки в плейлист не попадает
+	{GroupName: "Кино", SongName: "Группа крови", Link: "https://example.com/кино"},
+}
+
+// Записанный плейлист должен читаться обратно без потерь группы, названия и ссылки
+func TestPlaylistRoundTrip(t *testing.T) {
+	for _, format := range []string{M3U8, XSPF, PLS} {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(format, &buf, "DJ set")
+		require.NoError(t, err)
+		for _, song := range playlistSongs {
+			require.NoError(t, encoder.Encode(song))
+		}
+		require.NoError(t, encoder.Close())
+
+		var songs []domain.Song
+		err = Decode(format, &buf, func(song domain.Song) error {
+			songs = append(songs, song)
+			return nil
+		})
+		require.NoError(t, err, format)
+		require.Equal(t, []domain.Song{playlistSongs[0], playlistSongs[1], playlistSongs[3]}, songs, format)
+	}
+}
+
+func TestEmptyPlaylist(t *testing.T) {
+	for _, format := range []string{M3U8, XSPF, PLS} {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(format, &buf, "")
+		require.NoError(t, err)
+		require.NoError(t, encoder.Close())
+		require.NotEmpty(t, buf.String(), format)
+
+		err = Decode(format, &buf, func(song domain.Song) error {
+			t.Fatalf("%s: unexpected song %v", format, song)
+			return nil
+		})
+		require.NoError(t, err, format)
+	}
+}
+
+func TestM3U8Format(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, _ := NewEncoder(M3U8, &buf, "DJ set")
+	require.NoError(t, encoder.Encode(playlistSongs[0]))
+	require.NoError(t, encoder.Close())
+	require.Equal(t, "#EXTM3U\n#PLAYLIST:DJ set\n#EXTINF:-1,Muse - Supermassive Black Hole\nhttps://www.youtube.com/watch?v=Xsp3_a-PMTw\n", buf.String())
+}
+
+// Плейлисты из сторонних плееров: атрибуты в #EXTINF, записи без #EXTINF, комментарии
+func TestDecodeM3U8FromPlayer(t *testing.T) {
+	playlist := "\ufeff#EXTM3U\r\n" +
+		"#EXTINF:245 tvg-id=\"1\",Muse - Uprising\r\n" +
+		"# комментарий\r\n" +
+		"C:\\Music\\uprising.mp3\r\n" +
+		"\r\n" +
+		"http://example.com/stream.mp3\r\n"
+	var songs []domain.Song
+	err := DecodeM3U8(strings.NewReader(playlist), func(song domain.Song) error {
+		songs = append(songs, song)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []domain.Song{
+		{GroupName: "Muse", SongName: "Uprising", Link: "C:\\Music\\uprising.mp3"},
+		{SongName: "http://example.com/stream.mp3", Link: "http://example.com/stream.mp3"},
+	}, songs)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := NewEncoder("wpl", &bytes.Buffer{}, "")
+	require.ErrorIs(t, err, ErrUnknownFormat)
+	require.ErrorIs(t, Decode("wpl", strings.NewReader(""), nil), ErrUnknownFormat)
+	require.Equal(t, M3U8, FormatFromName("set.M3U"))
+	require.Equal(t, XSPF, FormatFromName("set.xspf"))
+	require.Equal(t, "", FormatFromName("set.txt"))
+}
@@ -0,0 +1,82 @@
+package formats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mobileSongLibrary/domain"
+	"strings"
+)
+
+// m3u8Encoder пишет extended M3U в UTF-8:
+//
+//	#EXTM3U
+//	#PLAYLIST:title
+//	#EXTINF:-1,Группа - Песня
+//	ссылка
+type m3u8Encoder struct {
+	w             *bufio.Writer
+	title         string
+	headerWritten bool
+}
+
+func newM3U8Encoder(w io.Writer, title string) *m3u8Encoder {
+	return &m3u8Encoder{w: bufio.NewWriter(w), title: title}
+}
+
+func (e *m3u8Encoder) writeHeader() {
+	if e.headerWritten {
+		return
+	}
+	e.headerWritten = true
+	e.w.WriteString("#EXTM3U\n")
+	if e.title != "" {
+		e.w.WriteString("#PLAYLIST:" + oneLine(e.title) + "\n")
+	}
+}
+
+func (e *m3u8Encoder) Encode(song domain.Song) error {
+	e.writeHeader()
+	if song.Link == "" {
+		return nil
+	}
+	// длительность песни нам неизвестна, по стандарту в этом случае пишется -1
+	_, err := fmt.Fprintf(e.w, "#EXTINF:-1,%s\n%s\n", oneLine(displayTitle(song)), oneLine(string(song.Link)))
+	return err
+}
+
+func (e *m3u8Encoder) Close() error {
+	e.writeHeader()
+	return e.w.Flush()
+}
+
+// DecodeM3U8 читает M3U/M3U8. Группа и название берутся из #EXTINF, записи без #EXTINF получают название из ссылки
+func DecodeM3U8(r io.Reader, fn func(domain.Song) error) error {
+	scanner := bufio.NewScanner(r)
+	var pending *domain.Song
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			// #EXTINF:длительность[ атрибуты],название
+			_, title, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			group, song := splitTitle(title)
+			pending = &domain.Song{GroupName: group, SongName: song}
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			song := domain.Song{SongName: domain.SongName(line)}
+			if pending != nil {
+				song = *pending
+			}
+			song.Link = domain.Link(line)
+			pending = nil
+			if err := fn(song); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,93 @@
+package formats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mobileSongLibrary/domain"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// plsEncoder пишет PLS. Количество записей становится известно только в конце, поэтому NumberOfEntries пишется последним
+type plsEncoder struct {
+	w     *bufio.Writer
+	count int
+}
+
+func newPLSEncoder(w io.Writer) *plsEncoder {
+	e := &plsEncoder{w: bufio.NewWriter(w)}
+	e.w.WriteString("[playlist]\n")
+	return e
+}
+
+func (e *plsEncoder) Encode(song domain.Song) error {
+	if song.Link == "" {
+		return nil
+	}
+	e.count++
+	_, err := fmt.Fprintf(e.w, "File%d=%s\nTitle%d=%s\nLength%d=-1\n",
+		e.count, oneLine(string(song.Link)), e.count, oneLine(displayTitle(song)), e.count)
+	return err
+}
+
+func (e *plsEncoder) Close() error {
+	fmt.Fprintf(e.w, "NumberOfEntries=%d\nVersion=2\n", e.count)
+	return e.w.Flush()
+}
+
+// DecodePLS читает PLS. Записи отдаются в порядке номеров FileN
+func DecodePLS(r io.Reader, fn func(domain.Song) error) error {
+	entries := make(map[int]*domain.Song)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		var field string
+		switch {
+		case strings.HasPrefix(key, "File"):
+			field = "File"
+		case strings.HasPrefix(key, "Title"):
+			field = "Title"
+		default:
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if err != nil {
+			continue
+		}
+		if entries[n] == nil {
+			entries[n] = &domain.Song{}
+		}
+		if field == "File" {
+			entries[n].Link = domain.Link(value)
+		} else {
+			entries[n].GroupName, entries[n].SongName = splitTitle(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	numbers := make([]int, 0, len(entries))
+	for n := range entries {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	for _, n := range numbers {
+		song := *entries[n]
+		if song.Link == "" {
+			continue
+		}
+		if song.SongName == "" {
+			song.SongName = domain.SongName(song.Link)
+		}
+		if err := fn(song); err != nil {
+			return err
+		}
+	}
+	return nil
+}
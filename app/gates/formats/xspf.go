@@ -0,0 +1,108 @@
+package formats
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"mobileSongLibrary/domain"
+	"strings"
+)
+
+const xspfNamespace = "http://xspf.org/ns/0/"
+
+type xspfTrack struct {
+	XMLName  xml.Name `xml:"track"`
+	Location string   `xml:"location"`
+	Creator  string   `xml:"creator,omitempty"`
+	Title    string   `xml:"title,omitempty"`
+}
+
+// xspfEncoder пишет XSPF. Треки кодируются по одному, поэтому весь плейлист в памяти не собирается
+type xspfEncoder struct {
+	w             *bufio.Writer
+	title         string
+	headerWritten bool
+}
+
+func newXSPFEncoder(w io.Writer, title string) *xspfEncoder {
+	return &xspfEncoder{w: bufio.NewWriter(w), title: title}
+}
+
+func (e *xspfEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+	e.w.WriteString(xml.Header)
+	e.w.WriteString(`<playlist version="1" xmlns="` + xspfNamespace + `">` + "\n")
+	if e.title != "" {
+		e.w.WriteString("  <title>")
+		if err := xml.EscapeText(e.w, []byte(e.title)); err != nil {
+			return err
+		}
+		e.w.WriteString("</title>\n")
+	}
+	_, err := e.w.WriteString("  <trackList>\n")
+	return err
+}
+
+func (e *xspfEncoder) Encode(song domain.Song) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	if song.Link == "" {
+		return nil
+	}
+	track, err := xml.MarshalIndent(xspfTrack{
+		Location: string(song.Link),
+		Creator:  string(song.GroupName),
+		Title:    string(song.SongName),
+	}, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	e.w.Write(track)
+	_, err = e.w.WriteString("\n")
+	return err
+}
+
+func (e *xspfEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.WriteString("  </trackList>\n</playlist>\n")
+	return e.w.Flush()
+}
+
+// DecodeXSPF читает XSPF потоково, трек за треком
+func DecodeXSPF(r io.Reader, fn func(domain.Song) error) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "track" {
+			continue
+		}
+		var track xspfTrack
+		if err = decoder.DecodeElement(&track, &start); err != nil {
+			return err
+		}
+		song := domain.Song{
+			GroupName: domain.GroupName(strings.TrimSpace(track.Creator)),
+			SongName:  domain.SongName(strings.TrimSpace(track.Title)),
+			Link:      domain.Link(strings.TrimSpace(track.Location)),
+		}
+		if song.SongName == "" {
+			song.SongName = domain.SongName(song.Link)
+		}
+		if err = fn(song); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"time"
+)
+
+// pruneInterval как часто удаляются старые доставленные события
+const pruneInterval = time.Hour
+
+// Store таблица outbox, события в неё пишет само хранилище в транзакциях изменений
+type Store interface {
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]domain.Event, error)
+	MarkEventsPublished(ctx context.Context, ids ...int64) error
+	MarkEventFailed(ctx context.Context, id int64, reason string, retryIn time.Duration) error
+	PruneEvents(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+// Sink получатель событий. Publish должен вернуть ошибку, если событие не принято, тогда оно будет доставлено ещё раз
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event domain.Event) error
+}
+
+// Relay фоновая задача, которая доставляет события из outbox во все получатели. Доставка хотя бы однократная:
+// событие считается доставленным, только когда его приняли все получатели, а при ошибке любого из них
+// повторяется для всех с растущей паузой. Повторы и события, доставленные вне очереди из-за повторов, получатели
+// отбрасывают по id события
+type Relay struct {
+	store      Store
+	sinks      []Sink
+	log        *slog.Logger
+	interval   time.Duration
+	batchSize  int
+	lease      time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	retention  time.Duration
+}
+
+func New(store Store, sinks []Sink, cfg config.Outbox, log *slog.Logger) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 30 * time.Second
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = cfg.MinBackoff
+	}
+	return &Relay{
+		store:      store,
+		sinks:      sinks,
+		log:        log,
+		interval:   cfg.PollInterval,
+		batchSize:  cfg.BatchSize,
+		lease:      cfg.Lease,
+		minBackoff: cfg.MinBackoff,
+		maxBackoff: cfg.MaxBackoff,
+		retention:  cfg.Retention,
+	}
+}
+
+// Run доставляет события, пока не отменён ctx. Полные пачки забираются сразу одна за другой,
+// после неполной relay ждёт PollInterval
+func (r *Relay) Run(ctx context.Context) {
+	const op = "gates.outbox.Run"
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+	for {
+		for {
+			claimed, err := r.Relay(ctx)
+			if err != nil && ctx.Err() == nil {
+				r.log.Error(op, "failed to relay events", err)
+			}
+			if err != nil || claimed < r.batchSize {
+				break
+			}
+		}
+		if r.retention > 0 && time.Since(lastPrune) >= pruneInterval {
+			lastPrune = time.Now()
+			if pruned, err := r.store.PruneEvents(ctx, r.retention); err != nil && ctx.Err() == nil {
+				r.log.Error(op, "failed to prune events", err)
+			} else if pruned > 0 {
+				r.log.Debug(op, "pruned delivered events", pruned)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Relay забирает одну пачку событий, доставляет их и отмечает результат. Возвращает сколько событий было взято
+func (r *Relay) Relay(ctx context.Context) (int, error) {
+	const op = "gates.outbox.Relay"
+
+	events, err := r.store.ClaimEvents(ctx, r.batchSize, r.lease)
+	if err != nil {
+		return 0, err
+	}
+	published := make([]int64, 0, len(events))
+	for _, event := range events {
+		if err = r.publish(ctx, event); err != nil {
+			if ctx.Err() != nil {
+				break //событие осталось взятым и будет доставлено после истечения аренды
+			}
+			retryIn := r.backoff(event.Attempts)
+			r.log.Warn(op, fmt.Sprintf("failed to deliver event %d, retry in %s", event.ID, retryIn), err)
+			if err = r.store.MarkEventFailed(ctx, event.ID, err.Error(), retryIn); err != nil {
+				return len(events), err
+			}
+			continue
+		}
+		published = append(published, event.ID)
+	}
+	// уже доставленные события отмечаем и при остановке, чтобы после перезапуска они не ушли повторно
+	if err = r.store.MarkEventsPublished(context.WithoutCancel(ctx), published...); err != nil {
+		return len(events), err
+	}
+	if len(published) > 0 {
+		r.log.Debug(op, "delivered events", len(published))
+	}
+	return len(events), ctx.Err()
+}
+
+// publish отдаёт событие всем получателям по очереди, первая ошибка прерывает доставку
+func (r *Relay) publish(ctx context.Context, event domain.Event) error {
+	for _, sink := range r.sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			return fmt.Errorf("%s: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+// backoff пауза перед следующей попыткой: MinBackoff, дальше вдвое больше после каждой ошибки, но не больше MaxBackoff
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.minBackoff
+	for i := 1; i < attempts && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.maxBackoff {
+		delay = r.maxBackoff
+	}
+	return delay
+}
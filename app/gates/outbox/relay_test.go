@@ -0,0 +1,183 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memStore struct {
+	mu        sync.Mutex
+	pending   []domain.Event
+	published []int64
+	failed    map[int64]time.Duration
+}
+
+func (m *memStore) ClaimEvents(_ context.Context, limit int, _ time.Duration) ([]domain.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if limit > len(m.pending) {
+		limit = len(m.pending)
+	}
+	claimed := m.pending[:limit]
+	m.pending = m.pending[limit:]
+	for i := range claimed {
+		claimed[i].Attempts++
+	}
+	return claimed, nil
+}
+
+func (m *memStore) MarkEventsPublished(_ context.Context, ids ...int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.published = append(m.published, ids...)
+	return nil
+}
+
+func (m *memStore) MarkEventFailed(_ context.Context, id int64, _ string, retryIn time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed[id] = retryIn
+	return nil
+}
+
+func (m *memStore) PruneEvents(context.Context, time.Duration) (int64, error) {
+	return 0, nil
+}
+
+type memSink struct {
+	mu       sync.Mutex
+	received []int64
+	reject   map[int64]bool
+}
+
+func (s *memSink) Name() string { return "mem" }
+
+func (s *memSink) Publish(_ context.Context, event domain.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reject[event.ID] {
+		return errors.New("rejected")
+	}
+	s.received = append(s.received, event.ID)
+	return nil
+}
+
+func testLog() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+func TestRelayDeliversAndRetries(t *testing.T) {
+	store := &memStore{failed: map[int64]time.Duration{}}
+	for id := int64(1); id <= 5; id++ {
+		store.pending = append(store.pending, domain.Event{ID: id, Type: domain.AuditSongCreate})
+	}
+	store.pending[2].Attempts = 3 //третье событие уже дважды не доставилось
+	sink := &memSink{reject: map[int64]bool{3: true}}
+	relay := New(store, []Sink{sink}, config.Outbox{BatchSize: 2, MinBackoff: time.Second, MaxBackoff: 3 * time.Second}, testLog())
+
+	claimed, err := relay.Relay(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, claimed)
+	claimed, err = relay.Relay(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, claimed)
+
+	require.Equal(t, []int64{1, 2, 4}, sink.received)
+	require.Equal(t, []int64{1, 2, 4}, store.published)
+	// четвёртая попытка: 1s, 2s, 4s, но не больше MaxBackoff
+	require.Equal(t, map[int64]time.Duration{3: 3 * time.Second}, store.failed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.published) == 4
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestBackoff(t *testing.T) {
+	relay := New(&memStore{}, nil, config.Outbox{MinBackoff: time.Second, MaxBackoff: time.Minute}, testLog())
+	require.Equal(t, time.Second, relay.backoff(1))
+	require.Equal(t, 2*time.Second, relay.backoff(2))
+	require.Equal(t, 32*time.Second, relay.backoff(6))
+	require.Equal(t, time.Minute, relay.backoff(100))
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got domain.Event
+	status := http.StatusNoContent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "7", r.Header.Get("X-Event-Id"))
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	sinks, err := NewSinks([]config.OutboxSink{{Type: SinkWebhook, URL: receiver.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}}, nil)
+	require.NoError(t, err)
+	event := domain.Event{ID: 7, Type: domain.AuditSongUpdate, Target: "song:muse/uprising", GroupName: "Muse"}
+	require.NoError(t, sinks[0].Publish(context.Background(), event))
+	require.Equal(t, event.Target, got.Target)
+
+	status = http.StatusBadGateway
+	require.Error(t, sinks[0].Publish(context.Background(), event))
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	sinks, err := NewSinks([]config.OutboxSink{{Type: SinkFile, Path: path}}, nil)
+	require.NoError(t, err)
+	for id := int64(1); id <= 2; id++ {
+		require.NoError(t, sinks[0].Publish(context.Background(), domain.Event{ID: id, Type: domain.AuditSongDelete}))
+	}
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var ids []int64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event domain.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		ids = append(ids, event.ID)
+	}
+	require.Equal(t, []int64{1, 2}, ids)
+
+	_, err = NewSinks([]config.OutboxSink{{Type: "kafka"}}, nil)
+	require.Error(t, err)
+}
+
+func TestNotifyPayloadDropsStatesWhenTooLarge(t *testing.T) {
+	small := domain.Event{ID: 1, After: json.RawMessage(`{"text":"short"}`)}
+	payload, err := notifyPayload(small)
+	require.NoError(t, err)
+	require.Contains(t, payload, "short")
+
+	large := domain.Event{ID: 2, After: json.RawMessage(`{"text":"` + strings.Repeat("a", maxNotifyPayload) + `"}`)}
+	payload, err = notifyPayload(large)
+	require.NoError(t, err)
+	require.Less(t, len(payload), maxNotifyPayload)
+	require.NotContains(t, payload, `"after"`)
+}
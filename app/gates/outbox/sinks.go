@@ -0,0 +1,179 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Типы получателей в конфиге
+const (
+	SinkWebhook = "webhook"
+	SinkFile    = "file"
+	SinkNotify  = "notify"
+)
+
+// maxNotifyPayload предел размера NOTIFY в Postgres 8000 байт, берём с запасом
+const maxNotifyPayload = 7900
+
+// Notifier отправляет сообщения слушателям Postgres LISTEN/NOTIFY
+type Notifier interface {
+	Notify(ctx context.Context, channel string, payload string) error
+}
+
+// NewSinks создаёт получателей из конфига
+func NewSinks(cfgs []config.OutboxSink, notifier Notifier) ([]Sink, error) {
+	sinks := make([]Sink, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		switch cfg.Type {
+		case SinkWebhook:
+			if cfg.URL == "" {
+				return nil, fmt.Errorf("outbox.sinks[%d]: url is required for webhook", i)
+			}
+			sinks = append(sinks, NewWebhookSink(cfg.URL, cfg.Headers, cfg.Timeout))
+		case SinkFile:
+			sink, err := NewFileSink(cfg.Path)
+			if err != nil {
+				return nil, fmt.Errorf("outbox.sinks[%d]: %w", i, err)
+			}
+			sinks = append(sinks, sink)
+		case SinkNotify:
+			if cfg.Channel == "" {
+				return nil, fmt.Errorf("outbox.sinks[%d]: channel is required for notify", i)
+			}
+			sinks = append(sinks, &NotifySink{channel: cfg.Channel, notifier: notifier})
+		default:
+			return nil, fmt.Errorf("outbox.sinks[%d]: unknown type %q, expected webhook, file or notify", i, cfg.Type)
+		}
+	}
+	return sinks, nil
+}
+
+// WebhookSink отправляет каждое событие POST запросом с JSON телом. Любой ответ кроме 2xx считается ошибкой
+type WebhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewWebhookSink(url string, headers map[string]string, timeout time.Duration) *WebhookSink {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &WebhookSink{url: url, headers: headers, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *WebhookSink) Name() string {
+	return SinkWebhook + " " + s.url
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, event domain.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Id", strconv.FormatInt(event.ID, 10))
+	req.Header.Set("X-Event-Type", string(event.Type))
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) //дочитываем, чтобы соединение вернулось в пул
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// FileSink дописывает события построчно в NDJSON файл или stdout
+type FileSink struct {
+	mu   sync.Mutex
+	name string
+	w    io.Writer
+	file *os.File // nil для stdout, его не синхронизируем
+}
+
+// NewFileSink открывает файл path на дозапись, "-" или пустой path - stdout
+func NewFileSink(path string) (*FileSink, error) {
+	if path == "" || path == "-" {
+		return &FileSink{name: "stdout", w: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{name: path, w: file, file: file}, nil
+}
+
+func (s *FileSink) Name() string {
+	return SinkFile + " " + s.name
+}
+
+// Publish пишет событие одной строкой. Файл синхронизируется на диск до того, как событие будет отмечено доставленным
+func (s *FileSink) Publish(_ context.Context, event domain.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if s.file != nil {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+// NotifySink отправляет события в канал Postgres LISTEN/NOTIFY. NOTIFY не хранит сообщения: слушатель, который
+// был отключён, события пропустит. Если событие не влезает в NOTIFY, состояния до и после отбрасываются,
+// за ними слушатель может сходить в API
+type NotifySink struct {
+	channel  string
+	notifier Notifier
+}
+
+func (s *NotifySink) Name() string {
+	return SinkNotify + " " + s.channel
+}
+
+func (s *NotifySink) Publish(ctx context.Context, event domain.Event) error {
+	payload, err := notifyPayload(event)
+	if err != nil {
+		return err
+	}
+	return s.notifier.Notify(ctx, s.channel, payload)
+}
+
+func notifyPayload(event domain.Event) (string, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	if len(payload) > maxNotifyPayload {
+		event.Before, event.After = nil, nil
+		if payload, err = json.Marshal(event); err != nil {
+			return "", err
+		}
+	}
+	return string(payload), nil
+}
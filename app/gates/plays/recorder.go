@@ -0,0 +1,121 @@
+package plays
+
+import (
+	"context"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"time"
+)
+
+// Store куда пишутся пачки прослушиваний
+type Store interface {
+	SavePlays(ctx context.Context, plays []domain.Play) error
+}
+
+// Recorder принимает прослушивания и пишет их в бд пачками: когда набралось BatchSize или прошло FlushInterval.
+// Так частые прослушивания одной песни превращаются в одну вставку и одно обновление счётчика за пачку.
+//
+// Очередь живёт только в памяти, это осознанный размен на то, что POST /song/play не ждёт бд. При штатной остановке
+// (SIGINT, SIGTERM) Run дописывает очередь, но если процесс упал или был убит, теряется всё, что ещё не записано:
+// обычно не больше FlushInterval прослушиваний, а пока бд недоступна - до QueueSize. Столько же теряется, если
+// бд не ответила за 10 секунд при остановке, об этом пишется ошибка с количеством
+type Recorder struct {
+	store     Store
+	log       *slog.Logger
+	queue     chan domain.Play
+	batchSize int
+	interval  time.Duration
+	done      chan struct{}
+}
+
+func New(store Store, cfg config.Plays, log *slog.Logger) *Recorder {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 2 * time.Second
+	}
+	if cfg.QueueSize < cfg.BatchSize {
+		cfg.QueueSize = cfg.BatchSize
+	}
+	return &Recorder{
+		store:     store,
+		log:       log,
+		queue:     make(chan domain.Play, cfg.QueueSize),
+		batchSize: cfg.BatchSize,
+		interval:  cfg.FlushInterval,
+		done:      make(chan struct{}),
+	}
+}
+
+// Record ставит прослушивание в очередь не дожидаясь записи. Если очередь заполнена, возвращает domain.ErrPlayQueueFull
+func (r *Recorder) Record(play domain.Play) error {
+	select {
+	case r.queue <- play:
+		return nil
+	default:
+		return domain.ErrPlayQueueFull
+	}
+}
+
+// Run пишет пачки, пока не отменён ctx, после чего дописывает всё, что осталось в очереди
+func (r *Recorder) Run(ctx context.Context) {
+	const op = "gates.plays.Run"
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	batch := make([]domain.Play, 0, r.batchSize)
+	failing := false // после неудачной записи следующая попытка только по таймеру, а не на каждое прослушивание
+	for {
+		select {
+		case play := <-r.queue:
+			batch = append(batch, play)
+			if len(batch) >= r.batchSize && !failing {
+				batch, failing = r.flush(ctx, batch)
+			}
+		case <-ticker.C:
+			batch, failing = r.flush(ctx, batch)
+		case <-ctx.Done():
+			for len(r.queue) > 0 {
+				batch = append(batch, <-r.queue)
+			}
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			for len(batch) > 0 {
+				n := min(len(batch), r.batchSize)
+				if err := r.store.SavePlays(flushCtx, batch[:n]); err != nil {
+					r.log.Error(op, "failed to save plays on shutdown, dropped: ", len(batch))
+					break
+				}
+				batch = batch[n:]
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// Wait ждёт, пока Run допишет очередь после отмены контекста
+func (r *Recorder) Wait() {
+	<-r.done
+}
+
+// flush пишет пачку. Неудачная пачка остаётся до следующей попытки, пока не превысит размер очереди.
+// Второе значение - запись не удалась
+func (r *Recorder) flush(ctx context.Context, batch []domain.Play) ([]domain.Play, bool) {
+	const op = "gates.plays.flush"
+
+	if len(batch) == 0 {
+		return batch, false
+	}
+	if err := r.store.SavePlays(ctx, batch); err != nil {
+		if len(batch) <= cap(r.queue) {
+			r.log.Warn(op, "failed to save plays, will retry: ", err)
+			return batch, true
+		}
+		r.log.Error(op, "failed to save plays, dropped: ", len(batch), "error", err)
+		return batch[:0], true
+	}
+	return batch[:0], false
+}
@@ -0,0 +1,87 @@
+package plays
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore запоминает размеры записанных пачек
+type memStore struct {
+	mu      sync.Mutex
+	batches []int
+	fail    bool
+}
+
+func (m *memStore) SavePlays(_ context.Context, plays []domain.Play) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail {
+		return errors.New("db is down")
+	}
+	m.batches = append(m.batches, len(plays))
+	return nil
+}
+
+func (m *memStore) saved() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]int(nil), m.batches...)
+}
+
+func TestRecorderBatches(t *testing.T) {
+	store := &memStore{}
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	r := New(store, config.Plays{BatchSize: 3, FlushInterval: time.Hour, QueueSize: 10}, log)
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.Run(ctx)
+
+	for i := 0; i < 7; i++ {
+		require.NoError(t, r.Record(domain.Play{SongID: 1}))
+	}
+	require.Eventually(t, func() bool { return len(store.saved()) == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, []int{3, 3}, store.saved())
+
+	// при остановке остаток очереди дописывается
+	cancel()
+	r.Wait()
+	require.Equal(t, []int{3, 3, 1}, store.saved())
+}
+
+func TestRecorderRetriesAndQueueFull(t *testing.T) {
+	store := &memStore{fail: true}
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	r := New(store, config.Plays{BatchSize: 2, FlushInterval: 10 * time.Millisecond, QueueSize: 4}, log)
+
+	// Run ещё не запущен, очередь заполняется до QueueSize
+	for i := 0; i < 4; i++ {
+		require.NoError(t, r.Record(domain.Play{SongID: 1}))
+	}
+	require.ErrorIs(t, r.Record(domain.Play{SongID: 1}), domain.ErrPlayQueueFull)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.Run(ctx)
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, store.saved())
+
+	// бд поднялась: накопленное пишется по таймеру
+	store.mu.Lock()
+	store.fail = false
+	store.mu.Unlock()
+	require.Eventually(t, func() bool {
+		total := 0
+		for _, n := range store.saved() {
+			total += n
+		}
+		return total == 4
+	}, time.Second, time.Millisecond)
+	cancel()
+	r.Wait()
+}
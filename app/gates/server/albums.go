@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"mobileSongLibrary/domain"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// addToAlbum ставит только что добавленную песню в её альбом. Песня уже сохранена, поэтому ошибка только логируется
+func (s Server) addToAlbum(ctx context.Context, op string, song domain.Song) {
+	if song.Album == "" {
+		return
+	}
+	if err := s.db.AddSongToAlbum(ctx, song.GroupName, song.Album, song.SongName); err != nil {
+		s.log.Error(op, "failed to add song to album", err)
+	}
+}
+
+// albumID достаёт id альбома из пути
+func albumID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("album id must be a positive integer")
+	}
+	return id, nil
+}
+
+// albumVersion версия альбома из If-Match. Для альбомов заголовок не обязателен, без него изменение безусловное
+func (s Server) albumVersion(r *http.Request, id int64) (int, error) {
+	version, err := ifMatchVersion(r, func() (int, error) {
+		album, err := s.db.GetAlbum(r.Context(), id)
+		return album.Version, err
+	})
+	if errors.Is(err, errNoPrecondition) {
+		return 0, nil
+	}
+	return version, err
+}
+
+// writeAlbumError отвечает на ошибки операций над альбомами подходящим статусом
+func (s Server) writeAlbumError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrAlbumNotFound):
+		http.Error(w, "Album not found", http.StatusNotFound)
+		s.log.Debug(op, "album not found", err)
+	case errors.Is(err, domain.ErrAlbumConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+		s.log.Debug(op, "album conflict", err)
+	case errors.Is(err, domain.ErrSongNotFound):
+		http.Error(w, "Unknown track: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "unknown track", err)
+	case errors.Is(err, domain.ErrVersionMismatch):
+		http.Error(w, "Album was modified by someone else, reload it and try again", http.StatusPreconditionFailed)
+		s.log.Debug(op, "album version mismatch", err)
+	case errors.Is(err, errMalformedETag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "malformed If-Match", err)
+	default:
+		http.Error(w, "Failed to process album: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to process album", err)
+	}
+}
+
+func (s Server) writeAlbum(w http.ResponseWriter, status int, album domain.Album) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(album.Version))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(album)
+}
+
+// CreateAlbumHandler godoc
+//
+// @Summary      Создать альбом
+// @Description  Создаёт альбом группы (type: lp, ep, single, compilation) вместе с трек-листом. Песни трек-листа должны уже быть в библиотеке, по умолчанию они ищутся в группе альбома и стоят на первом диске
+// @Tags         Albums
+// @Accept       json
+// @Produce      json
+// @Param        album  body  domain.Album  true  "Альбом и трек-лист"
+// @Success      201     {object}  domain.Album
+// @Failure      400     {object}  string  "Некорректный запрос или песни нет в библиотеке"
+// @Failure      409     {object}  string  "У группы уже есть альбом с таким названием"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /albums [post]
+func (s Server) CreateAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.CreateAlbumHandler"
+
+	s.log.Info(op, "connected to CreateAlbumHandler", "trying to create album")
+	var album domain.Album
+	if err := json.NewDecoder(r.Body).Decode(&album); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode album", err)
+		return
+	}
+	defer r.Body.Close()
+	if err := album.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate album", err)
+		return
+	}
+
+	album, err := s.db.CreateAlbum(r.Context(), album)
+	if err != nil {
+		s.writeAlbumError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully created album", album.ID)
+	s.writeAlbum(w, http.StatusCreated, album)
+}
+
+// GetAlbumHandler godoc
+//
+// @Summary      Получить альбом
+// @Description  Возвращает альбом с трек-листом по порядку дисков и треков
+// @Tags         Albums
+// @Produce      json
+// @Param        id   path  int  true  "id альбома"
+// @Success      200     {object}  domain.Album
+// @Failure      400     {object}  string  "Некорректный id"
+// @Failure      404     {object}  string  "Альбом не найден"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /albums/{id} [get]
+func (s Server) GetAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetAlbumHandler"
+
+	s.log.Info(op, "connected to GetAlbumHandler", "trying to get album")
+	id, err := albumID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid album id", err)
+		return
+	}
+	album, err := s.db.GetAlbum(r.Context(), id)
+	if err != nil {
+		s.writeAlbumError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully retrieved album", id)
+	s.writeAlbum(w, http.StatusOK, album)
+}
+
+// UpdateAlbumHandler godoc
+//
+// @Summary      Изменить альбом
+// @Description  Меняет непустые поля альбома. Если передан tracks, трек-лист заменяется целиком (пустой массив очищает альбом). If-Match не обязателен, но если передан - проверяется
+// @Tags         Albums
+// @Accept       json
+// @Produce      json
+// @Param        id        path    int           true   "id альбома"
+// @Param        If-Match  header  string        false  "ETag альбома"
+// @Param        album     body    domain.Album  true   "Изменённые поля"
+// @Success      200     {object}  domain.Album
+// @Failure      400     {object}  string  "Некорректный запрос или песни нет в библиотеке"
+// @Failure      404     {object}  string  "Альбом не найден"
+// @Failure      409     {object}  string  "У группы уже есть альбом с таким названием"
+// @Failure      412     {object}  string  "Альбом уже был изменён кем-то другим"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /albums/{id} [patch]
+func (s Server) UpdateAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.UpdateAlbumHandler"
+
+	s.log.Info(op, "connected to UpdateAlbumHandler", "trying to update album")
+	id, err := albumID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid album id", err)
+		return
+	}
+	var patch domain.Album
+	if err = json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode album", err)
+		return
+	}
+	defer r.Body.Close()
+	patch.ID = id
+	if patch.Tracks != nil && patch.GroupName == "" {
+		// треки без группы ищутся в группе альбома
+		current, err := s.db.GetAlbum(r.Context(), id)
+		if err != nil {
+			s.writeAlbumError(w, op, err)
+			return
+		}
+		for i := range patch.Tracks {
+			if patch.Tracks[i].GroupName == "" {
+				patch.Tracks[i].GroupName = current.GroupName
+			}
+		}
+	}
+	if err = patch.ValidatePatch(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate album", err)
+		return
+	}
+	version, err := s.albumVersion(r, id)
+	if err != nil {
+		s.writeAlbumError(w, op, err)
+		return
+	}
+
+	album, err := s.db.UpdateAlbum(r.Context(), patch, version)
+	if err != nil {
+		s.writeAlbumError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully updated album", id)
+	s.writeAlbum(w, http.StatusOK, album)
+}
+
+// DeleteAlbumHandler godoc
+//
+// @Summary      Удалить альбом
+// @Description  Удаляет альбом, песни остаются в библиотеке. If-Match не обязателен, но если передан - проверяется
+// @Tags         Albums
+// @Param        id        path    int     true   "id альбома"
+// @Param        If-Match  header  string  false  "ETag альбома"
+// @Success      200     {string}  string  "Альбом удалён"
+// @Failure      400     {object}  string  "Некорректный id"
+// @Failure      404     {object}  string  "Альбом не найден"
+// @Failure      412     {object}  string  "Альбом уже был изменён кем-то другим"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /albums/{id} [delete]
+func (s Server) DeleteAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.DeleteAlbumHandler"
+
+	s.log.Info(op, "connected to DeleteAlbumHandler", "trying to delete album")
+	id, err := albumID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid album id", err)
+		return
+	}
+	version, err := s.albumVersion(r, id)
+	if err != nil {
+		s.writeAlbumError(w, op, err)
+		return
+	}
+	if err = s.db.DeleteAlbum(r.Context(), id, version); err != nil {
+		s.writeAlbumError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully deleted album", id)
+	w.WriteHeader(http.StatusOK)
+}
+
+// GroupAlbumsHandler godoc
+//
+// @Summary      Дискография группы
+// @Description  Возвращает альбомы группы по дате выхода вместе с трек-листами
+// @Tags         Albums
+// @Produce      json
+// @Param        name  path  string  true  "Название группы"
+// @Success      200     {array}   domain.Album
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /groups/{name}/albums [get]
+func (s Server) GroupAlbumsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GroupAlbumsHandler"
+
+	s.log.Info(op, "connected to GroupAlbumsHandler", "trying to get albums")
+	group := groupParam(r)
+	if group == "" {
+		http.Error(w, "Group name is required", http.StatusBadRequest)
+		s.log.Debug(op, "empty group name", "")
+		return
+	}
+	albums, err := s.db.GroupAlbums(r.Context(), group)
+	if err != nil {
+		http.Error(w, "Failed to retrieve albums: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve albums", err)
+		return
+	}
+	s.log.Info(op, "successfully retrieved albums", len(albums))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(albums)
+}
+
+// groupParam название группы из пути. "/" в названии (AC/DC) клиент передаёт как %2F
+func groupParam(r *http.Request) domain.GroupName {
+	name := chi.URLParam(r, "name")
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return domain.GroupName(name)
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/auth"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// auditCSVHeader колонки выгрузки журнала аудита в CSV
+var auditCSVHeader = []string{"id", "created_at", "user_id", "username", "action", "target", "request_id", "client_ip", "before", "after"}
+
+// withActor кладёт в контекст автора изменений для журнала аудита: пользователя из токена, id запроса и адрес клиента.
+// Id запроса возвращается клиенту в X-Request-Id, по нему запись в журнале находится через GET /admin/audit
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := domain.Actor{RequestID: middleware.GetReqID(r.Context()), ClientIP: r.RemoteAddr}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			actor.ClientIP = host
+		}
+		if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+			actor.UserID, actor.Username = principal.UserID, principal.Username
+		}
+		if actor.RequestID != "" {
+			w.Header().Set(middleware.RequestIDHeader, actor.RequestID)
+		}
+		next.ServeHTTP(w, r.WithContext(domain.WithActor(r.Context(), actor)))
+	})
+}
+
+// parseAuditFilter читает фильтр журнала аудита из query параметров
+func parseAuditFilter(r *http.Request) (domain.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := domain.AuditFilter{
+		Username:  query.Get("user"),
+		Target:    query.Get("target"),
+		RequestID: query.Get("request_id"),
+	}
+	if raw := query.Get("action"); raw != "" {
+		action, err := domain.ParseAuditAction(raw)
+		if err != nil {
+			return filter, err
+		}
+		filter.Action = action
+	}
+	for name, value := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be a RFC 3339 timestamp, e.g. 2026-10-19T00:00:00Z", name)
+		}
+		*value = t
+	}
+	return filter, nil
+}
+
+// GetAuditHandler godoc
+//
+// @Summary      Журнал аудита
+// @Description  Возвращает записи журнала аудита, новые первыми: кто, когда и откуда добавил, изменил, перенёс или удалил песню, переименовал, слил или удалил группу, с состоянием до и после.
+// @Description  Записи пишутся в одной транзакции с изменением и не меняются. В JSON по умолчанию отдаётся 50 записей, выгрузка в csv и ndjson без limit отдаёт все записи по фильтру
+// @Tags         Admin
+// @Produce      json
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Security     BearerAuth
+// @Param        user        query  string  false  "Логин автора"
+// @Param        action      query  string  false  "Действие: song.*, lyrics.*, group.*, album.*, playlist.*, user.*, apikey.* или webhook.*, например song.update или user.roles"
+// @Param        target      query  string  false  "Ключ объекта, song:<группа>/<песня> или group:<группа>, * на конце ищет по началу ключа"
+// @Param        request_id  query  string  false  "Id запроса из заголовка X-Request-Id"
+// @Param        from        query  string  false  "Не раньше, RFC 3339"
+// @Param        to          query  string  false  "Раньше, RFC 3339"
+// @Param        format      query  string  false  "json, csv или ndjson (по умолчанию json)"
+// @Param        limit       query  int     false  "Лимит выдачи"
+// @Param        offset      query  int     false  "Смещение выдачи"
+// @Success      200     {array}   domain.AuditEntry
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Нет права audit:read"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /admin/audit [get]
+func (s Server) GetAuditHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetAuditHandler"
+
+	s.log.Info(op, "connected to GetAuditHandler", "trying to get audit log")
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to parse filter", err)
+		return
+	}
+	filter.Limit, filter.Offset, err = queryPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid page", err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "json":
+		entries := []domain.AuditEntry{}
+		err = s.db.StreamAudit(r.Context(), filter, func(entry domain.AuditEntry) error {
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			http.Error(w, "Failed to retrieve audit log: "+err.Error(), http.StatusInternalServerError)
+			s.log.Error(op, "failed to retrieve audit log", err)
+			return
+		}
+		s.log.Info(op, "successfully retrieved audit entries", len(entries))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(entries)
+		return
+	case "csv", "ndjson":
+	default:
+		http.Error(w, "Unknown format, expected json, csv or ndjson", http.StatusBadRequest)
+		s.log.Debug(op, "unknown format", format)
+		return
+	}
+
+	if r.URL.Query().Get("limit") == "" { //выгрузка по умолчанию целиком
+		filter.Limit = 0
+	}
+	write, closeWriter := auditWriter(w, format)
+	exported := 0
+	err = s.db.StreamAudit(r.Context(), filter, func(entry domain.AuditEntry) error {
+		exported++
+		return write(entry)
+	})
+	if err == nil {
+		err = closeWriter()
+	}
+	if err != nil {
+		// Заголовки уже могли уйти клиенту, поменять статус нельзя, поэтому просто обрываем ответ
+		s.log.Error(op, "failed to export audit log", err)
+		if exported == 0 {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Failed to export audit log: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	s.log.Info(op, "successfully exported audit entries", exported)
+}
+
+// auditWriter ставит заголовки выгрузки и возвращает функцию, которая пишет одну запись в формате format,
+// и функцию, которая дописывает выгрузку после последней записи
+func auditWriter(w http.ResponseWriter, format string) (func(domain.AuditEntry) error, func() error) {
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.`+format+`"`)
+	if format == "ndjson" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		return func(entry domain.AuditEntry) error {
+			return encoder.Encode(entry)
+		}, func() error { return nil }
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(w)
+	header := false
+	writeHeader := func() error {
+		if header {
+			return nil
+		}
+		header = true
+		return writer.Write(auditCSVHeader)
+	}
+	write := func(entry domain.AuditEntry) error {
+		if err := writeHeader(); err != nil {
+			return err
+		}
+		userID := ""
+		if entry.UserID != nil {
+			userID = strconv.FormatInt(*entry.UserID, 10)
+		}
+		return writer.Write([]string{strconv.FormatInt(entry.ID, 10), entry.CreatedAt.Format(time.RFC3339Nano), userID, entry.Username,
+			string(entry.Action), entry.Target, entry.RequestID, entry.ClientIP, string(entry.Before), string(entry.After)})
+	}
+	closeWriter := func() error {
+		if err := writeHeader(); err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return write, closeWriter
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/auth"
+	"net/http"
+	"time"
+)
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// principal тот, кто выполняет запрос. Если его нет (аутентификация выключена), отвечает 401
+func (s Server) principal(w http.ResponseWriter, r *http.Request, op string) (domain.Principal, bool) {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mobileSongLibrary"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		s.log.Debug(op, "anonymous request", "")
+	}
+	return principal, ok
+}
+
+func (s Server) writeTokens(w http.ResponseWriter, op string, pair domain.TokenPair, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidCredentials), errors.Is(err, domain.ErrInvalidToken):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		s.log.Debug(op, "authentication failed", err)
+	case err != nil:
+		http.Error(w, "Failed to issue tokens: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to issue tokens", err)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(pair)
+	}
+}
+
+// LoginHandler godoc
+//
+// @Summary      Войти
+// @Description  Проверяет логин и пароль и выдаёт короткоживущий access токен (JWT) и refresh токен для его обновления
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        credentials  body  domain.Credentials  true  "Логин и пароль"
+// @Success      200     {object}  domain.TokenPair
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  string  "Неверный логин или пароль"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /auth/login [post]
+func (s Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.LoginHandler"
+
+	s.log.Info(op, "connected to LoginHandler", "trying to log in")
+	var creds domain.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode credentials", err)
+		return
+	}
+	defer r.Body.Close()
+
+	pair, err := s.auth.Login(r.Context(), creds)
+	if err == nil {
+		s.log.Info(op, "user logged in", creds.Username)
+	}
+	s.writeTokens(w, op, pair, err)
+}
+
+// RefreshHandler godoc
+//
+// @Summary      Обновить токены
+// @Description  Меняет refresh токен на новую пару токенов. Refresh токен одноразовый, повторное использование отзывает все токены пользователя
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        token  body  refreshRequest  true  "Refresh токен"
+// @Success      200     {object}  domain.TokenPair
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  string  "Токен недействителен"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /auth/refresh [post]
+func (s Server) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.RefreshHandler"
+
+	s.log.Info(op, "connected to RefreshHandler", "trying to refresh tokens")
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode refresh token", err)
+		return
+	}
+	defer r.Body.Close()
+
+	pair, err := s.auth.Refresh(r.Context(), req.RefreshToken)
+	s.writeTokens(w, op, pair, err)
+}
+
+// LogoutHandler godoc
+//
+// @Summary      Выйти
+// @Description  Отзывает refresh токен. Уже выданный access токен действует до конца своего срока
+// @Tags         Auth
+// @Accept       json
+// @Param        token  body  refreshRequest  true  "Refresh токен"
+// @Success      200     {string}  string  "Токен отозван"
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /auth/logout [post]
+func (s Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.LogoutHandler"
+
+	s.log.Info(op, "connected to LogoutHandler", "trying to log out")
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode refresh token", err)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := s.auth.Logout(r.Context(), req.RefreshToken); err != nil {
+		http.Error(w, "Failed to log out: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to log out", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// MeHandler godoc
+//
+// @Summary      Текущий пользователь
+// @Description  Возвращает, от чьего имени выполняется запрос и как он аутентифицирован (jwt или api_key) и с какими ролями
+// @Tags         Auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200     {object}  domain.Principal
+// @Failure      401     {object}  string  "Нет токена или API-ключа"
+// @Router       /auth/me [get]
+func (s Server) MeHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.MeHandler"
+
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	roles, err := s.db.UserRoles(r.Context(), principal.UserID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve roles: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve roles", err)
+		return
+	}
+	principal.Roles = roles
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(principal)
+}
+
+// CreateAPIKeyHandler godoc
+//
+// @Summary      Создать API-ключ
+// @Description  Создаёт долгоживущий API-ключ текущего пользователя для сервисных клиентов. Ключ возвращается только в этом ответе, передавать его нужно в заголовке X-API-Key. Создать ключ можно только войдя по паролю, не другим ключом
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        key  body  domain.APIKeyRequest  true  "Название и срок действия"
+// @Success      201     {object}  domain.APIKey
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  string  "Нет токена"
+// @Failure      403     {object}  string  "Запрос пришёл с API-ключом"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /auth/keys [post]
+func (s Server) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.CreateAPIKeyHandler"
+
+	s.log.Info(op, "connected to CreateAPIKeyHandler", "trying to create api key")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	if principal.Method != domain.AuthJWT {
+		http.Error(w, "API keys can only be created with a user token", http.StatusForbidden)
+		s.log.Debug(op, "api key used to create api key", principal.APIKeyID)
+		return
+	}
+	var req domain.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode api key", err)
+		return
+	}
+	defer r.Body.Close()
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate api key", err)
+		return
+	}
+
+	key, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		http.Error(w, "Failed to create api key: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to generate api key", err)
+		return
+	}
+	apiKey := domain.APIKey{Name: req.Name, Prefix: prefix, Key: key}
+	if req.ExpiresIn > 0 {
+		expires := time.Now().AddDate(0, 0, req.ExpiresIn)
+		apiKey.ExpiresAt = &expires
+	}
+	apiKey, err = s.db.CreateAPIKey(r.Context(), principal.UserID, apiKey, hash)
+	if err != nil {
+		http.Error(w, "Failed to create api key: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to create api key", err)
+		return
+	}
+	s.log.Info(op, "successfully created api key", apiKey.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(apiKey)
+}
+
+// GetAPIKeysHandler godoc
+//
+// @Summary      Список API-ключей
+// @Description  Возвращает действующие API-ключи текущего пользователя, без самих ключей
+// @Tags         Auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200     {array}   domain.APIKey
+// @Failure      401     {object}  string  "Нет токена или API-ключа"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /auth/keys [get]
+func (s Server) GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetAPIKeysHandler"
+
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	keys, err := s.db.GetAPIKeys(r.Context(), principal.UserID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve api keys: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve api keys", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+}
+
+// DeleteAPIKeyHandler godoc
+//
+// @Summary      Отозвать API-ключ
+// @Description  Отзывает API-ключ текущего пользователя, запросы с ним сразу перестают проходить
+// @Tags         Auth
+// @Security     BearerAuth
+// @Param        id   path  int  true  "id ключа"
+// @Success      200     {string}  string  "Ключ отозван"
+// @Failure      400     {object}  string  "Некорректный id"
+// @Failure      401     {object}  string  "Нет токена или API-ключа"
+// @Failure      404     {object}  string  "Ключ не найден"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /auth/keys/{id} [delete]
+func (s Server) DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.DeleteAPIKeyHandler"
+
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid api key id", err)
+		return
+	}
+	err = s.db.RevokeAPIKey(r.Context(), principal.UserID, id)
+	switch {
+	case errors.Is(err, domain.ErrAPIKeyNotFound):
+		http.Error(w, "API key not found", http.StatusNotFound)
+		s.log.Debug(op, "api key not found", err)
+	case err != nil:
+		http.Error(w, "Failed to revoke api key: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to revoke api key", err)
+	default:
+		s.log.Info(op, "successfully revoked api key", id)
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/storage"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Статусы песен в ответе пакетного добавления
+const (
+	batchCreated          = "created"
+	batchDuplicate        = "duplicate"
+	batchEnrichmentFailed = "enrichment_failed"
+	batchInvalid          = "invalid"
+	batchFailed           = "failed"
+)
+
+type batchItemResult struct {
+	Index     int              `json:"index"`
+	GroupName domain.GroupName `json:"group"`
+	SongName  domain.SongName  `json:"song"`
+	Status    string           `json:"status"`
+	Error     string           `json:"error,omitempty"`
+}
+
+type batchResult struct {
+	Items []batchItemResult `json:"items"`
+}
+
+// BatchAddSongsHandler godoc
+//
+// @Summary      Добавить много песен разом
+// @Description  Принимает массив песен {group, song}, обогащает их через внешний API параллельно и вставляет пачками, по транзакции на пачку. Для каждой песни возвращается статус: created, duplicate, enrichment_failed, invalid или failed (пачку не удалось записать, песня не добавлена и её можно отправить повторно)
+// @Tags         Songs
+// @Accept       json
+// @Produce      json
+// @Param        songs  body  []domain.SongRef  true  "Песни для добавления"
+// @Success      200     {object}  batchResult
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      413     {object}  string  "Слишком много песен или слишком большое тело запроса"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /songs:batch [post]
+func (s Server) BatchAddSongsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.BatchAddSongsHandler"
+
+	s.log.Info(op, "connected to BatchAddSongsHandler", "trying to add songs")
+	var items []domain.Song
+	if s.cfg.Batch.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.cfg.Batch.MaxBodyBytes)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body is too large, max is "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes", http.StatusRequestEntityTooLarge)
+			s.log.Debug(op, "request body is too large", err)
+			return
+		}
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Error(op, "failed to decode songs", err)
+		return
+	}
+	defer r.Body.Close()
+	if len(items) > s.cfg.Batch.MaxItems {
+		http.Error(w, "Too many songs, max is "+strconv.Itoa(s.cfg.Batch.MaxItems), http.StatusRequestEntityTooLarge)
+		s.log.Debug(op, "too many songs", len(items))
+		return
+	}
+
+	results := make([]batchItemResult, len(items))
+	seen := make(map[[2]string]bool, len(items))
+	var pending []int // индексы песен, которые нужно обогатить и вставить
+	for i, song := range items {
+		results[i] = batchItemResult{Index: i, GroupName: song.GroupName, SongName: song.SongName}
+		if err := song.Validate(); err != nil {
+			results[i].Status, results[i].Error = batchInvalid, err.Error()
+			continue
+		}
+		key := [2]string{domain.NormalizeKey(string(song.GroupName)), domain.NormalizeKey(string(song.SongName))}
+		if seen[key] {
+			results[i].Status, results[i].Error = batchDuplicate, "song is repeated in the batch"
+			continue
+		}
+		seen[key] = true
+		pending = append(pending, i)
+	}
+
+	s.enrichAll(r, items, pending, results)
+
+	// Вставляем обогащённые песни пачками, по транзакции на пачку. Уже записанные пачки не откатываются,
+	// поэтому ошибка пачки не обрывает запрос: её песни получают статус failed, остальные пишутся дальше
+	var ready []int
+	for _, i := range pending {
+		if results[i].Status == "" {
+			ready = append(ready, i)
+		}
+	}
+	chunkSize := max(s.cfg.Batch.ChunkSize, 1)
+	for start := 0; start < len(ready); start += chunkSize {
+		chunk := ready[start:min(start+chunkSize, len(ready))]
+		songs := make([]storage.Song, len(chunk))
+		for j, i := range chunk {
+			songs[j] = storage.ToStorage(items[i])
+		}
+		created, err := s.db.AddSongs(r.Context(), songs)
+		if err != nil {
+			s.log.Error(op, "failed to add songs", err)
+			for _, i := range chunk {
+				results[i].Status, results[i].Error = batchFailed, "failed to add songs"
+			}
+			continue
+		}
+		for j, i := range chunk {
+			results[i].Status = batchDuplicate
+			if created[j] {
+				results[i].Status = batchCreated
+				s.addToAlbum(r.Context(), op, items[i])
+			}
+		}
+	}
+
+	s.log.Info(op, "successfully added songs", len(ready))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(batchResult{Items: results})
+}
+
+// enrichAll обогащает песни items[pending] не более чем в cfg.Batch.Workers потоков.
+// Песни, которые не удалось обогатить, получают статус enrichment_failed
+func (s Server) enrichAll(r *http.Request, items []domain.Song, pending []int, results []batchItemResult) {
+	const op = "gates.Server.enrichAll"
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < max(s.cfg.Batch.Workers, 1); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				song, err := s.enricher.Enrich(r.Context(), items[i])
+				if err != nil {
+					s.log.Debug(op, "failed to enrich song", err)
+					results[i].Status, results[i].Error = batchEnrichmentFailed, err.Error()
+					continue
+				}
+				items[i] = song
+			}
+		}()
+	}
+	for _, i := range pending {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
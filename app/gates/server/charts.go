@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"net/http"
+	"strconv"
+)
+
+// defaultChartSize сколько мест чарта отдаётся, если limit не задан
+const defaultChartSize = 50
+
+// GetChartHandler godoc
+//
+// @Summary      Чарт
+// @Description  Возвращает самые популярные песни за период по прослушиваниям и добавлениям в избранное. Вес события падает вдвое за четверть периода, добавление в избранное весит как 3 прослушивания.
+// @Description  Чарт берётся из последнего снимка, который фоновая задача пересчитывает раз в charts.refresh_interval. Места считаются внутри фильтра по группе и жанру, rank_change - изменение места относительно предыдущего снимка
+// @Tags         Charts
+// @Produce      json
+// @Security     BearerAuth
+// @Param        window  query  string  false  "day, week или month, по умолчанию week"
+// @Param        group   query  string  false  "Только песни группы"
+// @Param        genre   query  string  false  "Только песни с тегом genre:<genre>"
+// @Param        limit   query  int     false  "Сколько мест вернуть, по умолчанию 50"
+// @Success      200     {object}  domain.Chart
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      503     {object}  string  "Чарт ещё не посчитан"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /charts [get]
+func (s Server) GetChartHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetChartHandler"
+
+	s.log.Info(op, "connected to GetChartHandler", "trying to get chart")
+	window, err := domain.ParseChartWindow(r.URL.Query().Get("window"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid window", err)
+		return
+	}
+	query := domain.ChartQuery{Window: window, Group: r.URL.Query().Get("group"), Genre: r.URL.Query().Get("genre"), Limit: defaultChartSize}
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if query.Limit, err = strconv.Atoi(raw); err != nil || query.Limit < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			s.log.Debug(op, "invalid limit", raw)
+			return
+		}
+	}
+
+	chart, err := s.db.GetChart(r.Context(), query)
+	switch {
+	case errors.Is(err, domain.ErrChartNotReady):
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		s.log.Debug(op, "chart is not ready", window)
+	case errors.Is(err, domain.ErrInvalidTag):
+		http.Error(w, "Invalid genre: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid genre", err)
+	case err != nil:
+		http.Error(w, "Failed to retrieve chart: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve chart", err)
+	default:
+		s.log.Info(op, "successfully retrieved chart", window)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(chart)
+	}
+}
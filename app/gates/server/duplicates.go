@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"net/http"
+	"strconv"
+)
+
+type duplicatesReport struct {
+	Groups []domain.DuplicateGroup `json:"groups"`
+}
+
+// GetDuplicatesHandler godoc
+//
+// @Summary      Отчёт о возможных дублях
+// @Description  Группирует песни, которые скорее всего являются одной песней: одинаковое или отличающееся опечаткой название одной группы без пометок издания ((Remastered 2011), - Live), одинаковая ссылка, одинаковый или почти одинаковый текст. Каждой группе выставляется оценка от 0 до 1, песни в отчёте приходят без текста
+// @Tags         Library
+// @Produce      json
+// @Param        min_score  query  number  false  "Минимальная оценка группы (по умолчанию 0)"
+// @Param        limit      query  int     false  "Максимальное количество групп"
+// @Success      200     {object}  duplicatesReport
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /library/duplicates [get]
+func (s Server) GetDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetDuplicatesHandler"
+
+	s.log.Info(op, "connected to GetDuplicatesHandler", "trying to find duplicates")
+	query := r.URL.Query()
+	var minScore float64
+	if v := query.Get("min_score"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, "Invalid min_score: "+err.Error(), http.StatusBadRequest)
+			s.log.Debug(op, "invalid min_score", err)
+			return
+		}
+		minScore = parsed
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			s.log.Debug(op, "invalid limit", err)
+			return
+		}
+		limit = parsed
+	}
+
+	// Библиотека читается курсором, в памяти остаются только ключи и шинглы текстов, а не сами песни
+	finder := domain.NewDuplicateFinder()
+	err := s.db.StreamLibrary(r.Context(), domain.SongFilter{}, func(song domain.Song) error {
+		finder.Add(song)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Failed to retrieve library: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve library", err)
+		return
+	}
+
+	report := duplicatesReport{Groups: []domain.DuplicateGroup{}}
+	for _, group := range finder.Groups() {
+		if group.Score < minScore || limit > 0 && len(report.Groups) == limit {
+			break
+		}
+		report.Groups = append(report.Groups, group)
+	}
+
+	s.log.Info(op, "successfully found duplicates", len(report.Groups))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// MergeDuplicatesHandler godoc
+//
+// @Summary      Слить пару дублей
+// @Description  Сливает песню drop в песню keep: пустые поля keep заполняются данными drop, после чего drop удаляется. Текст и LRC берутся вместе с одной стороны: у drop только если у keep нет ни того, ни другого
+// @Tags         Library
+// @Accept       json
+// @Produce      json
+// @Param        pair  body  domain.SongPair  true  "Какую песню оставить и какую слить в неё"
+// @Success      200     {object}  domain.Song
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /library/duplicates/merge [post]
+func (s Server) MergeDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.MergeDuplicatesHandler"
+
+	s.log.Info(op, "connected to MergeDuplicatesHandler", "trying to merge duplicates")
+	var pair domain.SongPair
+	if err := json.NewDecoder(r.Body).Decode(&pair); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Error(op, "failed to decode song pair", err)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := pair.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Error(op, "failed to validate song pair", err)
+		return
+	}
+
+	song, err := s.db.MergeSongs(r.Context(), pair)
+	if errors.Is(err, domain.ErrSongNotFound) {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to merge songs: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to merge songs", err)
+		return
+	}
+
+	s.log.Info(op, "successfully merged songs", song.SongName)
+	w.Header().Set("ETag", formatETag(song.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(song)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"mobileSongLibrary/domain"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errNoPrecondition = errors.New("If-Match header is required")
+var errMalformedETag = errors.New("malformed ETag")
+
+// formatETag превращает версию песни в строгий ETag вида "3"
+func formatETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// variantETag строит ETag для ответа, который зависит не только от версии, но и от параметров запроса
+// (страница, язык...): "3-p1-s2-en". Версия всегда стоит первой, поэтому такой тег подходит и для If-Match
+func variantETag(version int, variant ...string) string {
+	return `"` + strings.Join(append([]string{strconv.Itoa(version)}, variant...), "-") + `"`
+}
+
+// entityTag один тег из If-Match / If-None-Match
+type entityTag struct {
+	opaque  string // значение без кавычек
+	weak    bool   // W/"3"
+	version int    // версия из начала значения
+}
+
+// parseETags разбирает список ETag из If-Match / If-None-Match.
+// any = true если клиент прислал "*". Теги должны быть в кавычках и начинаться с версии
+func parseETags(header string) (tags []entityTag, any bool, err error) {
+	for _, raw := range strings.Split(header, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if raw == "*" {
+			any = true
+			continue
+		}
+		var tag entityTag
+		value := raw
+		if strings.HasPrefix(value, "W/") {
+			tag.weak = true
+			value = value[len("W/"):]
+		}
+		if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' || strings.Contains(value[1:len(value)-1], `"`) {
+			return nil, false, fmt.Errorf("%w: %s", errMalformedETag, raw)
+		}
+		tag.opaque = value[1 : len(value)-1]
+		version, _, _ := strings.Cut(tag.opaque, "-")
+		if tag.version, err = strconv.Atoi(version); err != nil {
+			return nil, false, fmt.Errorf("%w: %s", errMalformedETag, raw)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, any, nil
+}
+
+// etagMatches проверяет подходит ли текущий ETag ответа под заголовок If-None-Match.
+// Для If-None-Match сравнение слабое: W/"3" совпадает с "3"
+func etagMatches(header string, etag string) bool {
+	tags, any, err := parseETags(header)
+	if err != nil {
+		return false
+	}
+	if any {
+		return true
+	}
+	for _, tag := range tags {
+		if tag.opaque == strings.Trim(etag, `"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion достаёт из If-Match ожидаемую версию песни.
+// 0 означает "*" - подойдёт любая существующая версия.
+// Сравнение строгое: слабые теги (W/"3") не совпадают ни с чем, как требует RFC 9110.
+// Если клиент перечислил несколько тегов, current вызывается чтобы узнать какая версия сейчас в бд
+func ifMatchVersion(r *http.Request, current func() (int, error)) (int, error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, errNoPrecondition
+	}
+	tags, any, err := parseETags(header)
+	if err != nil {
+		return 0, err
+	}
+	if any {
+		return 0, nil
+	}
+	versions := make([]int, 0, len(tags))
+	for _, tag := range tags {
+		if !tag.weak {
+			versions = append(versions, tag.version)
+		}
+	}
+	switch len(versions) {
+	case 0:
+		return 0, domain.ErrVersionMismatch //прислали только слабые теги
+	case 1:
+		return versions[0], nil
+	}
+	version, err := current()
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range versions {
+		if v == version {
+			return version, nil
+		}
+	}
+	return 0, domain.ErrVersionMismatch //ни один тег не подошёл
+}
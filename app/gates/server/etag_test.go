@@ -0,0 +1,103 @@
+package server
+
+import (
+	"github.com/stretchr/testify/require"
+	"mobileSongLibrary/domain"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseETags(t *testing.T) {
+	tests := []struct {
+		header   string
+		versions []int
+		weak     []bool
+		any      bool
+		err      bool
+	}{
+		{header: `"3"`, versions: []int{3}, weak: []bool{false}},
+		{header: `W/"3"`, versions: []int{3}, weak: []bool{true}},
+		{header: `"3-p1-s2-en"`, versions: []int{3}, weak: []bool{false}},
+		{header: `"1", W/"2" , "3"`, versions: []int{1, 2, 3}, weak: []bool{false, true, false}},
+		{header: `*`, any: true},
+		{header: `"1", *`, versions: []int{1}, weak: []bool{false}, any: true},
+		{header: `3`, err: true},
+		{header: `"3`, err: true},
+		{header: `"`, err: true},
+		{header: `"a"`, err: true},
+		{header: `""`, err: true},
+		{header: `"3"4"`, err: true},
+		{header: `w/"3"`, err: true},
+		{header: `"1", abc`, err: true},
+	}
+	for _, tt := range tests {
+		tags, any, err := parseETags(tt.header)
+		if tt.err {
+			require.ErrorIs(t, err, errMalformedETag, tt.header)
+			continue
+		}
+		require.NoError(t, err, tt.header)
+		require.Equal(t, tt.any, any, tt.header)
+		require.Len(t, tags, len(tt.versions), tt.header)
+		for i, tag := range tags {
+			require.Equal(t, tt.versions[i], tag.version, tt.header)
+			require.Equal(t, tt.weak[i], tag.weak, tt.header)
+		}
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		match  bool
+	}{
+		{header: `"3"`, etag: `"3"`, match: true},
+		{header: `W/"3"`, etag: `"3"`, match: true}, //If-None-Match сравнивает слабо
+		{header: `"2", "3"`, etag: `"3"`, match: true},
+		{header: `*`, etag: `"3"`, match: true},
+		{header: `"2"`, etag: `"3"`, match: false},
+		{header: `"3"`, etag: `"3-p1-s2-en"`, match: false}, //другая страница или язык
+		{header: `"3-p1-s2-de"`, etag: `"3-p1-s2-en"`, match: false},
+		{header: `"3-p1-s2-en"`, etag: `"3-p1-s2-en"`, match: true},
+		{header: `3`, etag: `"3"`, match: false},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.match, etagMatches(tt.header, tt.etag), tt.header+" vs "+tt.etag)
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	current := func() (int, error) { return 3, nil }
+	tests := []struct {
+		header  string
+		version int
+		err     error
+	}{
+		{header: "", err: errNoPrecondition},
+		{header: `*`, version: 0},
+		{header: `"3"`, version: 3},
+		{header: `"2"`, version: 2}, //одну версию сверяет бд при записи
+		{header: `"3-p1-s2-en"`, version: 3},
+		{header: `W/"3"`, err: domain.ErrVersionMismatch}, //If-Match сравнивает строго
+		{header: `W/"3", "2"`, version: 2},
+		{header: `"2", "3"`, version: 3},
+		{header: `"1", "2"`, err: domain.ErrVersionMismatch},
+		{header: `"2", W/"3"`, version: 2},
+		{header: `abc`, err: errMalformedETag},
+		{header: `"3", W/abc`, err: errMalformedETag},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("PATCH", "/song", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+		version, err := ifMatchVersion(r, current)
+		if tt.err != nil {
+			require.ErrorIs(t, err, tt.err, tt.header)
+			continue
+		}
+		require.NoError(t, err, tt.header)
+		require.Equal(t, tt.version, version, tt.header)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"errors"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/events"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventStreamRetry через сколько миллисекунд EventSource переподключается после обрыва
+const eventStreamRetry = 3000
+
+// lastEventID id последнего полученного события из Last-Event-ID или параметра last_event_id. false - клиент подключается впервые
+func lastEventID(r *http.Request) (int64, bool, error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, errors.New("Last-Event-ID must be a non-negative integer")
+	}
+	return id, true, nil
+}
+
+// EventsHandler godoc
+//
+// @Summary      Поток изменений библиотеки
+// @Description  Server-Sent Events: каждое добавление, изменение, перенос и удаление песни, переименование, слияние и удаление группы приходит событием с id, типом (song.create, group.rename, ...) и JSON как в outbox. Параметр group (можно несколько раз) оставляет события только этих групп, перенос и переименование приходят обеим группам. После обрыва клиент переподключается с Last-Event-ID (или last_event_id) и получает пропущенные события из журнала. Если журнал их уже не хранит, приходит событие reset и клиенту нужно перечитать /library. Каждые events.heartbeat приходит комментарий ": ping". Клиент, который не успевает принимать события, отключается и должен переподключиться с Last-Event-ID
+// @Tags         Events
+// @Produce      text/event-stream
+// @Security     BearerAuth
+// @Param        group          query   []string  false  "Фильтр по группам"  collectionFormat(multi)
+// @Param        last_event_id  query   int       false  "id последнего полученного события, если нельзя передать заголовок"
+// @Param        Last-Event-ID  header  int       false  "id последнего полученного события"
+// @Success      200     {string}  string  "Поток событий"
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Нет права library:read"
+// @Failure      503     {object}  string  "Поток ещё не готов, повторите позже"
+// @Router       /events [get]
+func (s Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.EventsHandler"
+
+	afterID, resume, err := lastEventID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid last event id", err)
+		return
+	}
+	var groups []domain.GroupName
+	for _, group := range r.URL.Query()["group"] {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, domain.GroupName(group))
+		}
+	}
+	sub, cursor, err := s.events.Subscribe(groups)
+	if err != nil {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Event stream is not ready, try again later", http.StatusServiceUnavailable)
+		s.log.Debug(op, "event stream is not ready", err)
+		return
+	}
+	defer sub.Close()
+	s.log.Info(op, "client subscribed to events", r.URL.RawQuery)
+
+	rc := http.NewResponseController(w)
+	defer rc.SetWriteDeadline(time.Time{})
+	// write отправляет кусок потока сразу. Клиент, который не принял его за write_timeout, отключается
+	write := func(chunk []byte) error {
+		if s.cfg.Events.WriteTimeout > 0 {
+			if err := rc.SetWriteDeadline(time.Now().Add(s.cfg.Events.WriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	send := func(event domain.Event) error {
+		chunk, err := events.Format(event)
+		if err != nil {
+			return err
+		}
+		return write(chunk)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") //чтобы nginx не копил поток в буфере
+	w.WriteHeader(http.StatusOK)
+	if err = write([]byte("retry: " + strconv.Itoa(eventStreamRetry) + "\n\n")); err != nil {
+		s.log.Debug(op, "client went away", err)
+		return
+	}
+
+	if resume {
+		err = s.events.Replay(r.Context(), sub, afterID, cursor, send)
+		switch {
+		case errors.Is(err, events.ErrLogExpired):
+			s.log.Debug(op, "last event id is no longer retained", afterID)
+			err = write([]byte("event: reset\ndata: {}\n\n"))
+		case err != nil && r.Context().Err() == nil:
+			s.log.Error(op, "failed to replay events", err)
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+	// события до cursor уже отданы из журнала, клиент, который пришёл с id больше cursor, видел и их
+	lastSent := max(cursor, afterID)
+
+	heartbeat := s.cfg.Events.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				if sub.Dropped() {
+					s.log.Info(op, "dropped slow client", lastSent)
+				}
+				return
+			}
+			if event.ID <= lastSent {
+				continue
+			}
+			if err = send(event); err != nil {
+				s.log.Debug(op, "client went away", err)
+				return
+			}
+			lastSent = event.ID
+		case <-ticker.C:
+			if err = write([]byte(": ping\n\n")); err != nil {
+				s.log.Debug(op, "client went away", err)
+				return
+			}
+		}
+	}
+}
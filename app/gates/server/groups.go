@@ -0,0 +1,303 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"net/http"
+	"strconv"
+)
+
+// MergeGroupsHandler godoc
+//
+// @Summary      Слить две группы
+// @Description  Переносит все песни группы source в группу target. Одноимённые песни разрешаются стратегией strategy (keep-target, keep-source, keep-newest), для отдельных песен её можно переопределить в overrides
+// @Tags         Groups
+// @Accept       json
+// @Produce      json
+// @Param        merge  body  domain.GroupMerge  true  "Какую группу и куда сливать"
+// @Success      200     {object}  domain.MergeResult
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Группа source не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /groups/merge [post]
+func (s Server) MergeGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.MergeGroupsHandler"
+
+	s.log.Info(op, "connected to MergeGroupsHandler", "trying to merge groups")
+	var merge domain.GroupMerge
+	if err := json.NewDecoder(r.Body).Decode(&merge); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Error(op, "failed to decode merge", err)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := merge.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Error(op, "failed to validate merge", err)
+		return
+	}
+
+	result, err := s.db.MergeGroups(r.Context(), merge)
+	if err != nil {
+		s.writeGroupError(w, op, err)
+		return
+	}
+
+	s.log.Info(op, "successfully merged groups", merge.Target, "moved", result.Moved)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeGroupError отвечает на ошибки операций над группами подходящим статусом
+func (s Server) writeGroupError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrGroupNotFound):
+		http.Error(w, "Group not found", http.StatusNotFound)
+		s.log.Debug(op, "group not found", err)
+	case errors.Is(err, domain.ErrGroupConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+		s.log.Debug(op, "group conflict", err)
+	case errors.Is(err, domain.ErrGroupExists):
+		http.Error(w, "Group profile already exists", http.StatusConflict)
+		s.log.Debug(op, "group exists", err)
+	case errors.Is(err, domain.ErrGroupNotEmpty):
+		http.Error(w, "Group still has songs, delete them first or use mode=cascade", http.StatusConflict)
+		s.log.Debug(op, "group not empty", err)
+	case errors.Is(err, domain.ErrVersionMismatch):
+		http.Error(w, "Group was modified by someone else, reload it and try again", http.StatusPreconditionFailed)
+		s.log.Debug(op, "group version mismatch", err)
+	case errors.Is(err, errMalformedETag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "malformed If-Match", err)
+	default:
+		http.Error(w, "Failed to modify group: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to modify group", err)
+	}
+}
+
+// GetGroupsHandler godoc
+//
+// @Summary      Список групп
+// @Description  Возвращает группы по алфавиту с карточкой, количеством песен и альбомов, годом первого и последнего релиза. Общее количество найденных групп отдаётся в заголовке X-Total-Count
+// @Tags         Groups
+// @Produce      json
+// @Param        q       query  string  false  "Часть названия группы"
+// @Param        limit   query  int     false  "Сколько групп вернуть"
+// @Param        offset  query  int     false  "Сколько групп пропустить"
+// @Success      200     {array}   domain.Group
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /groups [get]
+func (s Server) GetGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetGroupsHandler"
+
+	s.log.Info(op, "connected to GetGroupsHandler", "trying to get groups")
+	filter := domain.GroupFilter{Query: r.URL.Query().Get("q")}
+	for name, value := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, name+" must be a non-negative integer", http.StatusBadRequest)
+			s.log.Debug(op, "invalid pagination", raw)
+			return
+		}
+		*value = n
+	}
+
+	groups, total, err := s.db.GetGroups(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Failed to retrieve groups: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve groups", err)
+		return
+	}
+	s.log.Info(op, "successfully retrieved groups", len(groups))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(groups)
+}
+
+// GetGroupHandler godoc
+//
+// @Summary      Карточка группы
+// @Description  Возвращает карточку группы (страна, год основания, жанры, участники, описание) и сводку по её песням и альбомам
+// @Tags         Groups
+// @Produce      json
+// @Param        name  path  string  true  "Название группы"
+// @Success      200     {object}  domain.Group
+// @Failure      404     {object}  string  "Группа не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /groups/{name} [get]
+func (s Server) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetGroupHandler"
+
+	s.log.Info(op, "connected to GetGroupHandler", "trying to get group")
+	group, err := s.db.GetGroup(r.Context(), groupParam(r))
+	if err != nil {
+		s.writeGroupError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully retrieved group", group.Name)
+	s.writeGroup(w, http.StatusOK, group)
+}
+
+// CreateGroupHandler godoc
+//
+// @Summary      Создать карточку группы
+// @Description  Создаёт карточку группы. Песен у группы может ещё не быть
+// @Tags         Groups
+// @Accept       json
+// @Produce      json
+// @Param        group  body  domain.GroupProfile  true  "Карточка группы"
+// @Success      201     {object}  domain.Group
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      409     {object}  string  "Карточка группы уже есть"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /groups [post]
+func (s Server) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.CreateGroupHandler"
+
+	s.log.Info(op, "connected to CreateGroupHandler", "trying to create group")
+	var profile domain.GroupProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode group", err)
+		return
+	}
+	defer r.Body.Close()
+	if err := profile.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate group", err)
+		return
+	}
+
+	if err := s.db.CreateGroup(r.Context(), profile); err != nil {
+		s.writeGroupError(w, op, err)
+		return
+	}
+	group, err := s.db.GetGroup(r.Context(), profile.Name)
+	if err != nil {
+		s.writeGroupError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully created group", group.Name)
+	s.writeGroup(w, http.StatusCreated, group)
+}
+
+// UpdateGroupHandler godoc
+//
+// @Summary      Изменить карточку группы
+// @Description  Меняет непустые поля карточки, пустой массив genres или members очищает его. Название меняется через /renamegroup. Если карточки ещё нет, а песни у группы есть, карточка создаётся. If-Match не обязателен, но если передан - проверяется
+// @Tags         Groups
+// @Accept       json
+// @Produce      json
+// @Param        name      path    string               true   "Название группы"
+// @Param        If-Match  header  string               false  "ETag карточки"
+// @Param        group     body    domain.GroupProfile  true   "Изменяемые поля карточки"
+// @Success      200     {object}  domain.Group
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Группа не найдена"
+// @Failure      412     {object}  string  "Карточка уже была изменена кем-то другим"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /groups/{name} [patch]
+func (s Server) UpdateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.UpdateGroupHandler"
+
+	s.log.Info(op, "connected to UpdateGroupHandler", "trying to update group")
+	name := groupParam(r)
+	var patch domain.GroupProfile
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode group", err)
+		return
+	}
+	defer r.Body.Close()
+	if err := patch.ValidatePatch(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate group", err)
+		return
+	}
+	version, err := s.groupVersion(r, name)
+	if err != nil {
+		s.writeGroupError(w, op, err)
+		return
+	}
+
+	if err = s.db.UpdateGroup(r.Context(), name, patch, version); err != nil {
+		s.writeGroupError(w, op, err)
+		return
+	}
+	group, err := s.db.GetGroup(r.Context(), name)
+	if err != nil {
+		s.writeGroupError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully updated group", group.Name)
+	s.writeGroup(w, http.StatusOK, group)
+}
+
+// DeleteGroupHandler godoc
+//
+// @Summary      Удалить группу
+// @Description  Удаляет карточку группы. С mode=refuse (по умолчанию) группа с песнями не удаляется, с mode=cascade удаляются и все её песни и альбомы
+// @Tags         Groups
+// @Produce      json
+// @Param        name  path   string  true   "Название группы"
+// @Param        mode  query  string  false  "refuse или cascade"
+// @Success      200     {object}  map[string]int  "Сколько песен удалено"
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Группа не найдена"
+// @Failure      409     {object}  string  "У группы есть песни"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /groups/{name} [delete]
+func (s Server) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.DeleteGroupHandler"
+
+	s.log.Info(op, "connected to DeleteGroupHandler", "trying to delete group")
+	mode := domain.GroupDeleteMode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = domain.DeleteRefuse
+	}
+	if err := mode.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid delete mode", err)
+		return
+	}
+
+	deleted, err := s.db.DeleteGroup(r.Context(), groupParam(r), mode)
+	if err != nil {
+		s.writeGroupError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully deleted group", groupParam(r), "songs deleted", deleted)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int{"deleted_songs": deleted})
+}
+
+// groupVersion версия карточки из If-Match. Заголовок не обязателен, без него изменение безусловное
+func (s Server) groupVersion(r *http.Request, name domain.GroupName) (int, error) {
+	version, err := ifMatchVersion(r, func() (int, error) {
+		group, err := s.db.GetGroup(r.Context(), name)
+		return group.Version, err
+	})
+	if errors.Is(err, errNoPrecondition) {
+		return 0, nil
+	}
+	return version, err
+}
+
+func (s Server) writeGroup(w http.ResponseWriter, status int, group domain.Group) {
+	w.Header().Set("Content-Type", "application/json")
+	if group.Version > 0 {
+		w.Header().Set("ETag", formatETag(group.Version))
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(group)
+}
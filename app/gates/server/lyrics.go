@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"net/http"
+)
+
+// songLyrics ответ GET /song/lyrics?format=json
+type songLyrics struct {
+	GroupName domain.GroupName `json:"group"`
+	SongName  domain.SongName  `json:"song"`
+	domain.LRC
+}
+
+// GetLyricsHandler godoc
+//
+// @Summary      Синхронизированный текст песни
+// @Description  Отдаёт текст песни с метками времени для режима караоке: исходный LRC или JSON, где у каждой строки есть время начала в миллисекундах (offset уже учтён)
+// @Tags         Songs
+// @Produce      json
+// @Produce      text/plain
+// @Param        group          header  string  true   "Название группы (или query параметр group)"
+// @Param        song           header  string  true   "Название песни (или query параметр song)"
+// @Param        format         query   string  false  "lrc или json (по умолчанию json)"
+// @Param        If-None-Match  header  string  false  "ETag уже имеющейся у клиента версии"
+// @Success      200     {object}  songLyrics
+// @Success      304     {string}  string  "Песня не изменилась"
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена или у неё нет синхронизированного текста"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /song/lyrics [get]
+func (s Server) GetLyricsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetLyricsHandler"
+
+	s.log.Info(op, "connected to GetLyricsHandler", "trying to get lyrics")
+	filter, err := parseSongFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to parse request", err)
+		return
+	}
+	song := domain.Song{GroupName: domain.GroupName(filter.GroupName), SongName: domain.SongName(filter.SongName)}
+	if err = song.Validate(); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate song", err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "lrc" && format != "json" {
+		http.Error(w, "Unknown format, expected lrc or json", http.StatusBadRequest)
+		s.log.Debug(op, "unknown format", format)
+		return
+	}
+
+	song, err = s.db.GetSong(song.GroupName, song.SongName)
+	if errors.Is(err, domain.ErrSongNotFound) {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve song: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve song", err)
+		return
+	}
+	if song.LRC == "" {
+		http.Error(w, "Song has no synchronized lyrics", http.StatusNotFound)
+		s.log.Debug(op, "song has no lrc", song.SongName)
+		return
+	}
+
+	w.Header().Set("Vary", "group, song")
+	w.Header().Set("ETag", formatETag(song.Version))
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, formatETag(song.Version)) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if format == "lrc" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(song.LRC))
+		s.log.Info(op, "successfully retrieved lrc", song.SongName)
+		return
+	}
+	// В бд попадает только проверенный LRC, поэтому ошибка здесь значит испорченные данные
+	lrc, err := domain.ParseLRC(song.LRC)
+	if err != nil {
+		http.Error(w, "Stored lyrics are corrupted: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to parse stored lrc", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(songLyrics{GroupName: song.GroupName, SongName: song.SongName, LRC: lrc})
+	s.log.Info(op, "successfully retrieved lyrics", song.SongName)
+}
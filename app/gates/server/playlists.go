@@ -0,0 +1,475 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/formats"
+	"net/http"
+	"strconv"
+)
+
+// pathID положительное число из параметра пути name
+func pathID(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New(name + " must be a positive integer")
+	}
+	return id, nil
+}
+
+// playlistVersion версия плейлиста из If-Match. Заголовок не обязателен, без него изменение безусловное
+func (s Server) playlistVersion(r *http.Request, userID int64, id int64) (int, error) {
+	version, err := ifMatchVersion(r, func() (int, error) {
+		playlist, err := s.db.GetPlaylist(r.Context(), userID, id)
+		return playlist.Version, err
+	})
+	if errors.Is(err, errNoPrecondition) {
+		return 0, nil
+	}
+	return version, err
+}
+
+// writePlaylistError отвечает на ошибки операций над плейлистами подходящим статусом
+func (s Server) writePlaylistError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrPlaylistNotFound):
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		s.log.Debug(op, "playlist not found", err)
+	case errors.Is(err, domain.ErrPlaylistItemNotFound):
+		http.Error(w, "Playlist item not found", http.StatusNotFound)
+		s.log.Debug(op, "playlist item not found", err)
+	case errors.Is(err, domain.ErrSongNotFound):
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+	case errors.Is(err, domain.ErrVersionMismatch):
+		http.Error(w, "Playlist was modified by someone else, reload it and try again", http.StatusPreconditionFailed)
+		s.log.Debug(op, "playlist version mismatch", err)
+	case errors.Is(err, errMalformedETag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "malformed If-Match", err)
+	default:
+		http.Error(w, "Failed to process playlist: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to process playlist", err)
+	}
+}
+
+func (s Server) writePlaylist(w http.ResponseWriter, status int, playlist domain.Playlist) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(playlist.Version))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(playlist)
+}
+
+// CreatePlaylistHandler godoc
+//
+// @Summary      Создать плейлист
+// @Description  Создаёт пустой плейлист, песни добавляются через /playlists/{id}/items
+// @Tags         Playlists
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        playlist  body  domain.Playlist  true  "Название и описание"
+// @Success      201     {object}  domain.Playlist
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /playlists [post]
+func (s Server) CreatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.CreatePlaylistHandler"
+
+	s.log.Info(op, "connected to CreatePlaylistHandler", "trying to create playlist")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	var playlist domain.Playlist
+	if err := json.NewDecoder(r.Body).Decode(&playlist); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode playlist", err)
+		return
+	}
+	defer r.Body.Close()
+	if err := playlist.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate playlist", err)
+		return
+	}
+
+	playlist, err := s.db.CreatePlaylist(r.Context(), principal.UserID, playlist)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully created playlist", playlist.ID)
+	s.writePlaylist(w, http.StatusCreated, playlist)
+}
+
+// GetPlaylistsHandler godoc
+//
+// @Summary      Список плейлистов
+// @Description  Возвращает плейлисты по названию с количеством песен, без самих песен
+// @Tags         Playlists
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200     {array}   domain.Playlist
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /playlists [get]
+func (s Server) GetPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetPlaylistsHandler"
+
+	s.log.Info(op, "connected to GetPlaylistsHandler", "trying to get playlists")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	playlists, err := s.db.GetPlaylists(r.Context(), principal.UserID)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully retrieved playlists", len(playlists))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(playlists)
+}
+
+// GetPlaylistHandler godoc
+//
+// @Summary      Получить плейлист
+// @Description  Возвращает плейлист с песнями по порядку. id записи нужен, чтобы убрать или переставить её. С параметром format плейлист отдаётся файлом m3u8, xspf или pls для плеера, песни без ссылки в файл не попадают
+// @Tags         Playlists
+// @Security     BearerAuth
+// @Produce      json
+// @Produce      audio/x-mpegurl
+// @Produce      application/xspf+xml
+// @Produce      audio/x-scpls
+// @Param        id      path   int     true   "id плейлиста"
+// @Param        format  query  string  false  "Формат файла"  Enums(m3u8, xspf, pls)
+// @Success      200     {object}  domain.Playlist
+// @Failure      400     {object}  string  "Некорректный id или неизвестный формат"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      404     {object}  string  "Плейлист не найден"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /playlists/{id} [get]
+func (s Server) GetPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetPlaylistHandler"
+
+	s.log.Info(op, "connected to GetPlaylistHandler", "trying to get playlist")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid playlist id", err)
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" {
+		s.exportPlaylist(w, r, op, principal.UserID, id, format)
+		return
+	}
+	playlist, err := s.db.GetPlaylist(r.Context(), principal.UserID, id)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully retrieved playlist", id)
+	s.writePlaylist(w, http.StatusOK, playlist)
+}
+
+// exportPlaylist отдаёт плейлист файлом для плеера
+func (s Server) exportPlaylist(w http.ResponseWriter, r *http.Request, op string, userID int64, id int64, format string) {
+	if !formats.IsPlaylist(format) {
+		http.Error(w, "Unknown format, expected m3u8, xspf or pls", http.StatusBadRequest)
+		s.log.Debug(op, "unknown format", format)
+		return
+	}
+	playlist, songs, err := s.db.GetPlaylistSongs(r.Context(), userID, id)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	encoder, err := formats.NewEncoder(format, w, playlist.Name)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", formats.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="playlist-`+strconv.FormatInt(id, 10)+`.`+format+`"`)
+	for _, song := range songs {
+		if err = encoder.Encode(song); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err != nil {
+		// Заголовки уже могли уйти клиенту, поменять статус нельзя, поэтому просто обрываем ответ
+		s.log.Error(op, "failed to export playlist", err)
+		return
+	}
+	s.log.Info(op, "successfully exported playlist", id)
+}
+
+// UpdatePlaylistHandler godoc
+//
+// @Summary      Переименовать плейлист
+// @Description  Меняет непустые name и description. If-Match не обязателен, но если передан - проверяется
+// @Tags         Playlists
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id        path    int              true   "id плейлиста"
+// @Param        If-Match  header  string           false  "ETag плейлиста"
+// @Param        playlist  body    domain.Playlist  true   "Новые название и описание"
+// @Success      200     {object}  domain.Playlist
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      404     {object}  string  "Плейлист не найден"
+// @Failure      412     {object}  string  "Плейлист уже был изменён кем-то другим"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /playlists/{id} [patch]
+func (s Server) UpdatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.UpdatePlaylistHandler"
+
+	s.log.Info(op, "connected to UpdatePlaylistHandler", "trying to update playlist")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid playlist id", err)
+		return
+	}
+	var patch domain.Playlist
+	if err = json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode playlist", err)
+		return
+	}
+	defer r.Body.Close()
+	if err = patch.ValidatePatch(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate playlist", err)
+		return
+	}
+	patch.ID = id
+	version, err := s.playlistVersion(r, principal.UserID, id)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+
+	playlist, err := s.db.UpdatePlaylist(r.Context(), principal.UserID, patch, version)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully updated playlist", id)
+	s.writePlaylist(w, http.StatusOK, playlist)
+}
+
+// DeletePlaylistHandler godoc
+//
+// @Summary      Удалить плейлист
+// @Description  Удаляет плейлист, песни остаются в библиотеке. If-Match не обязателен, но если передан - проверяется
+// @Tags         Playlists
+// @Security     BearerAuth
+// @Param        id        path    int     true   "id плейлиста"
+// @Param        If-Match  header  string  false  "ETag плейлиста"
+// @Success      200     {string}  string  "Плейлист удалён"
+// @Failure      400     {object}  string  "Некорректный id"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      404     {object}  string  "Плейлист не найден"
+// @Failure      412     {object}  string  "Плейлист уже был изменён кем-то другим"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /playlists/{id} [delete]
+func (s Server) DeletePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.DeletePlaylistHandler"
+
+	s.log.Info(op, "connected to DeletePlaylistHandler", "trying to delete playlist")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid playlist id", err)
+		return
+	}
+	version, err := s.playlistVersion(r, principal.UserID, id)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	if err = s.db.DeletePlaylist(r.Context(), principal.UserID, id, version); err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully deleted playlist", id)
+	w.WriteHeader(http.StatusOK)
+}
+
+// AddPlaylistItemHandler godoc
+//
+// @Summary      Добавить песню в плейлист
+// @Description  Добавляет песню из библиотеки на место index (с 0), без index - в конец. Одну песню можно добавить несколько раз
+// @Tags         Playlists
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                 true  "id плейлиста"
+// @Param        item  body  domain.PlaylistAdd  true  "Песня и место"
+// @Success      201     {object}  domain.Playlist
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      404     {object}  string  "Плейлист или песня не найдены"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /playlists/{id}/items [post]
+func (s Server) AddPlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.AddPlaylistItemHandler"
+
+	s.log.Info(op, "connected to AddPlaylistItemHandler", "trying to add song to playlist")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid playlist id", err)
+		return
+	}
+	var add domain.PlaylistAdd
+	if err = json.NewDecoder(r.Body).Decode(&add); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode item", err)
+		return
+	}
+	defer r.Body.Close()
+	if err = add.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate item", err)
+		return
+	}
+
+	playlist, err := s.db.AddPlaylistItem(r.Context(), principal.UserID, id, add)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully added song to playlist", id)
+	s.writePlaylist(w, http.StatusCreated, playlist)
+}
+
+// RemovePlaylistItemHandler godoc
+//
+// @Summary      Убрать песню из плейлиста
+// @Description  Убирает запись item из плейлиста, порядок остальных записей не меняется
+// @Tags         Playlists
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id    path  int  true  "id плейлиста"
+// @Param        item  path  int  true  "id записи"
+// @Success      200     {object}  domain.Playlist
+// @Failure      400     {object}  string  "Некорректный id"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      404     {object}  string  "Плейлист или запись не найдены"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /playlists/{id}/items/{item} [delete]
+func (s Server) RemovePlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.RemovePlaylistItemHandler"
+
+	s.log.Info(op, "connected to RemovePlaylistItemHandler", "trying to remove song from playlist")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid playlist id", err)
+		return
+	}
+	itemID, err := pathID(r, "item")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid item id", err)
+		return
+	}
+
+	playlist, err := s.db.RemovePlaylistItem(r.Context(), principal.UserID, id, itemID)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully removed song from playlist", id)
+	s.writePlaylist(w, http.StatusOK, playlist)
+}
+
+// MovePlaylistItemHandler godoc
+//
+// @Summary      Переставить песню в плейлисте
+// @Description  Переносит запись item на место index (с 0). index больше длины плейлиста переносит запись в конец
+// @Tags         Playlists
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path  int                  true  "id плейлиста"
+// @Param        item  path  int                  true  "id записи"
+// @Param        move  body  domain.PlaylistMove  true  "Новое место"
+// @Success      200     {object}  domain.Playlist
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      404     {object}  string  "Плейлист или запись не найдены"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /playlists/{id}/items/{item}/move [post]
+func (s Server) MovePlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.MovePlaylistItemHandler"
+
+	s.log.Info(op, "connected to MovePlaylistItemHandler", "trying to move playlist item")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid playlist id", err)
+		return
+	}
+	itemID, err := pathID(r, "item")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid item id", err)
+		return
+	}
+	var move domain.PlaylistMove
+	if err = json.NewDecoder(r.Body).Decode(&move); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode move", err)
+		return
+	}
+	defer r.Body.Close()
+	if err = move.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate move", err)
+		return
+	}
+
+	playlist, err := s.db.MovePlaylistItem(r.Context(), principal.UserID, id, itemID, move.Index)
+	if err != nil {
+		s.writePlaylistError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully moved playlist item", itemID)
+	s.writePlaylist(w, http.StatusOK, playlist)
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/auth"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultPageSize сколько записей истории и избранного отдаётся, если limit не задан
+const defaultPageSize = 50
+
+// queryPage разбирает query параметры limit и offset
+func queryPage(r *http.Request) (limit int, offset int, err error) {
+	limit = defaultPageSize
+	for name, value := range map[string]*int{"limit": &limit, "offset": &offset} {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%s must be a non-negative integer", name)
+		}
+		*value = n
+	}
+	return limit, offset, nil
+}
+
+// PlaySongHandler godoc
+//
+// @Summary      Отметить прослушивание
+// @Description  Записывает прослушивание песни текущим пользователем. Прослушивания пишутся в бд пачками, поэтому в истории и счётчиках появляются с задержкой до plays.flush_interval
+// @Tags         Plays
+// @Accept       json
+// @Security     BearerAuth
+// @Param        play  body  domain.PlayRequest  true  "Песня и клиент"
+// @Success      202     {string}  string  "Прослушивание принято"
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      503     {object}  string  "Очередь прослушиваний переполнена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /song/play [post]
+func (s Server) PlaySongHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.PlaySongHandler"
+
+	var req domain.PlayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode play", err)
+		return
+	}
+	defer r.Body.Close()
+	if req.Client == "" {
+		req.Client = r.UserAgent()
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate play", err)
+		return
+	}
+
+	song, err := s.db.GetSong(req.GroupName, req.SongName)
+	if errors.Is(err, domain.ErrSongNotFound) {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to record play: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to get song", err)
+		return
+	}
+	play := domain.Play{SongID: song.ID, Client: req.Client, PlayedAt: time.Now()}
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		play.UserID = principal.UserID
+	}
+	if err = s.plays.Record(play); err != nil {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many plays, try again later", http.StatusServiceUnavailable)
+		s.log.Warn(op, "play queue is full", song.ID)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GetHistoryHandler godoc
+//
+// @Summary      История прослушиваний
+// @Description  Возвращает прослушивания текущего пользователя, последние первыми
+// @Tags         Plays
+// @Produce      json
+// @Security     BearerAuth
+// @Param        limit   query  int  false  "Сколько записей вернуть, по умолчанию 50"
+// @Param        offset  query  int  false  "Сколько записей пропустить"
+// @Success      200     {array}   domain.Play
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  string  "Нет токена или API-ключа"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /me/history [get]
+func (s Server) GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetHistoryHandler"
+
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	limit, offset, err := queryPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid pagination", err)
+		return
+	}
+	history, err := s.db.GetHistory(r.Context(), principal.UserID, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to retrieve history: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve history", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(history)
+}
+
+// GetFavoritesHandler godoc
+//
+// @Summary      Избранное
+// @Description  Возвращает избранные песни текущего пользователя, последние добавленные первыми
+// @Tags         Plays
+// @Produce      json
+// @Security     BearerAuth
+// @Param        limit   query  int  false  "Сколько песен вернуть, по умолчанию 50"
+// @Param        offset  query  int  false  "Сколько песен пропустить"
+// @Success      200     {array}   domain.Favorite
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  string  "Нет токена или API-ключа"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /me/favorites [get]
+func (s Server) GetFavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetFavoritesHandler"
+
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	limit, offset, err := queryPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid pagination", err)
+		return
+	}
+	favorites, err := s.db.GetFavorites(r.Context(), principal.UserID, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to retrieve favorites: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve favorites", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(favorites)
+}
+
+// AddFavoriteHandler godoc
+//
+// @Summary      Добавить в избранное
+// @Description  Добавляет песню в избранное текущего пользователя, повторное добавление ничего не меняет
+// @Tags         Plays
+// @Accept       json
+// @Security     BearerAuth
+// @Param        song  body  domain.FavoriteRequest  true  "Группа и песня"
+// @Success      200     {string}  string  "Песня в избранном"
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  string  "Нет токена или API-ключа"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /me/favorites [post]
+func (s Server) AddFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeFavorite(w, r, "gates.Server.AddFavoriteHandler", true)
+}
+
+// RemoveFavoriteHandler godoc
+//
+// @Summary      Убрать из избранного
+// @Description  Убирает песню из избранного текущего пользователя
+// @Tags         Plays
+// @Accept       json
+// @Security     BearerAuth
+// @Param        song  body  domain.FavoriteRequest  true  "Группа и песня"
+// @Success      200     {string}  string  "Песня убрана из избранного"
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  string  "Нет токена или API-ключа"
+// @Failure      404     {object}  string  "Песни нет в избранном"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /me/favorites [delete]
+func (s Server) RemoveFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeFavorite(w, r, "gates.Server.RemoveFavoriteHandler", false)
+}
+
+func (s Server) changeFavorite(w http.ResponseWriter, r *http.Request, op string, add bool) {
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	var req domain.FavoriteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode favorite", err)
+		return
+	}
+	defer r.Body.Close()
+	if err := req.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate favorite", err)
+		return
+	}
+
+	var err error
+	if add {
+		err = s.db.AddFavorite(r.Context(), principal.UserID, req.GroupName, req.SongName)
+	} else {
+		err = s.db.RemoveFavorite(r.Context(), principal.UserID, req.GroupName, req.SongName)
+	}
+	switch {
+	case errors.Is(err, domain.ErrSongNotFound), errors.Is(err, domain.ErrFavoriteNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		s.log.Debug(op, "favorite not found", err)
+	case err != nil:
+		http.Error(w, "Failed to change favorites: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to change favorites", err)
+	default:
+		s.log.Info(op, "successfully changed favorites", req.SongName)
+		w.WriteHeader(http.StatusOK)
+	}
+}
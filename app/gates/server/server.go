@@ -3,25 +3,37 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"log/slog"
 	_ "mobileSongLibrary/docs"
 	"mobileSongLibrary/domain"
 	swagger "mobileSongLibrary/gates/apiservice"
+	"mobileSongLibrary/gates/auth"
+	"mobileSongLibrary/gates/enricher"
+	"mobileSongLibrary/gates/events"
+	"mobileSongLibrary/gates/plays"
+	"mobileSongLibrary/gates/similar"
 	"mobileSongLibrary/gates/storage"
 	"mobileSongLibrary/internal/config"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
 type Server struct {
-	db      *storage.DB
-	context context.Context
-	log     *slog.Logger
-	client  swagger.ClientInterface
-	cfg     *config.Config
+	db       *storage.DB
+	context  context.Context
+	log      *slog.Logger
+	client   swagger.ClientInterface
+	enricher *enricher.Enricher
+	auth     *auth.Authenticator
+	plays    *plays.Recorder
+	similar  *similar.Job
+	events   *events.Hub
+	cfg      *config.Config
 }
 
 type groupRename struct {
@@ -29,30 +41,105 @@ type groupRename struct {
 	NewName string `json:"new_name"`
 }
 
+type groupRenameResult struct {
+	Moved int `json:"moved"` // сколько песен перенесено под новое название
+}
+
 type SongsStorage interface {
-	AddSong(song storage.Song) error
-	UpdateSong(song storage.Song) error
+	AddSong(ctx context.Context, song storage.Song) error
+	UpdateSong(ctx context.Context, song storage.Song) (int, error)
 	GetSong(group domain.GroupName, songName domain.SongName) (domain.Song, error)
-	DeleteSong(group domain.GroupName, song domain.SongName) error
+	DeleteSong(ctx context.Context, group domain.GroupName, song domain.SongName, version int) error
 	GetLibrary(ctx context.Context, filter domain.SongFilter) ([]domain.Song, error)
 }
 
-func NewServer(router *chi.Mux, db *storage.DB, log *slog.Logger, client swagger.ClientInterface, conf *config.Config) *Server {
+func NewServer(router *chi.Mux, db *storage.DB, log *slog.Logger, client swagger.ClientInterface, conf *config.Config, authenticator *auth.Authenticator, recorder *plays.Recorder, recommender *similar.Job, hub *events.Hub) *Server {
 	const op = "gates.Server.NewServer"
 	server := &Server{
-		db:      db,
-		context: context.Background(),
-		log:     log,
-		client:  client,
-		cfg:     conf,
-	}
-
-	router.Method(http.MethodGet, "/library", http.HandlerFunc(server.GetLibraryHandler))        //Хендлер на получение всей библиотеки песен
-	router.Method(http.MethodGet, "/song", http.HandlerFunc(server.GetSongHandler))              //хендлер на получение конкретной песни
-	router.Method(http.MethodDelete, "/song", http.HandlerFunc(server.DeleteSongHandler))        //Хендлер на удаление конкретной песни
-	router.Method(http.MethodPost, "/song", http.HandlerFunc(server.AddSongHandler))             //хендлер на добавление новой песни
-	router.Method(http.MethodPatch, "/song", http.HandlerFunc(server.UpdateSongHandler))         //Хендлер на изменение данных песни
-	router.Method(http.MethodPatch, "/renamegroup", http.HandlerFunc(server.RenameGroupHandler)) //Хендлер на изменение название группы
+		db:       db,
+		context:  context.Background(),
+		log:      log,
+		client:   client,
+		enricher: enricher.New(client, log),
+		auth:     authenticator,
+		plays:    recorder,
+		similar:  recommender,
+		events:   hub,
+		cfg:      conf,
+	}
+
+	router.Use(middleware.RequestID)     //id запроса из X-Request-Id или новый, попадает в журнал аудита
+	router.Use(authenticator.Middleware) //все маршруты кроме /auth/login, /auth/refresh, /auth/logout и swagger требуют токен или API-ключ
+	router.Use(withActor)                //автор изменений для журнала аудита
+	//права маршрутов: чтение - listener, изменения - editor, удаление, переименование групп, слияния и импорт - admin
+	can := authenticator.Require
+
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/library", http.HandlerFunc(server.GetLibraryHandler))         //Хендлер на получение всей библиотеки песен
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/song", http.HandlerFunc(server.GetSongHandler))               //хендлер на получение конкретной песни
+	router.With(can(domain.PermAdmin)).Method(http.MethodDelete, "/song", http.HandlerFunc(server.DeleteSongHandler))        //Хендлер на удаление конкретной песни
+	router.With(can(domain.PermEdit)).Method(http.MethodPost, "/song", http.HandlerFunc(server.AddSongHandler))              //хендлер на добавление новой песни
+	router.With(can(domain.PermEdit)).Method(http.MethodPatch, "/song", http.HandlerFunc(server.UpdateSongHandler))          //Хендлер на изменение данных песни
+	router.With(can(domain.PermEdit)).Method(http.MethodPost, "/song/move", http.HandlerFunc(server.MoveSongHandler))        //Хендлер на переименование песни и перенос в другую группу
+	router.With(can(domain.PermAdmin)).Method(http.MethodPatch, "/renamegroup", http.HandlerFunc(server.RenameGroupHandler)) //Хендлер на изменение название группы
+	router.With(can(domain.PermAdmin)).Method(http.MethodPost, "/groups/merge", http.HandlerFunc(server.MergeGroupsHandler)) //Хендлер на слияние двух групп
+
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/library/duplicates", http.HandlerFunc(server.GetDuplicatesHandler))                                 //Хендлер на отчёт о возможных дублях
+	router.With(can(domain.PermAdmin)).Method(http.MethodPost, "/library/duplicates/merge", http.HandlerFunc(server.MergeDuplicatesHandler))                       //Хендлер на слияние пары дублей
+	router.With(can(domain.PermEdit)).Method(http.MethodPost, "/songs:batch", http.HandlerFunc(server.BatchAddSongsHandler))                                       //Хендлер на пакетное добавление песен
+	router.With(can(domain.PermAdmin)).Method(http.MethodPost, "/import", http.HandlerFunc(server.ImportHandler))                                                  //Хендлер на импорт песен из CSV/NDJSON
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/export", http.HandlerFunc(server.ExportHandler))                                                    //Хендлер на выгрузку библиотеки в CSV/NDJSON/JSON
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/song/lyrics", http.HandlerFunc(server.GetLyricsHandler))                                            //Хендлер на синхронизированный текст песни (LRC)
+	router.With(can(domain.PermEdit)).Method(http.MethodPut, "/song/translation", http.HandlerFunc(server.PutTranslationHandler))                                  //Хендлер на добавление или замену перевода текста
+	router.With(can(domain.PermAdmin)).Method(http.MethodDelete, "/song/translation", http.HandlerFunc(server.DeleteTranslationHandler))                           //Хендлер на удаление перевода текста
+	router.With(can(domain.PermEdit)).Method(http.MethodPost, "/albums", http.HandlerFunc(server.CreateAlbumHandler))                                              //Хендлер на создание альбома
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/albums/{id}", http.HandlerFunc(server.GetAlbumHandler))                                             //Хендлер на альбом с трек-листом
+	router.With(can(domain.PermEdit)).Method(http.MethodPatch, "/albums/{id}", http.HandlerFunc(server.UpdateAlbumHandler))                                        //Хендлер на изменение альбома
+	router.With(can(domain.PermAdmin)).Method(http.MethodDelete, "/albums/{id}", http.HandlerFunc(server.DeleteAlbumHandler))                                      //Хендлер на удаление альбома
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/groups/{name}/albums", http.HandlerFunc(server.GroupAlbumsHandler))                                 //Хендлер на дискографию группы
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/groups", http.HandlerFunc(server.GetGroupsHandler))                                                 //Хендлер на список групп со сводкой
+	router.With(can(domain.PermEdit)).Method(http.MethodPost, "/groups", http.HandlerFunc(server.CreateGroupHandler))                                              //Хендлер на создание карточки группы
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/groups/{name}", http.HandlerFunc(server.GetGroupHandler))                                           //Хендлер на карточку группы
+	router.With(can(domain.PermEdit)).Method(http.MethodPatch, "/groups/{name}", http.HandlerFunc(server.UpdateGroupHandler))                                      //Хендлер на изменение карточки группы
+	router.With(can(domain.PermAdmin)).Method(http.MethodDelete, "/groups/{name}", http.HandlerFunc(server.DeleteGroupHandler))                                    //Хендлер на удаление группы
+	router.With(can(domain.PermEdit)).Method(http.MethodPost, "/song/tags", http.HandlerFunc(server.AddSongTagsHandler))                                           //Хендлер на добавление тегов песне
+	router.With(can(domain.PermEdit)).Method(http.MethodDelete, "/song/tags", http.HandlerFunc(server.RemoveSongTagsHandler))                                      //Хендлер на снятие тегов с песни
+	router.With(can(domain.PermEdit)).Method(http.MethodPost, "/groups/{name}/tags", http.HandlerFunc(server.AddGroupTagsHandler))                                 //Хендлер на добавление тегов группе
+	router.With(can(domain.PermEdit)).Method(http.MethodDelete, "/groups/{name}/tags", http.HandlerFunc(server.RemoveGroupTagsHandler))                            //Хендлер на снятие тегов с группы
+	router.With(can(domain.PermRead)).Method(http.MethodPost, "/playlists", http.HandlerFunc(server.CreatePlaylistHandler))                                        //Хендлер на создание плейлиста
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/playlists", http.HandlerFunc(server.GetPlaylistsHandler))                                           //Хендлер на список плейлистов
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/playlists/{id}", http.HandlerFunc(server.GetPlaylistHandler))                                       //Хендлер на плейлист с песнями
+	router.With(can(domain.PermRead)).Method(http.MethodPatch, "/playlists/{id}", http.HandlerFunc(server.UpdatePlaylistHandler))                                  //Хендлер на переименование плейлиста
+	router.With(can(domain.PermRead)).Method(http.MethodDelete, "/playlists/{id}", http.HandlerFunc(server.DeletePlaylistHandler))                                 //Хендлер на удаление плейлиста
+	router.With(can(domain.PermRead)).Method(http.MethodPost, "/playlists/{id}/items", http.HandlerFunc(server.AddPlaylistItemHandler))                            //Хендлер на добавление песни в плейлист
+	router.With(can(domain.PermRead)).Method(http.MethodDelete, "/playlists/{id}/items/{item}", http.HandlerFunc(server.RemovePlaylistItemHandler))                //Хендлер на удаление песни из плейлиста
+	router.With(can(domain.PermRead)).Method(http.MethodPost, "/playlists/{id}/items/{item}/move", http.HandlerFunc(server.MovePlaylistItemHandler))               //Хендлер на перестановку песни в плейлисте
+	router.Method(http.MethodPost, "/auth/login", http.HandlerFunc(server.LoginHandler))                                                                           //Хендлер на вход по логину и паролю
+	router.Method(http.MethodPost, "/auth/refresh", http.HandlerFunc(server.RefreshHandler))                                                                       //Хендлер на обновление токенов
+	router.Method(http.MethodPost, "/auth/logout", http.HandlerFunc(server.LogoutHandler))                                                                         //Хендлер на отзыв refresh токена
+	router.Method(http.MethodGet, "/auth/me", http.HandlerFunc(server.MeHandler))                                                                                  //Хендлер на текущего пользователя
+	router.Method(http.MethodPost, "/auth/keys", http.HandlerFunc(server.CreateAPIKeyHandler))                                                                     //Хендлер на создание API-ключа
+	router.Method(http.MethodGet, "/auth/keys", http.HandlerFunc(server.GetAPIKeysHandler))                                                                        //Хендлер на список API-ключей
+	router.Method(http.MethodDelete, "/auth/keys/{id}", http.HandlerFunc(server.DeleteAPIKeyHandler))                                                              //Хендлер на отзыв API-ключа
+	router.With(can(domain.PermUsers)).Method(http.MethodGet, "/admin/users", http.HandlerFunc(server.GetUsersHandler))                                            //Хендлер на список пользователей с ролями
+	router.With(can(domain.PermUsers)).Method(http.MethodPost, "/admin/users", http.HandlerFunc(server.CreateUserHandler))                                         //Хендлер на создание пользователя
+	router.With(can(domain.PermUsers)).Method(http.MethodPatch, "/admin/users/{id}", http.HandlerFunc(server.UpdateUserHandler))                                   //Хендлер на отключение и включение пользователя
+	router.With(can(domain.PermUsers)).Method(http.MethodPut, "/admin/users/{id}/roles", http.HandlerFunc(server.SetUserRolesHandler))                             //Хендлер на замену ролей пользователя
+	router.With(can(domain.PermAudit)).Method(http.MethodGet, "/admin/audit", http.HandlerFunc(server.GetAuditHandler))                                            //Хендлер на журнал аудита с выгрузкой
+	router.With(can(domain.PermHooks)).Method(http.MethodPost, "/webhooks", http.HandlerFunc(server.CreateWebhookHandler))                                         //Хендлер на создание подписки на вебхуки
+	router.With(can(domain.PermHooks)).Method(http.MethodGet, "/webhooks", http.HandlerFunc(server.GetWebhooksHandler))                                            //Хендлер на список подписок
+	router.With(can(domain.PermHooks)).Method(http.MethodGet, "/webhooks/{id}", http.HandlerFunc(server.GetWebhookHandler))                                        //Хендлер на подписку
+	router.With(can(domain.PermHooks)).Method(http.MethodPatch, "/webhooks/{id}", http.HandlerFunc(server.UpdateWebhookHandler))                                   //Хендлер на изменение и включение подписки
+	router.With(can(domain.PermHooks)).Method(http.MethodDelete, "/webhooks/{id}", http.HandlerFunc(server.DeleteWebhookHandler))                                  //Хендлер на удаление подписки
+	router.With(can(domain.PermHooks)).Method(http.MethodGet, "/webhooks/{id}/deliveries", http.HandlerFunc(server.GetWebhookDeliveriesHandler))                   //Хендлер на журнал доставок
+	router.With(can(domain.PermHooks)).Method(http.MethodPost, "/webhooks/{id}/deliveries/{delivery}/redeliver", http.HandlerFunc(server.RedeliverWebhookHandler)) //Хендлер на повторную доставку
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/events", http.HandlerFunc(server.EventsHandler))                                                    //Хендлер на поток изменений библиотеки по SSE
+	router.With(can(domain.PermRead)).Method(http.MethodPost, "/song/play", http.HandlerFunc(server.PlaySongHandler))                                              //Хендлер на отметку прослушивания
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/me/history", http.HandlerFunc(server.GetHistoryHandler))                                            //Хендлер на историю прослушиваний
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/me/favorites", http.HandlerFunc(server.GetFavoritesHandler))                                        //Хендлер на избранное
+	router.With(can(domain.PermRead)).Method(http.MethodPost, "/me/favorites", http.HandlerFunc(server.AddFavoriteHandler))                                        //Хендлер на добавление в избранное
+	router.With(can(domain.PermRead)).Method(http.MethodDelete, "/me/favorites", http.HandlerFunc(server.RemoveFavoriteHandler))                                   //Хендлер на удаление из избранного
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/charts", http.HandlerFunc(server.GetChartHandler))                                                  //Хендлер на чарт за период
+	router.With(can(domain.PermRead)).Method(http.MethodGet, "/song/similar", http.HandlerFunc(server.GetSimilarHandler))                                          //Хендлер на похожие песни
 	//swagger
 	router.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:8080/swagger/doc.json"),
@@ -64,13 +151,14 @@ func NewServer(router *chi.Mux, db *storage.DB, log *slog.Logger, client swagger
 // AddSongHandler godoc
 //
 // @Summary      Добавить новую песню
-// @Description  Добавляет новую песню в библиотеку
+// @Description  Добавляет новую песню в библиотеку, с полем album песня ставится последним треком этого альбома группы. Можно передать синхронизированный текст в поле lrc, тогда пустой text будет выведен из него
 // @Tags         Songs
 // @Accept       json
 // @Produce      json
 // @Param        song  body  domain.Song  true  "Данные новой песни"
 // @Success      201     {string}  string  "Песня успешно добавлена"
 // @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      409     {object}  string  "Такая песня уже есть в группе"
 // @Failure      500     {object}  string  "Ошибка сервера"
 // @Router       /song [post]
 func (s Server) AddSongHandler(w http.ResponseWriter, r *http.Request) {
@@ -86,81 +174,64 @@ func (s Server) AddSongHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := song.Validate() // Проверка на не пустые параметры group и song
+	err := song.Validate() // Проверка на не пустые параметры group и song и корректность LRC
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		s.log.Error(op, "failed to validate request body", "")
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Error(op, "failed to validate request body", err)
 		return
 	}
 	defer r.Body.Close()
 
-	// Запрос к внешнему API
-	response, err := s.client.GetInfo(r.Context(), &swagger.GetInfoParams{string(song.GroupName), string(song.SongName)})
-	s.log.Debug(op, "Request parameters: group=", string(song.GroupName), "song=", string(song.SongName))
-
+	// Дополняем песню данными из внешнего API
+	song, err = s.enricher.Enrich(r.Context(), song)
 	if err != nil {
-		s.log.Error(op, "failed to get info: ", err)
-		http.Error(w, "Failed to get info: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer response.Body.Close()
-
-	// Проверка на успешный статус-код API
-	if response.StatusCode != http.StatusOK {
-		http.Error(w, "Unexpected status code: "+response.Status, http.StatusInternalServerError)
-		s.log.Error(op, "got unexpected status code: ", response.Status)
+		s.log.Error(op, "failed to enrich song", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Декодирование ответа API
-	var songDetail swagger.SongDetail
-	if err := json.NewDecoder(response.Body).Decode(&songDetail); err != nil {
-		s.log.Error(op, "failed to decode API response: ", err)
-		http.Error(w, "Failed to decode API response: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Заполнение данных из API
-	song.Link = domain.Link(songDetail.Link)
-	song.Text = songDetail.Text
-	song.ReleaseDate, err = domain.ParseCustomDate(songDetail.ReleaseDate)
-	if err != nil {
-		s.log.Error(op, "failed to parse release date", err)
-		http.Error(w, "Failed to parse release date: "+err.Error(), http.StatusInternalServerError)
+	// Запись в базу данных
+	err = s.db.AddSong(r.Context(), storage.ToStorage(song))
+	if errors.Is(err, domain.ErrSongExists) {
+		s.log.Info(op, "song already exists", "")
+		http.Error(w, "Song "+string(song.SongName)+" already exists in group "+string(song.GroupName), http.StatusConflict)
 		return
 	}
-
-	// Запись в базу данных
-	err = s.db.AddSong(storage.ToStorage(song))
 	if err != nil {
 		s.log.Error(op, "Failed to add song", err)
 		http.Error(w, "Failed to add song", http.StatusInternalServerError)
 		return
 	}
 
-	s.log.Info(op, "successfully added song")
+	s.addToAlbum(r.Context(), op, song)
+
+	s.log.Info(op, "successfully added song", "")
 	w.WriteHeader(http.StatusCreated)
 }
 
-// обновит все старые данные на новые если строка не будет пустой (кроме имени группы и названии песни, он в renameGroupHandler),
-// а имя песни изменить никак нельзя, песни вроде как не меняют имена, верно?
+// обновит все старые данные на новые если строка не будет пустой (кроме имени группы и названии песни),
+// группа целиком переименовывается в RenameGroupHandler, а отдельная песня переименовывается и переносится в MoveSongHandler
 
 // UpdateSongHandler godoc
 //
 // @Summary      Обновить информацию о песне
-// @Description  Обновляет данные о песне, кроме её названия
+// @Description  Обновляет данные о песне, кроме её названия. Поле lrc проверяется, пустой text выводится из него. Требует заголовок If-Match с ETag из GET /song
 // @Tags         Songs
 // @Accept       json
 // @Produce      json
-// @Param        song  body  domain.Song  true  "Обновлённые данные песни"
-// @Success      200     {string}  string  "Песня успешно обновлена"
+// @Param        If-Match  header  string       true  "ETag песни, полученный из GET /song"
+// @Param        song      body    domain.Song  true  "Обновлённые данные песни"
+// @Success      201     {string}  string  "Песня успешно обновлена"
 // @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      412     {object}  string  "Песня уже была изменена кем-то другим"
+// @Failure      428     {object}  string  "Не передан If-Match"
 // @Failure      500     {object}  string  "Ошибка сервера"
 // @Router       /song [patch]
 func (s Server) UpdateSongHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "gates.Server.UpdateSongHandler"
 
-	s.log.Info(op)
+	s.log.Info(op, "connected to UpdateSongHandler", "trying to update song")
 	var song domain.Song
 	//читаем запрос
 	if err := json.NewDecoder(r.Body).Decode(&song); err != nil {
@@ -170,40 +241,54 @@ func (s Server) UpdateSongHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	err := song.Validate() //проверка на не пустые параметры group и song
+	err := song.Validate() //проверка на не пустые параметры group и song и корректность LRC
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		s.log.Error(op, "failed to validate song", err)
+		return
+	}
+
+	//версия которую видел клиент
+	song.Version, err = ifMatchVersion(r, s.currentVersion(song.GroupName, song.SongName))
+	if err != nil {
+		s.writePreconditionError(w, op, err)
+		return
 	}
 
 	//обновляем песню
-	err = s.db.UpdateSong(storage.ToStorage(song))
+	version, err := s.db.UpdateSong(r.Context(), storage.ToStorage(song))
 	if err == domain.ErrCantReplaceWithEmptyRows {
 		s.log.Debug(op, "nothing no update, everything is empty", err)
 		http.Error(w, "Failed to update song: you provided song with no info, cannot replace update info to nothing", http.StatusInternalServerError)
 		return
 	}
 	if err != nil {
-		s.log.Error(op, "failed to update song", err)
-		http.Error(w, "Failed to update song", http.StatusInternalServerError)
+		s.writePreconditionError(w, op, err)
 		return
 	}
 	//всё ок
-	s.log.Info("UpdateSongHandler: successfully updated song")
+	s.log.Info("UpdateSongHandler: successfully updated song", "version", version)
+	w.Header().Set("ETag", formatETag(version))
 	w.WriteHeader(http.StatusCreated)
 }
 
 // GetLibraryHandler godoc
 //
 // @Summary      Получить всю библиотеку песен
-// @Description  Возвращает список всех песен с возможностью фильтрации через заголовки
+// @Description  Возвращает список всех песен с возможностью фильтрации через заголовки (или одноимённые query параметры).
+// @Description  Если передан facets, ответ - объект {songs, facets}, где для каждого пространства тегов посчитано, сколько песен выборки (без учёта пагинации) помечено каждым тегом
 // @Tags         Library
 // @Produce      json
 // @Param        group          header  string  false  "Название группы"
 // @Param        song           header  string  false  "Название песни"
 // @Param        text           header  string  false  "Часть текста песни"
 // @Param        link           header  string  false  "Ссылка на песню"
+// @Param        album          header  string  false  "Название альбома"
 // @Param        release_date   header  string  false  "Дата релиза в формате 16.07.2006"
+// @Param        tags           header  string  false  "Теги через запятую, песня должна иметь все: genre:rock,mood:chill"
+// @Param        exclude_tags   header  string  false  "Теги через запятую, песня не должна иметь ни одного"
+// @Param        sort           header  string  false  "Сортировка через запятую: group, song, release_date, play_count, last_played, минус - по убыванию (-play_count)"
+// @Param        facets         query   string  false  "Пространства тегов через запятую (genre,mood), для которых посчитать фасеты"
 // @Param        limit          header  int     false  "Лимит выдачи"
 // @Param        offset         header  int     false  "Смещение выдачи"
 // @Success      200     {array}  domain.Song
@@ -215,68 +300,65 @@ func (s Server) GetLibraryHandler(w http.ResponseWriter, r *http.Request) {
 
 	s.log.Info(op, "connected to GetLibraryHandler", "trying to get library")
 
-	// Извлекаем параметры из заголовков
-	headers := r.Header
-	filter := domain.SongFilter{
-		GroupName: headers.Get("group"),
-		SongName:  headers.Get("song"),
-		Text:      headers.Get("text"),
-		Link:      domain.Link(headers.Get("link")),
-	}
-
-	if limit := headers.Get("limit"); limit != "" {
-		if l, err := strconv.Atoi(limit); err == nil {
-			filter.Limit = l
-		}
-	}
-
-	if offset := headers.Get("offset"); offset != "" {
-		if o, err := strconv.Atoi(offset); err == nil {
-			filter.Offset = o
-		}
-	}
-
-	// Парсим дату релиза
-	releaseDateString := headers.Get("release_date")
-	if releaseDateString != "" {
-		filterDate, err := domain.ParseCustomDate(releaseDateString)
-		if err != nil {
-			http.Error(w, "failed to parse date, wrong format", http.StatusBadRequest)
-			s.log.Debug(op, "failed to parse date, wrong format", err)
-			return
-		}
-		filter.ReleaseDate = filterDate
+	// Извлекаем фильтры из заголовков
+	filter, err := parseSongFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to parse filter", err)
+		return
 	}
 
 	s.log.Debug(op, "filter:", filter)
 
 	// Получаем библиотеку
-	library, err := s.db.GetLibrary(s.context, filter)
+	library, err := s.db.GetLibrary(r.Context(), filter)
 	if err != nil {
 		http.Error(w, "Failed to retrieve library: "+err.Error(), http.StatusInternalServerError)
 		s.log.Error(op, "failed to retrieve library", err)
 		return
 	}
 
+	// Фасеты по тегам считаются только если их попросили, иначе ответ остаётся массивом песен
+	namespaces := facetNamespaces(r)
+	var response interface{} = library
+	if len(namespaces) > 0 {
+		facets, err := s.db.GetTagFacets(r.Context(), filter, namespaces)
+		if err != nil {
+			http.Error(w, "Failed to count tags: "+err.Error(), http.StatusInternalServerError)
+			s.log.Error(op, "failed to count tags", err)
+			return
+		}
+		if library == nil {
+			library = []domain.Song{}
+		}
+		response = libraryPage{Songs: library, Facets: facets}
+	}
+
 	// Возвращаем результат
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(library)
-	s.log.Info(op, "successfully retrieved library")
+	json.NewEncoder(w).Encode(response)
+	s.log.Info(op, "successfully retrieved library", "")
 }
 
 // GetSongHandler godoc
 //
 // @Summary      Получить информацию о песне
-// @Description  Возвращает данные о песне с пагинацией текста
+// @Description  Возвращает данные о песне с пагинацией текста по частям. У каждой части в sections есть тип (verse, chorus, bridge...) и номер, повтор припева отмечен repeat.
+// @Description  Язык текста выбирается по параметру lang или заголовку Accept-Language, если перевода нет - отдаётся оригинал. Для перевода в original_sections лежат те же части оригинала
 // @Tags         Songs
 // @Produce      json
 // @Param        group          header  string  true   "Название группы"
 // @Param        song           header  string  true   "Название песни"
-// @Param        page           header  int     false  "Номер страницы (по умолчанию 1)"
-// @Param        size           header  int     false  "Количество куплетов на странице (по умолчанию 2)"
+// @Param        page           header  int     false  "Номер страницы, от 1 (по умолчанию 1)"
+// @Param        size           header  int     false  "Количество частей текста на странице, от 1 (по умолчанию 2)"
+// @Param        lang           query   string  false  "Языки текста в формате Accept-Language, например de, en;q=0.8"
+// @Param        Accept-Language header  string  false  "Используется если не передан lang"
+// @Param        If-None-Match  header  string  false  "ETag уже имеющейся у клиента версии"
 // @Success      200     {object}  map[string]interface{}
+// @Success      304     {string}  string  "Песня не изменилась"
 // @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
 // @Failure      500     {object}  string  "Ошибка сервера"
 // @Router       /song [get]
 func (s Server) GetSongHandler(w http.ResponseWriter, r *http.Request) {
@@ -299,36 +381,76 @@ func (s Server) GetSongHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Извлекаем параметры пагинации
-	page := 1
-	size := 2
-	if p := headers.Get("page"); p != "" {
-		if parsedPage, err := strconv.Atoi(p); err == nil {
-			page = parsedPage
-		}
-	}
-	if s := headers.Get("size"); s != "" {
-		if parsedSize, err := strconv.Atoi(s); err == nil {
-			size = parsedSize
-		}
+	page, size, err := parsePagination(headers)
+	if err != nil {
+		http.Error(w, "Invalid pagination: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid pagination", err)
+		return
 	}
 
 	// Вытаскиваем песню из БД
 	song, err = s.db.GetSong(song.GroupName, song.SongName)
+	if err == domain.ErrSongNotFound {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to retrieve song: "+err.Error(), http.StatusInternalServerError)
 		s.log.Error(op, "failed to retrieve song", err)
 		return
 	}
 
-	// Пагинация текста песни
-	verses := strings.Split(song.Text, "\n\n")
-	start := (page - 1) * size
-	end := start + size
-	if start > len(verses) {
-		start = len(verses)
+	if len(song.Sections) == 0 && song.Text != "" { //песня добавлена до разбора текста на части
+		song.Sections = domain.ParseLyrics(song.Text)
+	}
+
+	// Выбираем язык текста: параметр lang, а если его нет - Accept-Language
+	available, err := s.songLanguages(r.Context(), song)
+	if err != nil {
+		http.Error(w, "Failed to retrieve lyrics: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve lyrics", err)
+		return
 	}
-	if end > len(verses) {
-		end = len(verses)
+	tags, err := s.db.SongTags(r.Context(), song.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve tags: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve tags", err)
+		return
+	}
+	preferences := r.URL.Query().Get("lang")
+	if preferences == "" {
+		preferences = headers.Get("Accept-Language")
+	}
+	lyrics := domain.NegotiateLyrics(available, preferences)
+	original := available[0]
+	if lyrics.Lang != "und" {
+		w.Header().Set("Content-Language", lyrics.Lang)
+	}
+
+	// Песня и страница ищутся по заголовкам, поэтому кэши должны их учитывать. Тело зависит ещё от страницы
+	// и выбранного языка, так что они входят в ETag вместе с версией
+	w.Header().Set("Vary", "group, song, page, size, Accept-Language")
+	w.Header().Set("ETag", variantETag(song.Version, "p"+strconv.Itoa(page), "s"+strconv.Itoa(size), lyrics.Lang))
+	if inm := headers.Get("If-None-Match"); inm != "" && etagMatches(inm, w.Header().Get("ETag")) {
+		s.log.Debug(op, "song not modified, version", song.Version)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Пагинация текста песни по частям (куплеты, припевы...). Номера частей перевода совпадают с номерами частей оригинала,
+	// поэтому страницы можно показывать рядом
+	total := max(len(lyrics.Sections), len(original.Sections))
+	start := min((page-1)*size, total)
+	end := min(start+size, total)
+	sections := sectionsPage(lyrics.Sections, start, end)
+	verses := make([]string, 0, len(sections))
+	for _, section := range sections {
+		verses = append(verses, section.Text)
+	}
+	languages := make([]string, 0, len(available))
+	for _, l := range available {
+		languages = append(languages, l.Lang)
 	}
 
 	// Формирование ответа
@@ -337,11 +459,19 @@ func (s Server) GetSongHandler(w http.ResponseWriter, r *http.Request) {
 		"song":            song.SongName,
 		"release_date":    song.ReleaseDate,
 		"link":            song.Link,
-		"verses":          verses[start:end],
-		"total_verses":    len(verses),
+		"tags":            nonNilTags(tags[song.ID]),
+		"lang":            lyrics.Lang,
+		"original":        lyrics.Original,
+		"languages":       languages,
+		"sections":        sections,
+		"verses":          verses,
+		"total_verses":    total,
 		"page":            page,
 		"verses_per_page": size,
 	}
+	if !lyrics.Original {
+		resp["original_sections"] = sectionsPage(original.Sections, start, end)
+	}
 
 	// Пакуем ответ в JSON
 	w.Header().Set("Content-Type", "application/json")
@@ -352,7 +482,7 @@ func (s Server) GetSongHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.log.Info(op, "successfully retrieved song")
+	s.log.Info(op, "successfully retrieved song", "")
 }
 
 // DeleteSongHandler godoc
@@ -362,9 +492,13 @@ func (s Server) GetSongHandler(w http.ResponseWriter, r *http.Request) {
 // @Tags         Songs
 // @Accept       json
 // @Produce      json
-// @Param        song  body  domain.Song  true  "Название группы и песни для удаления"
+// @Param        If-Match  header  string       true  "ETag песни, полученный из GET /song"
+// @Param        song      body    domain.Song  true  "Название группы и песни для удаления"
 // @Success      200     {string}  string  "Успешное удаление"
 // @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      412     {object}  string  "Песня уже была изменена кем-то другим"
+// @Failure      428     {object}  string  "Не передан If-Match"
 // @Failure      500     {object}  string  "Ошибка сервера"
 // @Router       /song [delete]
 func (s Server) DeleteSongHandler(w http.ResponseWriter, r *http.Request) {
@@ -388,28 +522,93 @@ func (s Server) DeleteSongHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, err := ifMatchVersion(r, s.currentVersion(song.GroupName, song.SongName))
+	if err != nil {
+		s.writePreconditionError(w, op, err)
+		return
+	}
+
 	//удаляем песню из бд
-	err = s.db.DeleteSong(song.GroupName, song.SongName)
+	err = s.db.DeleteSong(r.Context(), song.GroupName, song.SongName, version)
 	if err != nil {
-		http.Error(w, "Failed to delete song: "+err.Error(), http.StatusInternalServerError)
-		s.log.Error(op, "failed to delete song", err)
+		s.writePreconditionError(w, op, err)
 		return
 	}
 	//пишем что всё ок
-	s.log.Info("DeleteSongHandler: successfully deleted song")
+	s.log.Info("DeleteSongHandler: successfully deleted song", "song", song.SongName)
 	w.WriteHeader(http.StatusOK)
 }
 
+// MoveSongHandler godoc
+//
+// @Summary      Переименовать песню или перенести её в другую группу
+// @Description  Атомарно меняет название и/или группу песни, все ссылки на песню сохраняются. If-Match необязателен, но если передан - проверяется
+// @Tags         Songs
+// @Accept       json
+// @Produce      json
+// @Param        If-Match  header  string           false  "ETag песни, полученный из GET /song"
+// @Param        move      body    domain.SongMove  true   "Текущие и новые группа и название песни"
+// @Success      200     {object}  domain.Song
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      409     {object}  string  "Песня с таким названием в группе уже есть"
+// @Failure      412     {object}  string  "Песня уже была изменена кем-то другим"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /song/move [post]
+func (s Server) MoveSongHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.MoveSongHandler"
+
+	s.log.Info(op, "connected to MoveSongHandler", "trying to move song")
+	var move domain.SongMove
+	if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Error(op, "failed to decode song move", err)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := move.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Error(op, "failed to validate song move", err)
+		return
+	}
+
+	version, err := ifMatchVersion(r, s.currentVersion(move.GroupName, move.SongName))
+	if err != nil && !errors.Is(err, errNoPrecondition) {
+		s.writePreconditionError(w, op, err)
+		return
+	}
+
+	song, err := s.db.MoveSong(r.Context(), move, version)
+	if errors.Is(err, domain.ErrSongConflict) {
+		http.Error(w, "Song "+string(move.NewSongName)+" already exists in group "+string(move.NewGroupName), http.StatusConflict)
+		s.log.Debug(op, "song conflict", err)
+		return
+	}
+	if err != nil {
+		s.writePreconditionError(w, op, err)
+		return
+	}
+
+	s.log.Info(op, "successfully moved song", song.SongName)
+	w.Header().Set("ETag", formatETag(song.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(song)
+}
+
 // RenameGroupHandler godoc
 //
 // @Summary      Переименовать группу
-// @Description  Изменяет название музыкальной группы
+// @Description  Изменяет название музыкальной группы у всех её песен в одной транзакции
 // @Tags         Groups
 // @Accept       json
 // @Produce      json
 // @Param        groupRename  body  groupRename  true  "Старое и новое название группы"
-// @Success      204     {string}  string  "Группа успешно переименована"
+// @Success      200     {object}  groupRenameResult  "Группа успешно переименована"
 // @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Группа не найдена"
+// @Failure      409     {object}  string  "У новой группы уже есть песни с такими названиями"
 // @Failure      500     {object}  string  "Ошибка сервера"
 // @Router       /renamegroup [patch]
 func (s Server) RenameGroupHandler(w http.ResponseWriter, r *http.Request) {
@@ -427,15 +626,120 @@ func (s Server) RenameGroupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer r.Body.Close()
+	if group.OldName == "" || group.NewName == "" || group.OldName == group.NewName {
+		http.Error(w, "Invalid request body: old_name and new_name are required and must differ", http.StatusBadRequest)
+		s.log.Error(op, "invalid group rename", group)
+		return
+	}
 	s.log.Debug(op, "old name", group.OldName, "new name", group.NewName)
 	//переименовываем группу
-	err = s.db.GroupRename(group.OldName, group.NewName)
+	moved, err := s.db.GroupRename(r.Context(), group.OldName, group.NewName)
 	if err != nil {
-		http.Error(w, "Failed to rename song: "+err.Error(), http.StatusInternalServerError)
-		s.log.Error(op, "failed to rename song", err)
+		s.writeGroupError(w, op, err)
 		return
 	}
 	//всё ок
-	s.log.Info("RenameGroupHandler: successfully renamed song")
-	w.WriteHeader(http.StatusNoContent)
+	s.log.Info("RenameGroupHandler: successfully renamed group", "group", group.NewName, "moved", moved)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(groupRenameResult{Moved: moved})
+}
+
+// currentVersion нужен ifMatchVersion когда клиент прислал в If-Match несколько тегов
+func (s Server) currentVersion(group domain.GroupName, songName domain.SongName) func() (int, error) {
+	return func() (int, error) {
+		song, err := s.db.GetSong(group, songName)
+		return song.Version, err
+	}
+}
+
+// writePreconditionError отвечает на ошибки условных запросов (If-Match) подходящим статусом
+func (s Server) writePreconditionError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, errNoPrecondition):
+		http.Error(w, err.Error(), http.StatusPreconditionRequired)
+		s.log.Debug(op, "missing If-Match", err)
+	case errors.Is(err, domain.ErrSongNotFound):
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+	case errors.Is(err, domain.ErrVersionMismatch):
+		http.Error(w, "Song was modified by someone else, reload it and try again", http.StatusPreconditionFailed)
+		s.log.Debug(op, "song version mismatch", err)
+	case errors.Is(err, errMalformedETag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "malformed If-Match", err)
+	default:
+		http.Error(w, "Failed to modify song: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to modify song", err)
+	}
+}
+
+// parsePagination разбирает page и size для GET /song, оба должны быть целыми числами от 1
+func parsePagination(headers http.Header) (page int, size int, err error) {
+	page, size = 1, 2
+	if p := headers.Get("page"); p != "" {
+		if page, err = strconv.Atoi(p); err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer, got %q", p)
+		}
+	}
+	if sz := headers.Get("size"); sz != "" {
+		if size, err = strconv.Atoi(sz); err != nil || size < 1 {
+			return 0, 0, fmt.Errorf("size must be a positive integer, got %q", sz)
+		}
+	}
+	return page, size, nil
+}
+
+// parseSongFilter собирает фильтр библиотеки из заголовков запроса. Если заголовка нет, берётся одноимённый query параметр,
+// чтобы, например, экспорт можно было скачать обычной ссылкой
+func parseSongFilter(r *http.Request) (domain.SongFilter, error) {
+	get := func(name string) string {
+		if v := r.Header.Get(name); v != "" {
+			return v
+		}
+		return r.URL.Query().Get(name)
+	}
+	filter := domain.SongFilter{
+		GroupName: get("group"),
+		SongName:  get("song"),
+		Text:      get("text"),
+		Link:      domain.Link(get("link")),
+		Album:     get("album"),
+	}
+
+	if limit := get("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil {
+			filter.Limit = l
+		}
+	}
+
+	if offset := get("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil {
+			filter.Offset = o
+		}
+	}
+
+	// Парсим дату релиза
+	if releaseDateString := get("release_date"); releaseDateString != "" {
+		filterDate, err := domain.ParseCustomDate(releaseDateString)
+		if err != nil {
+			return filter, errors.New("failed to parse date, wrong format")
+		}
+		filter.ReleaseDate = filterDate
+	}
+
+	// Теги перечисляются через запятую: tags=genre:rock,mood:chill
+	var err error
+	if filter.Tags, err = domain.SplitTags(get("tags")); err != nil {
+		return filter, err
+	}
+	if filter.ExcludeTags, err = domain.SplitTags(get("exclude_tags")); err != nil {
+		return filter, err
+	}
+
+	// Сортировка через запятую, минус - по убыванию: sort=-play_count,group
+	if filter.Sort, err = domain.ParseSort(get("sort")); err != nil {
+		return filter, err
+	}
+	return filter, nil
 }
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/similar"
+	"net/http"
+)
+
+// Сколько похожих песен отдаётся по умолчанию и максимум
+const (
+	defaultSimilarSize = 10
+	maxSimilarSize     = 100
+)
+
+// GetSimilarHandler godoc
+//
+// @Summary      Похожие песни
+// @Description  Возвращает песни, похожие на заданную, по убыванию сходства. Сходство складывается из tf-idf близости текстов, общих тегов, той же группы и близкого года релиза, в reasons перечислено, что совпало.
+// @Description  Индекс текстов строится в фоне и перестраивается, когда библиотека меняется, поэтому только что добавленные песни появляются в выдаче с задержкой до similar.refresh_interval
+// @Tags         Library
+// @Produce      json
+// @Security     BearerAuth
+// @Param        group  header  string  true   "Название группы (или query параметр group)"
+// @Param        song   header  string  true   "Название песни (или query параметр song)"
+// @Param        limit  query   int     false  "Сколько песен вернуть, по умолчанию 10, не больше 100"
+// @Success      200     {array}   domain.SimilarSong
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      503     {object}  string  "Индекс ещё строится"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /song/similar [get]
+func (s Server) GetSimilarHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetSimilarHandler"
+
+	s.log.Info(op, "connected to GetSimilarHandler", "trying to get similar songs")
+	filter, err := parseSongFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to parse request", err)
+		return
+	}
+	song := domain.Song{GroupName: domain.GroupName(filter.GroupName), SongName: domain.SongName(filter.SongName)}
+	if err = song.Validate(); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate song", err)
+		return
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultSimilarSize
+	}
+	limit = min(limit, maxSimilarSize)
+
+	song, err = s.db.GetSong(song.GroupName, song.SongName)
+	if errors.Is(err, domain.ErrSongNotFound) {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve song: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve song", err)
+		return
+	}
+	tags, err := s.db.SongTags(r.Context(), song.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve song: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve song tags", err)
+		return
+	}
+
+	songs, err := s.similar.Similar(similar.DocumentOf(song, tags[song.ID]), limit)
+	if errors.Is(err, domain.ErrSimilarNotReady) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		s.log.Debug(op, "similarity index is not ready", err)
+		return
+	}
+	s.log.Info(op, "successfully found similar songs", len(songs))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(songs)
+}
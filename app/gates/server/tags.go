@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"net/http"
+	"strings"
+)
+
+// libraryPage ответ /library с фасетами
+type libraryPage struct {
+	Songs  []domain.Song                `json:"songs"`
+	Facets map[string][]domain.TagCount `json:"facets"` // пространство тегов -> теги по убыванию количества песен
+}
+
+type tagsResult struct {
+	Tags []domain.Tag `json:"tags"`
+}
+
+// facetNamespaces пространства тегов из параметра facets (или одноимённого заголовка), через запятую
+func facetNamespaces(r *http.Request) []string {
+	raw := r.URL.Query().Get("facets")
+	if raw == "" {
+		raw = r.Header.Get("facets")
+	}
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, namespace := range strings.Split(raw, ",") {
+		namespace = strings.ToLower(strings.TrimSpace(namespace))
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
+}
+
+func nonNilTags(tags []domain.Tag) []domain.Tag {
+	if tags == nil {
+		return []domain.Tag{}
+	}
+	return tags
+}
+
+// decodeTags читает тело запроса с тегами. Пустой список тегов - ошибка
+func decodeTags(r *http.Request) (domain.TagsRequest, []domain.Tag, error) {
+	var req domain.TagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, nil, err
+	}
+	defer r.Body.Close()
+	tags, err := domain.ParseTags(req.Tags)
+	if err != nil {
+		return req, nil, err
+	}
+	if len(tags) == 0 {
+		return req, nil, errors.New("tags are required")
+	}
+	return req, tags, nil
+}
+
+// AddSongTagsHandler godoc
+//
+// @Summary      Добавить теги песне
+// @Description  Добавляет песне теги вида namespace:value (genre:rock, mood:chill). Возвращает собственные теги песни, без тегов группы
+// @Tags         Tags
+// @Accept       json
+// @Produce      json
+// @Param        tags  body  domain.TagsRequest  true  "Песня и теги"
+// @Success      200     {object}  tagsResult
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /song/tags [post]
+func (s Server) AddSongTagsHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeSongTags(w, r, "gates.Server.AddSongTagsHandler", true)
+}
+
+// RemoveSongTagsHandler godoc
+//
+// @Summary      Снять теги с песни
+// @Description  Снимает с песни её теги. Теги группы так снять нельзя, они снимаются с группы. Возвращает оставшиеся собственные теги песни
+// @Tags         Tags
+// @Accept       json
+// @Produce      json
+// @Param        tags  body  domain.TagsRequest  true  "Песня и теги"
+// @Success      200     {object}  tagsResult
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /song/tags [delete]
+func (s Server) RemoveSongTagsHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeSongTags(w, r, "gates.Server.RemoveSongTagsHandler", false)
+}
+
+func (s Server) changeSongTags(w http.ResponseWriter, r *http.Request, op string, add bool) {
+	s.log.Info(op, "connected to "+op, "trying to change song tags")
+	req, tags, err := decodeTags(r)
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode tags", err)
+		return
+	}
+	song := domain.Song{GroupName: req.GroupName, SongName: req.SongName}
+	if err = song.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate song", err)
+		return
+	}
+
+	result, err := s.db.ChangeSongTags(r.Context(), song.GroupName, song.SongName, tags, add)
+	if errors.Is(err, domain.ErrSongNotFound) {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to change tags: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to change tags", err)
+		return
+	}
+	s.log.Info(op, "successfully changed song tags", song.SongName)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tagsResult{Tags: result})
+}
+
+// AddGroupTagsHandler godoc
+//
+// @Summary      Добавить теги группе
+// @Description  Добавляет группе теги вида namespace:value. Теги группы действуют на все её песни в фильтрах и фасетах
+// @Tags         Tags
+// @Accept       json
+// @Produce      json
+// @Param        name  path  string              true  "Название группы"
+// @Param        tags  body  domain.TagsRequest  true  "Теги, group и song не нужны"
+// @Success      200     {object}  tagsResult
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Группа не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /groups/{name}/tags [post]
+func (s Server) AddGroupTagsHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeGroupTags(w, r, "gates.Server.AddGroupTagsHandler", true)
+}
+
+// RemoveGroupTagsHandler godoc
+//
+// @Summary      Снять теги с группы
+// @Description  Снимает теги с группы, а значит и со всех её песен. Собственные теги песен не меняются
+// @Tags         Tags
+// @Accept       json
+// @Produce      json
+// @Param        name  path  string              true  "Название группы"
+// @Param        tags  body  domain.TagsRequest  true  "Теги, group и song не нужны"
+// @Success      200     {object}  tagsResult
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Группа не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /groups/{name}/tags [delete]
+func (s Server) RemoveGroupTagsHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeGroupTags(w, r, "gates.Server.RemoveGroupTagsHandler", false)
+}
+
+func (s Server) changeGroupTags(w http.ResponseWriter, r *http.Request, op string, add bool) {
+	s.log.Info(op, "connected to "+op, "trying to change group tags")
+	_, tags, err := decodeTags(r)
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode tags", err)
+		return
+	}
+	group := groupParam(r)
+
+	result, err := s.db.ChangeGroupTags(r.Context(), group, tags, add)
+	if err != nil {
+		s.writeGroupError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully changed group tags", group)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tagsResult{Tags: result})
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/transfer"
+	"net/http"
+	"strconv"
+)
+
+// ImportHandler godoc
+//
+// @Summary      Импорт песен из файла
+// @Description  Потоково читает CSV (с заголовком), NDJSON или плейлист M3U8/XSPF/PLS из multipart поля file и добавляет или обновляет песни. Ошибки отдельных строк не прерывают импорт и попадают в отчёт
+// @Tags         Library
+// @Accept       multipart/form-data
+// @Produce      json
+// @Produce      text/csv
+// @Param        file     formData  file    true   "CSV, NDJSON, M3U8, XSPF или PLS файл"
+// @Param        format   query     string  false  "csv, ndjson, m3u8, xspf или pls, по умолчанию по расширению файла"
+// @Param        mapping  query     string  false  "Маппинг колонок CSV, например Artist=group,Title=song"
+// @Param        dry_run  query     bool    false  "Только проверить файл, ничего не записывая"
+// @Param        enrich   query     bool    false  "Дополнять пустые поля через внешний API"
+// @Param        report   query     string  false  "csv - вернуть файл с ошибками вместо JSON отчёта"
+// @Success      200     {object}  transfer.ImportReport
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /import [post]
+func (s Server) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.ImportHandler"
+
+	s.log.Info(op, "connected to ImportHandler", "trying to import songs")
+	query := r.URL.Query()
+	opts := transfer.ImportOptions{Format: query.Get("format")}
+	var err error
+	if opts.Mapping, err = transfer.ParseMapping(query.Get("mapping")); err != nil {
+		http.Error(w, "Invalid mapping: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid mapping", err)
+		return
+	}
+	opts.DryRun, _ = strconv.ParseBool(query.Get("dry_run"))
+	opts.Enrich, _ = strconv.ParseBool(query.Get("enrich"))
+
+	// Файл читаем прямо из тела запроса, не сохраняя его целиком
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected multipart/form-data: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "not a multipart request", err)
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			http.Error(w, "Missing file field", http.StatusBadRequest)
+			s.log.Debug(op, "missing file field", err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Invalid multipart body: "+err.Error(), http.StatusBadRequest)
+			s.log.Debug(op, "invalid multipart body", err)
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		if opts.Format == "" {
+			opts.Format = transfer.FormatFromName(part.FileName())
+		}
+
+		report, err := transfer.NewImporter(s.db, s.enricher, s.log).Import(r.Context(), part, opts)
+		if errors.Is(err, transfer.ErrUnknownFormat) {
+			http.Error(w, "Unknown format, expected csv, ndjson, m3u8, xspf or pls", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Import failed: "+err.Error(), http.StatusInternalServerError)
+			s.log.Error(op, "import failed", err)
+			return
+		}
+
+		s.log.Info(op, "successfully imported songs", report.Total)
+		if query.Get("report") == transfer.FormatCSV {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="import_errors.csv"`)
+			w.WriteHeader(http.StatusOK)
+			transfer.WriteErrorReport(w, report)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+}
+
+// ExportHandler godoc
+//
+// @Summary      Выгрузка библиотеки
+// @Description  Потоково выгружает песни в CSV, NDJSON, JSON или плейлистом M3U8, XSPF, PLS для медиаплееров (песни без ссылки в плейлист не попадают). Фильтры те же, что у /library, их можно передать заголовками или query параметрами
+// @Tags         Library
+// @Produce      json
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Produce      application/vnd.apple.mpegurl
+// @Produce      application/xspf+xml
+// @Produce      audio/x-scpls
+// @Param        format         query   string  false  "csv, ndjson, json, m3u8, xspf или pls (по умолчанию json)"
+// @Param        group          query   string  false  "Название группы"
+// @Param        song           query   string  false  "Название песни"
+// @Param        text           query   string  false  "Часть текста песни"
+// @Param        link           query   string  false  "Ссылка на песню"
+// @Param        album          query   string  false  "Название альбома"
+// @Param        release_date   query   string  false  "Дата релиза в формате 16.07.2006"
+// @Param        sort           query   string  false  "Сортировка перед группой и песней, например -play_count"
+// @Param        limit          query   int     false  "Лимит выдачи"
+// @Param        offset         query   int     false  "Смещение выдачи"
+// @Success      200     {array}   domain.Song
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /export [get]
+func (s Server) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.ExportHandler"
+
+	s.log.Info(op, "connected to ExportHandler", "trying to export library")
+	filter, err := parseSongFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to parse filter", err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = transfer.FormatJSON
+	}
+	encoder, err := transfer.NewEncoder(format, w)
+	if err != nil {
+		http.Error(w, "Unknown format, expected csv, ndjson, json, m3u8, xspf or pls", http.StatusBadRequest)
+		s.log.Debug(op, "unknown format", format)
+		return
+	}
+
+	w.Header().Set("Content-Type", transfer.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="library.`+format+`"`)
+	exported := 0
+	err = s.db.StreamLibrary(r.Context(), filter, func(song domain.Song) error {
+		exported++
+		return encoder.Encode(song)
+	})
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err != nil {
+		// Заголовки уже могли уйти клиенту, поменять статус нельзя, поэтому просто обрываем ответ
+		s.log.Error(op, "failed to export library", err)
+		if exported == 0 {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Failed to export library: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	s.log.Info(op, "successfully exported songs", exported)
+}
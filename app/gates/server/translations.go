@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"net/http"
+)
+
+// translationResult ответ PUT /song/translation
+type translationResult struct {
+	Lang     string `json:"lang"`
+	Original bool   `json:"original"`
+	Sections int    `json:"sections"` // на сколько частей разобран текст
+	Aligned  bool   `json:"aligned"`  // частей столько же, сколько в оригинале, и их можно показывать рядом
+}
+
+// translationDelete запрос DELETE /song/translation
+type translationDelete struct {
+	GroupName domain.GroupName `json:"group"`
+	SongName  domain.SongName  `json:"song"`
+	Lang      string           `json:"lang"`
+}
+
+// songLanguages собирает тексты песни на всех языках, оригинал первым. Текст оригинала берётся из самой песни,
+// из song_lyrics - только его язык
+func (s Server) songLanguages(ctx context.Context, song domain.Song) ([]domain.Lyrics, error) {
+	stored, err := s.db.GetSongLyrics(ctx, song.ID)
+	if err != nil {
+		return nil, err
+	}
+	available := []domain.Lyrics{{Lang: "und", Original: true, Text: song.Text, Sections: song.Sections}}
+	for _, lyrics := range stored {
+		if lyrics.Original {
+			available[0].Lang = lyrics.Lang
+			continue
+		}
+		available = append(available, lyrics)
+	}
+	return available, nil
+}
+
+// sectionsPage части текста с start по end, перевод может оказаться короче оригинала
+func sectionsPage(sections []domain.Section, start int, end int) []domain.Section {
+	start = min(start, len(sections))
+	end = min(end, len(sections))
+	return sections[start:end]
+}
+
+// PutTranslationHandler godoc
+//
+// @Summary      Добавить или заменить перевод текста песни
+// @Description  Сохраняет текст песни на языке lang (BCP-47, например en или pt-BR). Если original = true, язык становится языком оригинала и текст песни заменяется этим текстом
+// @Tags         Songs
+// @Accept       json
+// @Produce      json
+// @Param        translation  body  domain.SongTranslation  true  "Песня, язык и текст"
+// @Success      200     {object}  translationResult  "Перевод заменён"
+// @Success      201     {object}  translationResult  "Перевод добавлен"
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /song/translation [put]
+func (s Server) PutTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.PutTranslationHandler"
+
+	s.log.Info(op, "connected to PutTranslationHandler", "trying to put translation")
+	var tr domain.SongTranslation
+	if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode request body", err)
+		return
+	}
+	defer r.Body.Close()
+	if err := tr.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate translation", err)
+		return
+	}
+
+	created, err := s.db.PutLyrics(r.Context(), tr)
+	if errors.Is(err, domain.ErrSongNotFound) {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save translation: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to save translation", err)
+		return
+	}
+
+	song, err := s.db.GetSong(tr.GroupName, tr.SongName)
+	if err != nil {
+		http.Error(w, "Failed to retrieve song: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve song", err)
+		return
+	}
+	sections := len(domain.ParseLyrics(tr.Text))
+	result := translationResult{
+		Lang:     tr.Lang,
+		Original: tr.Original,
+		Sections: sections,
+		Aligned:  sections == len(domain.ParseLyrics(song.Text)),
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	s.log.Info(op, "successfully saved translation", tr.Lang)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(song.Version))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// DeleteTranslationHandler godoc
+//
+// @Summary      Удалить перевод текста песни
+// @Description  Удаляет текст песни на языке lang. Текст самой песни не меняется, даже если удаляется язык оригинала
+// @Tags         Songs
+// @Accept       json
+// @Param        translation  body  translationDelete  true  "Песня и язык"
+// @Success      200     {string}  string  "Перевод удалён"
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      404     {object}  string  "Песня или перевод не найдены"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /song/translation [delete]
+func (s Server) DeleteTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.DeleteTranslationHandler"
+
+	s.log.Info(op, "connected to DeleteTranslationHandler", "trying to delete translation")
+	var req translationDelete
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode request body", err)
+		return
+	}
+	defer r.Body.Close()
+	song := domain.Song{GroupName: req.GroupName, SongName: req.SongName}
+	if err := song.Validate(); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate song", err)
+		return
+	}
+	lang, err := domain.CanonicalLang(req.Lang)
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid language", err)
+		return
+	}
+
+	err = s.db.DeleteLyrics(r.Context(), song.GroupName, song.SongName, lang)
+	switch {
+	case errors.Is(err, domain.ErrSongNotFound):
+		http.Error(w, "Song not found", http.StatusNotFound)
+		s.log.Debug(op, "song not found", err)
+	case errors.Is(err, domain.ErrTranslationNotFound):
+		http.Error(w, "Translation not found", http.StatusNotFound)
+		s.log.Debug(op, "translation not found", err)
+	case err != nil:
+		http.Error(w, "Failed to delete translation: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to delete translation", err)
+	default:
+		s.log.Info(op, "successfully deleted translation", lang)
+		w.WriteHeader(http.StatusOK)
+	}
+}
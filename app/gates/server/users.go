@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/auth"
+	"net/http"
+)
+
+func (s Server) writeUserError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+		s.log.Debug(op, "user not found", err)
+	case errors.Is(err, domain.ErrUserExists):
+		http.Error(w, "User already exists", http.StatusConflict)
+		s.log.Debug(op, "user already exists", err)
+	default:
+		http.Error(w, "Failed to update user: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to update user", err)
+	}
+}
+
+func writeUser(w http.ResponseWriter, status int, user domain.User) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(user)
+}
+
+// selfLockout не даёт администратору отнять у себя права на управление пользователями
+func (s Server) selfLockout(w http.ResponseWriter, r *http.Request, op string, id int64) bool {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	if !ok || principal.UserID != id {
+		return false
+	}
+	http.Error(w, "You can not disable yourself or drop your own admin role", http.StatusConflict)
+	s.log.Debug(op, "admin tried to lock themselves out", id)
+	return true
+}
+
+// GetUsersHandler godoc
+//
+// @Summary      Список пользователей
+// @Description  Возвращает всех пользователей с ролями. Требует право users:manage (роль admin)
+// @Tags         Admin
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200     {array}   domain.User
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Недостаточно прав"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /admin/users [get]
+func (s Server) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetUsersHandler"
+
+	users, err := s.db.GetUsers(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve users: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to retrieve users", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(users)
+}
+
+// CreateUserHandler godoc
+//
+// @Summary      Создать пользователя
+// @Description  Заводит пользователя с паролем и ролями (listener, editor, admin), без ролей пользователь получает listener. Требует право users:manage
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        user  body  domain.UserRequest  true  "Логин, пароль и роли"
+// @Success      201     {object}  domain.User
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Недостаточно прав"
+// @Failure      409     {object}  string  "Пользователь уже есть"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /admin/users [post]
+func (s Server) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.CreateUserHandler"
+
+	s.log.Info(op, "connected to CreateUserHandler", "trying to create user")
+	var req domain.UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode user", err)
+		return
+	}
+	defer r.Body.Close()
+	if len(req.Roles) == 0 {
+		req.Roles = []string{string(domain.RoleListener)}
+	}
+	roles, err := domain.ParseRoles(req.Roles)
+	if err == nil {
+		err = req.Credentials.Validate()
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate user", err)
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		http.Error(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to hash password", err)
+		return
+	}
+	user, err := s.db.CreateUser(r.Context(), req.Username, hash, roles...)
+	if err != nil {
+		s.writeUserError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully created user", user.Username)
+	writeUser(w, http.StatusCreated, user)
+}
+
+// UpdateUserHandler godoc
+//
+// @Summary      Изменить пользователя
+// @Description  Отключает или включает пользователя. Отключённый пользователь не может войти, его refresh токены отзываются, а выданные access токены и API-ключи сразу перестают проходить проверку прав. Требует право users:manage
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path  int               true  "id пользователя"
+// @Param        user  body  domain.UserPatch  true  "Изменения"
+// @Success      200     {object}  domain.User
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Недостаточно прав"
+// @Failure      404     {object}  string  "Пользователь не найден"
+// @Failure      409     {object}  string  "Нельзя отключить самого себя"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /admin/users/{id} [patch]
+func (s Server) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.UpdateUserHandler"
+
+	s.log.Info(op, "connected to UpdateUserHandler", "trying to update user")
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid user id", err)
+		return
+	}
+	var patch domain.UserPatch
+	if err = json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode user", err)
+		return
+	}
+	defer r.Body.Close()
+	if patch.Disabled != nil && *patch.Disabled && s.selfLockout(w, r, op, id) {
+		return
+	}
+
+	user, err := s.db.UpdateUser(r.Context(), id, patch)
+	if err != nil {
+		s.writeUserError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully updated user", user.Username)
+	writeUser(w, http.StatusOK, user)
+}
+
+// SetUserRolesHandler godoc
+//
+// @Summary      Назначить роли
+// @Description  Заменяет роли пользователя целиком: listener читает библиотеку, editor ещё и меняет её, admin удаляет, переименовывает группы, импортирует и управляет пользователями. Изменения действуют сразу. Требует право users:manage
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path  int                  true  "id пользователя"
+// @Param        roles  body  domain.RolesRequest  true  "Новый набор ролей"
+// @Success      200     {object}  domain.User
+// @Failure      400     {object}  string  "Неизвестная роль"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Недостаточно прав"
+// @Failure      404     {object}  string  "Пользователь не найден"
+// @Failure      409     {object}  string  "Нельзя снять роль admin с самого себя"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /admin/users/{id}/roles [put]
+func (s Server) SetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.SetUserRolesHandler"
+
+	s.log.Info(op, "connected to SetUserRolesHandler", "trying to set user roles")
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid user id", err)
+		return
+	}
+	var req domain.RolesRequest
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode roles", err)
+		return
+	}
+	defer r.Body.Close()
+	roles, err := domain.ParseRoles(req.Roles)
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate roles", err)
+		return
+	}
+	if !domain.Allowed(roles, domain.PermUsers) && s.selfLockout(w, r, op, id) {
+		return
+	}
+
+	user, err := s.db.SetUserRoles(r.Context(), id, roles)
+	if err != nil {
+		s.writeUserError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully set user roles", user.Username)
+	writeUser(w, http.StatusOK, user)
+}
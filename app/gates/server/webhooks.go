@@ -0,0 +1,325 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/webhooks"
+	"net/http"
+)
+
+// writeWebhookError отвечает на ошибки операций над подписками подходящим статусом
+func (s Server) writeWebhookError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrWebhookNotFound):
+		http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+		s.log.Debug(op, "webhook subscription not found", err)
+	case errors.Is(err, domain.ErrDeliveryNotFound):
+		http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+		s.log.Debug(op, "webhook delivery not found", err)
+	default:
+		http.Error(w, "Failed to process webhook subscription: "+err.Error(), http.StatusInternalServerError)
+		s.log.Error(op, "failed to process webhook subscription", err)
+	}
+}
+
+func (s Server) writeWebhookJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// CreateWebhookHandler godoc
+//
+// @Summary      Создать подписку на вебхуки
+// @Description  Подписывает url на события об изменениях песен и групп. event_types - типы событий song.create, song.update, song.delete, song.move, group.rename, group.merge, group.delete, пустой - все события, пустой groups - события всех групп. Каждая доставка подписывается HMAC-SHA256 от "<X-Webhook-Timestamp>.<тело>" секретом подписки и приходит в заголовке X-Webhook-Signature как sha256=<hex>. Если secret не задан, он генерируется. Секрет возвращается только в этом ответе. Адреса в localhost и внутренних сетях (loopback, частные, link-local) отклоняются, если не включён webhooks.allow_private
+// @Tags         Webhooks
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        webhook  body  domain.WebhookRequest  true  "Адрес, фильтры и секрет"
+// @Success      201     {object}  domain.WebhookSubscription
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Нет права webhooks:manage"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /webhooks [post]
+func (s Server) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.CreateWebhookHandler"
+
+	s.log.Info(op, "connected to CreateWebhookHandler", "trying to create webhook subscription")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	var req domain.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode webhook subscription", err)
+		return
+	}
+	defer r.Body.Close()
+	if err := req.Validate(s.cfg.Webhooks.AllowPrivate); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate webhook subscription", err)
+		return
+	}
+	if req.Secret == "" {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			http.Error(w, "Failed to create webhook subscription: "+err.Error(), http.StatusInternalServerError)
+			s.log.Error(op, "failed to generate webhook secret", err)
+			return
+		}
+		req.Secret = secret
+	}
+
+	subscription, err := s.db.CreateWebhook(r.Context(), principal.UserID, req)
+	if err != nil {
+		s.writeWebhookError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully created webhook subscription", subscription.ID)
+	s.writeWebhookJSON(w, http.StatusCreated, subscription)
+}
+
+// GetWebhooksHandler godoc
+//
+// @Summary      Список подписок на вебхуки
+// @Description  Возвращает подписки текущего пользователя без секретов
+// @Tags         Webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200     {array}   domain.WebhookSubscription
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Нет права webhooks:manage"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /webhooks [get]
+func (s Server) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetWebhooksHandler"
+
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	subscriptions, err := s.db.GetWebhooks(r.Context(), principal.UserID)
+	if err != nil {
+		s.writeWebhookError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully retrieved webhook subscriptions", len(subscriptions))
+	s.writeWebhookJSON(w, http.StatusOK, subscriptions)
+}
+
+// GetWebhookHandler godoc
+//
+// @Summary      Подписка на вебхуки
+// @Description  Возвращает подписку текущего пользователя. У отключённой подписки в disabled_reason указано почему
+// @Tags         Webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path  int  true  "id подписки"
+// @Success      200     {object}  domain.WebhookSubscription
+// @Failure      400     {object}  string  "Некорректный id"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Нет права webhooks:manage"
+// @Failure      404     {object}  string  "Подписка не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /webhooks/{id} [get]
+func (s Server) GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetWebhookHandler"
+
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid webhook id", err)
+		return
+	}
+	subscription, err := s.db.GetWebhook(r.Context(), principal.UserID, id)
+	if err != nil {
+		s.writeWebhookError(w, op, err)
+		return
+	}
+	s.writeWebhookJSON(w, http.StatusOK, subscription)
+}
+
+// UpdateWebhookHandler godoc
+//
+// @Summary      Изменить подписку на вебхуки
+// @Description  Меняет переданные поля подписки. Пустой массив event_types или groups снимает фильтр. enabled=true включает подписку, отключённую после череды неудачных доставок, и сбрасывает счётчик ошибок. Новый secret возвращается в ответе
+// @Tags         Webhooks
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path  int                    true  "id подписки"
+// @Param        webhook  body  domain.WebhookRequest  true  "Изменяемые поля"
+// @Success      200     {object}  domain.WebhookSubscription
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Нет права webhooks:manage"
+// @Failure      404     {object}  string  "Подписка не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /webhooks/{id} [patch]
+func (s Server) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.UpdateWebhookHandler"
+
+	s.log.Info(op, "connected to UpdateWebhookHandler", "trying to update webhook subscription")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid webhook id", err)
+		return
+	}
+	var patch domain.WebhookRequest
+	if err = json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to decode webhook subscription", err)
+		return
+	}
+	defer r.Body.Close()
+	if err = patch.ValidatePatch(s.cfg.Webhooks.AllowPrivate); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "failed to validate webhook subscription", err)
+		return
+	}
+
+	subscription, err := s.db.UpdateWebhook(r.Context(), principal.UserID, id, patch)
+	if err != nil {
+		s.writeWebhookError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully updated webhook subscription", id)
+	s.writeWebhookJSON(w, http.StatusOK, subscription)
+}
+
+// DeleteWebhookHandler godoc
+//
+// @Summary      Удалить подписку на вебхуки
+// @Description  Удаляет подписку вместе с журналом доставок, ждущие доставки не уйдут
+// @Tags         Webhooks
+// @Security     BearerAuth
+// @Param        id   path  int  true  "id подписки"
+// @Success      200     {string}  string  "Подписка удалена"
+// @Failure      400     {object}  string  "Некорректный id"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Нет права webhooks:manage"
+// @Failure      404     {object}  string  "Подписка не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /webhooks/{id} [delete]
+func (s Server) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.DeleteWebhookHandler"
+
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid webhook id", err)
+		return
+	}
+	if err = s.db.DeleteWebhook(r.Context(), principal.UserID, id); err != nil {
+		s.writeWebhookError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully deleted webhook subscription", id)
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetWebhookDeliveriesHandler godoc
+//
+// @Summary      Журнал доставок подписки
+// @Description  Возвращает доставки подписки, новые первыми: статус, число попыток, код последнего ответа и ошибку
+// @Tags         Webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path   int  true   "id подписки"
+// @Param        limit   query  int  false  "Размер страницы, по умолчанию 50"
+// @Param        offset  query  int  false  "Смещение"
+// @Success      200     {array}   domain.WebhookDelivery
+// @Failure      400     {object}  string  "Некорректный запрос"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Нет права webhooks:manage"
+// @Failure      404     {object}  string  "Подписка не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /webhooks/{id}/deliveries [get]
+func (s Server) GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.GetWebhookDeliveriesHandler"
+
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid webhook id", err)
+		return
+	}
+	limit, offset, err := queryPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid page", err)
+		return
+	}
+	deliveries, err := s.db.GetDeliveries(r.Context(), principal.UserID, id, limit, offset)
+	if err != nil {
+		s.writeWebhookError(w, op, err)
+		return
+	}
+	s.writeWebhookJSON(w, http.StatusOK, deliveries)
+}
+
+// RedeliverWebhookHandler godoc
+//
+// @Summary      Повторить доставку
+// @Description  Ставит в очередь новую доставку того же события, с тем же телом и новым X-Webhook-Id. Исходная доставка остаётся в журнале. Отключённой подписке доставка уйдёт, когда её включат
+// @Tags         Webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id        path  int  true  "id подписки"
+// @Param        delivery  path  int  true  "id доставки"
+// @Success      202     {object}  domain.WebhookDelivery
+// @Failure      400     {object}  string  "Некорректный id"
+// @Failure      401     {object}  auth.Problem  "Нет токена или API-ключа"
+// @Failure      403     {object}  auth.Problem  "Нет права webhooks:manage"
+// @Failure      404     {object}  string  "Подписка или доставка не найдена"
+// @Failure      500     {object}  string  "Ошибка сервера"
+// @Router       /webhooks/{id}/deliveries/{delivery}/redeliver [post]
+func (s Server) RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "gates.Server.RedeliverWebhookHandler"
+
+	s.log.Info(op, "connected to RedeliverWebhookHandler", "trying to redeliver webhook")
+	principal, ok := s.principal(w, r, op)
+	if !ok {
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid webhook id", err)
+		return
+	}
+	deliveryID, err := pathID(r, "delivery")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		s.log.Debug(op, "invalid delivery id", err)
+		return
+	}
+	delivery, err := s.db.Redeliver(r.Context(), principal.UserID, id, deliveryID)
+	if err != nil {
+		s.writeWebhookError(w, op, err)
+		return
+	}
+	s.log.Info(op, "successfully queued redelivery", delivery.ID)
+	s.writeWebhookJSON(w, http.StatusAccepted, delivery)
+}
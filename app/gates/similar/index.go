@@ -0,0 +1,194 @@
+package similar
+
+import (
+	"math"
+	"mobileSongLibrary/domain"
+	"sort"
+)
+
+// Веса составляющих сходства, в сумме 1
+const (
+	lyricsWeight = 0.55
+	tagsWeight   = 0.25
+	groupWeight  = 0.1
+	eraWeight    = 0.1
+	eraYears     = 10 // песни с разницей в eraYears лет и больше по эпохе не похожи
+)
+
+// Document песня, как её видит индекс
+type Document struct {
+	ID        int64
+	GroupName domain.GroupName
+	SongName  domain.SongName
+	Text      string
+	Year      int // год релиза, 0 - неизвестен
+	Tags      []domain.Tag
+}
+
+// vector разреженный вектор tf-idf с нормой 1, термы по возрастанию
+type vector struct {
+	terms   []int32
+	weights []float32
+}
+
+// cosine косинусное сходство двух векторов с нормой 1 - просто скалярное произведение по общим термам
+func cosine(a vector, b vector) float64 {
+	var dot float64
+	for i, j := 0, 0; i < len(a.terms) && j < len(b.terms); {
+		switch {
+		case a.terms[i] < b.terms[j]:
+			i++
+		case a.terms[i] > b.terms[j]:
+			j++
+		default:
+			dot += float64(a.weights[i]) * float64(b.weights[j])
+			i++
+			j++
+		}
+	}
+	return dot
+}
+
+type entry struct {
+	doc      Document
+	groupKey string
+	tags     map[domain.Tag]bool
+	vec      vector
+}
+
+// Index tf-idf векторы текстов всей библиотеки. Строится целиком и после этого только читается,
+// поэтому им можно пользоваться из нескольких горутин
+type Index struct {
+	terms   map[string]int32
+	idf     []float64
+	entries []entry
+}
+
+// Build считает idf по всем текстам и векторы каждой песни
+func Build(docs []Document) *Index {
+	idx := &Index{terms: map[string]int32{}}
+	tokens := make([][]string, len(docs))
+	var df []int
+	for i, doc := range docs {
+		tokens[i] = Tokenize(doc.Text)
+		seen := map[int32]bool{}
+		for _, token := range tokens[i] {
+			id, ok := idx.terms[token]
+			if !ok {
+				id = int32(len(df))
+				idx.terms[token] = id
+				df = append(df, 0)
+			}
+			if !seen[id] {
+				seen[id] = true
+				df[id]++
+			}
+		}
+	}
+	idx.idf = make([]float64, len(df))
+	for id, n := range df {
+		idx.idf[id] = math.Log(float64(1+len(docs))/float64(1+n)) + 1
+	}
+	idx.entries = make([]entry, len(docs))
+	for i, doc := range docs {
+		idx.entries[i] = idx.newEntry(doc, tokens[i])
+	}
+	return idx
+}
+
+// Len сколько песен в индексе
+func (idx *Index) Len() int {
+	return len(idx.entries)
+}
+
+func (idx *Index) newEntry(doc Document, tokens []string) entry {
+	e := entry{doc: doc, groupKey: domain.NormalizeKey(string(doc.GroupName)), tags: make(map[domain.Tag]bool, len(doc.Tags))}
+	for _, tag := range doc.Tags {
+		e.tags[tag] = true
+	}
+	counts := map[int32]int{}
+	for _, token := range tokens {
+		if id, ok := idx.terms[token]; ok { //слова, которых нет в корпусе, не с чем сравнивать
+			counts[id]++
+		}
+	}
+	for id := range counts {
+		e.vec.terms = append(e.vec.terms, id)
+	}
+	sort.Slice(e.vec.terms, func(i, j int) bool { return e.vec.terms[i] < e.vec.terms[j] })
+	e.vec.weights = make([]float32, len(e.vec.terms))
+	var norm float64
+	weights := make([]float64, len(e.vec.terms))
+	for i, id := range e.vec.terms {
+		weights[i] = (1 + math.Log(float64(counts[id]))) * idx.idf[id]
+		norm += weights[i] * weights[i]
+	}
+	norm = math.Sqrt(norm)
+	for i := range weights {
+		e.vec.weights[i] = float32(weights[i] / norm)
+	}
+	return e
+}
+
+// Similar limit самых похожих на doc песен индекса, кроме самой doc. Песню можно искать, даже если её ещё нет в индексе:
+// её вектор считается по idf индекса
+func (idx *Index) Similar(doc Document, limit int) []domain.SimilarSong {
+	target := idx.newEntry(doc, Tokenize(doc.Text))
+	result := []domain.SimilarSong{}
+	for _, candidate := range idx.entries {
+		if candidate.doc.ID == doc.ID {
+			continue
+		}
+		similar := score(target, candidate)
+		if similar.Score > 0 {
+			result = append(result, similar)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Score > result[j].Score })
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// score сходство двух песен: текст, общие теги, та же группа и близкий год релиза
+func score(a entry, b entry) domain.SimilarSong {
+	similar := domain.SimilarSong{GroupName: b.doc.GroupName, SongName: b.doc.SongName, Reasons: []string{}}
+	if lyrics := cosine(a.vec, b.vec); lyrics > 0 {
+		similar.Score += lyricsWeight * lyrics
+		if lyrics >= 0.1 {
+			similar.Reasons = append(similar.Reasons, "lyrics")
+		}
+	}
+	if tags := jaccard(a.tags, b.tags); tags > 0 {
+		similar.Score += tagsWeight * tags
+		similar.Reasons = append(similar.Reasons, "tags")
+	}
+	if a.groupKey == b.groupKey {
+		similar.Score += groupWeight
+		similar.Reasons = append(similar.Reasons, "group")
+	}
+	if a.doc.Year > 0 && b.doc.Year > 0 {
+		if era := 1 - math.Abs(float64(a.doc.Year-b.doc.Year))/eraYears; era > 0 {
+			similar.Score += eraWeight * era
+			if era >= 0.5 {
+				similar.Reasons = append(similar.Reasons, "era")
+			}
+		}
+	}
+	similar.Score = math.Round(similar.Score*1e4) / 1e4
+	return similar
+}
+
+func jaccard(a map[domain.Tag]bool, b map[domain.Tag]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for tag := range a {
+		if b[tag] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
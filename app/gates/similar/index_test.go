@@ -0,0 +1,93 @@
+package similar
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"os"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	require.Equal(t, []string{"chorus", "can't", "stop", "feeling", "любовь"},
+		Tokenize("[Chorus]\nI can't stop the FEELING, 'oh' — любовь и я"))
+}
+
+func TestIndexSimilar(t *testing.T) {
+	docs := []Document{
+		{ID: 1, GroupName: "Muse", SongName: "Uprising", Text: "they will not force us, they will stop degrading us, we will be victorious", Year: 2009, Tags: []domain.Tag{"genre:rock"}},
+		{ID: 2, GroupName: "Muse", SongName: "Resistance", Text: "love is our resistance, they keep us apart, we will be victorious", Year: 2009, Tags: []domain.Tag{"genre:rock"}},
+		{ID: 3, GroupName: "ABBA", SongName: "Dancing Queen", Text: "you can dance, you can jive, having the time of your life", Year: 1976, Tags: []domain.Tag{"genre:pop"}},
+		{ID: 4, GroupName: "Radiohead", SongName: "Karma Police", Text: "karma police arrest this man, he talks in maths", Year: 1997, Tags: []domain.Tag{"genre:rock"}},
+	}
+	idx := Build(docs)
+	require.Equal(t, 4, idx.Len())
+
+	similar := idx.Similar(docs[0], 2)
+	require.Len(t, similar, 2)
+	require.Equal(t, domain.SongName("Resistance"), similar[0].SongName)
+	require.ElementsMatch(t, []string{"lyrics", "tags", "group", "era"}, similar[0].Reasons)
+	require.Equal(t, domain.SongName("Karma Police"), similar[1].SongName)
+	for _, song := range idx.Similar(docs[0], 0) {
+		require.NotEqual(t, domain.SongName("Uprising"), song.SongName)
+		require.NotEqual(t, domain.SongName("Dancing Queen"), song.SongName) //ничего общего
+	}
+
+	// песню, которой ещё нет в индексе, тоже можно искать
+	fresh := Document{ID: 5, GroupName: "Unknown", SongName: "New", Text: "time of your life, dance"}
+	require.Equal(t, domain.SongName("Dancing Queen"), idx.Similar(fresh, 1)[0].SongName)
+}
+
+func TestCosine(t *testing.T) {
+	a := vector{terms: []int32{1, 3, 5}, weights: []float32{0.6, 0.8, 0}}
+	b := vector{terms: []int32{3, 4}, weights: []float32{1, 0}}
+	require.InDelta(t, 0.8, cosine(a, b), 1e-6)
+	require.Zero(t, cosine(a, vector{}))
+}
+
+// memStore библиотека в памяти
+type memStore struct {
+	fingerprint string
+	songs       []domain.Song
+	reads       int
+}
+
+func (m *memStore) LibraryFingerprint(context.Context) (string, error) {
+	return m.fingerprint, nil
+}
+
+func (m *memStore) StreamLibrary(_ context.Context, _ domain.SongFilter, fn func(domain.Song) error) error {
+	m.reads++
+	for _, song := range m.songs {
+		if err := fn(song); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memStore) SongTags(context.Context, ...int64) (map[int64][]domain.Tag, error) {
+	return map[int64][]domain.Tag{}, nil
+}
+
+func TestJobRebuildsOnlyOnChange(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{fingerprint: "1", songs: []domain.Song{{ID: 1, GroupName: "Muse", SongName: "Uprising", Text: "victorious"}}}
+	job := New(store, config.Similar{}, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	_, err := job.Similar(Document{ID: 2, Text: "victorious"}, 10)
+	require.ErrorIs(t, err, domain.ErrSimilarNotReady)
+
+	require.NoError(t, job.Refresh(ctx))
+	require.NoError(t, job.Refresh(ctx))
+	require.Equal(t, 1, store.reads)
+	similar, err := job.Similar(Document{ID: 2, Text: "victorious"}, 10)
+	require.NoError(t, err)
+	require.Len(t, similar, 1)
+
+	store.fingerprint = "2"
+	require.NoError(t, job.Refresh(ctx))
+	require.Equal(t, 2, store.reads)
+}
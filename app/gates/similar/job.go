@@ -0,0 +1,108 @@
+package similar
+
+import (
+	"context"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"sync/atomic"
+	"time"
+)
+
+// Store откуда берутся тексты и теги для индекса
+type Store interface {
+	LibraryFingerprint(ctx context.Context) (string, error)
+	StreamLibrary(ctx context.Context, filter domain.SongFilter, fn func(domain.Song) error) error
+	SongTags(ctx context.Context, ids ...int64) (map[int64][]domain.Tag, error)
+}
+
+// Job фоновая задача, которая держит в памяти индекс сходства песен и перестраивает его, когда библиотека меняется.
+// Поиск идёт по готовому индексу и бд не трогает
+type Job struct {
+	store       Store
+	log         *slog.Logger
+	interval    time.Duration
+	index       atomic.Pointer[Index]
+	fingerprint string
+}
+
+func New(store Store, cfg config.Similar, log *slog.Logger) *Job {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 30 * time.Minute
+	}
+	return &Job{store: store, log: log, interval: cfg.RefreshInterval}
+}
+
+// DocumentOf песня в виде документа индекса
+func DocumentOf(song domain.Song, tags []domain.Tag) Document {
+	doc := Document{ID: song.ID, GroupName: song.GroupName, SongName: song.SongName, Text: song.Text, Tags: tags}
+	if released := time.Time(song.ReleaseDate); !released.IsZero() {
+		doc.Year = released.Year()
+	}
+	return doc
+}
+
+// Run строит индекс при старте и затем раз в RefreshInterval, пока не отменён ctx
+func (j *Job) Run(ctx context.Context) {
+	const op = "gates.similar.Run"
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		if err := j.Refresh(ctx); err != nil && ctx.Err() == nil {
+			j.log.Error(op, "failed to build similarity index", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh перестраивает индекс, если библиотека изменилась с прошлого раза
+func (j *Job) Refresh(ctx context.Context) error {
+	const op = "gates.similar.Refresh"
+
+	fingerprint, err := j.store.LibraryFingerprint(ctx)
+	if err != nil {
+		return err
+	}
+	if j.index.Load() != nil && fingerprint == j.fingerprint {
+		return nil
+	}
+	started := time.Now()
+	var songs []domain.Song
+	err = j.store.StreamLibrary(ctx, domain.SongFilter{}, func(song domain.Song) error {
+		songs = append(songs, song)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, len(songs))
+	for i, song := range songs {
+		ids[i] = song.ID
+	}
+	tags, err := j.store.SongTags(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	docs := make([]Document, len(songs))
+	for i, song := range songs {
+		docs[i] = DocumentOf(song, tags[song.ID])
+	}
+	j.index.Store(Build(docs))
+	j.fingerprint = fingerprint
+	j.log.Info(op, "similarity index built, songs: ", len(docs), "took", time.Since(started).String())
+	return nil
+}
+
+// Similar limit песен, похожих на doc. Пока индекс не построен, возвращает domain.ErrSimilarNotReady
+func (j *Job) Similar(doc Document, limit int) ([]domain.SimilarSong, error) {
+	index := j.index.Load()
+	if index == nil {
+		return nil, domain.ErrSimilarNotReady
+	}
+	return index.Similar(doc, limit), nil
+}
@@ -0,0 +1,37 @@
+package similar
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopWords частые слова, которые ничего не говорят о песне. Самые частые слова корпуса и так получают низкий idf,
+// но служебные слова попадаются почти в каждом тексте и зря раздувают векторы
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`a an and are as at be but by do for from have he her his i if in into is it its
+		me my no not of oh on or our she so that the their them then there they this to up was we were what when will with
+		yeah you your
+		а без бы в во вот все всё да для до если же за и из или их к как ко когда ли меня мне мой моя мы на над не нет ни
+		но ну о об однако он она они оно от по под при с со так там то ты у уж что чтобы это я`) {
+		stopWords[word] = true
+	}
+}
+
+// Tokenize разбивает текст на слова в нижнем регистре без знаков препинания, однобуквенных слов и стоп-слов.
+// Метки частей вроде [Chorus] становятся обычными словами и из-за частоты почти не влияют на сходство
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	tokens := words[:0]
+	for _, word := range words {
+		word = strings.Trim(word, "'")
+		if len([]rune(word)) < 2 || stopWords[word] {
+			continue
+		}
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
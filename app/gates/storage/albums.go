@@ -0,0 +1,435 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"time"
+)
+
+type Album struct {
+	ID          int64            `db:"id"`
+	Title       string           `db:"title"`
+	TitleKey    string           `db:"title_key"`
+	GroupName   domain.GroupName `db:"group_name"`
+	GroupKey    string           `db:"group_key"`
+	ReleaseDate sql.NullTime     `db:"release_date"`
+	Type        domain.AlbumType `db:"type"`
+	Version     int              `db:"version"`
+	CreatedAt   time.Time        `db:"created_at"`
+	UpdatedAt   time.Time        `db:"updated_at"`
+}
+
+func (a Album) ToDomain() domain.Album {
+	album := domain.Album{
+		ID:        a.ID,
+		Title:     a.Title,
+		GroupName: a.GroupName,
+		Type:      a.Type,
+		Version:   a.Version,
+	}
+	if a.ReleaseDate.Valid {
+		album.ReleaseDate = domain.CustomDate(a.ReleaseDate.Time)
+	}
+	return album
+}
+
+// albumTrack строка трек-листа вместе с названием песни
+type albumTrack struct {
+	AlbumID   int64            `db:"album_id"`
+	Disc      int              `db:"disc"`
+	Track     int              `db:"track"`
+	GroupName domain.GroupName `db:"group_name"`
+	SongName  domain.SongName  `db:"song"`
+}
+
+func nullTime(date domain.CustomDate) sql.NullTime {
+	return sql.NullTime{Time: time.Time(date), Valid: !date.IsZero()}
+}
+
+// CreateAlbum создаёт альбом вместе с трек-листом. Песни трек-листа должны уже быть в библиотеке
+func (p *DB) CreateAlbum(ctx context.Context, album domain.Album) (domain.Album, error) {
+	const op = "storage.postgres.CreateAlbum"
+
+	p.log.Debug(op, "trying to create album: ", album.Title)
+	var result domain.Album
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		qry, args, err := p.sq.Insert("albums").
+			Columns("title", "title_key", "group_name", "group_key", "release_date", "type", "created_at", "updated_at").
+			Values(album.Title, domain.NormalizeKey(album.Title), p.groupDisplayName(album.GroupName), groupKey(album.GroupName),
+				nullTime(album.ReleaseDate), album.Type, time.Now(), time.Now()).
+			Suffix("RETURNING id").
+			ToSql()
+		if err != nil {
+			return err
+		}
+		var id int64
+		if err = tx.QueryRowxContext(ctx, qry, args...).Scan(&id); err != nil {
+			if isUniqueViolation(err) {
+				return domain.ErrAlbumConflict
+			}
+			return err
+		}
+		if err = p.setTracksTx(ctx, tx, id, album.Tracks); err != nil {
+			return err
+		}
+		if result, err = p.getAlbumTx(ctx, tx, id, false); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: domain.AuditAlbumCreate, target: domain.AlbumTarget(id), group: result.GroupName, after: result})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return result, err
+	}
+	p.log.Debug(op, "Successfully created album: ", album.Title, "id", result.ID)
+	return result, nil
+}
+
+// setTracksTx заменяет трек-лист альбома
+func (p *DB) setTracksTx(ctx context.Context, tx *sqlx.Tx, albumID int64, tracks []domain.Track) error {
+	qry, args, err := p.sq.Delete("album_songs").Where(sq.Eq{"album_id": albumID}).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+		return err
+	}
+	for _, track := range tracks {
+		qry, args, err := p.sq.Insert("album_songs").
+			Columns("album_id", "song_id", "disc", "track").
+			Select(p.sq.Select().
+				Column("?, id, ?, ?", albumID, track.Disc, track.Number).
+				From("songs_library").
+				Where(songKey(track.GroupName, track.SongName))).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, qry, args...)
+		if err != nil {
+			return err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			return fmt.Errorf("%w: %s - %s", domain.ErrSongNotFound, track.GroupName, track.SongName)
+		}
+	}
+	return nil
+}
+
+// getAlbumTx читает альбом с трек-листом, forUpdate блокирует его до конца транзакции
+func (p *DB) getAlbumTx(ctx context.Context, tx *sqlx.Tx, id int64, forUpdate bool) (domain.Album, error) {
+	query := p.sm.Select(p.sq.Select(), &Album{}).From("albums").Where(sq.Eq{"id": id})
+	if forUpdate {
+		query = query.Suffix("FOR UPDATE")
+	}
+	qry, args, err := query.ToSql()
+	if err != nil {
+		return domain.Album{}, err
+	}
+	var row Album
+	err = tx.GetContext(ctx, &row, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Album{}, domain.ErrAlbumNotFound
+	}
+	if err != nil {
+		return domain.Album{}, err
+	}
+	albums := []domain.Album{row.ToDomain()}
+	if err = p.loadTracks(ctx, tx, albums); err != nil {
+		return domain.Album{}, err
+	}
+	return albums[0], nil
+}
+
+// loadTracks заполняет трек-листы альбомов одним запросом
+func (p *DB) loadTracks(ctx context.Context, q sqlx.QueryerContext, albums []domain.Album) error {
+	if len(albums) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(albums))
+	index := make(map[int64]int, len(albums))
+	for i, album := range albums {
+		ids[i] = album.ID
+		index[album.ID] = i
+	}
+	qry, args, err := p.sq.Select("a.album_id", "a.disc", "a.track", "s.group_name", "s.song").
+		From("album_songs a").
+		Join("songs_library s ON s.id = a.song_id").
+		Where(sq.Eq{"a.album_id": ids}).
+		OrderBy("a.album_id", "a.disc", "a.track").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	var rows []albumTrack
+	if err = sqlx.SelectContext(ctx, q, &rows, qry, args...); err != nil {
+		return err
+	}
+	for i := range albums {
+		albums[i].Tracks = []domain.Track{}
+	}
+	for _, row := range rows {
+		album := &albums[index[row.AlbumID]]
+		album.Tracks = append(album.Tracks, domain.Track{Disc: row.Disc, Number: row.Track, GroupName: row.GroupName, SongName: row.SongName})
+	}
+	return nil
+}
+
+func (p *DB) GetAlbum(ctx context.Context, id int64) (domain.Album, error) {
+	const op = "storage.postgres.GetAlbum"
+
+	p.log.Debug(op, "trying to get album: ", id)
+	var result domain.Album
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = p.getAlbumTx(ctx, tx, id, false)
+		return err
+	})
+	if err != nil && !errors.Is(err, domain.ErrAlbumNotFound) {
+		p.log.Error(op, " ERROR: ", err)
+	}
+	return result, err
+}
+
+// UpdateAlbum меняет непустые поля альбома, patch.Tracks != nil заменяет трек-лист.
+// Если version больше нуля, изменение пройдёт только при совпадении версии альбома
+func (p *DB) UpdateAlbum(ctx context.Context, patch domain.Album, version int) (domain.Album, error) {
+	const op = "storage.postgres.UpdateAlbum"
+
+	p.log.Debug(op, "trying to update album: ", patch.ID)
+	var result domain.Album
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		current, err := p.getAlbumTx(ctx, tx, patch.ID, true)
+		if err != nil {
+			return err
+		}
+		if version > 0 && current.Version != version {
+			return domain.ErrVersionMismatch
+		}
+
+		query := p.sq.Update("albums").
+			Set("updated_at", time.Now()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"id": patch.ID})
+		if patch.Title != "" {
+			query = query.Set("title", patch.Title).Set("title_key", domain.NormalizeKey(patch.Title))
+		}
+		if patch.GroupName != "" {
+			query = query.Set("group_name", p.groupDisplayName(patch.GroupName)).Set("group_key", groupKey(patch.GroupName))
+		}
+		if !patch.ReleaseDate.IsZero() {
+			query = query.Set("release_date", nullTime(patch.ReleaseDate))
+		}
+		if patch.Type != "" {
+			query = query.Set("type", patch.Type)
+		}
+		qry, args, err := query.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			if isUniqueViolation(err) {
+				return domain.ErrAlbumConflict
+			}
+			return err
+		}
+		if patch.Tracks != nil {
+			if err = p.setTracksTx(ctx, tx, patch.ID, patch.Tracks); err != nil {
+				return err
+			}
+		}
+		if result, err = p.getAlbumTx(ctx, tx, patch.ID, false); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{
+			action: domain.AuditAlbumUpdate,
+			target: domain.AlbumTarget(patch.ID),
+			group:  result.GroupName,
+			before: current,
+			after:  result,
+		})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return result, err
+	}
+	p.log.Debug(op, "Successfully updated album: ", patch.ID)
+	return result, nil
+}
+
+// DeleteAlbum удаляет альбом, песни остаются в библиотеке
+func (p *DB) DeleteAlbum(ctx context.Context, id int64, version int) error {
+	const op = "storage.postgres.DeleteAlbum"
+
+	p.log.Debug(op, "trying to delete album: ", id)
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		current, err := p.getAlbumTx(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+		if version > 0 && current.Version != version {
+			return domain.ErrVersionMismatch
+		}
+		qry, args, err := p.sq.Delete("albums").Where(sq.Eq{"id": id}).ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: domain.AuditAlbumDelete, target: domain.AlbumTarget(id), group: current.GroupName, before: current})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	p.log.Debug(op, "Successfully deleted album: ", id)
+	return nil
+}
+
+// GroupAlbums дискография группы: альбомы по дате выхода вместе с трек-листами
+func (p *DB) GroupAlbums(ctx context.Context, group domain.GroupName) ([]domain.Album, error) {
+	const op = "storage.postgres.GroupAlbums"
+
+	p.log.Debug(op, "trying to get albums of group: ", group)
+	qry, args, err := p.sm.Select(p.sq.Select(), &Album{}).
+		From("albums").
+		Where(sq.Eq{"group_key": groupKey(group)}).
+		OrderBy("release_date NULLS LAST", "title_key").
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []Album
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	albums := make([]domain.Album, 0, len(rows))
+	for _, row := range rows {
+		albums = append(albums, row.ToDomain())
+	}
+	if err = p.loadTracks(ctx, p.db, albums); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	return albums, nil
+}
+
+// AddSongToAlbum ставит песню последним треком первого диска альбома album её группы, создавая альбом если его нет
+func (p *DB) AddSongToAlbum(ctx context.Context, group domain.GroupName, album string, song domain.SongName) error {
+	const op = "storage.postgres.AddSongToAlbum"
+
+	p.log.Debug(op, "trying to add song: ", song, "to album", album)
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		qry, args, err := p.sq.Insert("albums").
+			Columns("title", "title_key", "group_name", "group_key", "created_at", "updated_at").
+			Values(album, domain.NormalizeKey(album), p.groupDisplayName(group), groupKey(group), time.Now(), time.Now()).
+			Suffix("ON CONFLICT (group_key, title_key) DO UPDATE SET updated_at = EXCLUDED.updated_at RETURNING id, (xmax = 0)").
+			ToSql()
+		if err != nil {
+			return err
+		}
+		var albumID int64
+		var created bool
+		if err = tx.QueryRowxContext(ctx, qry, args...).Scan(&albumID, &created); err != nil {
+			return err
+		}
+		c := change{action: domain.AuditAlbumCreate, target: domain.AlbumTarget(albumID), group: group}
+		if !created {
+			before, err := p.getAlbumTx(ctx, tx, albumID, true)
+			if err != nil {
+				return err
+			}
+			c.action, c.before = domain.AuditAlbumUpdate, before
+		}
+		qry, args, err = p.sq.Insert("album_songs").
+			Columns("album_id", "song_id", "disc", "track").
+			Select(p.sq.Select().
+				Column("?, id, 1", albumID).
+				Column("(SELECT COALESCE(MAX(track), 0) + 1 FROM album_songs WHERE album_id = ? AND disc = 1)", albumID).
+				From("songs_library").
+				Where(songKey(group, song))).
+			Suffix("ON CONFLICT (album_id, song_id) DO NOTHING").
+			ToSql()
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, qry, args...)
+		if err != nil {
+			return err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 && !created {
+			return nil //песня уже в альбоме
+		}
+		after, err := p.getAlbumTx(ctx, tx, albumID, false)
+		if err != nil {
+			return err
+		}
+		c.after = after
+		return p.auditTx(ctx, tx, c)
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	return nil
+}
+
+// albumClashes названия альбомов, которые есть и у группы from, и у группы to
+func (p *DB) albumClashes(ctx context.Context, tx *sqlx.Tx, from string, to string) ([]string, error) {
+	qry, args, err := p.sq.Select("a.title").
+		From("albums a").
+		Join("albums b ON b.title_key = a.title_key AND b.group_key = ?", groupKey(domain.GroupName(to))).
+		Where(sq.Eq{"a.group_key": groupKey(domain.GroupName(from))}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var titles []string
+	err = tx.SelectContext(ctx, &titles, qry, args...)
+	return titles, err
+}
+
+// moveGroupAlbumsTx переносит альбомы группы from в группу to. Альбом, который уже есть у группы to,
+// сливается с ним: его треки дописываются в альбом to, если там ещё нет этой песни и место свободно
+func (p *DB) moveGroupAlbumsTx(ctx context.Context, tx *sqlx.Tx, from string, to string) error {
+	fromKey, toKey := groupKey(domain.GroupName(from)), groupKey(domain.GroupName(to))
+	statements := []sq.Sqlizer{
+		sq.Expr(`UPDATE album_songs SET album_id = t.id
+			FROM albums f JOIN albums t ON t.title_key = f.title_key AND t.group_key = ?
+			WHERE album_songs.album_id = f.id AND f.group_key = ? AND f.group_key <> t.group_key
+			AND NOT EXISTS (SELECT 1 FROM album_songs x WHERE x.album_id = t.id
+				AND (x.song_id = album_songs.song_id OR (x.disc = album_songs.disc AND x.track = album_songs.track)))`, toKey, fromKey),
+		sq.Expr(`DELETE FROM albums f USING albums t
+			WHERE f.group_key = ? AND t.group_key = ? AND t.title_key = f.title_key AND f.id <> t.id`, fromKey, toKey),
+		p.sq.Update("albums").
+			Set("group_name", p.groupDisplayName(domain.GroupName(to))).
+			Set("group_key", toKey).
+			Set("updated_at", time.Now()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"group_key": fromKey}),
+	}
+	for _, statement := range statements {
+		qry, args, err := statement.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, p.placeholders(qry), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeholders переводит ? в $1, $2... для запросов собранных через sq.Expr
+func (p *DB) placeholders(qry string) string {
+	qry, _ = sq.Dollar.ReplacePlaceholders(qry)
+	return qry
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"mobileSongLibrary/domain"
+	"strings"
+	"time"
+)
+
+// change одно изменение библиотеки: что сделали, с чем, и как оно выглядело до и после. nil - состояния нет
+type change struct {
+	action        domain.AuditAction
+	target        string
+	group         domain.GroupName // группа, к которой относится изменение, по ней потребители событий фильтруют
+	previousGroup domain.GroupName // прежняя группа, если изменение переносит песни между группами
+	before        interface{}
+	after         interface{}
+}
+
+// songChange изменение одной песни. before nil у добавления, after nil у удаления. Ключ - прежний ключ песни,
+// так у переноса вся история песни до переноса находится по одному ключу
+func songChange(action domain.AuditAction, before *domain.Song, after *domain.Song) change {
+	c := change{action: action}
+	if before != nil {
+		c.target, c.group, c.before = domain.SongTarget(before.GroupName, before.SongName), before.GroupName, *before
+	}
+	if after != nil {
+		if before == nil {
+			c.target = domain.SongTarget(after.GroupName, after.SongName)
+		} else if groupKey(before.GroupName) != groupKey(after.GroupName) {
+			c.previousGroup = before.GroupName
+		}
+		c.group, c.after = after.GroupName, *after
+	}
+	return c
+}
+
+// groupState состояние группы в журнале аудита
+type groupState struct {
+	GroupName string `json:"group"`
+	Songs     int    `json:"songs"`
+}
+
+// tagsState собственные теги песни или группы в журнале аудита
+type tagsState struct {
+	Tags []domain.Tag `json:"tags"`
+}
+
+// recordTx пишет изменение в журнал аудита и событие о нём в outbox в транзакции самого изменения, так что нет ни записей
+// об изменениях, которые откатились, ни изменений без записи. Автор берётся из контекста, см. domain.WithActor
+func (p *DB) recordTx(ctx context.Context, tx *sqlx.Tx, c change) error {
+	before, after, err := p.insertAuditTx(ctx, tx, c)
+	if err != nil {
+		return err
+	}
+	return p.enqueueTx(ctx, tx, c, before, after, domain.ActorFrom(ctx).RequestID)
+}
+
+// auditTx пишет изменение только в журнал аудита, без события в outbox. Так пишутся изменения из domain.AuditActions,
+// которых нет в domain.EventTypes: пользователи, плейлисты, подписки, карточки групп и т.д.
+func (p *DB) auditTx(ctx context.Context, tx *sqlx.Tx, c change) error {
+	_, _, err := p.insertAuditTx(ctx, tx, c)
+	return err
+}
+
+// insertAuditTx добавляет запись в журнал аудита и возвращает состояния до и после в JSON
+func (p *DB) insertAuditTx(ctx context.Context, tx *sqlx.Tx, c change) (interface{}, interface{}, error) {
+	before, err := auditJSON(c.before)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := auditJSON(c.after)
+	if err != nil {
+		return nil, nil, err
+	}
+	actor := domain.ActorFrom(ctx)
+	qry, args, err := p.sq.Insert("audit_log").
+		Columns("user_id", "username", "action", "target", "before", "after", "request_id", "client_ip", "created_at").
+		Values(nullInt(actor.UserID), nullString(actor.Username), string(c.action), c.target, before, after,
+			nullString(actor.RequestID), nullString(actor.ClientIP), time.Now()).
+		ToSql()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+func auditJSON(state interface{}) (interface{}, error) {
+	if state == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+func nullInt(n int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: n, Valid: n != 0}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// auditRow запись журнала аудита в бд
+type auditRow struct {
+	ID        int64          `db:"id"`
+	UserID    sql.NullInt64  `db:"user_id"`
+	Username  sql.NullString `db:"username"`
+	Action    string         `db:"action"`
+	Target    string         `db:"target"`
+	Before    []byte         `db:"before"`
+	After     []byte         `db:"after"`
+	RequestID sql.NullString `db:"request_id"`
+	ClientIP  sql.NullString `db:"client_ip"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (row auditRow) toDomain() domain.AuditEntry {
+	entry := domain.AuditEntry{
+		ID:        row.ID,
+		Username:  row.Username.String,
+		Action:    domain.AuditAction(row.Action),
+		Target:    row.Target,
+		Before:    row.Before,
+		After:     row.After,
+		RequestID: row.RequestID.String,
+		ClientIP:  row.ClientIP.String,
+		CreatedAt: row.CreatedAt,
+	}
+	if row.UserID.Valid {
+		entry.UserID = &row.UserID.Int64
+	}
+	return entry
+}
+
+// auditQuery выборка журнала по фильтру, новые записи первыми
+func (p *DB) auditQuery(filter domain.AuditFilter) sq.SelectBuilder {
+	query := p.sm.Select(p.sq.Select(), &auditRow{}).From("audit_log")
+	if filter.Username != "" {
+		query = query.Where(sq.Eq{"username": strings.ToLower(strings.TrimSpace(filter.Username))})
+	}
+	if filter.Action != "" {
+		query = query.Where(sq.Eq{"action": string(filter.Action)})
+	}
+	if prefix, ok := strings.CutSuffix(filter.Target, "*"); ok {
+		query = query.Where("target LIKE ?", escapeLike(prefix)+"%")
+	} else if filter.Target != "" {
+		query = query.Where(sq.Eq{"target": filter.Target})
+	}
+	if filter.RequestID != "" {
+		query = query.Where(sq.Eq{"request_id": filter.RequestID})
+	}
+	if !filter.From.IsZero() {
+		query = query.Where(sq.GtOrEq{"created_at": filter.From})
+	}
+	if !filter.To.IsZero() {
+		query = query.Where(sq.Lt{"created_at": filter.To})
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(uint64(filter.Limit))
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(uint64(filter.Offset))
+	}
+	return query.OrderBy("id DESC")
+}
+
+// StreamAudit отдаёт записи журнала аудита по фильтру в fn по одной через серверный курсор, как StreamLibrary.
+// Ошибка из fn прерывает чтение
+func (p *DB) StreamAudit(ctx context.Context, filter domain.AuditFilter, fn func(domain.AuditEntry) error) error {
+	const op = "storage.postgres.StreamAudit"
+
+	p.log.Debug(op, "trying to stream audit log, filter is: ", filter)
+	qry, args, err := p.auditQuery(filter).ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+
+	tx, err := p.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	defer tx.Rollback() //транзакция только читает, откат просто закрывает курсор
+
+	if _, err = tx.ExecContext(ctx, "DECLARE audit_export NO SCROLL CURSOR FOR "+qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	streamed := 0
+	for {
+		var rows []auditRow
+		err = tx.SelectContext(ctx, &rows, fmt.Sprintf("FETCH FORWARD %d FROM audit_export", exportFetchSize))
+		if err != nil {
+			p.log.Error(op, " ERROR: ", err)
+			return err
+		}
+		for _, row := range rows {
+			if err = fn(row.toDomain()); err != nil {
+				return err
+			}
+		}
+		streamed += len(rows)
+		if len(rows) < exportFetchSize {
+			break
+		}
+	}
+	p.log.Debug(op, "Successfully streamed audit entries: ", streamed)
+	return nil
+}
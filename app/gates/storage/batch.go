@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"strings"
+	"time"
+)
+
+// AddSongs вставляет песни одним многострочным INSERT в одной транзакции.
+// Возвращает для каждой песни была ли она добавлена: false значит песня с таким ключом уже есть
+func (p *DB) AddSongs(ctx context.Context, songs []Song) ([]bool, error) {
+	const op = "storage.postgres.AddSongs"
+
+	created := make([]bool, len(songs))
+	if len(songs) == 0 {
+		return created, nil
+	}
+	p.log.Debug(op, "trying to add songs: ", len(songs))
+	query := p.sq.Insert("songs_library").
+		Columns("group_name", "Song", "group_key", "song_key", "release_date", "text", "sections", "link", "lrc", "created_at", "updated_at")
+	// подзапрос groupDisplayName не видит строки своего же INSERT, поэтому новая группа, которая в пачке записана
+	// по-разному, получает написание из первой её песни
+	displayNames := make(map[string]domain.GroupName, len(songs))
+	for _, song := range songs {
+		if _, ok := displayNames[song.GroupKey]; !ok {
+			displayNames[song.GroupKey] = song.GroupName
+		}
+	}
+	now := time.Now()
+	for _, song := range songs {
+		query = query.Values(p.groupDisplayName(displayNames[song.GroupKey]), song.SongName, song.GroupKey, song.SongKey,
+			song.ReleaseDate, song.Text, song.Sections, song.Link, song.LRC, now, now)
+	}
+	qry, args, err := query.Suffix("ON CONFLICT (group_key, song_key) DO NOTHING RETURNING " + p.songColumns()).ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+
+	inserted := make(map[[2]string]bool, len(songs))
+	err = p.inTx(ctx, func(tx *sqlx.Tx) error {
+		var added []Song
+		if err := tx.SelectContext(ctx, &added, qry, args...); err != nil {
+			return err
+		}
+		for _, song := range added {
+			inserted[[2]string{song.GroupKey, song.SongKey}] = true
+			after := ToDomain(song)
+			if err := p.recordTx(ctx, tx, songChange(domain.AuditSongCreate, nil, &after)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+
+	for i, song := range songs {
+		key := [2]string{song.GroupKey, song.SongKey}
+		created[i] = inserted[key]
+		delete(inserted, key) //если в пачке была одна и та же песня дважды, добавленной считается только первая
+	}
+	p.log.Debug(op, "Successfully added songs: ", len(songs))
+	return created, nil
+}
+
+// UpsertSong добавляет песню, а если она уже есть - обновляет её непустые поля, как UpdateSong.
+// Возвращает true если песня была добавлена, false если обновлена или не изменилась
+func (p *DB) UpsertSong(ctx context.Context, song Song) (bool, error) {
+	const op = "storage.postgres.UpsertSong"
+
+	p.log.Debug(op, "trying to upsert Song: ", song.SongName)
+	now := time.Now()
+	query := p.sq.Insert("songs_library").
+		Columns("group_name", "Song", "group_key", "song_key", "release_date", "text", "sections", "link", "lrc", "created_at", "updated_at").
+		Values(p.groupDisplayName(song.GroupName), song.SongName, song.GroupKey, song.SongKey,
+			song.ReleaseDate, song.Text, song.Sections, song.Link, song.LRC, now, now)
+
+	// Пустыми полями уже существующие данные не затираем
+	var set []string
+	if song.Link != "" {
+		set = append(set, "link = EXCLUDED.link")
+	}
+	if !song.ReleaseDate.IsZero() {
+		set = append(set, "release_date = EXCLUDED.release_date")
+	}
+	if song.Text != "" {
+		set = append(set, "text = EXCLUDED.text", "sections = EXCLUDED.sections")
+	}
+	if song.LRC != "" {
+		set = append(set, "lrc = EXCLUDED.lrc")
+	}
+	if len(set) == 0 {
+		query = query.Suffix("ON CONFLICT (group_key, song_key) DO NOTHING RETURNING " + p.songColumns())
+	} else {
+		set = append(set, "updated_at = EXCLUDED.updated_at", "version = songs_library.version + 1")
+		query = query.Suffix("ON CONFLICT (group_key, song_key) DO UPDATE SET " + strings.Join(set, ", ") + " RETURNING " + p.songColumns())
+	}
+	qry, args, err := query.ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return false, err
+	}
+	p.log.Debug(op, "qry: ", qry, "args: ", args)
+
+	var created bool
+	err = p.inTx(ctx, func(tx *sqlx.Tx) error {
+		// до вставки блокируем уже существующую песню, чтобы записать в журнал её состояние до обновления
+		var before *domain.Song
+		locked, err := p.lockSong(ctx, tx, song.GroupName, song.SongName)
+		switch {
+		case err == nil:
+			existing := ToDomain(locked)
+			before = &existing
+		case !errors.Is(err, domain.ErrSongNotFound):
+			return err
+		}
+		var upserted Song
+		err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&upserted)
+		if errors.Is(err, sql.ErrNoRows) { //песня уже есть и обновлять в ней нечего
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		after := ToDomain(upserted)
+		action := domain.AuditSongUpdate
+		if before == nil {
+			created, action = true, domain.AuditSongCreate
+		}
+		return p.recordTx(ctx, tx, songChange(action, before, &after))
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return false, err
+	}
+	p.log.Debug(op, "Successfully upserted Song: ", song.SongName, "created", created)
+	return created, nil
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"time"
+)
+
+// chartEntriesQuery считает снимок $1 на момент $2: вес события падает вдвое каждые $3 секунд, события старше $4 секунд
+// не учитываются, добавление в избранное весит $5 прослушиваний
+const chartEntriesQuery = `INSERT INTO chart_entries (snapshot_id, song_id, rank, score, plays, favorites)
+SELECT $1, song_id, row_number() OVER (ORDER BY SUM(weight) DESC, song_id), SUM(weight), SUM(p), SUM(f) FROM (
+	SELECT song_id, power(0.5, EXTRACT(EPOCH FROM $2::timestamptz - played_at) / $3::float8) AS weight, 1 AS p, 0 AS f
+	FROM plays WHERE played_at > $2::timestamptz - make_interval(secs => $4::float8) AND played_at <= $2::timestamptz
+	UNION ALL
+	SELECT song_id, $5::float8 * power(0.5, EXTRACT(EPOCH FROM $2::timestamptz - created_at) / $3::float8), 0, 1
+	FROM favorites WHERE created_at > $2::timestamptz - make_interval(secs => $4::float8) AND created_at <= $2::timestamptz
+) e GROUP BY song_id`
+
+// RefreshChart считает новый снимок чарта window на момент now и оставляет только keep последних снимков.
+// Если тот же чарт сейчас считает другой экземпляр сервиса, ничего не делает
+func (p *DB) RefreshChart(ctx context.Context, window domain.ChartWindow, now time.Time, keep int) error {
+	const op = "storage.postgres.RefreshChart"
+
+	p.log.Debug(op, "trying to refresh chart: ", window)
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		var locked bool
+		if err := tx.GetContext(ctx, &locked, "SELECT pg_try_advisory_xact_lock(hashtext('chart:' || $1))", string(window)); err != nil {
+			return err
+		}
+		if !locked {
+			p.log.Debug(op, "chart is being refreshed by another instance: ", window)
+			return nil
+		}
+
+		var snapshotID int64
+		qry, args, err := p.sq.Insert("chart_snapshots").
+			Columns("period", "computed_at").
+			Values(string(window), now).
+			Suffix("RETURNING id").
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if err = tx.GetContext(ctx, &snapshotID, qry, args...); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, chartEntriesQuery, snapshotID, now,
+			window.HalfLife().Seconds(), window.Duration().Seconds(), domain.FavoriteWeight)
+		if err != nil {
+			return err
+		}
+
+		qry, args, err = p.sq.Delete("chart_snapshots").
+			Where(sq.Eq{"period": string(window)}).
+			Where(sq.Expr("id NOT IN (?)", sq.Select("id").From("chart_snapshots").
+				Where(sq.Eq{"period": string(window)}).
+				OrderBy("computed_at DESC").
+				Limit(uint64(keep)))).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, qry, args...)
+		return err
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	p.log.Debug(op, "Successfully refreshed chart: ", window)
+	return nil
+}
+
+// rankedChartQuery места песен снимка snapshotID среди песен, подходящих под filter
+func (p *DB) rankedChartQuery(snapshotID int64, filter domain.SongFilter) sq.SelectBuilder {
+	return sq.Select("ce.song_id", "ce.score", "ce.plays", "ce.favorites", "row_number() OVER (ORDER BY ce.score DESC, ce.song_id) AS rank").
+		From("chart_entries ce").
+		Where(sq.Eq{"ce.snapshot_id": snapshotID}).
+		Where(sq.Expr("ce.song_id IN (?)", p.filterLibrary(sq.Select("id").From("songs_library"), filter)))
+}
+
+// GetChart последний снимок чарта query.Window с местами внутри фильтра по группе и жанру
+// и изменением мест относительно предыдущего снимка
+func (p *DB) GetChart(ctx context.Context, query domain.ChartQuery) (domain.Chart, error) {
+	const op = "storage.postgres.GetChart"
+
+	chart := domain.Chart{Window: query.Window, Entries: []domain.ChartEntry{}}
+	qry, args, err := p.sq.Select("id", "computed_at").
+		From("chart_snapshots").
+		Where(sq.Eq{"period": string(query.Window)}).
+		OrderBy("computed_at DESC").
+		Limit(2).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return chart, err
+	}
+	var snapshots []struct {
+		ID         int64     `db:"id"`
+		ComputedAt time.Time `db:"computed_at"`
+	}
+	if err = p.db.SelectContext(ctx, &snapshots, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return chart, err
+	}
+	if len(snapshots) == 0 {
+		return chart, domain.ErrChartNotReady
+	}
+	chart.ComputedAt = snapshots[0].ComputedAt
+	previousID := int64(0) // снимка с id 0 нет, все песни будут новыми
+	if len(snapshots) > 1 {
+		previousID = snapshots[1].ID
+		chart.PreviousAt = &snapshots[1].ComputedAt
+	}
+
+	filter := domain.SongFilter{GroupName: query.Group}
+	if query.Genre != "" {
+		tag, err := domain.ParseTag("genre:" + query.Genre)
+		if err != nil {
+			return chart, err
+		}
+		filter.Tags = []domain.Tag{tag}
+	}
+	builder := p.sq.Select("s.group_name", "s.song", "cur.rank", "prev.rank AS previous_rank", "cur.score", "cur.plays", "cur.favorites").
+		From("songs_library s").
+		JoinClause(sq.Expr("JOIN (?) cur ON cur.song_id = s.id", p.rankedChartQuery(snapshots[0].ID, filter))).
+		JoinClause(sq.Expr("LEFT JOIN (?) prev ON prev.song_id = s.id", p.rankedChartQuery(previousID, filter))).
+		OrderBy("cur.rank")
+	if query.Limit > 0 {
+		builder = builder.Limit(uint64(query.Limit))
+	}
+	qry, args, err = builder.ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return chart, err
+	}
+	var rows []struct {
+		GroupName    string        `db:"group_name"`
+		SongName     string        `db:"song"`
+		Rank         int           `db:"rank"`
+		PreviousRank sql.NullInt64 `db:"previous_rank"`
+		Score        float64       `db:"score"`
+		Plays        int64         `db:"plays"`
+		Favorites    int64         `db:"favorites"`
+	}
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return chart, errors.Wrap(err, "failed to read chart")
+	}
+	for _, row := range rows {
+		entry := domain.ChartEntry{
+			Rank:      row.Rank,
+			GroupName: domain.GroupName(row.GroupName),
+			SongName:  domain.SongName(row.SongName),
+			Score:     row.Score,
+			Plays:     row.Plays,
+			Favorites: row.Favorites,
+		}
+		var previous *int
+		if row.PreviousRank.Valid {
+			rank := int(row.PreviousRank.Int64)
+			previous = &rank
+		}
+		entry.SetPrevious(previous)
+		chart.Entries = append(chart.Entries, entry)
+	}
+	return chart, nil
+}
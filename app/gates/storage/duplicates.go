@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"time"
+)
+
+// lockSong блокирует песню до конца транзакции
+func (p *DB) lockSong(ctx context.Context, tx *sqlx.Tx, group domain.GroupName, song domain.SongName) (Song, error) {
+	var result Song
+	qry, args, err := p.sm.Select(p.sq.Select(), &Song{}).
+		From("songs_library").
+		Where(songKey(group, song)).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return result, err
+	}
+	err = tx.GetContext(ctx, &result, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return result, domain.ErrSongNotFound
+	}
+	return result, err
+}
+
+// MergeSongs сливает песню pair.Drop в pair.Keep: пустые поля Keep заполняются данными Drop, после чего Drop удаляется.
+// Текст и LRC - одна и та же песня в двух видах, поэтому они берутся вместе у одной из песен, а не по отдельности
+func (p *DB) MergeSongs(ctx context.Context, pair domain.SongPair) (domain.Song, error) {
+	const op = "storage.postgres.MergeSongs"
+
+	p.log.Debug(op, "trying to merge Song: ", pair.Drop.SongName, "into", pair.Keep.SongName)
+	var result domain.Song
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		keep, err := p.lockSong(ctx, tx, pair.Keep.GroupName, pair.Keep.SongName)
+		if err != nil {
+			return err
+		}
+		kept := ToDomain(keep)
+		drop, err := p.lockSong(ctx, tx, pair.Drop.GroupName, pair.Drop.SongName)
+		if err != nil {
+			return err
+		}
+		dropped := ToDomain(drop)
+
+		if keep.Text == "" && keep.LRC == "" {
+			keep.Text, keep.LRC = drop.Text, drop.LRC
+		}
+		if keep.Link == "" {
+			keep.Link = drop.Link
+		}
+		if keep.ReleaseDate.IsZero() {
+			keep.ReleaseDate = drop.ReleaseDate
+		}
+
+		if err = p.repointSongRefs(ctx, tx, drop.ID, keep.ID); err != nil {
+			return err
+		}
+		if err = p.deleteSongTx(ctx, tx, drop.GroupName, drop.SongName); err != nil {
+			return err
+		}
+		qry, args, err := p.sq.Update("songs_library").
+			Set("text", keep.Text).
+			Set("sections", Sections(domain.ParseLyrics(keep.Text))).
+			Set("link", keep.Link).
+			Set("release_date", keep.ReleaseDate).
+			Set("lrc", keep.LRC).
+			Set("updated_at", time.Now()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"id": keep.ID}).
+			Suffix("RETURNING " + p.songColumns()).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		var merged Song
+		if err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&merged); err != nil {
+			return err
+		}
+		result = ToDomain(merged)
+		// ключ - удалённая песня, так её история заканчивается записью о том, куда она ушла
+		err = p.auditTx(ctx, tx, change{
+			action: domain.AuditSongMerge,
+			target: domain.SongTarget(dropped.GroupName, dropped.SongName),
+			group:  result.GroupName,
+			before: dropped,
+			after:  result,
+		})
+		if err != nil {
+			return err
+		}
+		// потребители событий о слиянии не знают, для них одна песня удалена, а другая изменилась
+		if err = p.eventTx(ctx, tx, songChange(domain.AuditSongDelete, &dropped, nil)); err != nil {
+			return err
+		}
+		return p.eventTx(ctx, tx, songChange(domain.AuditSongUpdate, &kept, &result))
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return result, err
+	}
+	p.log.Debug(op, "Successfully merged Song: ", pair.Drop.SongName, "into", pair.Keep.SongName)
+	return result, nil
+}
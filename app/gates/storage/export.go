@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"mobileSongLibrary/domain"
+)
+
+// exportFetchSize сколько строк за раз забирается из курсора
+const exportFetchSize = 500
+
+// StreamLibrary отдаёт песни по фильтру в fn по одной, читая их через серверный курсор,
+// так что вся выборка никогда не лежит в памяти. Ошибка из fn прерывает чтение
+func (p *DB) StreamLibrary(ctx context.Context, filter domain.SongFilter, fn func(domain.Song) error) error {
+	const op = "storage.postgres.StreamLibrary"
+
+	p.log.Debug(op, "trying to stream songs, filter is: ", filter)
+	qry, args, err := p.libraryQuery(filter).OrderBy("group_key", "song_key").ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+
+	tx, err := p.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	defer tx.Rollback() //транзакция только читает, откат просто закрывает курсор
+
+	if _, err = tx.ExecContext(ctx, "DECLARE library_export NO SCROLL CURSOR FOR "+qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	streamed := 0
+	for {
+		songs, err := p.fetchSongs(ctx, tx)
+		if err != nil {
+			p.log.Error(op, " ERROR: ", err)
+			return err
+		}
+		for _, song := range songs {
+			if err = fn(ToDomain(song)); err != nil {
+				return err
+			}
+		}
+		streamed += len(songs)
+		if len(songs) < exportFetchSize {
+			break
+		}
+	}
+	p.log.Debug(op, "Successfully streamed songs: ", streamed)
+	return nil
+}
+
+func (p *DB) fetchSongs(ctx context.Context, tx *sqlx.Tx) ([]Song, error) {
+	var songs []Song
+	err := tx.SelectContext(ctx, &songs, fmt.Sprintf("FETCH FORWARD %d FROM library_export", exportFetchSize))
+	return songs, err
+}
+
+// LibraryFingerprint меняется при любом добавлении, изменении или удалении песни, в том числе при смене тегов,
+// которая поднимает версию песен. По нему фоновые задачи понимают, что библиотеку пора перечитать
+func (p *DB) LibraryFingerprint(ctx context.Context) (string, error) {
+	const op = "storage.postgres.LibraryFingerprint"
+
+	var fingerprint string
+	err := p.db.GetContext(ctx, &fingerprint,
+		`SELECT COUNT(*) || ':' || COALESCE(SUM(version), 0) || ':' || COALESCE(MAX(updated_at)::text, '') FROM songs_library`)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return "", err
+	}
+	return fingerprint, nil
+}
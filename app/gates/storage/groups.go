@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"mobileSongLibrary/domain"
+	"time"
+)
+
+// lockGroupSongs блокирует до конца транзакции все песни группы и возвращает их по ключу названия
+func (p *DB) lockGroupSongs(ctx context.Context, tx *sqlx.Tx, group string) (map[string]Song, error) {
+	query := p.sm.Select(p.sq.Select(), &Song{}).
+		From("songs_library").
+		Where(sq.Eq{"group_key": groupKey(domain.GroupName(group))}).
+		Suffix("FOR UPDATE")
+	qry, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var rows []Song
+	if err = tx.SelectContext(ctx, &rows, qry, args...); err != nil {
+		return nil, err
+	}
+	songs := make(map[string]Song, len(rows))
+	for _, row := range rows {
+		songs[row.SongKey] = row
+	}
+	return songs, nil
+}
+
+// MergeGroups сливает группу merge.Source в merge.Target. Одноимённые песни разрешаются стратегией merge.StrategyFor,
+// проигравшая песня удаляется. Альбомы source переносятся в target, одноимённые альбомы сливаются,
+// карточка source переносится, только если у target своей нет. Всё выполняется в одной транзакции
+func (p *DB) MergeGroups(ctx context.Context, merge domain.GroupMerge) (domain.MergeResult, error) {
+	const op = "storage.postgres.MergeGroups"
+
+	p.log.Debug(op, "trying to merge group: ", merge.Source, " into ", merge.Target)
+	result := domain.MergeResult{Conflicts: []domain.MergeConflict{}}
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		source, err := p.lockGroupSongs(ctx, tx, merge.Source)
+		if err != nil {
+			return err
+		}
+		if len(source) == 0 {
+			return domain.ErrGroupNotFound
+		}
+		target, err := p.lockGroupSongs(ctx, tx, merge.Target)
+		if err != nil {
+			return err
+		}
+
+		for key, sourceSong := range source {
+			targetSong, clash := target[key]
+			if clash {
+				strategy := merge.StrategyFor(sourceSong.SongName)
+				keepSource := strategy == domain.KeepSource ||
+					strategy == domain.KeepNewest && sourceSong.UpdatedAt.After(targetSong.UpdatedAt)
+				conflict := domain.MergeConflict{SongName: sourceSong.SongName, Strategy: strategy, Kept: "target"}
+				winner, loser := targetSong, sourceSong
+				if keepSource {
+					conflict.Kept = "source"
+					winner, loser = sourceSong, targetSong
+				}
+				result.Conflicts = append(result.Conflicts, conflict)
+				if err = p.repointSongRefs(ctx, tx, loser.ID, winner.ID); err != nil {
+					return err
+				}
+				if err = p.deleteSongTx(ctx, tx, loser.GroupName, loser.SongName); err != nil {
+					return err
+				}
+				// в журнал слияние пишется одной записью group.merge, а потребителям событий нужно знать об удалённой песне
+				dropped := ToDomain(loser)
+				if err = p.eventTx(ctx, tx, songChange(domain.AuditSongDelete, &dropped, nil)); err != nil {
+					return err
+				}
+				if !keepSource {
+					continue
+				}
+			}
+			if err = p.moveSongTx(ctx, tx, sourceSong.GroupName, sourceSong.SongName, domain.GroupName(merge.Target)); err != nil {
+				return err
+			}
+			result.Moved++
+		}
+		if err = p.moveGroupDataTx(ctx, tx, merge.Source, merge.Target); err != nil {
+			return err
+		}
+		return p.recordTx(ctx, tx, change{
+			action:        domain.AuditGroupMerge,
+			target:        domain.GroupTarget(domain.GroupName(merge.Source)),
+			group:         domain.GroupName(merge.Target),
+			previousGroup: domain.GroupName(merge.Source),
+			before:        groupState{GroupName: merge.Source, Songs: len(source)},
+			after:         result,
+		})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return result, err
+	}
+	p.log.Debug(op, "Successfully merged group: ", merge.Source, "songs moved: ", result.Moved)
+	return result, nil
+}
+
+// moveGroupDataTx переносит всё, что привязано к ключу группы from, на группу to: альбомы, карточку и теги
+func (p *DB) moveGroupDataTx(ctx context.Context, tx *sqlx.Tx, from string, to string) error {
+	if err := p.moveGroupAlbumsTx(ctx, tx, from, to); err != nil {
+		return err
+	}
+	if err := p.moveGroupProfileTx(ctx, tx, from, to); err != nil {
+		return err
+	}
+	return p.moveGroupTagsTx(ctx, tx, from, to)
+}
+
+func (p *DB) deleteSongTx(ctx context.Context, tx *sqlx.Tx, group domain.GroupName, song domain.SongName) error {
+	qry, args, err := p.sq.Delete("songs_library").
+		Where(songKey(group, song)).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, qry, args...)
+	return err
+}
+
+func (p *DB) moveSongTx(ctx context.Context, tx *sqlx.Tx, group domain.GroupName, song domain.SongName, newGroup domain.GroupName) error {
+	qry, args, err := p.sq.Update("songs_library").
+		Set("group_name", p.groupDisplayName(newGroup)).
+		Set("group_key", groupKey(newGroup)).
+		Set("updated_at", time.Now()).
+		Set("version", sq.Expr("version + 1")).
+		Where(songKey(group, song)).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, qry, args...)
+	return err
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"time"
+)
+
+type Lyrics struct {
+	SongID    int64     `db:"song_id"`
+	Lang      string    `db:"lang"`
+	Text      string    `db:"text"`
+	Sections  Sections  `db:"sections"`
+	Original  bool      `db:"original"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+func (l Lyrics) ToDomain() domain.Lyrics {
+	return domain.Lyrics{Lang: l.Lang, Original: l.Original, Text: l.Text, Sections: l.Sections}
+}
+
+// lyricsChange изменение текста песни на одном языке для журнала аудита. nil - текста не было или больше нет
+func lyricsChange(action domain.AuditAction, song Song, before *domain.Lyrics, after *domain.Lyrics) change {
+	c := change{action: action, target: domain.SongTarget(song.GroupName, song.SongName), group: song.GroupName}
+	if before != nil {
+		c.before = *before
+	}
+	if after != nil {
+		c.after = *after
+	}
+	return c
+}
+
+// lyricsTx текст песни songID на языке lang, nil если его нет
+func (p *DB) lyricsTx(ctx context.Context, tx *sqlx.Tx, songID int64, lang string) (*domain.Lyrics, error) {
+	qry, args, err := p.sm.Select(p.sq.Select(), &Lyrics{}).
+		From("song_lyrics").
+		Where(sq.Eq{"song_id": songID, "lang": lang}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var row Lyrics
+	err = tx.GetContext(ctx, &row, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lyrics := row.ToDomain()
+	return &lyrics, nil
+}
+
+// PutLyrics добавляет или заменяет текст песни на языке tr.Lang и возвращает true если текста на этом языке ещё не было.
+// Если tr.Original, язык становится языком оригинала, а текст заменяет текст песни. Версия песни увеличивается
+func (p *DB) PutLyrics(ctx context.Context, tr domain.SongTranslation) (bool, error) {
+	const op = "storage.postgres.PutLyrics"
+
+	p.log.Debug(op, "trying to put lyrics: ", tr.SongName, "lang", tr.Lang)
+	sections := Sections(domain.ParseLyrics(tr.Text))
+	var created bool
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		song, err := p.lockSong(ctx, tx, tr.GroupName, tr.SongName)
+		if err != nil {
+			return err
+		}
+		before, err := p.lyricsTx(ctx, tx, song.ID, tr.Lang)
+		if err != nil {
+			return err
+		}
+
+		songUpdate := p.sq.Update("songs_library").
+			Set("updated_at", time.Now()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"id": song.ID})
+		if tr.Original {
+			// оригинал у песни один, прежний становится обычным переводом
+			qry, args, err := p.sq.Update("song_lyrics").
+				Set("original", false).
+				Where(sq.Eq{"song_id": song.ID, "original": true}).
+				Where(sq.NotEq{"lang": tr.Lang}).
+				ToSql()
+			if err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+				return err
+			}
+			songUpdate = songUpdate.Set("text", tr.Text).Set("sections", sections)
+		}
+
+		qry, args, err := p.sq.Insert("song_lyrics").
+			Columns("song_id", "lang", "text", "sections", "original", "created_at", "updated_at").
+			Values(song.ID, tr.Lang, tr.Text, sections, tr.Original, time.Now(), time.Now()).
+			Suffix("ON CONFLICT (song_id, lang) DO UPDATE SET text = EXCLUDED.text, sections = EXCLUDED.sections, " +
+				"original = EXCLUDED.original, updated_at = EXCLUDED.updated_at RETURNING (xmax = 0)").
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if err = tx.QueryRowxContext(ctx, qry, args...).Scan(&created); err != nil {
+			return err
+		}
+
+		qry, args, err = songUpdate.Suffix("RETURNING " + p.songColumns()).ToSql()
+		if err != nil {
+			return err
+		}
+		var updated Song
+		if err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&updated); err != nil {
+			return err
+		}
+		after := domain.Lyrics{Lang: tr.Lang, Original: tr.Original, Text: tr.Text, Sections: sections}
+		if err = p.auditTx(ctx, tx, lyricsChange(domain.AuditLyricsPut, song, before, &after)); err != nil {
+			return err
+		}
+		if !tr.Original {
+			return nil
+		}
+		// оригинал заменяет текст самой песни, об этом потребители событий узнают как об изменении песни
+		songBefore, songAfter := ToDomain(song), ToDomain(updated)
+		return p.eventTx(ctx, tx, songChange(domain.AuditSongUpdate, &songBefore, &songAfter))
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return false, err
+	}
+	p.log.Debug(op, "Successfully put lyrics: ", tr.SongName, "created", created)
+	return created, nil
+}
+
+// DeleteLyrics удаляет текст песни на языке lang. Текст песни при этом не меняется, даже если это был оригинал
+func (p *DB) DeleteLyrics(ctx context.Context, group domain.GroupName, songName domain.SongName, lang string) error {
+	const op = "storage.postgres.DeleteLyrics"
+
+	p.log.Debug(op, "trying to delete lyrics: ", songName, "lang", lang)
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		song, err := p.lockSong(ctx, tx, group, songName)
+		if err != nil {
+			return err
+		}
+		before, err := p.lyricsTx(ctx, tx, song.ID, lang)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return domain.ErrTranslationNotFound
+		}
+		qry, args, err := p.sq.Delete("song_lyrics").
+			Where(sq.Eq{"song_id": song.ID, "lang": lang}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		qry, args, err = p.sq.Update("songs_library").
+			Set("updated_at", time.Now()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"id": song.ID}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, lyricsChange(domain.AuditLyricsDelete, song, before, nil))
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	p.log.Debug(op, "Successfully deleted lyrics: ", songName, "lang", lang)
+	return nil
+}
+
+// GetSongLyrics возвращает все тексты песни, оригинал первым
+func (p *DB) GetSongLyrics(ctx context.Context, songID int64) ([]domain.Lyrics, error) {
+	const op = "storage.postgres.GetSongLyrics"
+
+	qry, args, err := p.sm.Select(p.sq.Select(), &Lyrics{}).
+		From("song_lyrics").
+		Where(sq.Eq{"song_id": songID}).
+		OrderBy("original DESC", "lang").
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []Lyrics
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	result := make([]domain.Lyrics, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row.ToDomain())
+	}
+	return result, nil
+}
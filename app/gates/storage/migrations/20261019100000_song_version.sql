@@ -0,0 +1,5 @@
+-- +goose Up
+-- Версия строки для оптимистичной блокировки, увеличивается при каждом изменении песни
+ALTER TABLE songs_library ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+-- +goose Down
+ALTER TABLE songs_library DROP COLUMN IF EXISTS version;
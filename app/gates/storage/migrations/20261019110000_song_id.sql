@@ -0,0 +1,8 @@
+-- +goose Up
+-- Суррогатный ключ песни. Название и группа песни могут меняться (переименование, слияние групп),
+-- поэтому всё что ссылается на песню (история, плейлисты и т.д.) должно ссылаться на id
+ALTER TABLE songs_library ADD COLUMN id BIGSERIAL;
+CREATE UNIQUE INDEX idx_song_id ON songs_library(id);
+-- +goose Down
+DROP INDEX IF EXISTS idx_song_id;
+ALTER TABLE songs_library DROP COLUMN IF EXISTS id;
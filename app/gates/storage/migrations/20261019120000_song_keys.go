@@ -0,0 +1,124 @@
+// Package migrations содержит миграции, которым мало SQL. SQL-миграции лежат рядом в .sql файлах,
+// goose собирает их вместе с зарегистрированными здесь Go-миграциями по номеру версии
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+	"mobileSongLibrary/domain"
+)
+
+func init() {
+	goose.AddMigrationContext(upSongKeys, downSongKeys)
+}
+
+// Каноничные ключи группы и песни считаются той же domain.NormalizeKey, что и у новых строк:
+// приближение на SQL (lower, normalize) расходится с case folding на символах вроде ß,
+// и такие строки потом не находились бы по ключу
+const addSongKeys = `ALTER TABLE songs_library ADD COLUMN group_key VARCHAR(255), ADD COLUMN song_key VARCHAR(255)`
+
+// Ключи уже посчитаны, дальше дубли по ключу сливаются и ставится уникальный индекс
+const mergeSongKeys = `
+-- Отчёт о дублях: сюда складываются строки, которые совпали по ключу с другой песней и были в неё слиты
+CREATE TABLE songs_library_collisions (
+    LIKE songs_library,
+    merged_into BIGINT NOT NULL,
+    detected_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+-- Из дублей остаётся последняя обновлённая песня
+INSERT INTO songs_library_collisions
+SELECT s.*, r.keep_id, NOW()
+FROM songs_library s
+JOIN (
+    SELECT id, first_value(id) OVER (PARTITION BY group_key, song_key ORDER BY updated_at DESC, id) AS keep_id
+    FROM songs_library
+) r ON r.id = s.id
+WHERE r.id <> r.keep_id;
+-- Пустые поля оставшейся песни заполняем данными из дублей
+UPDATE songs_library k SET
+    text = COALESCE(NULLIF(k.text, ''), c.text),
+    link = COALESCE(NULLIF(k.link, ''), c.link),
+    release_date = COALESCE(k.release_date, c.release_date)
+FROM songs_library_collisions c
+WHERE c.merged_into = k.id;
+DELETE FROM songs_library WHERE id IN (SELECT id FROM songs_library_collisions);
+
+-- У одной группы одно отображаемое название, берём его у последней обновлённой песни
+UPDATE songs_library s SET group_name = g.group_name
+FROM (
+    SELECT DISTINCT ON (group_key) group_key, group_name
+    FROM songs_library
+    ORDER BY group_key, updated_at DESC
+) g
+WHERE s.group_key = g.group_key AND s.group_name <> g.group_name;
+
+ALTER TABLE songs_library ALTER COLUMN group_key SET NOT NULL, ALTER COLUMN song_key SET NOT NULL;
+CREATE UNIQUE INDEX idx_song_key ON songs_library(group_key, song_key);
+`
+
+const dropSongKeys = `
+DROP INDEX IF EXISTS idx_song_key;
+-- Возвращаем слитые дубли обратно
+INSERT INTO songs_library (group_name, song, release_date, text, link, created_at, updated_at, version, id)
+SELECT group_name, song, release_date, text, link, created_at, updated_at, version, id
+FROM songs_library_collisions
+ON CONFLICT (group_name, song) DO NOTHING;
+DROP TABLE IF EXISTS songs_library_collisions;
+ALTER TABLE songs_library DROP COLUMN IF EXISTS group_key, DROP COLUMN IF EXISTS song_key;
+`
+
+func upSongKeys(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, addSongKeys); err != nil {
+		return err
+	}
+	if err := backfillSongKeys(ctx, tx); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, mergeSongKeys)
+	return err
+}
+
+func downSongKeys(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, dropSongKeys)
+	return err
+}
+
+// backfillSongKeys заполняет ключи существующих песен. Строки сначала читаются целиком:
+// на одном соединении транзакции нельзя писать, пока не дочитан курсор
+func backfillSongKeys(ctx context.Context, tx *sql.Tx) error {
+	type row struct {
+		id    int64
+		group string
+		song  string
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT id, group_name, song FROM songs_library`)
+	if err != nil {
+		return err
+	}
+	var songs []row
+	for rows.Next() {
+		var r row
+		if err = rows.Scan(&r.id, &r.group, &r.song); err != nil {
+			rows.Close()
+			return err
+		}
+		songs = append(songs, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE songs_library SET group_key = $1, song_key = $2 WHERE id = $3`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range songs {
+		if _, err = stmt.ExecContext(ctx, domain.NormalizeKey(r.group), domain.NormalizeKey(r.song), r.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
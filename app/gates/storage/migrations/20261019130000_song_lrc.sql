@@ -0,0 +1,5 @@
+-- +goose Up
+-- Синхронизированный текст песни в формате LRC, пустая строка - текста с метками времени нет
+ALTER TABLE songs_library ADD COLUMN lrc TEXT NOT NULL DEFAULT '';
+-- +goose Down
+ALTER TABLE songs_library DROP COLUMN IF EXISTS lrc;
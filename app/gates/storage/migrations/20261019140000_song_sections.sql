@@ -0,0 +1,6 @@
+-- +goose Up
+-- Текст песни, разобранный на части (куплеты, припевы...) через domain.ParseLyrics.
+-- Уже существующие песни разбираются при чтении, пока их текст не изменят
+ALTER TABLE songs_library ADD COLUMN sections JSONB NOT NULL DEFAULT '[]';
+-- +goose Down
+ALTER TABLE songs_library DROP COLUMN IF EXISTS sections;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- Тексты песни на разных языках. Текст оригинала по-прежнему лежит в songs_library.text,
+-- строка с original = true хранит его язык и его копию, которую поддерживает триггер ниже
+CREATE TABLE song_lyrics (
+    song_id BIGINT NOT NULL REFERENCES songs_library(id) ON DELETE CASCADE,
+    lang TEXT NOT NULL, -- BCP-47 тег в каноничном виде
+    text TEXT NOT NULL,
+    sections JSONB NOT NULL DEFAULT '[]',
+    original BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (song_id, lang)
+);
+-- У песни может быть только один оригинал
+CREATE UNIQUE INDEX idx_song_lyrics_original ON song_lyrics (song_id) WHERE original;
+
+-- +goose StatementBegin
+CREATE FUNCTION sync_original_lyrics() RETURNS trigger AS $$
+BEGIN
+    UPDATE song_lyrics SET text = NEW.text, sections = NEW.sections, updated_at = NOW()
+    WHERE song_id = NEW.id AND original;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER songs_library_sync_original_lyrics
+    AFTER UPDATE OF text ON songs_library
+    FOR EACH ROW WHEN (OLD.text IS DISTINCT FROM NEW.text)
+    EXECUTE FUNCTION sync_original_lyrics();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS songs_library_sync_original_lyrics ON songs_library;
+DROP FUNCTION IF EXISTS sync_original_lyrics();
+DROP TABLE IF EXISTS song_lyrics;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Альбомы групп. Группа и название хранятся так же как у песен: отображаемое название и каноничный ключ
+CREATE TABLE albums (
+    id BIGSERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    title_key TEXT NOT NULL,
+    group_name VARCHAR(255) NOT NULL,
+    group_key TEXT NOT NULL,
+    release_date TIMESTAMP WITH TIME ZONE,
+    type TEXT NOT NULL DEFAULT 'lp' CHECK (type IN ('lp', 'ep', 'single', 'compilation')),
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX idx_album_key ON albums(group_key, title_key);
+
+-- Трек-лист альбома. Одна песня может быть на нескольких альбомах (альбом, сингл, сборник)
+CREATE TABLE album_songs (
+    album_id BIGINT NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+    song_id BIGINT NOT NULL REFERENCES songs_library(id) ON DELETE CASCADE,
+    disc INTEGER NOT NULL DEFAULT 1 CHECK (disc > 0),
+    track INTEGER NOT NULL CHECK (track > 0),
+    PRIMARY KEY (album_id, song_id),
+    UNIQUE (album_id, disc, track)
+);
+CREATE INDEX idx_album_songs_song ON album_songs(song_id);
+-- +goose Down
+DROP TABLE IF EXISTS album_songs;
+DROP TABLE IF EXISTS albums;
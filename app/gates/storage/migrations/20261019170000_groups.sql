@@ -0,0 +1,18 @@
+-- +goose Up
+-- Карточки групп. Группа по-прежнему определяется песнями (songs_library.group_key), карточка необязательна
+CREATE TABLE groups (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    group_key TEXT NOT NULL,
+    country TEXT NOT NULL DEFAULT '',
+    formed_year INTEGER,
+    genres TEXT[] NOT NULL DEFAULT '{}',
+    members TEXT[] NOT NULL DEFAULT '{}',
+    description TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX idx_groups_key ON groups(group_key);
+-- +goose Down
+DROP TABLE IF EXISTS groups;
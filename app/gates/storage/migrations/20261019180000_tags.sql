@@ -0,0 +1,33 @@
+-- +goose Up
+-- Теги вида namespace:value (genre:rock, mood:chill)
+CREATE TABLE tags (
+    id BIGSERIAL PRIMARY KEY,
+    namespace TEXT NOT NULL,
+    value TEXT NOT NULL,
+    UNIQUE (namespace, value)
+);
+CREATE TABLE song_tags (
+    song_id BIGINT NOT NULL REFERENCES songs_library(id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (song_id, tag_id)
+);
+CREATE INDEX idx_song_tags_tag ON song_tags(tag_id);
+-- Теги группы, как и карточка, привязаны к ключу группы и действуют на все её песни
+CREATE TABLE group_tags (
+    group_key TEXT NOT NULL,
+    tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_key, tag_id)
+);
+CREATE INDEX idx_group_tags_tag ON group_tags(tag_id);
+-- Теги песни вместе с тегами её группы, по ним работают фильтры и фасеты
+CREATE VIEW song_effective_tags AS
+    SELECT song_id, tag_id FROM song_tags
+    UNION
+    SELECT s.id, g.tag_id FROM songs_library s JOIN group_tags g ON g.group_key = s.group_key;
+-- +goose Down
+DROP VIEW IF EXISTS song_effective_tags;
+DROP TABLE IF EXISTS group_tags;
+DROP TABLE IF EXISTS song_tags;
+DROP TABLE IF EXISTS tags;
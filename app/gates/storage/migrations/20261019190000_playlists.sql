@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE playlists (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+-- Порядок задаётся позициями с промежутками: вставка между двумя записями не трогает остальные,
+-- пока между соседями есть свободное место
+CREATE TABLE playlist_items (
+    id BIGSERIAL PRIMARY KEY,
+    playlist_id BIGINT NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+    song_id BIGINT NOT NULL REFERENCES songs_library(id) ON DELETE CASCADE,
+    position BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- проверка в конце запроса, чтобы перенумерация позиций одним UPDATE не упиралась в уникальность
+    UNIQUE (playlist_id, position) DEFERRABLE INITIALLY IMMEDIATE
+);
+CREATE INDEX idx_playlist_items_song ON playlist_items(song_id);
+-- +goose Down
+DROP TABLE IF EXISTS playlist_items;
+DROP TABLE IF EXISTS playlists;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE user_roles (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(32) NOT NULL CHECK (role IN ('listener', 'editor', 'admin')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role)
+);
+-- уже заведённые пользователи до появления ролей были полноправными
+INSERT INTO user_roles (user_id, role) SELECT id, 'admin' FROM users;
+-- +goose Down
+DROP TABLE IF EXISTS user_roles;
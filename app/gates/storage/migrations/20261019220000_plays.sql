@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE favorites (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    song_id BIGINT NOT NULL REFERENCES songs_library(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, song_id)
+);
+CREATE INDEX idx_favorites_song ON favorites(song_id);
+-- история прослушиваний, пишется пачками, songs_library при этом не трогается
+CREATE TABLE plays (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    song_id BIGINT NOT NULL REFERENCES songs_library(id) ON DELETE CASCADE,
+    client VARCHAR(64) NOT NULL DEFAULT '',
+    played_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX idx_plays_user ON plays(user_id, played_at DESC);
+CREATE INDEX idx_plays_song ON plays(song_id);
+-- счётчики прослушиваний для сортировки, одна строка на песню обновляется раз за пачку
+CREATE TABLE song_play_stats (
+    song_id BIGINT PRIMARY KEY REFERENCES songs_library(id) ON DELETE CASCADE,
+    play_count BIGINT NOT NULL DEFAULT 0,
+    last_played TIMESTAMP WITH TIME ZONE
+);
+-- +goose Down
+DROP TABLE IF EXISTS song_play_stats;
+DROP TABLE IF EXISTS plays;
+DROP TABLE IF EXISTS favorites;
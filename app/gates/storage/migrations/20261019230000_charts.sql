@@ -0,0 +1,25 @@
+-- +goose Up
+-- снимки чартов, их считает фоновая задача, чтение чарта не трогает plays и favorites
+CREATE TABLE chart_snapshots (
+    id BIGSERIAL PRIMARY KEY,
+    period VARCHAR(16) NOT NULL,
+    computed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX idx_chart_snapshots_period ON chart_snapshots(period, computed_at DESC);
+CREATE TABLE chart_entries (
+    snapshot_id BIGINT NOT NULL REFERENCES chart_snapshots(id) ON DELETE CASCADE,
+    song_id BIGINT NOT NULL REFERENCES songs_library(id) ON DELETE CASCADE,
+    rank INT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    plays BIGINT NOT NULL,
+    favorites BIGINT NOT NULL,
+    PRIMARY KEY (snapshot_id, song_id)
+);
+CREATE INDEX idx_chart_entries_song ON chart_entries(song_id);
+CREATE INDEX idx_plays_played_at ON plays(played_at);
+CREATE INDEX idx_favorites_created_at ON favorites(created_at);
+-- +goose Down
+DROP INDEX IF EXISTS idx_favorites_created_at;
+DROP INDEX IF EXISTS idx_plays_played_at;
+DROP TABLE IF EXISTS chart_entries;
+DROP TABLE IF EXISTS chart_snapshots;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- журнал аудита пишется в одной транзакции с изменением. user_id без внешнего ключа и username копией,
+-- чтобы записи переживали любые изменения пользователей
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT,
+    username VARCHAR(255),
+    action VARCHAR(64) NOT NULL,
+    target TEXT NOT NULL,
+    before JSONB,
+    after JSONB,
+    request_id TEXT,
+    client_ip TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX idx_audit_log_target ON audit_log(target text_pattern_ops);
+CREATE INDEX idx_audit_log_username ON audit_log(username);
+
+-- Журнал только пополняется: любые UPDATE, DELETE и TRUNCATE отклоняются
+-- +goose StatementBegin
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+-- +goose Down
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- события об изменениях библиотеки пишутся в одной транзакции с изменением, relay доставляет их во внешние системы.
+-- next_attempt_at одновременно и время следующей попытки, и аренда: взятое relay событие до этого времени никто больше не возьмёт
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(64) NOT NULL,
+    target TEXT NOT NULL,
+    group_name VARCHAR(255) NOT NULL,
+    group_key VARCHAR(255) NOT NULL,
+    previous_group_name VARCHAR(255),
+    previous_group_key VARCHAR(255),
+    before JSONB,
+    after JSONB,
+    request_id TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMP WITH TIME ZONE,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT
+);
+CREATE INDEX idx_outbox_pending ON outbox(next_attempt_at, id) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_published_at ON outbox(published_at) WHERE published_at IS NOT NULL;
+-- +goose Down
+DROP TABLE IF EXISTS outbox;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- плейлисты принадлежат пользователям и видны только владельцу. Плейлисты, созданные до этого, отдаются первому
+-- администратору, а если пользователей ещё нет - остаются без владельца и через API не видны
+ALTER TABLE playlists ADD COLUMN user_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+UPDATE playlists SET user_id = (SELECT user_id FROM user_roles WHERE role = 'admin' ORDER BY user_id LIMIT 1);
+CREATE INDEX idx_playlists_user ON playlists(user_id, name);
+-- +goose Down
+DROP INDEX IF EXISTS idx_playlists_user;
+ALTER TABLE playlists DROP COLUMN IF EXISTS user_id;
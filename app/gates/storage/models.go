@@ -1,17 +1,27 @@
 package storage
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"mobileSongLibrary/domain"
 	"time"
 )
 
 type Song struct {
+	ID          int64            `db:"id"`
 	GroupName   domain.GroupName `db:"group_name"`
 	SongName    domain.SongName  `db:"song"`
+	GroupKey    string           `db:"group_key"` // domain.NormalizeKey(GroupName), по нему ищутся песни
+	SongKey     string           `db:"song_key"`  // domain.NormalizeKey(SongName)
 	ReleaseDate time.Time        `db:"release_date"`
 	Text        string           `db:"text"`
+	Sections    Sections         `db:"sections"` // Text разобранный на части, пересчитывается при каждом изменении текста
 	Link        domain.Link      `db:"link"`
+	LRC         string           `db:"lrc"`
+	Version     int              `db:"version"`
+	UpdatedAt   time.Time        `db:"updated_at"`
 }
 
 func (s *Song) Validate() error {
@@ -26,20 +36,58 @@ func (s *Song) Validate() error {
 
 func ToStorage(dsong domain.Song) Song {
 	return Song{
+		ID:          dsong.ID,
 		GroupName:   dsong.GroupName,
 		SongName:    dsong.SongName,
+		GroupKey:    domain.NormalizeKey(string(dsong.GroupName)),
+		SongKey:     domain.NormalizeKey(string(dsong.SongName)),
 		ReleaseDate: time.Time(dsong.ReleaseDate),
 		Text:        dsong.Text,
+		Sections:    domain.ParseLyrics(dsong.Text),
 		Link:        dsong.Link,
+		LRC:         dsong.LRC,
+		Version:     dsong.Version,
 	}
 }
 
 func ToDomain(ssong Song) domain.Song {
 	return domain.Song{
+		ID:          ssong.ID,
 		GroupName:   ssong.GroupName,
 		SongName:    ssong.SongName,
 		ReleaseDate: domain.CustomDate(ssong.ReleaseDate),
 		Text:        ssong.Text,
+		Sections:    ssong.Sections,
 		Link:        ssong.Link,
+		LRC:         ssong.LRC,
+		Version:     ssong.Version,
 	}
 }
+
+// Sections части текста песни, хранятся в JSONB колонке
+type Sections []domain.Section
+
+// Value отдаёт JSON строкой: []byte lib/pq передаёт как bytea, и postgres не примет его в JSONB
+func (s Sections) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s)
+	return string(data), err
+}
+
+func (s *Sections) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("can't scan %T into Sections", src)
+	}
+	return json.Unmarshal(data, s)
+}
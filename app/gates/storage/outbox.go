@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"mobileSongLibrary/domain"
+	"sort"
+	"time"
+)
+
+// enqueueTx кладёт событие об изменении в outbox. before и after уже в JSON, как их пишет recordTx
+func (p *DB) enqueueTx(ctx context.Context, tx *sqlx.Tx, c change, before interface{}, after interface{}, requestID string) error {
+	var previousName, previousKey interface{}
+	if c.previousGroup != "" {
+		previousName, previousKey = string(c.previousGroup), groupKey(c.previousGroup)
+	}
+	qry, args, err := p.sq.Insert("outbox").
+		Columns("type", "target", "group_name", "group_key", "previous_group_name", "previous_group_key", "before", "after", "request_id").
+		Values(string(c.action), c.target, string(c.group), groupKey(c.group), previousName, previousKey, before, after, nullString(requestID)).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, qry, args...)
+	return err
+}
+
+// eventTx кладёт событие в outbox без записи в журнале аудита: так публикуются последствия изменения, которое
+// записано в журнал своим действием, например удаление песни при слиянии дубликатов
+func (p *DB) eventTx(ctx context.Context, tx *sqlx.Tx, c change) error {
+	before, err := auditJSON(c.before)
+	if err != nil {
+		return err
+	}
+	after, err := auditJSON(c.after)
+	if err != nil {
+		return err
+	}
+	return p.enqueueTx(ctx, tx, c, before, after, domain.ActorFrom(ctx).RequestID)
+}
+
+// eventRow событие outbox в бд
+type eventRow struct {
+	ID                int64          `db:"id"`
+	Type              string         `db:"type"`
+	Target            string         `db:"target"`
+	GroupName         string         `db:"group_name"`
+	PreviousGroupName sql.NullString `db:"previous_group_name"`
+	Before            []byte         `db:"before"`
+	After             []byte         `db:"after"`
+	RequestID         sql.NullString `db:"request_id"`
+	CreatedAt         time.Time      `db:"created_at"`
+	Attempts          int            `db:"attempts"`
+}
+
+func (row eventRow) toDomain() domain.Event {
+	return domain.Event{
+		ID:            row.ID,
+		Type:          domain.AuditAction(row.Type),
+		Target:        row.Target,
+		GroupName:     domain.GroupName(row.GroupName),
+		PreviousGroup: domain.GroupName(row.PreviousGroupName.String),
+		Before:        row.Before,
+		After:         row.After,
+		RequestID:     row.RequestID.String,
+		OccurredAt:    row.CreatedAt,
+		Attempts:      row.Attempts,
+	}
+}
+
+// ClaimEvents берёт до limit недоставленных событий, которым пора уйти, и сдвигает их следующую попытку на lease вперёд.
+// Пока аренда не истекла, другие экземпляры relay эти события не возьмут, а если relay упадёт не отметив результат,
+// события будут доставлены ещё раз. События отдаются в порядке id
+func (p *DB) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]domain.Event, error) {
+	const op = "storage.postgres.ClaimEvents"
+
+	due := sq.Select("id").
+		From("outbox").
+		Where("published_at IS NULL AND next_attempt_at <= NOW()").
+		OrderBy("id").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+	qry, args, err := p.sq.Update("outbox").
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("next_attempt_at", sq.Expr("NOW() + make_interval(secs => ?)", lease.Seconds())).
+		Where(sq.Expr("id IN (?)", due)).
+		Suffix("RETURNING " + p.columns(eventRow{})).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []eventRow
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	events := make([]domain.Event, len(rows))
+	for i, row := range rows {
+		events[i] = row.toDomain()
+	}
+	return events, nil
+}
+
+// MarkEventsPublished отмечает события доставленными
+func (p *DB) MarkEventsPublished(ctx context.Context, ids ...int64) error {
+	const op = "storage.postgres.MarkEventsPublished"
+
+	if len(ids) == 0 {
+		return nil
+	}
+	qry, args, err := p.sq.Update("outbox").
+		Set("published_at", sq.Expr("NOW()")).
+		Set("last_error", nil).
+		Where(sq.Expr("id = ANY(?)", pq.Int64Array(ids))).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	if _, err = p.db.ExecContext(ctx, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	return nil
+}
+
+// MarkEventFailed запоминает ошибку доставки события и откладывает следующую попытку на retryIn
+func (p *DB) MarkEventFailed(ctx context.Context, id int64, reason string, retryIn time.Duration) error {
+	const op = "storage.postgres.MarkEventFailed"
+
+	qry, args, err := p.sq.Update("outbox").
+		Set("last_error", reason).
+		Set("next_attempt_at", sq.Expr("NOW() + make_interval(secs => ?)", retryIn.Seconds())).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	if _, err = p.db.ExecContext(ctx, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	return nil
+}
+
+// PruneEvents удаляет события, доставленные раньше чем olderThan назад, и возвращает сколько удалено
+func (p *DB) PruneEvents(ctx context.Context, olderThan time.Duration) (int64, error) {
+	const op = "storage.postgres.PruneEvents"
+
+	qry, args, err := p.sq.Delete("outbox").
+		Where("published_at < NOW() - make_interval(secs => ?)", olderThan.Seconds()).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return 0, err
+	}
+	res, err := p.db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return 0, err
+	}
+	pruned, _ := res.RowsAffected()
+	return pruned, nil
+}
+
+// Notify отправляет payload слушателям канала Postgres LISTEN/NOTIFY
+func (p *DB) Notify(ctx context.Context, channel string, payload string) error {
+	const op = "storage.postgres.Notify"
+
+	if _, err := p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channel, payload); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	return nil
+}
+
+// GetEventsAfter до limit событий outbox с id больше afterID в порядке id, доставленных и нет. Это журнал, из которого
+// клиенты SSE догоняют пропущенные изменения, поэтому он хранится outbox.retention после доставки
+func (p *DB) GetEventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.Event, error) {
+	const op = "storage.postgres.GetEventsAfter"
+
+	qry, args, err := p.sm.Select(p.sq.Select(), &eventRow{}).
+		From("outbox").
+		Where(sq.Gt{"id": afterID}).
+		OrderBy("id").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []eventRow
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	events := make([]domain.Event, len(rows))
+	for i, row := range rows {
+		events[i] = row.toDomain()
+	}
+	return events, nil
+}
+
+// EventLogBounds id самого старого и самого нового события в outbox, нули если outbox пуст
+func (p *DB) EventLogBounds(ctx context.Context) (first int64, last int64, err error) {
+	const op = "storage.postgres.EventLogBounds"
+
+	qry, args, err := p.sq.Select("COALESCE(MIN(id), 0)", "COALESCE(MAX(id), 0)").From("outbox").ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return 0, 0, err
+	}
+	if err = p.db.QueryRowxContext(ctx, qry, args...).Scan(&first, &last); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return 0, 0, err
+	}
+	return first, last, nil
+}
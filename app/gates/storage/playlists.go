@@ -0,0 +1,450 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"strings"
+	"time"
+)
+
+// playlistGap шаг между позициями записей плейлиста. Новая запись встаёт посередине между соседями,
+// когда места между ними не остаётся, позиции плейлиста перенумеровываются заново
+const playlistGap = 1024
+
+type Playlist struct {
+	ID          int64     `db:"id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Songs       int       `db:"songs"`
+	Version     int       `db:"version"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+func (p Playlist) ToDomain() domain.Playlist {
+	return domain.Playlist{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Songs:       p.Songs,
+		Version:     p.Version,
+	}
+}
+
+// playlistsQuery плейлисты вместе с количеством песен
+func (p *DB) playlistsQuery() sq.SelectBuilder {
+	return p.sq.Select("p.id", "p.name", "p.description", "p.version", "p.created_at", "p.updated_at",
+		"(SELECT COUNT(*) FROM playlist_items i WHERE i.playlist_id = p.id) AS songs").
+		From("playlists p")
+}
+
+// CreatePlaylist создаёт пустой плейлист пользователя userID
+func (p *DB) CreatePlaylist(ctx context.Context, userID int64, playlist domain.Playlist) (domain.Playlist, error) {
+	const op = "storage.postgres.CreatePlaylist"
+
+	p.log.Debug(op, "trying to create playlist: ", playlist.Name)
+	var result domain.Playlist
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		qry, args, err := p.sq.Insert("playlists").
+			Columns("user_id", "name", "description", "created_at", "updated_at").
+			Values(userID, playlist.Name, playlist.Description, time.Now(), time.Now()).
+			Suffix("RETURNING id, name, description, version, created_at, updated_at, 0 AS songs").
+			ToSql()
+		if err != nil {
+			return err
+		}
+		var row Playlist
+		if err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&row); err != nil {
+			return err
+		}
+		result = row.ToDomain()
+		result.Items = []domain.PlaylistItem{}
+		return p.auditTx(ctx, tx, change{action: domain.AuditPlaylistCreate, target: domain.PlaylistTarget(result.ID), after: result})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.Playlist{}, err
+	}
+	p.log.Debug(op, "Successfully created playlist: ", playlist.Name, "id", result.ID)
+	return result, nil
+}
+
+// GetPlaylists плейлисты пользователя по названию, без записей
+func (p *DB) GetPlaylists(ctx context.Context, userID int64) ([]domain.Playlist, error) {
+	const op = "storage.postgres.GetPlaylists"
+
+	p.log.Debug(op, "trying to get playlists", "")
+	qry, args, err := p.playlistsQuery().Where(sq.Eq{"p.user_id": userID}).OrderBy("p.name", "p.id").ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []Playlist
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	playlists := make([]domain.Playlist, 0, len(rows))
+	for _, row := range rows {
+		playlists = append(playlists, row.ToDomain())
+	}
+	return playlists, nil
+}
+
+// getPlaylistTx читает плейлист пользователя userID с записями, forUpdate блокирует его до конца транзакции.
+// Чужой плейлист не находится
+func (p *DB) getPlaylistTx(ctx context.Context, tx *sqlx.Tx, userID int64, id int64, forUpdate bool) (domain.Playlist, error) {
+	query := p.playlistsQuery().Where(sq.Eq{"p.id": id, "p.user_id": userID})
+	if forUpdate {
+		query = query.Suffix("FOR UPDATE OF p")
+	}
+	qry, args, err := query.ToSql()
+	if err != nil {
+		return domain.Playlist{}, err
+	}
+	var row Playlist
+	err = tx.GetContext(ctx, &row, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Playlist{}, domain.ErrPlaylistNotFound
+	}
+	if err != nil {
+		return domain.Playlist{}, err
+	}
+	playlist := row.ToDomain()
+
+	qry, args, err = p.sq.Select("i.id", "s.group_name", "s.song").
+		From("playlist_items i").
+		Join("songs_library s ON s.id = i.song_id").
+		Where(sq.Eq{"i.playlist_id": id}).
+		OrderBy("i.position").
+		ToSql()
+	if err != nil {
+		return domain.Playlist{}, err
+	}
+	var items []struct {
+		ID        int64            `db:"id"`
+		GroupName domain.GroupName `db:"group_name"`
+		SongName  domain.SongName  `db:"song"`
+	}
+	if err = tx.SelectContext(ctx, &items, qry, args...); err != nil {
+		return domain.Playlist{}, err
+	}
+	playlist.Items = make([]domain.PlaylistItem, 0, len(items))
+	for _, item := range items {
+		playlist.Items = append(playlist.Items, domain.PlaylistItem{ID: item.ID, GroupName: item.GroupName, SongName: item.SongName})
+	}
+	return playlist, nil
+}
+
+// GetPlaylist плейлист пользователя с записями по порядку
+func (p *DB) GetPlaylist(ctx context.Context, userID int64, id int64) (domain.Playlist, error) {
+	const op = "storage.postgres.GetPlaylist"
+
+	p.log.Debug(op, "trying to get playlist: ", id)
+	var result domain.Playlist
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = p.getPlaylistTx(ctx, tx, userID, id, false)
+		return err
+	})
+	if err != nil && !errors.Is(err, domain.ErrPlaylistNotFound) {
+		p.log.Error(op, " ERROR: ", err)
+	}
+	return result, err
+}
+
+// UpdatePlaylist меняет непустые name и description.
+// Если version больше нуля, изменение пройдёт только при совпадении версии плейлиста
+func (p *DB) UpdatePlaylist(ctx context.Context, userID int64, patch domain.Playlist, version int) (domain.Playlist, error) {
+	const op = "storage.postgres.UpdatePlaylist"
+
+	p.log.Debug(op, "trying to update playlist: ", patch.ID)
+	var result domain.Playlist
+	err := p.changePlaylistTx(ctx, domain.AuditPlaylistUpdate, userID, patch.ID, version, func(tx *sqlx.Tx) error {
+		query := p.sq.Update("playlists").Where(sq.Eq{"id": patch.ID})
+		if patch.Name != "" {
+			query = query.Set("name", patch.Name)
+		}
+		if patch.Description != "" {
+			query = query.Set("description", patch.Description)
+		}
+		qry, args, err := query.ToSql()
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, qry, args...)
+		return err
+	}, &result)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return result, err
+	}
+	p.log.Debug(op, "Successfully updated playlist: ", patch.ID)
+	return result, nil
+}
+
+// DeletePlaylist удаляет плейлист, песни остаются в библиотеке
+func (p *DB) DeletePlaylist(ctx context.Context, userID int64, id int64, version int) error {
+	const op = "storage.postgres.DeletePlaylist"
+
+	p.log.Debug(op, "trying to delete playlist: ", id)
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		current, err := p.getPlaylistTx(ctx, tx, userID, id, true)
+		if err != nil {
+			return err
+		}
+		if version > 0 && current.Version != version {
+			return domain.ErrVersionMismatch
+		}
+		qry, args, err := p.sq.Delete("playlists").Where(sq.Eq{"id": id}).ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: domain.AuditPlaylistDelete, target: domain.PlaylistTarget(id), before: current})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	p.log.Debug(op, "Successfully deleted playlist: ", id)
+	return nil
+}
+
+// AddPlaylistItem добавляет песню в плейлист на место add.Index (по умолчанию в конец) и возвращает плейлист
+func (p *DB) AddPlaylistItem(ctx context.Context, userID int64, id int64, add domain.PlaylistAdd) (domain.Playlist, error) {
+	const op = "storage.postgres.AddPlaylistItem"
+
+	p.log.Debug(op, "trying to add song: ", add.SongName, "to playlist", id)
+	var result domain.Playlist
+	err := p.changePlaylistTx(ctx, domain.AuditPlaylistItems, userID, id, 0, func(tx *sqlx.Tx) error {
+		song, err := p.lockSong(ctx, tx, add.GroupName, add.SongName)
+		if err != nil {
+			return err
+		}
+		index := -1
+		if add.Index != nil {
+			index = *add.Index
+		}
+		position, err := p.playlistPositionTx(ctx, tx, id, 0, index)
+		if err != nil {
+			return err
+		}
+		qry, args, err := p.sq.Insert("playlist_items").
+			Columns("playlist_id", "song_id", "position", "created_at").
+			Values(id, song.ID, position, time.Now()).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, qry, args...)
+		return err
+	}, &result)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return result, err
+	}
+	p.log.Debug(op, "Successfully added song: ", add.SongName, "to playlist", id)
+	return result, nil
+}
+
+// RemovePlaylistItem убирает запись из плейлиста, остальные записи не сдвигаются
+func (p *DB) RemovePlaylistItem(ctx context.Context, userID int64, id int64, itemID int64) (domain.Playlist, error) {
+	const op = "storage.postgres.RemovePlaylistItem"
+
+	p.log.Debug(op, "trying to remove item: ", itemID, "from playlist", id)
+	var result domain.Playlist
+	err := p.changePlaylistTx(ctx, domain.AuditPlaylistItems, userID, id, 0, func(tx *sqlx.Tx) error {
+		qry, args, err := p.sq.Delete("playlist_items").Where(sq.Eq{"id": itemID, "playlist_id": id}).ToSql()
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, qry, args...)
+		if err != nil {
+			return err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			return domain.ErrPlaylistItemNotFound
+		}
+		return nil
+	}, &result)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return result, err
+	}
+	p.log.Debug(op, "Successfully removed item: ", itemID, "from playlist", id)
+	return result, nil
+}
+
+// MovePlaylistItem переносит запись на место index (с 0). Меняется позиция только этой записи,
+// кроме случая, когда между новыми соседями не осталось места
+func (p *DB) MovePlaylistItem(ctx context.Context, userID int64, id int64, itemID int64, index int) (domain.Playlist, error) {
+	const op = "storage.postgres.MovePlaylistItem"
+
+	p.log.Debug(op, "trying to move item: ", itemID, "to", index)
+	var result domain.Playlist
+	err := p.changePlaylistTx(ctx, domain.AuditPlaylistItems, userID, id, 0, func(tx *sqlx.Tx) error {
+		var exists bool
+		err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM playlist_items WHERE id = $1 AND playlist_id = $2)", itemID, id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return domain.ErrPlaylistItemNotFound
+		}
+		position, err := p.playlistPositionTx(ctx, tx, id, itemID, index)
+		if err != nil {
+			return err
+		}
+		qry, args, err := p.sq.Update("playlist_items").Set("position", position).Where(sq.Eq{"id": itemID}).ToSql()
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, qry, args...)
+		return err
+	}, &result)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return result, err
+	}
+	p.log.Debug(op, "Successfully moved item: ", itemID, "to", index)
+	return result, nil
+}
+
+// changePlaylistTx блокирует плейлист пользователя userID, проверяет версию (если version больше нуля), выполняет fn,
+// поднимает версию плейлиста, пишет action в журнал аудита и кладёт в result плейлист после изменения
+func (p *DB) changePlaylistTx(ctx context.Context, action domain.AuditAction, userID int64, id int64, version int, fn func(tx *sqlx.Tx) error, result *domain.Playlist) error {
+	return p.inTx(ctx, func(tx *sqlx.Tx) error {
+		current, err := p.getPlaylistTx(ctx, tx, userID, id, true)
+		if err != nil {
+			return err
+		}
+		if version > 0 && current.Version != version {
+			return domain.ErrVersionMismatch
+		}
+		if err = fn(tx); err != nil {
+			return err
+		}
+		qry, args, err := p.sq.Update("playlists").
+			Set("updated_at", time.Now()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"id": id}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		if *result, err = p.getPlaylistTx(ctx, tx, userID, id, false); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: action, target: domain.PlaylistTarget(id), before: current, after: *result})
+	})
+}
+
+// playlistPositionTx позиция для записи, которая должна встать на место index (index < 0 - в конец).
+// Запись skip (переносимая) при подсчёте мест не учитывается
+func (p *DB) playlistPositionTx(ctx context.Context, tx *sqlx.Tx, id int64, skip int64, index int) (int64, error) {
+	for attempt := 0; ; attempt++ {
+		query := p.sq.Select("position").
+			From("playlist_items").
+			Where(sq.Eq{"playlist_id": id}).
+			Where(sq.NotEq{"id": skip})
+		var neighbours []int64
+		switch {
+		case index < 0:
+			query = query.OrderBy("position DESC").Limit(1)
+		case index == 0:
+			query = query.OrderBy("position").Limit(1)
+		default:
+			query = query.OrderBy("position").Limit(2).Offset(uint64(index - 1))
+		}
+		qry, args, err := query.ToSql()
+		if err != nil {
+			return 0, err
+		}
+		if err = tx.SelectContext(ctx, &neighbours, qry, args...); err != nil {
+			return 0, err
+		}
+
+		switch {
+		case len(neighbours) == 0 && index > 0:
+			index = -1 //мест меньше чем index, ставим в конец
+			continue
+		case len(neighbours) == 0:
+			return playlistGap, nil
+		case index < 0:
+			return neighbours[0] + playlistGap, nil
+		case index == 0:
+			return neighbours[0] - playlistGap, nil
+		case len(neighbours) == 1:
+			return neighbours[0] + playlistGap, nil
+		}
+		prev, next := neighbours[0], neighbours[1]
+		if next-prev > 1 {
+			return prev + (next-prev)/2, nil
+		}
+		if attempt > 0 {
+			return 0, fmt.Errorf("no room between positions %d and %d after renumbering", prev, next)
+		}
+		if err = p.renumberPlaylistTx(ctx, tx, id); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// renumberPlaylistTx раздаёт записям плейлиста позиции заново с шагом playlistGap, сохраняя порядок
+func (p *DB) renumberPlaylistTx(ctx context.Context, tx *sqlx.Tx, id int64) error {
+	_, err := tx.ExecContext(ctx, `UPDATE playlist_items SET position = r.n * $2
+		FROM (SELECT id, row_number() OVER (ORDER BY position) AS n FROM playlist_items WHERE playlist_id = $1) r
+		WHERE playlist_items.id = r.id`, id, playlistGap)
+	return err
+}
+
+// GetPlaylistSongs песни плейлиста пользователя по порядку записей, для выгрузки в форматы плееров
+func (p *DB) GetPlaylistSongs(ctx context.Context, userID int64, id int64) (domain.Playlist, []domain.Song, error) {
+	const op = "storage.postgres.GetPlaylistSongs"
+
+	p.log.Debug(op, "trying to get playlist songs: ", id)
+	columns := strings.Split(p.songColumns(), ", ")
+	for i := range columns {
+		columns[i] = "s." + columns[i]
+	}
+	var playlist domain.Playlist
+	var rows []Song
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		if playlist, err = p.getPlaylistTx(ctx, tx, userID, id, false); err != nil {
+			return err
+		}
+		qry, args, err := p.sq.Select(columns...).
+			From("playlist_items i").
+			Join("songs_library s ON s.id = i.song_id").
+			Where(sq.Eq{"i.playlist_id": id}).
+			OrderBy("i.position").
+			ToSql()
+		if err != nil {
+			return err
+		}
+		return tx.SelectContext(ctx, &rows, qry, args...)
+	})
+	if err != nil {
+		if !errors.Is(err, domain.ErrPlaylistNotFound) {
+			p.log.Error(op, " ERROR: ", err)
+		}
+		return domain.Playlist{}, nil, err
+	}
+	songs := make([]domain.Song, 0, len(rows))
+	for _, row := range rows {
+		songs = append(songs, ToDomain(row))
+	}
+	return playlist, songs, nil
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+	"mobileSongLibrary/domain"
+	"time"
+)
+
+// savePlaysQuery пишет пачку прослушиваний одним запросом и добавляет их к счётчикам песен. Счётчики обновляются
+// по одной строке на песню за пачку и в порядке song_id, поэтому частые прослушивания одной песни не спорят
+// за блокировки ни друг с другом, ни с правками songs_library. Прослушивания удалённых за это время песен пропускаются,
+// запрос возвращает сколько прослушиваний записано, чтобы пропущенные можно было посчитать
+const savePlaysQuery = `WITH v AS (
+	SELECT NULLIF(u, 0) AS user_id, s AS song_id, c AS client, t AS played_at
+	FROM unnest($1::bigint[], $2::bigint[], $3::text[], $4::timestamptz[]) AS v(u, s, c, t)
+	WHERE EXISTS (SELECT 1 FROM songs_library l WHERE l.id = v.s)
+), inserted AS (
+	INSERT INTO plays (user_id, song_id, client, played_at) SELECT user_id, song_id, client, played_at FROM v RETURNING 1
+), stats AS (
+	INSERT INTO song_play_stats (song_id, play_count, last_played)
+	SELECT song_id, COUNT(*), MAX(played_at) FROM v GROUP BY song_id ORDER BY song_id
+	ON CONFLICT (song_id) DO UPDATE SET play_count = song_play_stats.play_count + EXCLUDED.play_count,
+	last_played = GREATEST(song_play_stats.last_played, EXCLUDED.last_played)
+)
+SELECT COUNT(*) FROM inserted`
+
+// SavePlays сохраняет пачку прослушиваний. Прослушивания песен, удалённых пока пачка ждала записи,
+// не сохраняются и попадают в лог с количеством
+func (p *DB) SavePlays(ctx context.Context, plays []domain.Play) error {
+	const op = "storage.postgres.SavePlays"
+
+	if len(plays) == 0 {
+		return nil
+	}
+	users := make(pq.Int64Array, len(plays))
+	songs := make(pq.Int64Array, len(plays))
+	clients := make(pq.StringArray, len(plays))
+	times := make(pq.StringArray, len(plays))
+	for i, play := range plays {
+		users[i], songs[i], clients[i] = play.UserID, play.SongID, play.Client
+		times[i] = play.PlayedAt.UTC().Format(time.RFC3339Nano)
+	}
+	var saved int
+	if err := p.db.GetContext(ctx, &saved, savePlaysQuery, users, songs, clients, times); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	if skipped := len(plays) - saved; skipped > 0 {
+		p.log.Warn(op, "skipped plays of deleted songs: ", skipped)
+	}
+	p.log.Debug(op, "saved plays: ", saved)
+	return nil
+}
+
+// SongPlayStats счётчики прослушиваний песен ids. Песен, которые не слушали, в ответе нет
+func (p *DB) SongPlayStats(ctx context.Context, ids ...int64) (map[int64]domain.PlayStats, error) {
+	const op = "storage.postgres.SongPlayStats"
+
+	result := make(map[int64]domain.PlayStats, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	qry, args, err := p.sq.Select("song_id", "play_count", "last_played").
+		From("song_play_stats").
+		Where(sq.Expr("song_id = ANY(?)", pq.Int64Array(ids))).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []struct {
+		SongID     int64        `db:"song_id"`
+		PlayCount  int64        `db:"play_count"`
+		LastPlayed sql.NullTime `db:"last_played"`
+	}
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	for _, row := range rows {
+		stats := domain.PlayStats{PlayCount: row.PlayCount}
+		if row.LastPlayed.Valid {
+			stats.LastPlayed = &row.LastPlayed.Time
+		}
+		result[row.SongID] = stats
+	}
+	return result, nil
+}
+
+// GetHistory прослушивания пользователя, последние первыми
+func (p *DB) GetHistory(ctx context.Context, userID int64, limit int, offset int) ([]domain.Play, error) {
+	const op = "storage.postgres.GetHistory"
+
+	query := p.sq.Select("s.group_name", "s.song", "pl.client", "pl.played_at").
+		From("plays pl").
+		Join("songs_library s ON s.id = pl.song_id").
+		Where(sq.Eq{"pl.user_id": userID}).
+		OrderBy("pl.played_at DESC", "pl.id DESC")
+	if limit > 0 {
+		query = query.Limit(uint64(limit)).Offset(uint64(offset))
+	}
+	qry, args, err := query.ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []struct {
+		GroupName string    `db:"group_name"`
+		SongName  string    `db:"song"`
+		Client    string    `db:"client"`
+		PlayedAt  time.Time `db:"played_at"`
+	}
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	plays := make([]domain.Play, len(rows))
+	for i, row := range rows {
+		plays[i] = domain.Play{
+			UserID:    userID,
+			GroupName: domain.GroupName(row.GroupName),
+			SongName:  domain.SongName(row.SongName),
+			Client:    row.Client,
+			PlayedAt:  row.PlayedAt,
+		}
+	}
+	return plays, nil
+}
+
+// AddFavorite добавляет песню в избранное пользователя. Повторное добавление не ошибка
+func (p *DB) AddFavorite(ctx context.Context, userID int64, group domain.GroupName, song domain.SongName) error {
+	const op = "storage.postgres.AddFavorite"
+
+	p.log.Debug(op, "trying to add favorite: ", song)
+	// плейсхолдеры вложенного запроса пронумерует внешний
+	row := sq.Select().
+		Column(sq.Expr("?::bigint", userID)).
+		Column("id").
+		Column(sq.Expr("?::timestamptz", time.Now())).
+		From("songs_library").
+		Where(songKey(group, song))
+	qry, args, err := p.sq.Insert("favorites").
+		Columns("user_id", "song_id", "created_at").
+		Select(row).
+		Suffix("ON CONFLICT (user_id, song_id) DO NOTHING").
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		if _, err = p.GetSong(group, song); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveFavorite убирает песню из избранного пользователя
+func (p *DB) RemoveFavorite(ctx context.Context, userID int64, group domain.GroupName, song domain.SongName) error {
+	const op = "storage.postgres.RemoveFavorite"
+
+	p.log.Debug(op, "trying to remove favorite: ", song)
+	qry, args, err := p.sq.Delete("favorites").
+		Where(sq.Eq{"user_id": userID}).
+		Where(sq.Expr("song_id = (?)", p.sq.Select("id").From("songs_library").Where(songKey(group, song)))).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return domain.ErrFavoriteNotFound
+	}
+	return nil
+}
+
+// GetFavorites избранное пользователя, последние добавленные первыми
+func (p *DB) GetFavorites(ctx context.Context, userID int64, limit int, offset int) ([]domain.Favorite, error) {
+	const op = "storage.postgres.GetFavorites"
+
+	query := p.sq.Select("s.group_name", "s.song", "f.created_at").
+		From("favorites f").
+		Join("songs_library s ON s.id = f.song_id").
+		Where(sq.Eq{"f.user_id": userID}).
+		OrderBy("f.created_at DESC", "f.song_id")
+	if limit > 0 {
+		query = query.Limit(uint64(limit)).Offset(uint64(offset))
+	}
+	qry, args, err := query.ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []struct {
+		GroupName string    `db:"group_name"`
+		SongName  string    `db:"song"`
+		AddedAt   time.Time `db:"created_at"`
+	}
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	favorites := make([]domain.Favorite, len(rows))
+	for i, row := range rows {
+		favorites[i] = domain.Favorite{GroupName: domain.GroupName(row.GroupName), SongName: domain.SongName(row.SongName), AddedAt: row.AddedAt}
+	}
+	return favorites, nil
+}
@@ -2,12 +2,17 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/bool64/sqluct"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"log/slog"
 	"mobileSongLibrary/domain"
+	"reflect"
+	"strings"
 	"time"
 )
 
@@ -27,42 +32,78 @@ func NewDB(db *sqlx.DB, log *slog.Logger) *DB {
 	}
 }
 
-func (p *DB) AddSong(song Song) error { //функция добавления новой песни
+// songKey условие поиска песни по каноничным ключам, так "muse"/"Supermassive black hole " найдёт "Muse"/"Supermassive Black Hole"
+func songKey(group domain.GroupName, song domain.SongName) sq.Eq {
+	return sq.Eq{"group_key": groupKey(group), "song_key": songKeyOf(song)}
+}
+
+func groupKey(group domain.GroupName) string {
+	return domain.NormalizeKey(string(group))
+}
+
+func songKeyOf(song domain.SongName) string {
+	return domain.NormalizeKey(string(song))
+}
+
+// groupDisplayName если группа с таким ключом уже есть, новая песня получает её отображаемое название,
+// чтобы у одной группы не было "Muse" и "MUSE" одновременно
+func (p *DB) groupDisplayName(group domain.GroupName) sq.Sqlizer {
+	return sq.Expr("COALESCE((SELECT group_name FROM songs_library WHERE group_key = ? LIMIT 1), ?)", groupKey(group), group)
+}
+
+// inTx выполняет fn в транзакции, откатывая её при любой ошибке
+func (p *DB) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit transaction")
+}
+
+func (p *DB) AddSong(ctx context.Context, song Song) error { //функция добавления новой песни
 	const op = "storage.postgres.AddSong"
 
 	p.log.Debug(op, "trying to add Song: ", song.SongName)
 	query := p.sq.Insert("songs_library").
-		Columns("group_name", "Song", "release_date", "text", "link", "created_at", "updated_at").
-		Values(song.GroupName, song.SongName, song.ReleaseDate, song.Text, song.Link, time.Now(), time.Now()).
-		Suffix("ON CONFLICT (group_name, Song) DO NOTHING")
+		Columns("group_name", "Song", "group_key", "song_key", "release_date", "text", "sections", "link", "lrc", "created_at", "updated_at").
+		Values(p.groupDisplayName(song.GroupName), song.SongName, groupKey(song.GroupName), songKeyOf(song.SongName),
+			song.ReleaseDate, song.Text, song.Sections, song.Link, song.LRC, time.Now(), time.Now()).
+		Suffix("ON CONFLICT (group_key, song_key) DO NOTHING RETURNING " + p.songColumns())
 	qry, args, err := query.ToSql()
 	if err != nil {
 		p.log.Error(op, " ERROR: ", err)
-		return err
+		return errors.Wrap(err, "failed to make query while adding Song")
 	}
 
 	p.log.Debug(op, "qry: ", qry, "args: ", args)
 
-	if err != nil {
-		return errors.Wrap(err, "failed to make query while adding Song")
-	}
-	rows, err := p.db.Exec(qry, args...)
+	err = p.inTx(ctx, func(tx *sqlx.Tx) error {
+		var added Song
+		err := tx.QueryRowxContext(ctx, qry, args...).StructScan(&added)
+		if errors.Is(err, sql.ErrNoRows) { //песня с такими ключами уже есть
+			return domain.ErrSongExists
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to add Song")
+		}
+		after := ToDomain(added)
+		return p.recordTx(ctx, tx, songChange(domain.AuditSongCreate, nil, &after))
+	})
 	if err != nil {
 		p.log.Error(op, " ERROR: ", err)
 		return err
 	}
-
-	if err != nil {
-		return errors.Wrap(err, "failed to add Song")
-	}
-	if affectedRows, _ := rows.RowsAffected(); affectedRows == 0 { //проверка на поменялось ли что
-		return errors.New("failed to add Song, no rows affected")
-	}
 	p.log.Debug(op, "Successfully added Song: ", song.SongName)
 	return nil
 }
 
-func (p *DB) UpdateSong(song Song) error {
+// UpdateSong обновляет непустые поля песни и возвращает её новую версию.
+// Если song.Version больше нуля, обновление пройдёт только при совпадении версии в бд
+func (p *DB) UpdateSong(ctx context.Context, song Song) (int, error) {
 	const op = "storage.postgres.UpdateSong"
 
 	p.log.Debug(op, "trying to update Song: ", song.SongName)
@@ -77,58 +118,161 @@ func (p *DB) UpdateSong(song Song) error {
 	if song.Link != "" { //проверка на то что линка не пустая
 		p.log.Debug(op, "Song link not empty, replacing with: ", song.Link)
 		query = query.Set("link", song.Link).
-			Where(sq.Eq{"group_name": song.GroupName, "Song": song.SongName})
+			Where(songKey(song.GroupName, song.SongName))
 	}
 	if !song.ReleaseDate.IsZero() {
 		p.log.Debug(op, "Song release_date not empty, replacing with: ", song.ReleaseDate)
 		query = query.Set("release_date", song.ReleaseDate).
-			Where(sq.Eq{"group_name": song.GroupName, "Song": song.SongName})
+			Where(songKey(song.GroupName, song.SongName))
 	}
 	if song.Text != "" {
 		p.log.Debug(op, "Song text not empty, replacing with: ", song.Text)
 		query = query.Set("text", song.Text).
-			Where(sq.Eq{"group_name": song.GroupName, "Song": song.SongName})
+			Set("sections", song.Sections).
+			Where(songKey(song.GroupName, song.SongName))
 	}
-	if song.Link == "" && song.ReleaseDate.IsZero() && song.Text == "" {
+	if song.LRC != "" {
+		p.log.Debug(op, "Song lrc not empty, replacing with: ", song.LRC)
+		query = query.Set("lrc", song.LRC).
+			Where(songKey(song.GroupName, song.SongName))
+	}
+	if song.Link == "" && song.ReleaseDate.IsZero() && song.Text == "" && song.LRC == "" {
 		p.log.Debug(op, "everything is empty, not doing anything", song.Link)
-		return domain.ErrCantReplaceWithEmptyRows
+		return 0, domain.ErrCantReplaceWithEmptyRows
 	}
 	query = query.Set("updated_at", time.Now()).
-		Where(sq.Eq{"group_name": song.GroupName, "Song": song.SongName})
-	qry, args, err := query.ToSql()
+		Set("version", sq.Expr("version + 1")).
+		Where(songKey(song.GroupName, song.SongName))
+	if song.Version > 0 { //оптимистичная блокировка, обновляем только ту версию которую видел клиент
+		query = query.Where(sq.Eq{"version": song.Version})
+	}
+	qry, args, err := query.Suffix("RETURNING " + p.songColumns()).ToSql()
 	if err != nil {
 		p.log.Error(op, " ERROR: ", err)
-		return err
+		return 0, err
 	}
 	p.log.Debug(op, "qry: ", qry, "args: ", args)
-	_, err = p.db.Exec(qry, args...)
+	var version int
+	err = p.inTx(ctx, func(tx *sqlx.Tx) error {
+		locked, err := p.lockSong(ctx, tx, song.GroupName, song.SongName)
+		if err != nil {
+			return err
+		}
+		before := ToDomain(locked)
+		var updated Song
+		err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&updated)
+		if errors.Is(err, sql.ErrNoRows) { //песня есть и заблокирована, значит не совпала версия
+			return domain.ErrVersionMismatch
+		}
+		if err != nil {
+			return err
+		}
+		version = updated.Version
+		after := ToDomain(updated)
+		return p.recordTx(ctx, tx, songChange(domain.AuditSongUpdate, &before, &after))
+	})
+	if errors.Is(err, domain.ErrSongNotFound) || errors.Is(err, domain.ErrVersionMismatch) {
+		p.log.Debug(op, "Song not updated: ", err)
+		return 0, err
+	}
 	if err != nil {
 		p.log.Error(op, " ERROR: ", err)
-		return err
+		return 0, err
 	}
 	p.log.Debug(op, "Successfully updated Song: ", song.SongName)
-	return nil
+	return version, nil
 }
 
-func (p *DB) GroupRename(oldGroupName string, newGroupName string) error {
-	const op = "storage.postgres.GroupRename"
-
-	p.log.Debug(op, "trying to rename group: ", oldGroupName, " to ", newGroupName)
-	query := p.sq.Update("songs_library").
-		Set("group_name", newGroupName).
-		Where(sq.Eq{"group_name": oldGroupName})
-	qry, args, err := query.ToSql()
+// whyNotAffected объясняет почему изменение песни не затронуло ни одной строки:
+// либо песни нет, либо её версия уже поменялась
+func (p *DB) whyNotAffected(group domain.GroupName, songName domain.SongName) error {
+	_, err := p.GetSong(group, songName)
 	if err != nil {
-		p.log.Error(op, " ERROR: ", err)
 		return err
 	}
-	_, err = p.db.Exec(qry, args...)
+	return domain.ErrVersionMismatch
+}
+
+// GroupRename переносит все песни группы под новое название и возвращает количество перенесённых песен.
+// Альбомы, карточка и теги группы переносятся вместе с песнями. Если у новой группы уже есть песни или альбомы с такими же названиями,
+// ничего не меняет и возвращает domain.ErrGroupConflict
+func (p *DB) GroupRename(ctx context.Context, oldGroupName string, newGroupName string) (int, error) {
+	const op = "storage.postgres.GroupRename"
+
+	p.log.Debug(op, "trying to rename group: ", oldGroupName, " to ", newGroupName)
+	var moved int
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		songs, err := p.lockGroupSongs(ctx, tx, oldGroupName)
+		if err != nil {
+			return err
+		}
+		if len(songs) == 0 {
+			return domain.ErrGroupNotFound
+		}
+
+		var displayName interface{} = newGroupName
+		// Если ключи совпадают, меняется только написание названия ("muse" -> "Muse"), конфликтов быть не может
+		if groupKey(domain.GroupName(oldGroupName)) != groupKey(domain.GroupName(newGroupName)) {
+			conflicts, err := p.lockGroupSongs(ctx, tx, newGroupName)
+			if err != nil {
+				return err
+			}
+			var clashes []string
+			for key, conflict := range conflicts {
+				if _, ok := songs[key]; ok {
+					clashes = append(clashes, string(conflict.SongName))
+				}
+			}
+			albums, err := p.albumClashes(ctx, tx, oldGroupName, newGroupName)
+			if err != nil {
+				return err
+			}
+			for _, title := range albums {
+				clashes = append(clashes, "album "+title)
+			}
+			if len(clashes) > 0 {
+				return fmt.Errorf("%w: %s", domain.ErrGroupConflict, strings.Join(clashes, ", "))
+			}
+			displayName = p.groupDisplayName(domain.GroupName(newGroupName))
+		}
+
+		query := p.sq.Update("songs_library").
+			Set("group_name", displayName).
+			Set("group_key", groupKey(domain.GroupName(newGroupName))).
+			Set("updated_at", time.Now()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"group_key": groupKey(domain.GroupName(oldGroupName))})
+		qry, args, err := query.ToSql()
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, qry, args...)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		moved = int(affected)
+		if err = p.moveGroupDataTx(ctx, tx, oldGroupName, newGroupName); err != nil {
+			return err
+		}
+		return p.recordTx(ctx, tx, change{
+			action:        domain.AuditGroupRename,
+			target:        domain.GroupTarget(domain.GroupName(oldGroupName)),
+			group:         domain.GroupName(newGroupName),
+			previousGroup: domain.GroupName(oldGroupName),
+			before:        groupState{GroupName: oldGroupName, Songs: moved},
+			after:         groupState{GroupName: newGroupName, Songs: moved},
+		})
+	})
 	if err != nil {
 		p.log.Error(op, " ERROR: ", err)
-		return err
+		return 0, err
 	}
-	p.log.Debug(op, "Successfully renamed group: ", newGroupName)
-	return nil
+	p.log.Debug(op, "Successfully renamed group: ", newGroupName, "songs moved: ", moved)
+	return moved, nil
 }
 
 func (p *DB) GetSong(group domain.GroupName, songName domain.SongName) (domain.Song, error) {
@@ -139,13 +283,17 @@ func (p *DB) GetSong(group domain.GroupName, songName domain.SongName) (domain.S
 	var result domain.Song
 	query := p.sm.Select(p.sq.Select(), &Song{}).
 		From("songs_library").
-		Where(sq.Eq{"group_name": group, "Song": songName})
+		Where(songKey(group, songName))
 	qry, args, err := query.ToSql()
 	if err != nil {
 		p.log.Error(op, " ERROR: ", err)
 		return result, err
 	}
 	err = p.db.Get(&storSong, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		p.log.Debug(op, "Song not found: ", songName)
+		return result, domain.ErrSongNotFound
+	}
 	if err != nil {
 		p.log.Error(op, " ERROR: ", err)
 		return result, err
@@ -155,19 +303,34 @@ func (p *DB) GetSong(group domain.GroupName, songName domain.SongName) (domain.S
 	return result, nil
 }
 
-func (p *DB) DeleteSong(group domain.GroupName, song domain.SongName) error {
+// DeleteSong удаляет песню. Если version больше нуля, удаление пройдёт только при совпадении версии в бд
+func (p *DB) DeleteSong(ctx context.Context, group domain.GroupName, song domain.SongName, version int) error {
 	const op = "storage.postgres.DeleteSong"
 
 	p.log.Debug(op, "trying to delete Song: ", song)
 	query := p.sq.Delete("songs_library").
-		Where(sq.Eq{"group_name": group, "Song": song})
-	qry, args, err := query.ToSql()
+		Where(songKey(group, song))
+	if version > 0 {
+		query = query.Where(sq.Eq{"version": version})
+	}
+	qry, args, err := query.Suffix("RETURNING " + p.songColumns()).ToSql()
 	if err != nil {
 		p.log.Error(op, " ERROR: ", err)
 		return err
 	}
 	p.log.Debug(op, "qry: ", qry, "args: ", args)
-	_, err = p.db.Exec(qry, args...)
+	err = p.inTx(ctx, func(tx *sqlx.Tx) error {
+		var deleted Song
+		err := tx.QueryRowxContext(ctx, qry, args...).StructScan(&deleted)
+		if err != nil {
+			return err
+		}
+		before := ToDomain(deleted)
+		return p.recordTx(ctx, tx, songChange(domain.AuditSongDelete, &before, nil))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return p.whyNotAffected(group, song)
+	}
 	if err != nil {
 		p.log.Error(op, " ERROR: ", err)
 		return err
@@ -176,23 +339,121 @@ func (p *DB) DeleteSong(group domain.GroupName, song domain.SongName) error {
 	return nil
 }
 
-func (p *DB) GetLibrary(ctx context.Context, filter domain.SongFilter) ([]domain.Song, error) {
-	const op = "storage.postgres.GetLibrary"
+// MoveSong переименовывает песню и/или переносит её в другую группу. Строка песни остаётся той же,
+// поэтому её id и всё что на него ссылается сохраняются. Если version больше нуля, проверяется версия песни
+func (p *DB) MoveSong(ctx context.Context, move domain.SongMove, version int) (domain.Song, error) {
+	const op = "storage.postgres.MoveSong"
 
-	p.log.Debug(op, "trying to get songs, filter is: ", filter)
+	p.log.Debug(op, "trying to move Song: ", move.SongName, "to", move.NewSongName)
+	var result domain.Song
+	query := p.sq.Update("songs_library").
+		Set("group_name", p.groupDisplayName(move.NewGroupName)).
+		Set("song", move.NewSongName).
+		Set("group_key", groupKey(move.NewGroupName)).
+		Set("song_key", songKeyOf(move.NewSongName)).
+		Set("updated_at", time.Now()).
+		Set("version", sq.Expr("version + 1")).
+		Where(songKey(move.GroupName, move.SongName))
+	if version > 0 {
+		query = query.Where(sq.Eq{"version": version})
+	}
+	qry, args, err := query.Suffix("RETURNING " + p.songColumns()).ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return result, err
+	}
+	p.log.Debug(op, "qry: ", qry, "args: ", args)
+	err = p.inTx(ctx, func(tx *sqlx.Tx) error {
+		locked, err := p.lockSong(ctx, tx, move.GroupName, move.SongName)
+		if err != nil {
+			return err
+		}
+		var storSong Song
+		err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&storSong)
+		if errors.Is(err, sql.ErrNoRows) { //песня есть и заблокирована, значит не совпала версия
+			return domain.ErrVersionMismatch
+		}
+		if err != nil {
+			return err
+		}
+		before := ToDomain(locked)
+		result = ToDomain(storSong)
+		return p.recordTx(ctx, tx, songChange(domain.AuditSongMove, &before, &result))
+	})
+	if errors.Is(err, domain.ErrSongNotFound) || errors.Is(err, domain.ErrVersionMismatch) {
+		p.log.Debug(op, "Song not moved: ", err)
+		return domain.Song{}, err
+	}
+	if isUniqueViolation(err) {
+		p.log.Debug(op, "Song already exists: ", move.NewSongName)
+		return domain.Song{}, domain.ErrSongConflict
+	}
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.Song{}, err
+	}
+	p.log.Debug(op, "Successfully moved Song: ", move.NewSongName)
+	return result, nil
+}
+
+// songColumns список колонок песни для RETURNING
+func (p *DB) songColumns() string {
+	return p.columns(Song{})
+}
 
+// columns колонки структуры row через запятую, для RETURNING
+func (p *DB) columns(row interface{}) string {
+	columns, _ := p.sm.ColumnsValues(reflect.ValueOf(row))
+	return strings.Join(columns, ", ")
+}
+
+// isUniqueViolation проверяет что запрос упал на уникальном индексе
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// sortColumns выражения для ключей сортировки библиотеки. Счётчики прослушиваний лежат отдельно от songs_library,
+// чтобы прослушивания не блокировали строки песен
+var sortColumns = map[string]string{
+	domain.SortGroup:       "group_key",
+	domain.SortSong:        "song_key",
+	domain.SortReleaseDate: "release_date",
+	domain.SortPlayCount:   "COALESCE((SELECT st.play_count FROM song_play_stats st WHERE st.song_id = songs_library.id), 0)",
+	domain.SortLastPlayed:  "(SELECT st.last_played FROM song_play_stats st WHERE st.song_id = songs_library.id)",
+}
+
+// libraryQuery запрос песен библиотеки с фильтрами и пагинацией из filter
+func (p *DB) libraryQuery(filter domain.SongFilter) sq.SelectBuilder {
 	// Создаем базовый запрос
-	query := p.sm.Select(p.sq.Select(), &Song{}).From("songs_library")
+	query := p.filterLibrary(p.sm.Select(p.sq.Select(), &Song{}).From("songs_library"), filter)
+
+	// Сортировка
+	for _, key := range filter.Sort {
+		direction := " ASC NULLS LAST"
+		if key.Desc {
+			direction = " DESC NULLS LAST"
+		}
+		query = query.OrderBy(sortColumns[key.Key] + direction)
+	}
+
+	// Пагинация
+	if filter.Limit > 0 {
+		query = query.Limit(uint64(filter.Limit)).Offset(uint64(filter.Offset))
+	}
+	return query
+}
 
-	// Фильтрация
+// filterLibrary добавляет к запросу по songs_library условия filter, без пагинации
+func (p *DB) filterLibrary(query sq.SelectBuilder, filter domain.SongFilter) sq.SelectBuilder {
 	if filter.GroupName != "" {
-		query = query.Where("group_name = ?", filter.GroupName)
+		query = query.Where("group_key = ?", groupKey(domain.GroupName(filter.GroupName)))
 	}
 	if filter.SongName != "" {
-		query = query.Where("Song = ?", filter.SongName)
+		query = query.Where("song_key = ?", songKeyOf(domain.SongName(filter.SongName)))
 	}
 	if !time.Time(filter.ReleaseDate).IsZero() {
-		query = query.Where("release_date = ?", filter.ReleaseDate)
+		query = query.Where("release_date = ?", time.Time(filter.ReleaseDate))
 	}
 	if filter.Text != "" {
 		query = query.Where("text LIKE ?", "%"+filter.Text+"%")
@@ -200,10 +461,28 @@ func (p *DB) GetLibrary(ctx context.Context, filter domain.SongFilter) ([]domain
 	if filter.Link != "" {
 		query = query.Where("link = ?", filter.Link)
 	}
+	if filter.Album != "" {
+		query = query.Where("id IN (SELECT s.song_id FROM album_songs s JOIN albums a ON a.id = s.album_id WHERE a.title_key = ?)",
+			domain.NormalizeKey(filter.Album))
+	}
+	for _, tag := range filter.Tags {
+		query = query.Where("id IN (SELECT e.song_id FROM song_effective_tags e JOIN tags t ON t.id = e.tag_id WHERE t.namespace = ? AND t.value = ?)",
+			tag.Namespace(), tag.Value())
+	}
+	if len(filter.ExcludeTags) > 0 {
+		query = query.Where(sq.Expr("id NOT IN (SELECT e.song_id FROM song_effective_tags e JOIN tags t ON t.id = e.tag_id WHERE ?)",
+			tagsCondition(filter.ExcludeTags)))
+	}
+	return query
+}
 
-	// Пагинация
-	if filter.Limit > 0 {
-		query = query.Limit(uint64(filter.Limit)).Offset(uint64(filter.Offset))
+func (p *DB) GetLibrary(ctx context.Context, filter domain.SongFilter) ([]domain.Song, error) {
+	const op = "storage.postgres.GetLibrary"
+
+	p.log.Debug(op, "trying to get songs, filter is: ", filter)
+	query := p.libraryQuery(filter)
+	if len(filter.Sort) > 0 {
+		query = query.OrderBy("id") // равные по ключам сортировки песни не должны переезжать между страницами
 	}
 
 	// Генерация SQL-запроса
@@ -222,10 +501,29 @@ func (p *DB) GetLibrary(ctx context.Context, filter domain.SongFilter) ([]domain
 		return nil, err
 	}
 
+	// Теги и счётчики прослушиваний одним запросом на всю страницу
+	ids := make([]int64, len(storSongs))
+	for i, storSong := range storSongs {
+		ids[i] = storSong.ID
+	}
+	tags, err := p.SongTags(ctx, ids...)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	stats, err := p.SongPlayStats(ctx, ids...)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+
 	// Преобразуем в domain.Song
 	var songs []domain.Song
 	for _, storSong := range storSongs {
-		songs = append(songs, ToDomain(storSong))
+		song := ToDomain(storSong)
+		song.Tags = tags[storSong.ID]
+		song.PlayCount, song.LastPlayed = stats[storSong.ID].PlayCount, stats[storSong.ID].LastPlayed
+		songs = append(songs, song)
 	}
 
 	p.log.Debug(op, "Successfully retrieved songs", "")
@@ -8,21 +8,26 @@ import (
 	"github.com/pressly/goose/v3"
 	"github.com/stretchr/testify/require"
 	"mobileSongLibrary/domain"
+	_ "mobileSongLibrary/gates/storage/migrations" //Go-миграции регистрируются в goose при импорте
 	"mobileSongLibrary/internal/config"
 	"mobileSongLibrary/internal/logger"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
-func TestInsertUpdateSelectGetLibraryRenameGroupDelete(t *testing.T) {
-	ctx := context.Background()
+// newTestDB подключается к тестовой бд из конфига и накатывает миграции
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
 
 	// Считываем конфиг
 	os.Setenv("CONFIG_PATH", "../../../config.yaml")
 	cfg := config.MustLoad()
 
-	// Инициализация логгера
+	// Инициализация логгера. Логи тестов пишутся во временную папку, а не в logs.txt рядом с репозиторием
+	cfg.Log.FilePath = filepath.Join(t.TempDir(), "logs.txt")
 	log := logger.MustInitLogger(cfg)
 
 	// Подключение к БД и накатывание миграций
@@ -38,7 +43,13 @@ func TestInsertUpdateSelectGetLibraryRenameGroupDelete(t *testing.T) {
 	require.NoError(t, err)
 	t.Log("Test database migrations applied successfully")
 
-	db := NewDB(conn, log)
+	return NewDB(conn, log)
+}
+
+func TestInsertUpdateSelectGetLibraryRenameGroupDelete(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	var err error
 
 	// Создание тестовых данных
 	testSongs := []Song{
@@ -67,12 +78,12 @@ func TestInsertUpdateSelectGetLibraryRenameGroupDelete(t *testing.T) {
 
 	// Загружаем тестовые данные
 	for _, testSong := range testSongs {
-		err = db.AddSong(testSong)
+		err = db.AddSong(ctx, testSong)
 		require.NoError(t, err)
 	}
 
 	// Тестируем обновление песни
-	err = db.UpdateSong(Song{
+	_, err = db.UpdateSong(ctx, Song{
 		GroupName:   "Buku",
 		SongName:    "Front to Back",
 		ReleaseDate: time.Date(2006, time.July, 16, 0, 0, 0, 0, time.UTC),
@@ -84,10 +95,25 @@ func TestInsertUpdateSelectGetLibraryRenameGroupDelete(t *testing.T) {
 	require.Equal(t, time.Date(2006, time.July, 16, 0, 0, 0, 0, time.UTC), time.Time(songFromDB.ReleaseDate))
 
 	// Тестируем переименование группы
-	err = db.GroupRename("muse", "Muse")
+	moved, err := db.GroupRename(ctx, "muse", "Muse")
 	testSongs[0].GroupName = "Muse"
 	testSongs[1].GroupName = "Muse"
 	require.NoError(t, err)
+	require.Equal(t, 2, moved)
+
+	// Поиск не зависит от регистра и пробелов
+	songFromDB, err = db.GetSong(" MUSE ", "supermassive  black hole")
+	require.NoError(t, err)
+	require.Equal(t, domain.GroupName("Muse"), songFromDB.GroupName)
+	require.Equal(t, domain.SongName("Supermassive Black Hole"), songFromDB.SongName)
+
+	// Та же песня в другом написании считается дублем
+	err = db.AddSong(ctx, Song{GroupName: "muse ", SongName: "SUPERMASSIVE BLACK HOLE"})
+	require.ErrorIs(t, err, domain.ErrSongExists)
+
+	// Переименование несуществующей группы
+	_, err = db.GroupRename(ctx, "Radiohead", "Muse")
+	require.ErrorIs(t, err, domain.ErrGroupNotFound)
 
 	// Проверяем, что группа была переименована
 	testLibrary, err := db.GetLibrary(ctx, domain.SongFilter{GroupName: "Muse"})
@@ -96,7 +122,7 @@ func TestInsertUpdateSelectGetLibraryRenameGroupDelete(t *testing.T) {
 
 	// Удаляем данные
 	for _, song := range testSongs {
-		err = db.DeleteSong(song.GroupName, song.SongName)
+		err = db.DeleteSong(ctx, song.GroupName, song.SongName, 0)
 		require.NoError(t, err)
 	}
 
@@ -107,3 +133,885 @@ func TestInsertUpdateSelectGetLibraryRenameGroupDelete(t *testing.T) {
 
 	t.Log("All tests passed successfully")
 }
+
+func TestUpdateDeleteSongVersionMismatch(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	song := Song{
+		GroupName:   "Muse",
+		SongName:    "Uprising",
+		ReleaseDate: time.Date(2009, time.September, 7, 0, 0, 0, 0, time.UTC),
+		Text:        "Paranoia is in bloom...",
+		Link:        "https://www.youtube.com/watch?v=w8KQmps-Sog",
+	}
+	require.NoError(t, db.AddSong(ctx, song))
+	defer db.DeleteSong(ctx, song.GroupName, song.SongName, 0)
+
+	stored, err := db.GetSong(song.GroupName, song.SongName)
+	require.NoError(t, err)
+
+	// Первый редактор обновляет песню со своей версией
+	version, err := db.UpdateSong(ctx, Song{GroupName: song.GroupName, SongName: song.SongName, Text: "The PR transmissions will resume", Version: stored.Version})
+	require.NoError(t, err)
+	require.Equal(t, stored.Version+1, version)
+
+	// Второй редактор со старой версией должен получить конфликт
+	_, err = db.UpdateSong(ctx, Song{GroupName: song.GroupName, SongName: song.SongName, Text: "They will try to push drugs", Version: stored.Version})
+	require.ErrorIs(t, err, domain.ErrVersionMismatch)
+	err = db.DeleteSong(ctx, song.GroupName, song.SongName, stored.Version)
+	require.ErrorIs(t, err, domain.ErrVersionMismatch)
+
+	// Несуществующая песня
+	_, err = db.UpdateSong(ctx, Song{GroupName: "Muse", SongName: "No Such Song", Text: "nothing", Version: 1})
+	require.ErrorIs(t, err, domain.ErrSongNotFound)
+
+	require.NoError(t, db.DeleteSong(ctx, song.GroupName, song.SongName, version))
+}
+
+func TestGroupRenameConflictAndMerge(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	testSongs := []Song{
+		{GroupName: "Muse UK", SongName: "Hysteria", Text: "It's bugging me"},
+		{GroupName: "Muse UK", SongName: "Plug In Baby", Text: "I've exposed your lies"},
+		{GroupName: "Muse", SongName: "Hysteria", Text: "It's bugging me, grating me"},
+	}
+	for _, song := range testSongs {
+		require.NoError(t, db.AddSong(ctx, song))
+	}
+
+	// В группе Muse уже есть Hysteria, переименование должно упасть и ничего не поменять
+	_, err := db.GroupRename(ctx, "Muse UK", "Muse")
+	require.ErrorIs(t, err, domain.ErrGroupConflict)
+	library, err := db.GetLibrary(ctx, domain.SongFilter{GroupName: "Muse UK"})
+	require.NoError(t, err)
+	require.Len(t, library, 2)
+
+	// Слияние оставляет песню из Muse UK для Hysteria, override ищется по ключу названия
+	requestID := fmt.Sprintf("merge-groups-%d", time.Now().UnixNano())
+	result, err := db.MergeGroups(domain.WithActor(ctx, domain.Actor{RequestID: requestID}), domain.GroupMerge{
+		Source:    "Muse UK",
+		Target:    "Muse",
+		Strategy:  domain.KeepTarget,
+		Overrides: map[domain.SongName]domain.MergeStrategy{" HYSTERIA": domain.KeepSource},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Moved)
+	require.Len(t, result.Conflicts, 1)
+	require.Equal(t, "source", result.Conflicts[0].Kept)
+
+	// Проигравшая песня target удалена, потребители событий узнают об этом
+	var deleted []string
+	err = db.db.SelectContext(ctx, &deleted, "SELECT target FROM outbox WHERE request_id = $1 AND type = $2", requestID, string(domain.AuditSongDelete))
+	require.NoError(t, err)
+	require.Equal(t, []string{domain.SongTarget("Muse", "Hysteria")}, deleted)
+
+	hysteria, err := db.GetSong("Muse", "Hysteria")
+	require.NoError(t, err)
+	require.Equal(t, "It's bugging me", hysteria.Text)
+
+	library, err = db.GetLibrary(ctx, domain.SongFilter{GroupName: "Muse UK"})
+	require.NoError(t, err)
+	require.Empty(t, library)
+
+	for _, song := range []domain.SongName{"Hysteria", "Plug In Baby"} {
+		require.NoError(t, db.DeleteSong(ctx, "Muse", song, 0))
+	}
+}
+
+func TestMoveSong(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: "Muse", SongName: "Supermasive Black Hole", Text: "Ooh baby"}))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: "Muse", SongName: "Starlight", Text: "Far away"}))
+	before, err := db.GetSong("Muse", "Supermasive Black Hole")
+	require.NoError(t, err)
+
+	// Исправляем опечатку и переносим в другую группу, id должен сохраниться
+	moved, err := db.MoveSong(ctx, domain.SongMove{
+		GroupName:    "Muse",
+		SongName:     "Supermasive Black Hole",
+		NewGroupName: "MUSE",
+		NewSongName:  "Supermassive Black Hole",
+	}, before.Version)
+	require.NoError(t, err)
+	require.Equal(t, before.ID, moved.ID)
+	require.Equal(t, before.Version+1, moved.Version)
+
+	_, err = db.GetSong("Muse", "Supermasive Black Hole")
+	require.ErrorIs(t, err, domain.ErrSongNotFound)
+
+	// Коллизия с уже существующей песней
+	_, err = db.MoveSong(ctx, domain.SongMove{GroupName: "MUSE", SongName: "Supermassive Black Hole", NewGroupName: "Muse", NewSongName: "Starlight"}, 0)
+	require.ErrorIs(t, err, domain.ErrSongConflict)
+
+	require.NoError(t, db.DeleteSong(ctx, "MUSE", "Supermassive Black Hole", 0))
+	require.NoError(t, db.DeleteSong(ctx, "Muse", "Starlight", 0))
+}
+
+func TestSongLRC(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: "Muse", SongName: "Uprising"}))
+	_, err := db.UpdateSong(ctx, Song{GroupName: "Muse", SongName: "Uprising", LRC: "[00:01.00]Paranoia is in bloom"})
+	require.NoError(t, err)
+	song, err := db.GetSong("Muse", "Uprising")
+	require.NoError(t, err)
+	require.Equal(t, "[00:01.00]Paranoia is in bloom", song.LRC)
+
+	require.NoError(t, db.DeleteSong(ctx, "Muse", "Uprising", 0))
+}
+
+func TestSongTranslations(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: "Кино", SongName: "Группа крови", Text: "Тёплое место"}))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: "Кино", SongName: "Группа крови (Remastered)"}))
+
+	created, err := db.PutLyrics(ctx, domain.SongTranslation{GroupName: "Кино", SongName: "Группа крови", Lang: "ru", Text: "Тёплое место, но улицы ждут", Original: true})
+	require.NoError(t, err)
+	require.True(t, created)
+	created, err = db.PutLyrics(ctx, domain.SongTranslation{GroupName: "Кино", SongName: "Группа крови (Remastered)", Lang: "en", Text: "A warm place"})
+	require.NoError(t, err)
+	require.True(t, created)
+
+	// Текст оригинала заменил текст песни, правка текста песни попадает в строку оригинала
+	song, err := db.GetSong("Кино", "Группа крови")
+	require.NoError(t, err)
+	require.Equal(t, "Тёплое место, но улицы ждут", song.Text)
+	_, err = db.UpdateSong(ctx, Song{GroupName: "Кино", SongName: "Группа крови", Text: "Тёплое место, но улицы ждут отпечатков наших ног"})
+	require.NoError(t, err)
+
+	// При слиянии дублей перевод переезжает на оставшуюся песню
+	_, err = db.MergeSongs(ctx, domain.SongPair{
+		Keep: domain.SongRef{GroupName: "Кино", SongName: "Группа крови"},
+		Drop: domain.SongRef{GroupName: "Кино", SongName: "Группа крови (Remastered)"},
+	})
+	require.NoError(t, err)
+	lyrics, err := db.GetSongLyrics(ctx, song.ID)
+	require.NoError(t, err)
+	require.Len(t, lyrics, 2)
+	require.Equal(t, "ru", lyrics[0].Lang)
+	require.True(t, lyrics[0].Original)
+	require.Equal(t, "Тёплое место, но улицы ждут отпечатков наших ног", lyrics[0].Text)
+	require.Equal(t, "en", lyrics[1].Lang)
+
+	require.NoError(t, db.DeleteLyrics(ctx, "Кино", "Группа крови", "en"))
+	require.ErrorIs(t, db.DeleteLyrics(ctx, "Кино", "Группа крови", "en"), domain.ErrTranslationNotFound)
+	require.NoError(t, db.DeleteSong(ctx, "Кино", "Группа крови", 0))
+}
+
+func TestAlbums(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	for _, song := range []domain.SongName{"Take a Bow", "Starlight", "Knights of Cydonia"} {
+		require.NoError(t, db.AddSong(ctx, Song{GroupName: "Muse", SongName: song}))
+	}
+	album := domain.Album{Title: "Black Holes and Revelations", GroupName: "Muse", Tracks: []domain.Track{
+		{Number: 2, SongName: "Starlight"},
+		{Number: 1, SongName: "Take a Bow"},
+	}}
+	require.NoError(t, album.Validate())
+	album, err := db.CreateAlbum(ctx, album)
+	require.NoError(t, err)
+	require.Equal(t, domain.SongName("Take a Bow"), album.Tracks[0].SongName)
+
+	_, err = db.CreateAlbum(ctx, domain.Album{Title: "black holes and revelations", GroupName: "MUSE", Type: domain.AlbumLP})
+	require.ErrorIs(t, err, domain.ErrAlbumConflict)
+
+	// Песня с полем album дописывается в конец альбома, фильтр по альбому её находит
+	require.NoError(t, db.AddSongToAlbum(ctx, "Muse", "Black Holes and Revelations", "Knights of Cydonia"))
+	songs, err := db.GetLibrary(ctx, domain.SongFilter{Album: "Black Holes and Revelations"})
+	require.NoError(t, err)
+	require.Len(t, songs, 3)
+
+	// Альбомы переезжают вместе с группой
+	_, err = db.GroupRename(ctx, "Muse", "Muse (band)")
+	require.NoError(t, err)
+	albums, err := db.GroupAlbums(ctx, "Muse (band)")
+	require.NoError(t, err)
+	require.Len(t, albums, 1)
+	require.Equal(t, domain.Track{Disc: 1, Number: 3, GroupName: "Muse (band)", SongName: "Knights of Cydonia"}, albums[0].Tracks[2])
+
+	_, err = db.UpdateAlbum(ctx, domain.Album{ID: album.ID, Type: domain.AlbumEP}, album.Version)
+	require.ErrorIs(t, err, domain.ErrVersionMismatch) //AddSongToAlbum и переименование уже поменяли версию
+	require.NoError(t, db.DeleteAlbum(ctx, album.ID, 0))
+	_, err = db.GetAlbum(ctx, album.ID)
+	require.ErrorIs(t, err, domain.ErrAlbumNotFound)
+
+	for _, song := range []domain.SongName{"Take a Bow", "Starlight", "Knights of Cydonia"} {
+		require.NoError(t, db.DeleteSong(ctx, "Muse (band)", song, 0))
+	}
+}
+
+func TestGroupProfiles(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: "Radiohead", SongName: "Creep", ReleaseDate: time.Date(1992, 9, 21, 0, 0, 0, 0, time.UTC)}))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: "Radiohead", SongName: "Reckoner", ReleaseDate: time.Date(2007, 10, 10, 0, 0, 0, 0, time.UTC)}))
+
+	// Карточка не нужна, чтобы группа была в списке
+	group, err := db.GetGroup(ctx, "radiohead")
+	require.NoError(t, err)
+	require.Equal(t, domain.GroupStats{Songs: 2, FirstReleaseYear: 1992, LastReleaseYear: 2007}, group.GroupStats)
+
+	require.NoError(t, db.UpdateGroup(ctx, "Radiohead", domain.GroupProfile{Country: "UK", Genres: []string{"rock"}}, 0))
+	require.ErrorIs(t, db.CreateGroup(ctx, domain.GroupProfile{Name: "RADIOHEAD"}), domain.ErrGroupExists)
+	require.NoError(t, db.CreateGroup(ctx, domain.GroupProfile{Name: "Portishead", FormedYear: 1991}))
+
+	groups, total, err := db.GetGroups(ctx, domain.GroupFilter{Query: "head", Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Len(t, groups, 1)
+	require.Equal(t, domain.GroupName("Portishead"), groups[0].Name)
+
+	// Карточка переезжает вместе с группой
+	_, err = db.GroupRename(ctx, "Radiohead", "Radiohead (band)")
+	require.NoError(t, err)
+	group, err = db.GetGroup(ctx, "Radiohead (band)")
+	require.NoError(t, err)
+	require.Equal(t, "UK", group.Country)
+
+	_, err = db.DeleteGroup(ctx, "Radiohead (band)", domain.DeleteRefuse)
+	require.ErrorIs(t, err, domain.ErrGroupNotEmpty)
+	deleted, err := db.DeleteGroup(ctx, "Radiohead (band)", domain.DeleteCascade)
+	require.NoError(t, err)
+	require.Equal(t, 2, deleted)
+	_, err = db.DeleteGroup(ctx, "Portishead", domain.DeleteRefuse)
+	require.NoError(t, err)
+	_, err = db.GetGroup(ctx, "Portishead")
+	require.ErrorIs(t, err, domain.ErrGroupNotFound)
+}
+
+func TestTags(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	for _, song := range []domain.SongName{"Teardrop", "Angel", "Unfinished Sympathy"} {
+		require.NoError(t, db.AddSong(ctx, Song{GroupName: "Massive Attack", SongName: song}))
+	}
+	_, err := db.ChangeGroupTags(ctx, "Massive Attack", []domain.Tag{"genre:trip-hop"}, true)
+	require.NoError(t, err)
+	tags, err := db.ChangeSongTags(ctx, "Massive Attack", "Teardrop", []domain.Tag{"mood:chill"}, true)
+	require.NoError(t, err)
+	require.Equal(t, []domain.Tag{"mood:chill"}, tags)
+	_, err = db.ChangeSongTags(ctx, "Massive Attack", "Angel", []domain.Tag{"mood:dark"}, true)
+	require.NoError(t, err)
+
+	// Тег группы действует на все её песни
+	songs, err := db.GetLibrary(ctx, domain.SongFilter{Tags: []domain.Tag{"genre:trip-hop"}, ExcludeTags: []domain.Tag{"mood:dark"}})
+	require.NoError(t, err)
+	require.Len(t, songs, 2)
+
+	facets, err := db.GetTagFacets(ctx, domain.SongFilter{GroupName: "Massive Attack"}, []string{"genre", "mood"})
+	require.NoError(t, err)
+	require.Equal(t, []domain.TagCount{{Tag: "genre:trip-hop", Count: 3}}, facets["genre"])
+	require.Len(t, facets["mood"], 2)
+
+	// Теги переезжают вместе с группой и снимаются
+	_, err = db.GroupRename(ctx, "Massive Attack", "Massive Attack (band)")
+	require.NoError(t, err)
+	group, err := db.GetGroup(ctx, "Massive Attack (band)")
+	require.NoError(t, err)
+	require.Equal(t, []domain.Tag{"genre:trip-hop"}, group.Tags)
+	tags, err = db.ChangeSongTags(ctx, "Massive Attack (band)", "Teardrop", []domain.Tag{"mood:chill"}, false)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	_, err = db.DeleteGroup(ctx, "Massive Attack (band)", domain.DeleteCascade)
+	require.NoError(t, err)
+}
+
+func TestPlaylists(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	for _, song := range []domain.SongName{"Paranoid Android", "Karma Police", "No Surprises"} {
+		require.NoError(t, db.AddSong(ctx, Song{GroupName: "Radiohead", SongName: song}))
+	}
+	owner, err := db.CreateUser(ctx, fmt.Sprintf("owner%d", time.Now().UnixNano()), "hash")
+	require.NoError(t, err)
+	stranger, err := db.CreateUser(ctx, fmt.Sprintf("stranger%d", time.Now().UnixNano()), "hash")
+	require.NoError(t, err)
+	playlist, err := db.CreatePlaylist(ctx, owner.ID, domain.Playlist{Name: "OK Computer"})
+	require.NoError(t, err)
+	for _, song := range []domain.SongName{"Paranoid Android", "No Surprises"} {
+		playlist, err = db.AddPlaylistItem(ctx, owner.ID, playlist.ID, domain.PlaylistAdd{GroupName: "Radiohead", SongName: song})
+		require.NoError(t, err)
+	}
+	index := 1
+	playlist, err = db.AddPlaylistItem(ctx, owner.ID, playlist.ID, domain.PlaylistAdd{GroupName: "radiohead", SongName: "karma police", Index: &index})
+	require.NoError(t, err)
+	require.Equal(t, domain.SongName("Karma Police"), playlist.Items[1].SongName)
+
+	// Перестановка в начало и в конец
+	playlist, err = db.MovePlaylistItem(ctx, owner.ID, playlist.ID, playlist.Items[2].ID, 0)
+	require.NoError(t, err)
+	require.Equal(t, domain.SongName("No Surprises"), playlist.Items[0].SongName)
+	playlist, err = db.MovePlaylistItem(ctx, owner.ID, playlist.ID, playlist.Items[0].ID, 10)
+	require.NoError(t, err)
+	require.Equal(t, domain.SongName("No Surprises"), playlist.Items[2].SongName)
+
+	// Много вставок в одно и то же место исчерпывают промежуток и перенумеровывают плейлист
+	for i := 0; i < 12; i++ {
+		playlist, err = db.AddPlaylistItem(ctx, owner.ID, playlist.ID, domain.PlaylistAdd{GroupName: "Radiohead", SongName: "No Surprises", Index: &index})
+		require.NoError(t, err)
+	}
+	require.Len(t, playlist.Items, 15)
+	require.Equal(t, domain.SongName("Paranoid Android"), playlist.Items[0].SongName)
+	require.Equal(t, domain.SongName("Karma Police"), playlist.Items[13].SongName)
+
+	// Записи переживают переименование группы
+	_, err = db.GroupRename(ctx, "Radiohead", "Radiohead (band)")
+	require.NoError(t, err)
+	playlist, err = db.GetPlaylist(ctx, owner.ID, playlist.ID)
+	require.NoError(t, err)
+	require.Equal(t, domain.GroupName("Radiohead (band)"), playlist.Items[0].GroupName)
+
+	// Чужой плейлист не виден и не меняется
+	_, err = db.GetPlaylist(ctx, stranger.ID, playlist.ID)
+	require.ErrorIs(t, err, domain.ErrPlaylistNotFound)
+	_, err = db.AddPlaylistItem(ctx, stranger.ID, playlist.ID, domain.PlaylistAdd{GroupName: "Radiohead (band)", SongName: "Karma Police"})
+	require.ErrorIs(t, err, domain.ErrPlaylistNotFound)
+	require.ErrorIs(t, db.DeletePlaylist(ctx, stranger.ID, playlist.ID, 0), domain.ErrPlaylistNotFound)
+	playlists, err := db.GetPlaylists(ctx, stranger.ID)
+	require.NoError(t, err)
+	require.Empty(t, playlists)
+
+	// Для выгрузки песни идут в порядке плейлиста
+	_, songs, err := db.GetPlaylistSongs(ctx, owner.ID, playlist.ID)
+	require.NoError(t, err)
+	require.Len(t, songs, 15)
+	require.Equal(t, domain.SongName("Paranoid Android"), songs[0].SongName)
+
+	playlist, err = db.RemovePlaylistItem(ctx, owner.ID, playlist.ID, playlist.Items[0].ID)
+	require.NoError(t, err)
+	require.Len(t, playlist.Items, 14)
+	require.NoError(t, db.DeletePlaylist(ctx, owner.ID, playlist.ID, 0))
+	_, err = db.DeleteGroup(ctx, "Radiohead (band)", domain.DeleteCascade)
+	require.NoError(t, err)
+}
+
+func TestUsersAndAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	username := fmt.Sprintf("user%d", time.Now().UnixNano())
+	user, err := db.CreateUser(ctx, username, "hash")
+	require.NoError(t, err)
+	_, err = db.CreateUser(ctx, username, "hash")
+	require.ErrorIs(t, err, domain.ErrUserExists)
+	found, hash, err := db.UserCredentials(ctx, username)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, found.ID)
+	require.Equal(t, "hash", hash)
+
+	// Refresh токен одноразовый, повторное использование отзывает все токены пользователя
+	expires := time.Now().Add(time.Hour)
+	require.NoError(t, db.SaveRefreshToken(ctx, user.ID, username+"-1", expires))
+	_, err = db.RotateRefreshToken(ctx, username+"-1", username+"-2", expires)
+	require.NoError(t, err)
+	_, err = db.RotateRefreshToken(ctx, username+"-1", username+"-3", expires)
+	require.ErrorIs(t, err, domain.ErrInvalidToken)
+	_, err = db.RotateRefreshToken(ctx, username+"-2", username+"-4", expires)
+	require.ErrorIs(t, err, domain.ErrInvalidToken)
+
+	key, err := db.CreateAPIKey(ctx, user.ID, domain.APIKey{Name: "ci", Prefix: "msl_test"}, username+"-key")
+	require.NoError(t, err)
+	principal, err := db.APIKeyPrincipal(ctx, username+"-key")
+	require.NoError(t, err)
+	require.Equal(t, domain.AuthAPIKey, principal.Method)
+	require.Equal(t, key.ID, principal.APIKeyID)
+	keys, err := db.GetAPIKeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NotNil(t, keys[0].LastUsedAt)
+
+	require.NoError(t, db.RevokeAPIKey(ctx, user.ID, key.ID))
+	require.ErrorIs(t, db.RevokeAPIKey(ctx, user.ID, key.ID), domain.ErrAPIKeyNotFound)
+	_, err = db.APIKeyPrincipal(ctx, username+"-key")
+	require.ErrorIs(t, err, domain.ErrInvalidToken)
+}
+
+func TestUserRoles(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	username := fmt.Sprintf("editor%d", time.Now().UnixNano())
+	user, err := db.CreateUser(ctx, username, "hash", domain.RoleEditor)
+	require.NoError(t, err)
+	require.Equal(t, []domain.Role{domain.RoleEditor}, user.Roles)
+
+	user, err = db.SetUserRoles(ctx, user.ID, []domain.Role{domain.RoleListener, domain.RoleAdmin})
+	require.NoError(t, err)
+	roles, err := db.UserRoles(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, []domain.Role{domain.RoleAdmin, domain.RoleListener}, roles)
+	_, err = db.SetUserRoles(ctx, -1, nil)
+	require.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	// у отключённого пользователя ролей нет, пока его не включат обратно
+	disabled := true
+	user, err = db.UpdateUser(ctx, user.ID, domain.UserPatch{Disabled: &disabled})
+	require.NoError(t, err)
+	require.True(t, user.Disabled)
+	roles, err = db.UserRoles(ctx, user.ID)
+	require.NoError(t, err)
+	require.Empty(t, roles)
+}
+
+func TestPlaysAndFavorites(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	group := domain.GroupName(fmt.Sprintf("Plays %d", time.Now().UnixNano()))
+	for _, song := range []domain.SongName{"Hot", "Cold"} {
+		require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: song}))
+	}
+	user, err := db.CreateUser(ctx, fmt.Sprintf("listener%d", time.Now().UnixNano()), "hash", domain.RoleListener)
+	require.NoError(t, err)
+	hot, err := db.GetSong(group, "Hot")
+	require.NoError(t, err)
+	cold, err := db.GetSong(group, "Cold")
+	require.NoError(t, err)
+
+	// одна пачка с повторами и песней, удалённой до записи
+	now := time.Now()
+	require.NoError(t, db.SavePlays(ctx, []domain.Play{
+		{UserID: user.ID, SongID: hot.ID, Client: "web", PlayedAt: now.Add(-time.Minute)},
+		{UserID: user.ID, SongID: hot.ID, Client: "web", PlayedAt: now},
+		{SongID: cold.ID, PlayedAt: now.Add(-time.Hour)},
+		{UserID: user.ID, SongID: -1, PlayedAt: now},
+	}))
+	stats, err := db.SongPlayStats(ctx, hot.ID, cold.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), stats[hot.ID].PlayCount)
+	require.Equal(t, int64(1), stats[cold.ID].PlayCount)
+
+	songs, err := db.GetLibrary(ctx, domain.SongFilter{GroupName: string(group), Sort: []domain.SortKey{{Key: domain.SortPlayCount, Desc: true}}})
+	require.NoError(t, err)
+	require.Equal(t, domain.SongName("Hot"), songs[0].SongName)
+	require.Equal(t, int64(2), songs[0].PlayCount)
+
+	history, err := db.GetHistory(ctx, user.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, "web", history[0].Client)
+
+	require.NoError(t, db.AddFavorite(ctx, user.ID, group, "cold"))
+	require.NoError(t, db.AddFavorite(ctx, user.ID, group, "Cold"))
+	require.ErrorIs(t, db.AddFavorite(ctx, user.ID, group, "Missing"), domain.ErrSongNotFound)
+	favorites, err := db.GetFavorites(ctx, user.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, favorites, 1)
+	require.NoError(t, db.RemoveFavorite(ctx, user.ID, group, "Cold"))
+	require.ErrorIs(t, db.RemoveFavorite(ctx, user.ID, group, "Cold"), domain.ErrFavoriteNotFound)
+}
+
+func TestCharts(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	group := domain.GroupName(fmt.Sprintf("Charts %d", time.Now().UnixNano()))
+	ids := map[domain.SongName]int64{}
+	for _, name := range []domain.SongName{"Rising", "Falling"} {
+		require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: name}))
+		song, err := db.GetSong(group, name)
+		require.NoError(t, err)
+		ids[name] = song.ID
+	}
+	now := time.Now()
+	plays := func(song domain.SongName, n int, at time.Time) []domain.Play {
+		result := make([]domain.Play, n)
+		for i := range result {
+			result[i] = domain.Play{SongID: ids[song], PlayedAt: at}
+		}
+		return result
+	}
+
+	// В первом снимке Falling впереди
+	require.NoError(t, db.SavePlays(ctx, append(plays("Falling", 3, now.Add(-time.Hour)), plays("Rising", 1, now.Add(-time.Hour))...)))
+	require.NoError(t, db.RefreshChart(ctx, domain.ChartDay, now, 2))
+	chart, err := db.GetChart(ctx, domain.ChartQuery{Window: domain.ChartDay, Group: string(group)})
+	require.NoError(t, err)
+	require.Len(t, chart.Entries, 2)
+	require.Equal(t, domain.SongName("Falling"), chart.Entries[0].SongName)
+	require.True(t, chart.Entries[0].New)
+
+	// Свежие прослушивания весят больше: Rising обгоняет Falling
+	later := now.Add(6 * time.Hour)
+	require.NoError(t, db.SavePlays(ctx, plays("Rising", 3, later)))
+	require.NoError(t, db.RefreshChart(ctx, domain.ChartDay, later, 2))
+	chart, err = db.GetChart(ctx, domain.ChartQuery{Window: domain.ChartDay, Group: string(group)})
+	require.NoError(t, err)
+	require.Equal(t, domain.SongName("Rising"), chart.Entries[0].SongName)
+	require.Equal(t, 1, chart.Entries[0].RankChange)
+	require.Equal(t, -1, chart.Entries[1].RankChange)
+	require.Equal(t, int64(4), chart.Entries[0].Plays)
+}
+
+func TestLibraryFingerprint(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	before, err := db.LibraryFingerprint(ctx)
+	require.NoError(t, err)
+	group := domain.GroupName(fmt.Sprintf("Fingerprint %d", time.Now().UnixNano()))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: "First"}))
+	after, err := db.LibraryFingerprint(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, before, after)
+
+	// смена тегов поднимает версию песни и тоже меняет отпечаток
+	tag, err := domain.ParseTag("genre:rock")
+	require.NoError(t, err)
+	_, err = db.ChangeSongTags(ctx, group, "First", []domain.Tag{tag}, true)
+	require.NoError(t, err)
+	tagged, err := db.LibraryFingerprint(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, after, tagged)
+}
+
+func TestAuditLog(t *testing.T) {
+	db := newTestDB(t)
+
+	requestID := fmt.Sprintf("audit-%d", time.Now().UnixNano())
+	ctx := domain.WithActor(context.Background(), domain.Actor{UserID: 7, Username: "auditor", RequestID: requestID, ClientIP: "10.0.0.1"})
+	group := domain.GroupName(fmt.Sprintf("Audit %d", time.Now().UnixNano()))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: "Uprising"}))
+	_, err := db.UpdateSong(ctx, Song{GroupName: group, SongName: "Uprising", Text: "Paranoia is in bloom"})
+	require.NoError(t, err)
+	// неудачное изменение откатывается вместе с записью в журнале
+	_, err = db.UpdateSong(ctx, Song{GroupName: group, SongName: "Uprising", Text: "stale", Version: 100})
+	require.ErrorIs(t, err, domain.ErrVersionMismatch)
+	_, err = db.GroupRename(ctx, string(group), string(group)+" Renamed")
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteSong(ctx, group+" Renamed", "Uprising", 0))
+
+	var entries []domain.AuditEntry
+	err = db.StreamAudit(ctx, domain.AuditFilter{RequestID: requestID}, func(entry domain.AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.Equal(t, []domain.AuditAction{domain.AuditSongDelete, domain.AuditGroupRename, domain.AuditSongUpdate, domain.AuditSongCreate},
+		[]domain.AuditAction{entries[0].Action, entries[1].Action, entries[2].Action, entries[3].Action})
+	require.Equal(t, "auditor", entries[0].Username)
+	require.Equal(t, int64(7), *entries[0].UserID)
+	require.Equal(t, "10.0.0.1", entries[0].ClientIP)
+	require.Nil(t, entries[3].Before)
+	require.Contains(t, string(entries[2].After), "Paranoia is in bloom")
+	require.Nil(t, entries[0].After)
+
+	// фильтр по началу ключа и по действию
+	var updates int
+	err = db.StreamAudit(ctx, domain.AuditFilter{Target: domain.SongTarget(group, "") + "*", Action: domain.AuditSongUpdate}, func(domain.AuditEntry) error {
+		updates++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, updates)
+
+	// журнал только пополняется
+	_, err = db.db.ExecContext(ctx, "DELETE FROM audit_log WHERE request_id = $1", requestID)
+	require.Error(t, err)
+}
+
+func TestAuditOnlyActions(t *testing.T) {
+	db := newTestDB(t)
+
+	requestID := fmt.Sprintf("audit-only-%d", time.Now().UnixNano())
+	ctx := domain.WithActor(context.Background(), domain.Actor{Username: "auditor", RequestID: requestID})
+	group := domain.GroupName(fmt.Sprintf("Audit only %d", time.Now().UnixNano()))
+	require.NoError(t, db.AddSong(context.Background(), Song{GroupName: group, SongName: "Hysteria"}))
+
+	user, err := db.CreateUser(ctx, fmt.Sprintf("audited%d", time.Now().UnixNano()), "hash", domain.RoleListener)
+	require.NoError(t, err)
+	_, err = db.SetUserRoles(ctx, user.ID, []domain.Role{domain.RoleEditor})
+	require.NoError(t, err)
+	_, err = db.ChangeSongTags(ctx, group, "Hysteria", []domain.Tag{"rock"}, true)
+	require.NoError(t, err)
+	_, err = db.PutLyrics(ctx, domain.SongTranslation{GroupName: group, SongName: "Hysteria", Lang: "en", Text: "It's bugging me"})
+	require.NoError(t, err)
+	playlist, err := db.CreatePlaylist(ctx, user.ID, domain.Playlist{Name: "Absolution"})
+	require.NoError(t, err)
+	require.NoError(t, db.DeletePlaylist(ctx, user.ID, playlist.ID, 0))
+
+	var entries []domain.AuditEntry
+	err = db.StreamAudit(ctx, domain.AuditFilter{RequestID: requestID}, func(entry domain.AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	require.NoError(t, err)
+	var actions []domain.AuditAction
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	require.Equal(t, []domain.AuditAction{domain.AuditPlaylistDelete, domain.AuditPlaylistCreate, domain.AuditLyricsPut,
+		domain.AuditSongTags, domain.AuditUserRoles, domain.AuditUserCreate}, actions)
+	require.Equal(t, domain.UserTarget(user.ID), entries[4].Target)
+	require.Contains(t, string(entries[4].Before), "listener")
+	require.Contains(t, string(entries[4].After), "editor")
+	require.Contains(t, string(entries[3].After), "rock")
+
+	// о действиях только для журнала событий нет
+	var events int
+	require.NoError(t, db.db.GetContext(ctx, &events, "SELECT COUNT(*) FROM outbox WHERE request_id = $1", requestID))
+	require.Zero(t, events)
+
+	_, err = db.DeleteGroup(context.Background(), group, domain.DeleteCascade)
+	require.NoError(t, err)
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	group := domain.GroupName(fmt.Sprintf("Outbox %d", time.Now().UnixNano()))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: "Starlight"}))
+	_, err := db.MoveSong(ctx, domain.SongMove{GroupName: group, SongName: "Starlight", NewGroupName: group + " Moved", NewSongName: "Starlight"}, 0)
+	require.NoError(t, err)
+
+	// событий других тестов может быть сколько угодно, ищем свои
+	claim := func() []domain.Event {
+		events, err := db.ClaimEvents(ctx, 10000, time.Minute)
+		require.NoError(t, err)
+		var ours []domain.Event
+		for _, event := range events {
+			if strings.HasPrefix(event.Target, domain.SongTarget(group, "Starlight")) {
+				ours = append(ours, event)
+			}
+		}
+		return ours
+	}
+	events := claim()
+	require.Len(t, events, 2)
+	require.Equal(t, domain.AuditSongCreate, events[0].Type)
+	require.Equal(t, domain.AuditSongMove, events[1].Type)
+	require.Equal(t, group+" Moved", events[1].GroupName)
+	require.Equal(t, group, events[1].PreviousGroup)
+	require.Equal(t, 1, events[1].Attempts)
+
+	// взятые события до конца аренды не отдаются повторно, а после неудачи ждут паузу
+	require.Empty(t, claim())
+	require.NoError(t, db.MarkEventFailed(ctx, events[0].ID, "receiver is down", 0))
+	require.NoError(t, db.MarkEventsPublished(ctx, events[1].ID))
+	retried := claim()
+	require.Len(t, retried, 1)
+	require.Equal(t, events[0].ID, retried[0].ID)
+	require.Equal(t, 2, retried[0].Attempts)
+	require.NoError(t, db.MarkEventsPublished(ctx, retried[0].ID))
+	require.NoError(t, db.Notify(ctx, "library_events", `{"id":0}`))
+}
+
+func TestOutboxMergeAndLyrics(t *testing.T) {
+	db := newTestDB(t)
+
+	requestID := fmt.Sprintf("outbox-%d", time.Now().UnixNano())
+	ctx := domain.WithActor(context.Background(), domain.Actor{RequestID: requestID})
+	group := domain.GroupName(fmt.Sprintf("Outbox merge %d", time.Now().UnixNano()))
+	require.NoError(t, db.AddSong(context.Background(), Song{GroupName: group, SongName: "Knights of Cydonia"}))
+	require.NoError(t, db.AddSong(context.Background(), Song{GroupName: group, SongName: "Knights Of Cydonia (Live)", Link: "https://example.com/live"}))
+
+	// слияние для потребителей событий - удаление одной песни и изменение другой
+	_, err := db.MergeSongs(ctx, domain.SongPair{
+		Keep: domain.SongRef{GroupName: group, SongName: "Knights of Cydonia"},
+		Drop: domain.SongRef{GroupName: group, SongName: "Knights Of Cydonia (Live)"},
+	})
+	require.NoError(t, err)
+	// перевод песню не меняет, оригинал меняет её текст
+	_, err = db.PutLyrics(ctx, domain.SongTranslation{GroupName: group, SongName: "Knights of Cydonia", Lang: "de", Text: "Komm reite mit mir"})
+	require.NoError(t, err)
+	_, err = db.PutLyrics(ctx, domain.SongTranslation{GroupName: group, SongName: "Knights of Cydonia", Lang: "en", Text: "Come ride with me", Original: true})
+	require.NoError(t, err)
+
+	var events []struct {
+		Type   string `db:"type"`
+		Target string `db:"target"`
+		After  []byte `db:"after"`
+	}
+	err = db.db.SelectContext(ctx, &events, "SELECT type, target, after FROM outbox WHERE request_id = $1 ORDER BY id", requestID)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, string(domain.AuditSongDelete), events[0].Type)
+	require.Equal(t, domain.SongTarget(group, "Knights Of Cydonia (Live)"), events[0].Target)
+	require.Equal(t, string(domain.AuditSongUpdate), events[1].Type)
+	require.Contains(t, string(events[1].After), "https://example.com/live")
+	require.Equal(t, string(domain.AuditSongUpdate), events[2].Type)
+	require.Contains(t, string(events[2].After), "Come ride with me")
+
+	_, err = db.DeleteGroup(context.Background(), group, domain.DeleteCascade)
+	require.NoError(t, err)
+}
+
+func TestMergeSongsKeepsLyricsTogether(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	group := domain.GroupName(fmt.Sprintf("Merge lyrics %d", time.Now().UnixNano()))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: "Madness", Text: "I, I can't get these memories out of my mind"}))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: "Madness (Live)", Text: "Madness live",
+		LRC: "[00:01.00]Madness live"}))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: "Panic Station"}))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: "Panic Station (Live)", Text: "Panic station live",
+		LRC: "[00:01.00]Panic station live"}))
+
+	// У keep есть текст, LRC от другой записи к нему не подклеивается
+	merged, err := db.MergeSongs(ctx, domain.SongPair{
+		Keep: domain.SongRef{GroupName: group, SongName: "Madness"},
+		Drop: domain.SongRef{GroupName: group, SongName: "Madness (Live)"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "I, I can't get these memories out of my mind", merged.Text)
+	require.Empty(t, merged.LRC)
+
+	// У keep нет ни текста, ни LRC - оба берутся у drop
+	merged, err = db.MergeSongs(ctx, domain.SongPair{
+		Keep: domain.SongRef{GroupName: group, SongName: "Panic Station"},
+		Drop: domain.SongRef{GroupName: group, SongName: "Panic Station (Live)"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Panic station live", merged.Text)
+	require.Equal(t, "[00:01.00]Panic station live", merged.LRC)
+
+	_, err = db.DeleteGroup(ctx, group, domain.DeleteCascade)
+	require.NoError(t, err)
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	user, err := db.CreateUser(ctx, fmt.Sprintf("partner-%d", time.Now().UnixNano()), "hash", domain.RoleEditor)
+	require.NoError(t, err)
+	group := domain.GroupName(fmt.Sprintf("Webhooks %d", time.Now().UnixNano()))
+	subscription, err := db.CreateWebhook(ctx, user.ID, domain.WebhookRequest{
+		URL:        "https://partner.example/hook",
+		EventTypes: []string{string(domain.AuditSongUpdate)},
+		Groups:     []string{strings.ToUpper(string(group))},
+		Secret:     "0123456789abcdef",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "0123456789abcdef", subscription.Secret)
+	found, err := db.GetWebhook(ctx, user.ID, subscription.ID)
+	require.NoError(t, err)
+	require.Empty(t, found.Secret)
+	_, err = db.GetWebhook(ctx, user.ID+1, subscription.ID)
+	require.ErrorIs(t, err, domain.ErrWebhookNotFound)
+
+	// событие подходит по типу и группе без учёта регистра, повтор события второй доставки не создаёт
+	event := domain.Event{ID: time.Now().UnixNano(), Type: domain.AuditSongUpdate, GroupName: group}
+	for i := 0; i < 2; i++ {
+		_, err = db.EnqueueDeliveries(ctx, event)
+		require.NoError(t, err)
+	}
+	_, err = db.EnqueueDeliveries(ctx, domain.Event{ID: event.ID + 1, Type: domain.AuditSongDelete, GroupName: group})
+	require.NoError(t, err)
+	claim := func() []domain.PendingDelivery {
+		deliveries, err := db.ClaimDeliveries(ctx, 10000, time.Minute)
+		require.NoError(t, err)
+		var ours []domain.PendingDelivery
+		for _, delivery := range deliveries {
+			if delivery.SubscriptionID == subscription.ID {
+				ours = append(ours, delivery)
+			}
+		}
+		return ours
+	}
+	deliveries := claim()
+	require.Len(t, deliveries, 1)
+	require.Equal(t, event.ID, deliveries[0].EventID)
+	require.Equal(t, "0123456789abcdef", deliveries[0].Secret)
+	require.Equal(t, 1, deliveries[0].Attempts)
+
+	// две неудачи подряд отключают подписку при disableAfter 2
+	require.NoError(t, db.FinishDelivery(ctx, domain.DeliveryResult{ID: deliveries[0].ID, ResponseStatus: 500, Error: "boom", RetryIn: time.Millisecond}, 2))
+	time.Sleep(10 * time.Millisecond)
+	deliveries = claim()
+	require.Len(t, deliveries, 1)
+	require.NoError(t, db.FinishDelivery(ctx, domain.DeliveryResult{ID: deliveries[0].ID, Error: "timeout", RetryIn: time.Millisecond}, 2))
+	found, err = db.GetWebhook(ctx, user.ID, subscription.ID)
+	require.NoError(t, err)
+	require.False(t, found.Enabled)
+	require.Contains(t, found.DisabledReason, "timeout")
+
+	// ручная повторная доставка уходит после включения подписки
+	redelivery, err := db.Redeliver(ctx, user.ID, subscription.ID, deliveries[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, deliveries[0].ID, *redelivery.RedeliveryOf)
+	require.Empty(t, claim())
+	enabled := true
+	found, err = db.UpdateWebhook(ctx, user.ID, subscription.ID, domain.WebhookRequest{Enabled: &enabled})
+	require.NoError(t, err)
+	require.Zero(t, found.Failures)
+	deliveries = claim()
+	require.Len(t, deliveries, 1)
+	require.Equal(t, redelivery.ID, deliveries[0].ID)
+	require.NoError(t, db.FinishDelivery(ctx, domain.DeliveryResult{ID: redelivery.ID, ResponseStatus: 204}, 2))
+
+	log, err := db.GetDeliveries(ctx, user.ID, subscription.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, log, 2)
+	require.Equal(t, domain.DeliveryDelivered, log[0].Status)
+	require.Equal(t, domain.DeliveryFailed, log[1].Status)
+	require.Equal(t, 2, log[1].Attempts)
+
+	require.NoError(t, db.DeleteWebhook(ctx, user.ID, subscription.ID))
+	require.ErrorIs(t, db.DeleteWebhook(ctx, user.ID, subscription.ID), domain.ErrWebhookNotFound)
+}
+
+func TestEventLog(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	_, before, err := db.EventLogBounds(ctx)
+	require.NoError(t, err)
+	group := domain.GroupName(fmt.Sprintf("Events %d", time.Now().UnixNano()))
+	require.NoError(t, db.AddSong(ctx, Song{GroupName: group, SongName: "Hysteria"}))
+	_, err = db.GroupRename(ctx, string(group), string(group)+" Renamed")
+	require.NoError(t, err)
+
+	first, last, err := db.EventLogBounds(ctx)
+	require.NoError(t, err)
+	require.Positive(t, first)
+	require.Greater(t, last, before)
+	events, err := db.GetEventsAfter(ctx, before, 1000)
+	require.NoError(t, err)
+	var ours []domain.Event
+	for _, event := range events {
+		if event.GroupName == group || event.PreviousGroup == group {
+			ours = append(ours, event)
+		}
+	}
+	require.Len(t, ours, 2)
+	require.Equal(t, domain.AuditSongCreate, ours[0].Type)
+	require.Equal(t, domain.AuditGroupRename, ours[1].Type)
+	require.Less(t, ours[0].ID, ours[1].ID)
+}
+
+func TestAddSongsGroupDisplayName(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	group := fmt.Sprintf("batch group %d", time.Now().UnixNano())
+	songs := []Song{
+		ToStorage(domain.Song{GroupName: domain.GroupName(group), SongName: "First"}),
+		ToStorage(domain.Song{GroupName: domain.GroupName(strings.ToUpper(group)), SongName: "Second"}),
+	}
+	created, err := db.AddSongs(ctx, songs)
+	require.NoError(t, err)
+	require.Equal(t, []bool{true, true}, created)
+	for _, name := range []domain.SongName{"First", "Second"} {
+		song, err := db.GetSong(domain.GroupName(group), name)
+		require.NoError(t, err)
+		require.Equal(t, domain.GroupName(group), song.GroupName)
+	}
+}
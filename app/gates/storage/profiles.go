@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"strings"
+	"time"
+)
+
+// groupRow строка списка групп: карточка (если есть) и сводка по песням и альбомам
+type groupRow struct {
+	Name             domain.GroupName `db:"name"`
+	Country          sql.NullString   `db:"country"`
+	FormedYear       sql.NullInt64    `db:"formed_year"`
+	Genres           pq.StringArray   `db:"genres"`
+	Members          pq.StringArray   `db:"members"`
+	Description      sql.NullString   `db:"description"`
+	Version          sql.NullInt64    `db:"version"`
+	Songs            int              `db:"songs"`
+	Albums           int              `db:"albums"`
+	FirstReleaseYear sql.NullInt64    `db:"first_release_year"`
+	LastReleaseYear  sql.NullInt64    `db:"last_release_year"`
+	Tags             pq.StringArray   `db:"tags"`
+	Total            int              `db:"total"`
+}
+
+func (r groupRow) ToDomain() domain.Group {
+	var tags []domain.Tag
+	for _, tag := range r.Tags {
+		tags = append(tags, domain.Tag(tag))
+	}
+	return domain.Group{
+		GroupProfile: domain.GroupProfile{
+			Name:        r.Name,
+			Country:     r.Country.String,
+			FormedYear:  int(r.FormedYear.Int64),
+			Genres:      r.Genres,
+			Members:     r.Members,
+			Description: r.Description.String,
+			Version:     int(r.Version.Int64),
+		},
+		GroupStats: domain.GroupStats{
+			Songs:            r.Songs,
+			Albums:           r.Albums,
+			FirstReleaseYear: int(r.FirstReleaseYear.Int64),
+			LastReleaseYear:  int(r.LastReleaseYear.Int64),
+		},
+		Tags: tags,
+	}
+}
+
+// groupsQuery группы из песен, альбомов и карточек. Название берётся из карточки, а если её нет - из песен
+func (p *DB) groupsQuery() sq.SelectBuilder {
+	keys := "SELECT group_key FROM songs_library UNION SELECT group_key FROM albums UNION SELECT group_key FROM groups"
+	return p.sq.Select(
+		"COALESCE(g.name, s.group_name, a.group_name) AS name",
+		"g.country", "g.formed_year", "g.genres", "g.members", "g.description", "g.version",
+		"COALESCE(s.songs, 0) AS songs",
+		"COALESCE(a.albums, 0) AS albums",
+		"s.first_release_year", "s.last_release_year",
+		"ARRAY(SELECT "+tagName+" FROM group_tags gt JOIN tags t ON t.id = gt.tag_id WHERE gt.group_key = k.group_key ORDER BY 1) AS tags",
+		"COUNT(*) OVER () AS total",
+	).
+		From("(" + keys + ") k").
+		LeftJoin("groups g ON g.group_key = k.group_key").
+		LeftJoin(`(SELECT group_key, MIN(group_name) AS group_name, COUNT(*) AS songs,
+			EXTRACT(YEAR FROM MIN(release_date))::int AS first_release_year,
+			EXTRACT(YEAR FROM MAX(release_date))::int AS last_release_year
+			FROM songs_library GROUP BY group_key) s ON s.group_key = k.group_key`).
+		LeftJoin(`(SELECT group_key, MIN(group_name) AS group_name, COUNT(*) AS albums
+			FROM albums GROUP BY group_key) a ON a.group_key = k.group_key`)
+}
+
+// GetGroups список групп по названию с поиском и пагинацией, второе значение - сколько всего групп подходит под поиск
+func (p *DB) GetGroups(ctx context.Context, filter domain.GroupFilter) ([]domain.Group, int, error) {
+	const op = "storage.postgres.GetGroups"
+
+	p.log.Debug(op, "trying to get groups, filter is: ", filter)
+	query := p.groupsQuery().OrderBy("k.group_key")
+	if filter.Query != "" {
+		query = query.Where("k.group_key LIKE ?", "%"+escapeLike(domain.NormalizeKey(filter.Query))+"%")
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(uint64(filter.Limit)).Offset(uint64(filter.Offset))
+	}
+	qry, args, err := query.ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, 0, err
+	}
+	var rows []groupRow
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, 0, err
+	}
+	groups := make([]domain.Group, 0, len(rows))
+	total := 0
+	for _, row := range rows {
+		groups = append(groups, row.ToDomain())
+		total = row.Total
+	}
+	return groups, total, nil
+}
+
+// GetGroup карточка и сводка одной группы
+func (p *DB) GetGroup(ctx context.Context, name domain.GroupName) (domain.Group, error) {
+	const op = "storage.postgres.GetGroup"
+
+	p.log.Debug(op, "trying to get group: ", name)
+	qry, args, err := p.groupsQuery().Where(sq.Eq{"k.group_key": groupKey(name)}).ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.Group{}, err
+	}
+	var row groupRow
+	err = p.db.GetContext(ctx, &row, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Group{}, domain.ErrGroupNotFound
+	}
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.Group{}, err
+	}
+	return row.ToDomain(), nil
+}
+
+// groupProfileTx блокирует и возвращает карточку группы, nil если карточки нет
+func (p *DB) groupProfileTx(ctx context.Context, tx *sqlx.Tx, name domain.GroupName) (*domain.GroupProfile, error) {
+	qry, args, err := p.sq.Select("name", "country", "formed_year", "genres", "members", "description", "version").
+		From("groups").
+		Where(sq.Eq{"group_key": groupKey(name)}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var row groupRow
+	err = tx.GetContext(ctx, &row, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	profile := row.ToDomain().GroupProfile
+	return &profile, nil
+}
+
+// profileChange изменение карточки группы для журнала аудита
+func profileChange(action domain.AuditAction, name domain.GroupName, before *domain.GroupProfile, after *domain.GroupProfile) change {
+	c := change{action: action, target: domain.GroupTarget(name), group: name}
+	if before != nil {
+		c.before = *before
+	}
+	if after != nil {
+		c.after = *after
+	}
+	return c
+}
+
+// CreateGroup создаёт карточку группы. Песни у группы уже могут быть, тогда название карточки берётся из них
+func (p *DB) CreateGroup(ctx context.Context, profile domain.GroupProfile) error {
+	const op = "storage.postgres.CreateGroup"
+
+	p.log.Debug(op, "trying to create group: ", profile.Name)
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		qry, args, err := p.sq.Insert("groups").
+			Columns("name", "group_key", "country", "formed_year", "genres", "members", "description", "created_at", "updated_at").
+			Values(p.groupDisplayName(profile.Name), groupKey(profile.Name), profile.Country, nullYear(profile.FormedYear),
+				pq.StringArray(nonNil(profile.Genres)), pq.StringArray(nonNil(profile.Members)), profile.Description, time.Now(), time.Now()).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			if isUniqueViolation(err) {
+				return domain.ErrGroupExists
+			}
+			return err
+		}
+		after, err := p.groupProfileTx(ctx, tx, profile.Name)
+		if err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, profileChange(domain.AuditGroupCreate, profile.Name, nil, after))
+	})
+	if err != nil {
+		if !errors.Is(err, domain.ErrGroupExists) {
+			p.log.Error(op, " ERROR: ", err)
+		}
+		return err
+	}
+	p.log.Debug(op, "Successfully created group: ", profile.Name)
+	return nil
+}
+
+// UpdateGroup меняет непустые поля карточки. Если карточки нет, а песни у группы есть, карточка создаётся.
+// Если version больше нуля, изменение пройдёт только при совпадении версии карточки
+func (p *DB) UpdateGroup(ctx context.Context, name domain.GroupName, patch domain.GroupProfile, version int) error {
+	const op = "storage.postgres.UpdateGroup"
+
+	p.log.Debug(op, "trying to update group: ", name)
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		before, err := p.groupProfileTx(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		current := 1
+		if before == nil {
+			songs, err := p.lockGroupSongs(ctx, tx, string(name))
+			if err != nil {
+				return err
+			}
+			if len(songs) == 0 {
+				return domain.ErrGroupNotFound
+			}
+			qry, args, err := p.sq.Insert("groups").
+				Columns("name", "group_key", "created_at", "updated_at").
+				Values(p.groupDisplayName(name), groupKey(name), time.Now(), time.Now()).
+				ToSql()
+			if err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+				return err
+			}
+		} else {
+			current = before.Version
+		}
+		if version > 0 && version != current {
+			return domain.ErrVersionMismatch
+		}
+
+		query := p.sq.Update("groups").
+			Set("updated_at", time.Now()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"group_key": groupKey(name)})
+		if patch.Country != "" {
+			query = query.Set("country", patch.Country)
+		}
+		if patch.FormedYear != 0 {
+			query = query.Set("formed_year", patch.FormedYear)
+		}
+		if patch.Genres != nil {
+			query = query.Set("genres", pq.StringArray(patch.Genres))
+		}
+		if patch.Members != nil {
+			query = query.Set("members", pq.StringArray(patch.Members))
+		}
+		if patch.Description != "" {
+			query = query.Set("description", patch.Description)
+		}
+		qry, args, err := query.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		after, err := p.groupProfileTx(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, profileChange(domain.AuditGroupUpdate, name, before, after))
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	p.log.Debug(op, "Successfully updated group: ", name)
+	return nil
+}
+
+// DeleteGroup удаляет карточку группы. С DeleteRefuse группа с песнями не удаляется (domain.ErrGroupNotEmpty),
+// с DeleteCascade удаляются и песни вместе со всем, что на них ссылается, и альбомы группы. Теги группы удаляются в обоих случаях.
+// Возвращает количество удалённых песен
+func (p *DB) DeleteGroup(ctx context.Context, name domain.GroupName, mode domain.GroupDeleteMode) (int, error) {
+	const op = "storage.postgres.DeleteGroup"
+
+	p.log.Debug(op, "trying to delete group: ", name, "mode", mode)
+	var deleted int
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		songs, err := p.lockGroupSongs(ctx, tx, string(name))
+		if err != nil {
+			return err
+		}
+		if len(songs) > 0 && mode != domain.DeleteCascade {
+			return domain.ErrGroupNotEmpty
+		}
+		found := len(songs) > 0
+		for _, table := range []string{"songs_library", "albums", "groups", "group_tags"} {
+			qry, args, err := p.sq.Delete(table).Where(sq.Eq{"group_key": groupKey(name)}).ToSql()
+			if err != nil {
+				return err
+			}
+			res, err := tx.ExecContext(ctx, qry, args...)
+			if err != nil {
+				return err
+			}
+			if affected, _ := res.RowsAffected(); affected > 0 {
+				found = true
+			}
+		}
+		if !found {
+			return domain.ErrGroupNotFound
+		}
+		deleted = len(songs)
+		return p.recordTx(ctx, tx, change{
+			action: domain.AuditGroupDelete,
+			target: domain.GroupTarget(name),
+			group:  name,
+			before: groupState{GroupName: string(name), Songs: deleted},
+		})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return 0, err
+	}
+	p.log.Debug(op, "Successfully deleted group: ", name, "songs deleted", deleted)
+	return deleted, nil
+}
+
+// moveGroupProfileTx переносит карточку группы from на группу to. Если у to уже есть своя карточка, карточка from удаляется
+func (p *DB) moveGroupProfileTx(ctx context.Context, tx *sqlx.Tx, from string, to string) error {
+	fromKey, toKey := groupKey(domain.GroupName(from)), groupKey(domain.GroupName(to))
+	if fromKey != toKey {
+		qry, args, err := p.sq.Delete("groups").
+			Where(sq.Eq{"group_key": fromKey}).
+			Where("EXISTS (SELECT 1 FROM groups t WHERE t.group_key = ?)", toKey).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+	}
+	qry, args, err := p.sq.Update("groups").
+		Set("name", p.groupDisplayName(domain.GroupName(to))).
+		Set("group_key", toKey).
+		Set("updated_at", time.Now()).
+		Set("version", sq.Expr("version + 1")).
+		Where(sq.Eq{"group_key": fromKey}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, qry, args...)
+	return err
+}
+
+func nullYear(year int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(year), Valid: year != 0}
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// escapeLike экранирует спецсимволы LIKE в поисковой строке
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
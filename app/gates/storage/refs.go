@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+)
+
+// songRefStatements переносят на песню $2 всё, что ссылается на песню $1. Если у $2 уже есть такая же запись,
+// остаётся запись $2. Каждая новая таблица со ссылкой на songs_library(id) должна добавить сюда свой перенос
+var songRefStatements = []string{
+	// переводы, оригиналом остаётся текст $2
+	`INSERT INTO song_lyrics (song_id, lang, text, sections, original, created_at, updated_at)
+	SELECT $2, lang, text, sections, false, created_at, updated_at FROM song_lyrics WHERE song_id = $1
+	ON CONFLICT (song_id, lang) DO NOTHING`,
+	// треки альбомов, песня $2 занимает место $1 в трек-листе
+	`UPDATE album_songs SET song_id = $2 WHERE song_id = $1
+	AND NOT EXISTS (SELECT 1 FROM album_songs a WHERE a.album_id = album_songs.album_id AND a.song_id = $2)`,
+	// теги, у $2 остаются и его собственные
+	`INSERT INTO song_tags (song_id, tag_id, created_at)
+	SELECT $2, tag_id, created_at FROM song_tags WHERE song_id = $1
+	ON CONFLICT (song_id, tag_id) DO NOTHING`,
+	// записи плейлистов, одна песня может стоять в плейлисте несколько раз
+	`UPDATE playlist_items SET song_id = $2 WHERE song_id = $1`,
+	// избранное пользователей
+	`INSERT INTO favorites (user_id, song_id, created_at)
+	SELECT user_id, $2, created_at FROM favorites WHERE song_id = $1
+	ON CONFLICT (user_id, song_id) DO NOTHING`,
+	// история прослушиваний и счётчики, прослушивания $1 добавляются к $2
+	`UPDATE plays SET song_id = $2 WHERE song_id = $1`,
+	`INSERT INTO song_play_stats (song_id, play_count, last_played)
+	SELECT $2, play_count, last_played FROM song_play_stats WHERE song_id = $1
+	ON CONFLICT (song_id) DO UPDATE SET play_count = song_play_stats.play_count + EXCLUDED.play_count,
+	last_played = GREATEST(song_play_stats.last_played, EXCLUDED.last_played)`,
+	// места в снимках чартов, чтобы изменение места считалось от песни $2
+	`UPDATE chart_entries SET song_id = $2 WHERE song_id = $1
+	AND NOT EXISTS (SELECT 1 FROM chart_entries c WHERE c.snapshot_id = chart_entries.snapshot_id AND c.song_id = $2)`,
+}
+
+// repointSongRefs переносит ссылки с песни fromID на toID. Вызывается при слиянии перед удалением проигравшей песни,
+// иначе ON DELETE CASCADE удалит её переводы и прочие данные вместе с ней
+func (p *DB) repointSongRefs(ctx context.Context, tx *sqlx.Tx, fromID int64, toID int64) error {
+	for _, statement := range songRefStatements {
+		if _, err := tx.ExecContext(ctx, statement, fromID, toID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"time"
+)
+
+func nonNilRoles(roles []domain.Role) []domain.Role {
+	if roles == nil {
+		return []domain.Role{}
+	}
+	return roles
+}
+
+// setUserRolesTx заменяет роли пользователя на roles
+func (p *DB) setUserRolesTx(ctx context.Context, tx *sqlx.Tx, userID int64, roles []domain.Role) error {
+	qry, args, err := p.sq.Delete("user_roles").Where(sq.Eq{"user_id": userID}).ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+	insert := p.sq.Insert("user_roles").Columns("user_id", "role", "created_at")
+	for _, role := range roles {
+		insert = insert.Values(userID, string(role), time.Now())
+	}
+	qry, args, err = insert.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, qry, args...)
+	return err
+}
+
+// rolesOf роли пользователей ids по id пользователя
+func (p *DB) rolesOf(ctx context.Context, q sqlx.QueryerContext, ids ...int64) (map[int64][]domain.Role, error) {
+	qry, args, err := p.sq.Select("user_id", "role").
+		From("user_roles").
+		Where(sq.Eq{"user_id": ids}).
+		OrderBy("user_id", "role").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		UserID int64  `db:"user_id"`
+		Role   string `db:"role"`
+	}
+	if err = sqlx.SelectContext(ctx, q, &rows, qry, args...); err != nil {
+		return nil, err
+	}
+	roles := make(map[int64][]domain.Role, len(ids))
+	for _, row := range rows {
+		roles[row.UserID] = append(roles[row.UserID], domain.Role(row.Role))
+	}
+	return roles, nil
+}
+
+// UserRoles роли пользователя на момент запроса. У отключённого пользователя ролей нет
+func (p *DB) UserRoles(ctx context.Context, userID int64) ([]domain.Role, error) {
+	const op = "storage.postgres.UserRoles"
+
+	qry, args, err := p.sq.Select("r.role").
+		From("user_roles r").
+		Join("users u ON u.id = r.user_id").
+		Where(sq.Eq{"r.user_id": userID, "u.disabled": false}).
+		OrderBy("r.role").
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var roles []domain.Role
+	if err = p.db.SelectContext(ctx, &roles, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	return nonNilRoles(roles), nil
+}
+
+// GetUsers все пользователи с ролями, по логину
+func (p *DB) GetUsers(ctx context.Context) ([]domain.User, error) {
+	const op = "storage.postgres.GetUsers"
+
+	qry, args, err := p.sm.Select(p.sq.Select(), &User{}).From("users").OrderBy("username").ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []User
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	roles, err := p.rolesOf(ctx, p.db, ids...)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	users := make([]domain.User, len(rows))
+	for i, row := range rows {
+		users[i] = row.ToDomain()
+		users[i].Roles = nonNilRoles(roles[row.ID])
+	}
+	return users, nil
+}
+
+// userWithRolesTx пользователь вместе с ролями внутри транзакции
+func (p *DB) userWithRolesTx(ctx context.Context, tx *sqlx.Tx, id int64) (domain.User, error) {
+	user, err := p.getUser(ctx, tx, sq.Eq{"id": id})
+	if err != nil {
+		return domain.User{}, err
+	}
+	roles, err := p.rolesOf(ctx, tx, id)
+	if err != nil {
+		return domain.User{}, err
+	}
+	result := user.ToDomain()
+	result.Roles = nonNilRoles(roles[id])
+	return result, nil
+}
+
+// GetUserWithRoles пользователь вместе с ролями
+func (p *DB) GetUserWithRoles(ctx context.Context, id int64) (domain.User, error) {
+	const op = "storage.postgres.GetUserWithRoles"
+
+	user, err := p.GetUser(ctx, id)
+	if err != nil {
+		return user, err
+	}
+	roles, err := p.rolesOf(ctx, p.db, id)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return user, err
+	}
+	user.Roles = nonNilRoles(roles[id])
+	return user, nil
+}
+
+// SetUserRoles заменяет роли пользователя целиком
+func (p *DB) SetUserRoles(ctx context.Context, id int64, roles []domain.Role) (domain.User, error) {
+	const op = "storage.postgres.SetUserRoles"
+
+	p.log.Debug(op, "trying to set roles of user: ", id)
+	var result domain.User
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		before, err := p.userWithRolesTx(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err = p.setUserRolesTx(ctx, tx, id, roles); err != nil {
+			return err
+		}
+		if result, err = p.userWithRolesTx(ctx, tx, id); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: domain.AuditUserRoles, target: domain.UserTarget(id), before: before, after: result})
+	})
+	if err != nil {
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			p.log.Error(op, " ERROR: ", err)
+		}
+		return domain.User{}, err
+	}
+	return result, nil
+}
+
+// UpdateUser применяет patch к учётной записи. При отключении пользователя отзываются его refresh токены
+func (p *DB) UpdateUser(ctx context.Context, id int64, patch domain.UserPatch) (domain.User, error) {
+	const op = "storage.postgres.UpdateUser"
+
+	p.log.Debug(op, "trying to update user: ", id)
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		before, err := p.userWithRolesTx(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if patch.Disabled == nil || *patch.Disabled == before.Disabled {
+			return nil
+		}
+		qry, args, err := p.sq.Update("users").
+			Set("disabled", *patch.Disabled).
+			Set("updated_at", time.Now()).
+			Where(sq.Eq{"id": id}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		if *patch.Disabled {
+			if err = p.revokeUserTokensTx(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		after := before
+		after.Disabled = *patch.Disabled
+		return p.auditTx(ctx, tx, change{action: domain.AuditUserUpdate, target: domain.UserTarget(id), before: before, after: after})
+	})
+	if err != nil {
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			p.log.Error(op, " ERROR: ", err)
+		}
+		return domain.User{}, err
+	}
+	return p.GetUserWithRoles(ctx, id)
+}
@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"context"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"mobileSongLibrary/domain"
+	"time"
+)
+
+// tagName выражение с тегом в виде namespace:value для таблицы тегов с алиасом t
+const tagName = "t.namespace || ':' || t.value"
+
+// tagIDsTx заводит недостающие теги и возвращает id всех тегов tags
+func (p *DB) tagIDsTx(ctx context.Context, tx *sqlx.Tx, tags []domain.Tag) ([]int64, error) {
+	ids := make([]int64, 0, len(tags))
+	for _, tag := range tags {
+		qry, args, err := p.sq.Insert("tags").
+			Columns("namespace", "value").
+			Values(tag.Namespace(), tag.Value()).
+			Suffix("ON CONFLICT (namespace, value) DO UPDATE SET value = EXCLUDED.value RETURNING id").
+			ToSql()
+		if err != nil {
+			return nil, err
+		}
+		var id int64
+		if err = tx.QueryRowxContext(ctx, qry, args...).Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// tagsCondition условие "тег t входит в tags"
+func tagsCondition(tags []domain.Tag) sq.Sqlizer {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = string(tag)
+	}
+	return sq.Expr(tagName+" = ANY(?)", pq.StringArray(names))
+}
+
+// changeTagsTx добавляет (add) или снимает теги в таблице table (song_tags или group_tags) у строк, где column = owner
+func (p *DB) changeTagsTx(ctx context.Context, tx *sqlx.Tx, table string, column string, owner interface{}, tags []domain.Tag, add bool) error {
+	var query sq.Sqlizer
+	if add {
+		ids, err := p.tagIDsTx(ctx, tx, tags)
+		if err != nil {
+			return err
+		}
+		insert := p.sq.Insert(table).Columns(column, "tag_id").Suffix("ON CONFLICT DO NOTHING")
+		for _, id := range ids {
+			insert = insert.Values(owner, id)
+		}
+		query = insert
+	} else {
+		query = p.sq.Delete(table).
+			Where(sq.Eq{column: owner}).
+			Where(sq.Expr("tag_id IN (SELECT t.id FROM tags t WHERE ?)", tagsCondition(tags)))
+	}
+	qry, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, qry, args...)
+	return err
+}
+
+// ownTagsTx собственные теги строк table, где column = owner. Для песни это теги без тегов её группы
+func (p *DB) ownTagsTx(ctx context.Context, tx *sqlx.Tx, table string, column string, owner interface{}) ([]domain.Tag, error) {
+	qry, args, err := p.sq.Select(tagName).
+		From(table + " o").
+		Join("tags t ON t.id = o.tag_id").
+		Where(sq.Eq{"o." + column: owner}).
+		OrderBy(tagName).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	tags := []domain.Tag{}
+	err = tx.SelectContext(ctx, &tags, qry, args...)
+	return tags, err
+}
+
+// ChangeSongTags добавляет (add) или снимает теги песни и возвращает её собственные теги после изменения
+func (p *DB) ChangeSongTags(ctx context.Context, group domain.GroupName, song domain.SongName, tags []domain.Tag, add bool) ([]domain.Tag, error) {
+	const op = "storage.postgres.ChangeSongTags"
+
+	p.log.Debug(op, "trying to change song tags: ", song, "add", add)
+	var result []domain.Tag
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		locked, err := p.lockSong(ctx, tx, group, song)
+		if err != nil {
+			return err
+		}
+		before, err := p.ownTagsTx(ctx, tx, "song_tags", "song_id", locked.ID)
+		if err != nil {
+			return err
+		}
+		if err = p.changeTagsTx(ctx, tx, "song_tags", "song_id", locked.ID, tags, add); err != nil {
+			return err
+		}
+		if err = p.bumpSongsTx(ctx, tx, sq.Eq{"id": locked.ID}); err != nil {
+			return err
+		}
+		if result, err = p.ownTagsTx(ctx, tx, "song_tags", "song_id", locked.ID); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{
+			action: domain.AuditSongTags,
+			target: domain.SongTarget(locked.GroupName, locked.SongName),
+			group:  locked.GroupName,
+			before: tagsState{Tags: before},
+			after:  tagsState{Tags: result},
+		})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	p.log.Debug(op, "Successfully changed song tags: ", song)
+	return result, nil
+}
+
+// ChangeGroupTags добавляет (add) или снимает теги группы и возвращает её теги после изменения.
+// Теги группы действуют на все её песни, поэтому версии этих песен тоже меняются
+func (p *DB) ChangeGroupTags(ctx context.Context, group domain.GroupName, tags []domain.Tag, add bool) ([]domain.Tag, error) {
+	const op = "storage.postgres.ChangeGroupTags"
+
+	p.log.Debug(op, "trying to change group tags: ", group, "add", add)
+	var result []domain.Tag
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		key := groupKey(group)
+		var exists bool
+		err := tx.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM songs_library WHERE group_key = $1)
+			OR EXISTS (SELECT 1 FROM groups WHERE group_key = $1) OR EXISTS (SELECT 1 FROM albums WHERE group_key = $1)`, key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return domain.ErrGroupNotFound
+		}
+		before, err := p.ownTagsTx(ctx, tx, "group_tags", "group_key", key)
+		if err != nil {
+			return err
+		}
+		if err = p.changeTagsTx(ctx, tx, "group_tags", "group_key", key, tags, add); err != nil {
+			return err
+		}
+		if err = p.bumpSongsTx(ctx, tx, sq.Eq{"group_key": key}); err != nil {
+			return err
+		}
+		if result, err = p.ownTagsTx(ctx, tx, "group_tags", "group_key", key); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{
+			action: domain.AuditGroupTags,
+			target: domain.GroupTarget(group),
+			group:  group,
+			before: tagsState{Tags: before},
+			after:  tagsState{Tags: result},
+		})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	p.log.Debug(op, "Successfully changed group tags: ", group)
+	return result, nil
+}
+
+// bumpSongsTx меняет версию песен, у которых поменялись теги, чтобы клиенты не получили устаревший ответ по ETag
+func (p *DB) bumpSongsTx(ctx context.Context, tx *sqlx.Tx, where sq.Eq) error {
+	qry, args, err := p.sq.Update("songs_library").
+		Set("updated_at", time.Now()).
+		Set("version", sq.Expr("version + 1")).
+		Where(where).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, qry, args...)
+	return err
+}
+
+// SongTags теги песен ids вместе с тегами их групп
+func (p *DB) SongTags(ctx context.Context, ids ...int64) (map[int64][]domain.Tag, error) {
+	const op = "storage.postgres.SongTags"
+
+	result := make(map[int64][]domain.Tag, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	qry, args, err := p.sq.Select("e.song_id", tagName+" AS tag").
+		From("song_effective_tags e").
+		Join("tags t ON t.id = e.tag_id").
+		Where(sq.Expr("e.song_id = ANY(?)", pq.Int64Array(ids))).
+		OrderBy("e.song_id", tagName).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []struct {
+		SongID int64      `db:"song_id"`
+		Tag    domain.Tag `db:"tag"`
+	}
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.SongID] = append(result[row.SongID], row.Tag)
+	}
+	return result, nil
+}
+
+// GetTagFacets считает для каждого тега из пространств namespaces, сколько песен подходящих под filter им помечено.
+// Пагинация filter не учитывается, теги внутри пространства идут по убыванию количества
+func (p *DB) GetTagFacets(ctx context.Context, filter domain.SongFilter, namespaces []string) (map[string][]domain.TagCount, error) {
+	const op = "storage.postgres.GetTagFacets"
+
+	p.log.Debug(op, "trying to count tags, namespaces: ", namespaces)
+	songs := p.filterLibrary(p.sq.Select("id").From("songs_library"), filter)
+	qry, args, err := p.sq.Select("t.namespace", "t.value", "COUNT(DISTINCT e.song_id) AS count").
+		From("song_effective_tags e").
+		Join("tags t ON t.id = e.tag_id").
+		Where(sq.Expr("e.song_id IN (?)", songs)).
+		Where(sq.Expr("t.namespace = ANY(?)", pq.StringArray(namespaces))).
+		GroupBy("t.namespace", "t.value").
+		OrderBy("t.namespace", "count DESC", "t.value").
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []struct {
+		Namespace string `db:"namespace"`
+		Value     string `db:"value"`
+		Count     int    `db:"count"`
+	}
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	facets := make(map[string][]domain.TagCount, len(namespaces))
+	for _, namespace := range namespaces {
+		facets[namespace] = []domain.TagCount{}
+	}
+	for _, row := range rows {
+		facets[row.Namespace] = append(facets[row.Namespace], domain.TagCount{Tag: domain.Tag(row.Namespace + ":" + row.Value), Count: row.Count})
+	}
+	return facets, nil
+}
+
+// moveGroupTagsTx переносит теги группы from на группу to, совпадающие теги не дублируются
+func (p *DB) moveGroupTagsTx(ctx context.Context, tx *sqlx.Tx, from string, to string) error {
+	fromKey, toKey := groupKey(domain.GroupName(from)), groupKey(domain.GroupName(to))
+	if fromKey == toKey {
+		return nil
+	}
+	statements := []sq.Sqlizer{
+		sq.Expr(`INSERT INTO group_tags (group_key, tag_id, created_at)
+			SELECT ?, tag_id, created_at FROM group_tags WHERE group_key = ? ON CONFLICT DO NOTHING`, toKey, fromKey),
+		p.sq.Delete("group_tags").Where(sq.Eq{"group_key": fromKey}),
+	}
+	for _, statement := range statements {
+		qry, args, err := statement.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, p.placeholders(qry), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
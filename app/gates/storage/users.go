@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"time"
+)
+
+type User struct {
+	ID           int64     `db:"id"`
+	Username     string    `db:"username"`
+	PasswordHash string    `db:"password_hash"`
+	Disabled     bool      `db:"disabled"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+func (u User) ToDomain() domain.User {
+	return domain.User{ID: u.ID, Username: u.Username, Disabled: u.Disabled, CreatedAt: u.CreatedAt}
+}
+
+type APIKey struct {
+	ID         int64        `db:"id"`
+	UserID     int64        `db:"user_id"`
+	Name       string       `db:"name"`
+	Prefix     string       `db:"prefix"`
+	KeyHash    string       `db:"key_hash"`
+	ExpiresAt  sql.NullTime `db:"expires_at"`
+	LastUsedAt sql.NullTime `db:"last_used_at"`
+	RevokedAt  sql.NullTime `db:"revoked_at"`
+	CreatedAt  time.Time    `db:"created_at"`
+}
+
+func (k APIKey) ToDomain() domain.APIKey {
+	key := domain.APIKey{ID: k.ID, Name: k.Name, Prefix: k.Prefix, CreatedAt: k.CreatedAt}
+	if k.ExpiresAt.Valid {
+		key.ExpiresAt = &k.ExpiresAt.Time
+	}
+	if k.LastUsedAt.Valid {
+		key.LastUsedAt = &k.LastUsedAt.Time
+	}
+	return key
+}
+
+// CreateUser заводит пользователя с уже посчитанным хэшем пароля и ролями roles
+func (p *DB) CreateUser(ctx context.Context, username string, passwordHash string, roles ...domain.Role) (domain.User, error) {
+	const op = "storage.postgres.CreateUser"
+
+	p.log.Debug(op, "trying to create user: ", username)
+	var user User
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		qry, args, err := p.sq.Insert("users").
+			Columns("username", "password_hash", "created_at", "updated_at").
+			Values(username, passwordHash, time.Now(), time.Now()).
+			Suffix("RETURNING " + p.columns(User{})).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&user); err != nil {
+			if isUniqueViolation(err) {
+				return domain.ErrUserExists
+			}
+			return err
+		}
+		if err = p.setUserRolesTx(ctx, tx, user.ID, roles); err != nil {
+			return err
+		}
+		after, err := p.userWithRolesTx(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: domain.AuditUserCreate, target: domain.UserTarget(user.ID), after: after})
+	})
+	if err != nil {
+		if !errors.Is(err, domain.ErrUserExists) {
+			p.log.Error(op, " ERROR: ", err)
+		}
+		return domain.User{}, err
+	}
+	p.log.Debug(op, "Successfully created user: ", username)
+	result := user.ToDomain()
+	result.Roles = nonNilRoles(roles)
+	return result, nil
+}
+
+func (p *DB) getUser(ctx context.Context, q sqlx.QueryerContext, where sq.Eq) (User, error) {
+	qry, args, err := p.sm.Select(p.sq.Select(), &User{}).From("users").Where(where).ToSql()
+	if err != nil {
+		return User{}, err
+	}
+	var user User
+	err = sqlx.GetContext(ctx, q, &user, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, domain.ErrUserNotFound
+	}
+	return user, err
+}
+
+// UserCredentials пользователь и хэш его пароля для проверки при входе
+func (p *DB) UserCredentials(ctx context.Context, username string) (domain.User, string, error) {
+	const op = "storage.postgres.UserCredentials"
+
+	user, err := p.getUser(ctx, p.db, sq.Eq{"username": username})
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		p.log.Error(op, " ERROR: ", err)
+	}
+	return user.ToDomain(), user.PasswordHash, err
+}
+
+func (p *DB) GetUser(ctx context.Context, id int64) (domain.User, error) {
+	const op = "storage.postgres.GetUser"
+
+	user, err := p.getUser(ctx, p.db, sq.Eq{"id": id})
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		p.log.Error(op, " ERROR: ", err)
+	}
+	return user.ToDomain(), err
+}
+
+// SaveRefreshToken сохраняет хэш выданного refresh токена
+func (p *DB) SaveRefreshToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	const op = "storage.postgres.SaveRefreshToken"
+
+	qry, args, err := p.sq.Insert("refresh_tokens").
+		Columns("user_id", "token_hash", "expires_at", "created_at").
+		Values(userID, tokenHash, expiresAt, time.Now()).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	if _, err = p.db.ExecContext(ctx, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	return nil
+}
+
+// RotateRefreshToken отзывает refresh токен oldHash и сохраняет вместо него newHash, возвращая владельца.
+// Повторное использование уже отозванного токена значит, что его украли: тогда отзываются все токены пользователя
+func (p *DB) RotateRefreshToken(ctx context.Context, oldHash string, newHash string, expiresAt time.Time) (domain.User, error) {
+	const op = "storage.postgres.RotateRefreshToken"
+
+	var result domain.User
+	var reused bool
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		var token struct {
+			UserID    int64        `db:"user_id"`
+			ExpiresAt time.Time    `db:"expires_at"`
+			RevokedAt sql.NullTime `db:"revoked_at"`
+		}
+		qry, args, err := p.sq.Select("user_id", "expires_at", "revoked_at").
+			From("refresh_tokens").
+			Where(sq.Eq{"token_hash": oldHash}).
+			Suffix("FOR UPDATE").
+			ToSql()
+		if err != nil {
+			return err
+		}
+		err = tx.GetContext(ctx, &token, qry, args...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if token.RevokedAt.Valid {
+			reused = true
+			return p.revokeUserTokensTx(ctx, tx, token.UserID)
+		}
+		if token.ExpiresAt.Before(time.Now()) {
+			return domain.ErrInvalidToken
+		}
+		user, err := p.getUser(ctx, tx, sq.Eq{"id": token.UserID})
+		if err != nil {
+			return err
+		}
+		if user.Disabled {
+			return domain.ErrInvalidToken
+		}
+
+		qry, args, err = p.sq.Update("refresh_tokens").
+			Set("revoked_at", time.Now()).
+			Where(sq.Eq{"token_hash": oldHash}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		qry, args, err = p.sq.Insert("refresh_tokens").
+			Columns("user_id", "token_hash", "expires_at", "created_at").
+			Values(token.UserID, newHash, expiresAt, time.Now()).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		result = user.ToDomain()
+		return nil
+	})
+	if reused && err == nil { //отзыв всех токенов должен сохраниться, поэтому ошибку отдаём после коммита
+		p.log.Warn(op, "revoked refresh token was reused, all tokens of the user are revoked", "")
+		return result, domain.ErrInvalidToken
+	}
+	if err != nil && !errors.Is(err, domain.ErrInvalidToken) {
+		p.log.Error(op, " ERROR: ", err)
+	}
+	return result, err
+}
+
+func (p *DB) revokeUserTokensTx(ctx context.Context, tx *sqlx.Tx, userID int64) error {
+	qry, args, err := p.sq.Update("refresh_tokens").
+		Set("revoked_at", time.Now()).
+		Where(sq.Eq{"user_id": userID, "revoked_at": nil}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, qry, args...)
+	return err
+}
+
+// RevokeRefreshToken отзывает refresh токен при выходе. Неизвестный токен не ошибка
+func (p *DB) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	const op = "storage.postgres.RevokeRefreshToken"
+
+	qry, args, err := p.sq.Update("refresh_tokens").
+		Set("revoked_at", time.Now()).
+		Where(sq.Eq{"token_hash": tokenHash, "revoked_at": nil}).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	if _, err = p.db.ExecContext(ctx, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	return nil
+}
+
+// CreateAPIKey сохраняет API-ключ пользователя. key.Key не сохраняется, только keyHash
+func (p *DB) CreateAPIKey(ctx context.Context, userID int64, key domain.APIKey, keyHash string) (domain.APIKey, error) {
+	const op = "storage.postgres.CreateAPIKey"
+
+	p.log.Debug(op, "trying to create api key: ", key.Name, "user", userID)
+	var expiresAt sql.NullTime
+	if key.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *key.ExpiresAt, Valid: true}
+	}
+	var row APIKey
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		qry, args, err := p.sq.Insert("api_keys").
+			Columns("user_id", "name", "prefix", "key_hash", "expires_at", "created_at").
+			Values(userID, key.Name, key.Prefix, keyHash, expiresAt, time.Now()).
+			Suffix("RETURNING " + p.columns(APIKey{})).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&row); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: domain.AuditAPIKeyCreate, target: domain.APIKeyTarget(row.ID), after: row.ToDomain()})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.APIKey{}, err
+	}
+	result := row.ToDomain()
+	result.Key = key.Key
+	return result, nil
+}
+
+// GetAPIKeys действующие API-ключи пользователя
+func (p *DB) GetAPIKeys(ctx context.Context, userID int64) ([]domain.APIKey, error) {
+	const op = "storage.postgres.GetAPIKeys"
+
+	qry, args, err := p.sm.Select(p.sq.Select(), &APIKey{}).
+		From("api_keys").
+		Where(sq.Eq{"user_id": userID, "revoked_at": nil}).
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []APIKey
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	keys := make([]domain.APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, row.ToDomain())
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает API-ключ id пользователя userID
+func (p *DB) RevokeAPIKey(ctx context.Context, userID int64, id int64) error {
+	const op = "storage.postgres.RevokeAPIKey"
+
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		qry, args, err := p.sq.Update("api_keys").
+			Set("revoked_at", time.Now()).
+			Where(sq.Eq{"id": id, "user_id": userID, "revoked_at": nil}).
+			Suffix("RETURNING " + p.columns(APIKey{})).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		var row APIKey
+		err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&row)
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrAPIKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: domain.AuditAPIKeyRevoke, target: domain.APIKeyTarget(id), before: row.ToDomain()})
+	})
+	if err != nil && !errors.Is(err, domain.ErrAPIKeyNotFound) {
+		p.log.Error(op, " ERROR: ", err)
+	}
+	return err
+}
+
+// APIKeyPrincipal находит действующий ключ по хэшу и отмечает его использование
+func (p *DB) APIKeyPrincipal(ctx context.Context, keyHash string) (domain.Principal, error) {
+	const op = "storage.postgres.APIKeyPrincipal"
+
+	var principal domain.Principal
+	err := p.db.QueryRowxContext(ctx, `UPDATE api_keys k SET last_used_at = NOW()
+		FROM users u
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > NOW())
+		AND u.id = k.user_id AND NOT u.disabled
+		RETURNING u.id, u.username, k.id`, keyHash).Scan(&principal.UserID, &principal.Username, &principal.APIKeyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return principal, domain.ErrInvalidToken
+	}
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return principal, err
+	}
+	principal.Method = domain.AuthAPIKey
+	return principal, nil
+}
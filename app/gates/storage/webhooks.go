@@ -0,0 +1,511 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"mobileSongLibrary/domain"
+	"sort"
+	"time"
+)
+
+// WebhookSubscription подписка в бд
+type WebhookSubscription struct {
+	ID             int64          `db:"id"`
+	URL            string         `db:"url"`
+	EventTypes     pq.StringArray `db:"event_types"`
+	Groups         pq.StringArray `db:"groups"`
+	Secret         string         `db:"secret"`
+	Enabled        bool           `db:"enabled"`
+	Failures       int            `db:"failures"`
+	DisabledReason sql.NullString `db:"disabled_reason"`
+	CreatedAt      time.Time      `db:"created_at"`
+	UpdatedAt      time.Time      `db:"updated_at"`
+}
+
+// ToDomain подписка без секрета, секрет отдаётся клиенту только когда он его задаёт
+func (w WebhookSubscription) ToDomain() domain.WebhookSubscription {
+	result := domain.WebhookSubscription{
+		ID:             w.ID,
+		URL:            w.URL,
+		EventTypes:     make([]domain.AuditAction, 0, len(w.EventTypes)),
+		Groups:         make([]domain.GroupName, 0, len(w.Groups)),
+		Enabled:        w.Enabled,
+		Failures:       w.Failures,
+		DisabledReason: w.DisabledReason.String,
+		CreatedAt:      w.CreatedAt,
+		UpdatedAt:      w.UpdatedAt,
+	}
+	for _, t := range w.EventTypes {
+		result.EventTypes = append(result.EventTypes, domain.AuditAction(t))
+	}
+	for _, group := range w.Groups {
+		result.Groups = append(result.Groups, domain.GroupName(group))
+	}
+	return result
+}
+
+// WebhookDelivery доставка в бд
+type WebhookDelivery struct {
+	ID             int64          `db:"id"`
+	SubscriptionID int64          `db:"subscription_id"`
+	EventID        int64          `db:"event_id"`
+	EventType      string         `db:"event_type"`
+	Status         string         `db:"status"`
+	Attempts       int            `db:"attempts"`
+	ResponseStatus sql.NullInt64  `db:"response_status"`
+	LastError      sql.NullString `db:"last_error"`
+	RedeliveryOf   sql.NullInt64  `db:"redelivery_of"`
+	NextAttemptAt  time.Time      `db:"next_attempt_at"`
+	CreatedAt      time.Time      `db:"created_at"`
+	DeliveredAt    sql.NullTime   `db:"delivered_at"`
+}
+
+func (d WebhookDelivery) ToDomain() domain.WebhookDelivery {
+	result := domain.WebhookDelivery{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      domain.AuditAction(d.EventType),
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		ResponseStatus: int(d.ResponseStatus.Int64),
+		LastError:      d.LastError.String,
+		CreatedAt:      d.CreatedAt,
+	}
+	if d.RedeliveryOf.Valid {
+		result.RedeliveryOf = &d.RedeliveryOf.Int64
+	}
+	if d.Status == domain.DeliveryPending {
+		result.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.DeliveredAt.Valid {
+		result.DeliveredAt = &d.DeliveredAt.Time
+	}
+	return result
+}
+
+func webhookGroupKeys(groups []string) pq.StringArray {
+	keys := make(pq.StringArray, 0, len(groups))
+	for _, group := range groups {
+		keys = append(keys, groupKey(domain.GroupName(group)))
+	}
+	return keys
+}
+
+func nonNilStrings(values []string) pq.StringArray {
+	if values == nil {
+		return pq.StringArray{}
+	}
+	return values
+}
+
+// CreateWebhook создаёт подписку пользователя userID. req.Secret должен быть уже задан
+func (p *DB) CreateWebhook(ctx context.Context, userID int64, req domain.WebhookRequest) (domain.WebhookSubscription, error) {
+	const op = "storage.postgres.CreateWebhook"
+
+	p.log.Debug(op, "trying to create webhook: ", req.URL, "user", userID)
+	var row WebhookSubscription
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		qry, args, err := p.sq.Insert("webhook_subscriptions").
+			Columns("user_id", "url", "event_types", "groups", "group_keys", "secret", "created_at", "updated_at").
+			Values(userID, req.URL, nonNilStrings(req.EventTypes), nonNilStrings(req.Groups), webhookGroupKeys(req.Groups), req.Secret, time.Now(), time.Now()).
+			Suffix("RETURNING " + p.columns(WebhookSubscription{})).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&row); err != nil {
+			return err
+		}
+		// секрет в журнал не пишется, ToDomain его не отдаёт
+		return p.auditTx(ctx, tx, change{action: domain.AuditWebhookCreate, target: domain.WebhookTarget(row.ID), after: row.ToDomain()})
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.WebhookSubscription{}, err
+	}
+	result := row.ToDomain()
+	result.Secret = row.Secret
+	return result, nil
+}
+
+// GetWebhooks подписки пользователя
+func (p *DB) GetWebhooks(ctx context.Context, userID int64) ([]domain.WebhookSubscription, error) {
+	const op = "storage.postgres.GetWebhooks"
+
+	qry, args, err := p.sm.Select(p.sq.Select(), &WebhookSubscription{}).
+		From("webhook_subscriptions").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []WebhookSubscription
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	result := make([]domain.WebhookSubscription, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row.ToDomain())
+	}
+	return result, nil
+}
+
+// GetWebhook подписка id пользователя userID. Чужая подписка не находится
+func (p *DB) GetWebhook(ctx context.Context, userID int64, id int64) (domain.WebhookSubscription, error) {
+	const op = "storage.postgres.GetWebhook"
+
+	qry, args, err := p.sm.Select(p.sq.Select(), &WebhookSubscription{}).
+		From("webhook_subscriptions").
+		Where(sq.Eq{"id": id, "user_id": userID}).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.WebhookSubscription{}, err
+	}
+	var row WebhookSubscription
+	err = p.db.GetContext(ctx, &row, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.WebhookSubscription{}, domain.ErrWebhookNotFound
+	}
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.WebhookSubscription{}, err
+	}
+	return row.ToDomain(), nil
+}
+
+// UpdateWebhook меняет непустые поля подписки. Включение подписки сбрасывает счётчик неудачных попыток
+func (p *DB) UpdateWebhook(ctx context.Context, userID int64, id int64, patch domain.WebhookRequest) (domain.WebhookSubscription, error) {
+	const op = "storage.postgres.UpdateWebhook"
+
+	query := p.sq.Update("webhook_subscriptions").
+		Set("updated_at", time.Now()).
+		Where(sq.Eq{"id": id, "user_id": userID})
+	if patch.URL != "" {
+		query = query.Set("url", patch.URL)
+	}
+	if patch.EventTypes != nil {
+		query = query.Set("event_types", nonNilStrings(patch.EventTypes))
+	}
+	if patch.Groups != nil {
+		query = query.Set("groups", nonNilStrings(patch.Groups)).Set("group_keys", webhookGroupKeys(patch.Groups))
+	}
+	if patch.Secret != "" {
+		query = query.Set("secret", patch.Secret)
+	}
+	if patch.Enabled != nil {
+		query = query.Set("enabled", *patch.Enabled)
+		if *patch.Enabled {
+			query = query.Set("failures", 0).Set("disabled_reason", nil)
+		} else {
+			query = query.Set("disabled_reason", "disabled by owner")
+		}
+	}
+	var row WebhookSubscription
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		before, err := p.lockWebhookTx(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+		qry, args, err := query.Suffix("RETURNING " + p.columns(WebhookSubscription{})).ToSql()
+		if err != nil {
+			return err
+		}
+		if err = tx.QueryRowxContext(ctx, qry, args...).StructScan(&row); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: domain.AuditWebhookUpdate, target: domain.WebhookTarget(id), before: before, after: row.ToDomain()})
+	})
+	if errors.Is(err, domain.ErrWebhookNotFound) {
+		return domain.WebhookSubscription{}, err
+	}
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.WebhookSubscription{}, err
+	}
+	result := row.ToDomain()
+	if patch.Secret != "" {
+		result.Secret = row.Secret
+	}
+	return result, nil
+}
+
+// DeleteWebhook удаляет подписку вместе с журналом её доставок
+func (p *DB) DeleteWebhook(ctx context.Context, userID int64, id int64) error {
+	const op = "storage.postgres.DeleteWebhook"
+
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		before, err := p.lockWebhookTx(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+		qry, args, err := p.sq.Delete("webhook_subscriptions").Where(sq.Eq{"id": id}).ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+			return err
+		}
+		return p.auditTx(ctx, tx, change{action: domain.AuditWebhookDelete, target: domain.WebhookTarget(id), before: before})
+	})
+	if err != nil && !errors.Is(err, domain.ErrWebhookNotFound) {
+		p.log.Error(op, " ERROR: ", err)
+	}
+	return err
+}
+
+// lockWebhookTx блокирует подписку id пользователя userID. Чужая подписка не находится
+func (p *DB) lockWebhookTx(ctx context.Context, tx *sqlx.Tx, userID int64, id int64) (domain.WebhookSubscription, error) {
+	qry, args, err := p.sm.Select(p.sq.Select(), &WebhookSubscription{}).
+		From("webhook_subscriptions").
+		Where(sq.Eq{"id": id, "user_id": userID}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return domain.WebhookSubscription{}, err
+	}
+	var row WebhookSubscription
+	err = tx.GetContext(ctx, &row, qry, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.WebhookSubscription{}, domain.ErrWebhookNotFound
+	}
+	if err != nil {
+		return domain.WebhookSubscription{}, err
+	}
+	return row.ToDomain(), nil
+}
+
+// EnqueueDeliveries создаёт доставки события всем включённым подпискам, под фильтры которых оно подходит.
+// Повторный вызов для того же события новых доставок не создаёт. Возвращает сколько доставок создано
+func (p *DB) EnqueueDeliveries(ctx context.Context, event domain.Event) (int64, error) {
+	const op = "storage.postgres.EnqueueDeliveries"
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	keys := pq.StringArray{groupKey(event.GroupName)}
+	if event.PreviousGroup != "" {
+		keys = append(keys, groupKey(event.PreviousGroup))
+	}
+	subscribers := sq.Select("id").
+		Column(sq.Expr("?::BIGINT", event.ID)).
+		Column(sq.Expr("?::VARCHAR", string(event.Type))).
+		Column(sq.Expr("?::JSONB", string(payload))).
+		From("webhook_subscriptions").
+		Where("enabled").
+		Where("(cardinality(event_types) = 0 OR ? = ANY(event_types))", string(event.Type)).
+		Where("(cardinality(group_keys) = 0 OR group_keys && ?)", keys)
+	qry, args, err := p.sq.Insert("webhook_deliveries").
+		Columns("subscription_id", "event_id", "event_type", "payload").
+		Select(subscribers).
+		Suffix("ON CONFLICT (subscription_id, event_id) WHERE redelivery_of IS NULL DO NOTHING").
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return 0, err
+	}
+	res, err := p.db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return 0, err
+	}
+	enqueued, _ := res.RowsAffected()
+	return enqueued, nil
+}
+
+// pendingDeliveryRow доставка вместе с адресом и секретом подписки
+type pendingDeliveryRow struct {
+	WebhookDelivery
+	URL     string `db:"url"`
+	Secret  string `db:"secret"`
+	Payload []byte `db:"payload"`
+}
+
+// ClaimDeliveries берёт до limit доставок, которым пора уйти, у включённых подписок и сдвигает их следующую попытку на lease,
+// так же как ClaimEvents. attempts растёт на единицу
+func (p *DB) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.PendingDelivery, error) {
+	const op = "storage.postgres.ClaimDeliveries"
+
+	due := sq.Select("d.id").
+		From("webhook_deliveries d").
+		Join("webhook_subscriptions s ON s.id = d.subscription_id").
+		Where("d.status = 'pending' AND d.next_attempt_at <= NOW() AND s.enabled").
+		OrderBy("d.id").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE OF d SKIP LOCKED")
+	qry, args, err := p.sq.Update("webhook_deliveries d").
+		Set("attempts", sq.Expr("d.attempts + 1")).
+		Set("next_attempt_at", sq.Expr("NOW() + make_interval(secs => ?)", lease.Seconds())).
+		From("webhook_subscriptions s").
+		Where("s.id = d.subscription_id").
+		Where(sq.Expr("d.id IN (?)", due)).
+		Suffix("RETURNING d.*, s.url, s.secret").
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []pendingDeliveryRow
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	result := make([]domain.PendingDelivery, len(rows))
+	for i, row := range rows {
+		result[i] = domain.PendingDelivery{WebhookDelivery: row.WebhookDelivery.ToDomain(), URL: row.URL, Secret: row.Secret, Payload: row.Payload}
+	}
+	return result, nil
+}
+
+// FinishDelivery записывает итог попытки доставки. Удачная попытка сбрасывает счётчик ошибок подписки, неудачная
+// увеличивает его, и после disableAfter неудач подряд подписка отключается, а её ждущие доставки помечаются failed
+func (p *DB) FinishDelivery(ctx context.Context, result domain.DeliveryResult, disableAfter int) error {
+	const op = "storage.postgres.FinishDelivery"
+
+	err := p.inTx(ctx, func(tx *sqlx.Tx) error {
+		delivery := p.sq.Update("webhook_deliveries").
+			Set("response_status", sql.NullInt64{Int64: int64(result.ResponseStatus), Valid: result.ResponseStatus != 0}).
+			Where(sq.Eq{"id": result.ID})
+		switch {
+		case result.Error == "":
+			delivery = delivery.Set("status", domain.DeliveryDelivered).Set("delivered_at", time.Now()).Set("last_error", nil)
+		case result.RetryIn > 0:
+			delivery = delivery.Set("last_error", result.Error).
+				Set("next_attempt_at", sq.Expr("NOW() + make_interval(secs => ?)", result.RetryIn.Seconds()))
+		default:
+			delivery = delivery.Set("status", domain.DeliveryFailed).Set("last_error", result.Error)
+		}
+		var subscriptionID int64
+		qry, args, err := delivery.Suffix("RETURNING subscription_id").ToSql()
+		if err != nil {
+			return err
+		}
+		if err = tx.QueryRowxContext(ctx, qry, args...).Scan(&subscriptionID); err != nil {
+			return err
+		}
+
+		subscription := p.sq.Update("webhook_subscriptions").Where(sq.Eq{"id": subscriptionID})
+		if result.Error == "" {
+			subscription = subscription.Set("failures", 0)
+		} else {
+			subscription = subscription.Set("failures", sq.Expr("failures + 1"))
+		}
+		var failures int
+		qry, args, err = subscription.Suffix("RETURNING failures").ToSql()
+		if err != nil {
+			return err
+		}
+		if err = tx.QueryRowxContext(ctx, qry, args...).Scan(&failures); err != nil {
+			return err
+		}
+		if disableAfter <= 0 || failures < disableAfter {
+			return nil
+		}
+		return p.disableWebhookTx(ctx, tx, subscriptionID, result.Error)
+	})
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return err
+	}
+	return nil
+}
+
+// disableWebhookTx отключает подписку после череды неудач. Ждущие доставки больше не отправятся, их можно повторить вручную
+func (p *DB) disableWebhookTx(ctx context.Context, tx *sqlx.Tx, id int64, lastError string) error {
+	qry, args, err := p.sq.Update("webhook_subscriptions").
+		Set("enabled", false).
+		Set("disabled_reason", "too many failed deliveries, last error: "+lastError).
+		Set("updated_at", time.Now()).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, qry, args...); err != nil {
+		return err
+	}
+	qry, args, err = p.sq.Update("webhook_deliveries").
+		Set("status", domain.DeliveryFailed).
+		Where(sq.Eq{"subscription_id": id, "status": domain.DeliveryPending}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, qry, args...)
+	return err
+}
+
+// GetDeliveries журнал доставок подписки, новые первыми
+func (p *DB) GetDeliveries(ctx context.Context, userID int64, subscriptionID int64, limit int, offset int) ([]domain.WebhookDelivery, error) {
+	const op = "storage.postgres.GetDeliveries"
+
+	if _, err := p.GetWebhook(ctx, userID, subscriptionID); err != nil {
+		return nil, err
+	}
+	query := p.sm.Select(p.sq.Select(), &WebhookDelivery{}).
+		From("webhook_deliveries").
+		Where(sq.Eq{"subscription_id": subscriptionID}).
+		OrderBy("id DESC").
+		Offset(uint64(offset))
+	if limit > 0 {
+		query = query.Limit(uint64(limit))
+	}
+	qry, args, err := query.ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	var rows []WebhookDelivery
+	if err = p.db.SelectContext(ctx, &rows, qry, args...); err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return nil, err
+	}
+	result := make([]domain.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row.ToDomain())
+	}
+	return result, nil
+}
+
+// Redeliver ставит в очередь новую доставку того же события той же подписке. Исходная доставка остаётся в журнале как была
+func (p *DB) Redeliver(ctx context.Context, userID int64, subscriptionID int64, deliveryID int64) (domain.WebhookDelivery, error) {
+	const op = "storage.postgres.Redeliver"
+
+	original := sq.Select("d.subscription_id", "d.event_id", "d.event_type", "d.payload", "d.id").
+		From("webhook_deliveries d").
+		Join("webhook_subscriptions s ON s.id = d.subscription_id").
+		Where(sq.Eq{"d.id": deliveryID, "d.subscription_id": subscriptionID, "s.user_id": userID})
+	qry, args, err := p.sq.Insert("webhook_deliveries").
+		Columns("subscription_id", "event_id", "event_type", "payload", "redelivery_of").
+		Select(original).
+		Suffix("RETURNING " + p.columns(WebhookDelivery{})).
+		ToSql()
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.WebhookDelivery{}, err
+	}
+	var row WebhookDelivery
+	err = p.db.QueryRowxContext(ctx, qry, args...).StructScan(&row)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err = p.GetWebhook(ctx, userID, subscriptionID); err != nil {
+			return domain.WebhookDelivery{}, err
+		}
+		return domain.WebhookDelivery{}, domain.ErrDeliveryNotFound
+	}
+	if err != nil {
+		p.log.Error(op, " ERROR: ", err)
+		return domain.WebhookDelivery{}, err
+	}
+	return row.ToDomain(), nil
+}
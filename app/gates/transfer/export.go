@@ -0,0 +1,117 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/formats"
+	"time"
+)
+
+// Encoder пишет песни в поток по одной
+type Encoder interface {
+	Encode(song domain.Song) error
+	// Close дописывает хвост формата (например закрывающую скобку JSON массива) и сбрасывает буферы
+	Close() error
+}
+
+// PlaylistTitle название плейлиста при выгрузке в m3u8, xspf и pls
+const PlaylistTitle = "mobileSongLibrary"
+
+// NewEncoder создаёт Encoder для формата csv, ndjson, json или одного из форматов плейлистов (m3u8, xspf, pls)
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+	if formats.IsPlaylist(format) {
+		return formats.NewEncoder(format, w, PlaylistTitle)
+	}
+	switch format {
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		return &jsonEncoder{w: w, enc: json.NewEncoder(w)}, nil
+	case FormatJSON:
+		return &jsonEncoder{w: w, enc: json.NewEncoder(w), array: true}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// ContentType MIME тип формата экспорта
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatJSON:
+		return "application/json"
+	}
+	return formats.ContentType(format)
+}
+
+// csvEncoder пишет CSV с тем же заголовком, который понимает ReadCSV
+type csvEncoder struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+	return e.w.Write([]string{fieldGroup, fieldSong, fieldReleaseDate, fieldText, fieldLink, fieldLRC})
+}
+
+func (e *csvEncoder) Encode(song domain.Song) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	var releaseDate string
+	if !song.ReleaseDate.IsZero() {
+		releaseDate = time.Time(song.ReleaseDate).Format("02.01.2006")
+	}
+	return e.w.Write([]string{string(song.GroupName), string(song.SongName), releaseDate, song.Text, string(song.Link), song.LRC})
+}
+
+func (e *csvEncoder) Close() error {
+	if err := e.writeHeader(); err != nil { //пустая выборка, но заголовок всё равно нужен
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonEncoder пишет NDJSON, либо JSON массив если array = true
+type jsonEncoder struct {
+	w     io.Writer
+	enc   *json.Encoder
+	array bool
+	count int
+}
+
+func (e *jsonEncoder) Encode(song domain.Song) error {
+	if e.array {
+		sep := ","
+		if e.count == 0 {
+			sep = "["
+		}
+		if _, err := io.WriteString(e.w, sep); err != nil {
+			return err
+		}
+	}
+	e.count++
+	return e.enc.Encode(song)
+}
+
+func (e *jsonEncoder) Close() error {
+	if !e.array {
+		return nil
+	}
+	if e.count == 0 {
+		_, err := io.WriteString(e.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
@@ -0,0 +1,64 @@
+package transfer
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"mobileSongLibrary/domain"
+	"testing"
+	"time"
+)
+
+var exportSongs = []domain.Song{
+	{
+		GroupName:   "Muse",
+		SongName:    "Supermassive Black Hole",
+		ReleaseDate: domain.CustomDate(time.Date(2006, time.July, 16, 0, 0, 0, 0, time.UTC)),
+		Text:        "Ooh baby, don't you know I suffer?\nOoh baby, can you hear me moan?",
+		Link:        "https://www.youtube.com/watch?v=Xsp3_a-PMTw",
+		LRC:         "[00:17.50]Ooh baby, don't you know I suffer?\n[00:21.00]Ooh baby, can you hear me moan?",
+	},
+	{GroupName: "Buku", SongName: "Front to Back"},
+}
+
+// Выгруженный файл должен читаться импортом обратно без потерь
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		var buf bytes.Buffer
+		encoder, err := NewEncoder(format, &buf)
+		require.NoError(t, err)
+		for _, song := range exportSongs {
+			require.NoError(t, encoder.Encode(song))
+		}
+		require.NoError(t, encoder.Close())
+
+		var songs []domain.Song
+		collect := func(row Row) error {
+			require.NoError(t, row.Err)
+			songs = append(songs, row.Song)
+			return nil
+		}
+		if format == FormatCSV {
+			require.NoError(t, ReadCSV(&buf, nil, collect))
+		} else {
+			require.NoError(t, ReadNDJSON(&buf, collect))
+		}
+		require.Len(t, songs, len(exportSongs), format)
+		require.Equal(t, exportSongs[0], songs[0], format)
+		require.Equal(t, exportSongs[1].SongName, songs[1].SongName, format)
+	}
+}
+
+func TestExportJSONArray(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(FormatJSON, &buf)
+	require.NoError(t, err)
+	require.NoError(t, encoder.Close())
+	require.Equal(t, "[]\n", buf.String())
+
+	buf.Reset()
+	encoder, _ = NewEncoder(FormatJSON, &buf)
+	require.NoError(t, encoder.Encode(exportSongs[1]))
+	require.NoError(t, encoder.Encode(exportSongs[1]))
+	require.NoError(t, encoder.Close())
+	require.JSONEq(t, `[{"group":"Buku","song":"Front to Back","release_date":"01.01.0001"},{"group":"Buku","song":"Front to Back","release_date":"01.01.0001"}]`, buf.String())
+}
@@ -0,0 +1,337 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/formats"
+	"mobileSongLibrary/gates/storage"
+	"strconv"
+	"strings"
+)
+
+// Форматы импорта и экспорта
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatJSON   = "json"
+)
+
+// Поля песни, в которые отображаются колонки CSV
+const (
+	fieldGroup       = "group"
+	fieldSong        = "song"
+	fieldReleaseDate = "release_date"
+	fieldText        = "text"
+	fieldLink        = "link"
+	fieldLRC         = "lrc"
+)
+
+var ErrUnknownFormat = errors.New("unknown format")
+
+// defaultMapping как называются колонки CSV, если маппинг не передан явно
+var defaultMapping = map[string]string{
+	"group":        fieldGroup,
+	"group_name":   fieldGroup,
+	"artist":       fieldGroup,
+	"song":         fieldSong,
+	"song_name":    fieldSong,
+	"title":        fieldSong,
+	"release_date": fieldReleaseDate,
+	"releasedate":  fieldReleaseDate,
+	"text":         fieldText,
+	"lyrics":       fieldText,
+	"link":         fieldLink,
+	"url":          fieldLink,
+	"lrc":          fieldLRC,
+}
+
+// ParseMapping разбирает маппинг колонок вида "Artist=group,Title=song"
+func ParseMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		column, field, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mapping %q, expected column=field", pair)
+		}
+		field = strings.TrimSpace(field)
+		switch field {
+		case fieldGroup, fieldSong, fieldReleaseDate, fieldText, fieldLink, fieldLRC:
+		default:
+			return nil, fmt.Errorf("unknown field %q in mapping", field)
+		}
+		mapping[strings.ToLower(strings.TrimSpace(column))] = field
+	}
+	return mapping, nil
+}
+
+// Row одна прочитанная строка файла импорта
+type Row struct {
+	Line int
+	Song domain.Song
+	Err  error // строку не удалось разобрать
+}
+
+// ReadCSV построчно читает CSV с заголовком и вызывает fn для каждой строки.
+// Колонки сопоставляются с полями песни через mapping, а если колонки в нём нет - через defaultMapping
+func ReadCSV(r io.Reader, mapping map[string]string, fn func(Row) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	fields := make([]string, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if field, ok := mapping[column]; ok {
+			fields[i] = field
+		} else {
+			fields[i] = defaultMapping[column]
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		row := Row{Line: line}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return err
+			}
+			row.Err = err
+		} else {
+			row.Song, row.Err = songFromRecord(fields, record)
+		}
+		if err = fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+func songFromRecord(fields []string, record []string) (domain.Song, error) {
+	var song domain.Song
+	for i, value := range record {
+		if i >= len(fields) {
+			break
+		}
+		value = strings.TrimSpace(value)
+		switch fields[i] {
+		case fieldGroup:
+			song.GroupName = domain.GroupName(value)
+		case fieldSong:
+			song.SongName = domain.SongName(value)
+		case fieldText:
+			song.Text = value
+		case fieldLink:
+			song.Link = domain.Link(value)
+		case fieldLRC:
+			song.LRC = value
+		case fieldReleaseDate:
+			if value == "" {
+				continue
+			}
+			date, err := domain.ParseCustomDate(value)
+			if err != nil {
+				return song, fmt.Errorf("invalid release_date %q, expected DD.MM.YYYY", value)
+			}
+			song.ReleaseDate = date
+		}
+	}
+	return song, nil
+}
+
+// ReadNDJSON построчно читает песни в формате NDJSON (по JSON объекту domain.Song на строку) и вызывает fn для каждой
+func ReadNDJSON(r io.Reader, fn func(Row) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) //тексты песен бывают длинными
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+		row := Row{Line: line}
+		row.Err = json.Unmarshal([]byte(data), &row.Song)
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ReadPlaylist читает плейлист m3u8, xspf или pls. Номер строки в Row - порядковый номер записи в плейлисте
+func ReadPlaylist(r io.Reader, format string, fn func(Row) error) error {
+	entry := 0
+	return formats.Decode(format, r, func(song domain.Song) error {
+		entry++
+		return fn(Row{Line: entry, Song: song})
+	})
+}
+
+// Store куда импортируются песни
+type Store interface {
+	UpsertSong(ctx context.Context, song storage.Song) (bool, error)
+}
+
+// Enricher дополняет песню данными из внешнего API
+type Enricher interface {
+	Enrich(ctx context.Context, song domain.Song) (domain.Song, error)
+}
+
+type ImportOptions struct {
+	Format  string            // csv, ndjson или плейлист m3u8, xspf, pls
+	Mapping map[string]string // маппинг колонок CSV на поля песни
+	DryRun  bool              // только проверить файл, ничего не записывая
+	Enrich  bool              // дополнять пустые поля через внешний API
+}
+
+// RowError строка, которую не удалось импортировать
+type RowError struct {
+	Line      int              `json:"line"`
+	GroupName domain.GroupName `json:"group,omitempty"`
+	SongName  domain.SongName  `json:"song,omitempty"`
+	Error     string           `json:"error"`
+}
+
+type ImportReport struct {
+	DryRun  bool       `json:"dry_run"`
+	Total   int        `json:"total"`
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	Failed  int        `json:"failed"`
+	Errors  []RowError `json:"errors"`
+}
+
+type Importer struct {
+	store    Store
+	enricher Enricher
+	log      *slog.Logger
+}
+
+func NewImporter(store Store, enricher Enricher, log *slog.Logger) *Importer {
+	return &Importer{store: store, enricher: enricher, log: log}
+}
+
+// Import читает песни из r и сохраняет их через Store. Ошибки отдельных строк попадают в отчёт и не прерывают импорт,
+// возвращаемая ошибка значит что импорт оборвался целиком (битый файл, недоступная бд)
+func (im *Importer) Import(ctx context.Context, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	const op = "gates.transfer.Import"
+
+	im.log.Info(op, "starting import, format", opts.Format, "dry_run", opts.DryRun, "enrich", opts.Enrich)
+	report := ImportReport{DryRun: opts.DryRun, Errors: []RowError{}}
+	handle := func(row Row) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		report.Total++
+		created, err := im.importRow(ctx, row, opts)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			report.Failed++
+			report.Errors = append(report.Errors, RowError{
+				Line:      row.Line,
+				GroupName: row.Song.GroupName,
+				SongName:  row.Song.SongName,
+				Error:     err.Error(),
+			})
+		case created:
+			report.Created++
+		case !opts.DryRun:
+			report.Updated++
+		}
+		return nil
+	}
+
+	var err error
+	switch opts.Format {
+	case FormatCSV:
+		err = ReadCSV(r, opts.Mapping, handle)
+	case FormatNDJSON:
+		err = ReadNDJSON(r, handle)
+	case formats.M3U8, formats.XSPF, formats.PLS:
+		err = ReadPlaylist(r, opts.Format, handle)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownFormat, opts.Format)
+	}
+	if err != nil {
+		im.log.Error(op, "import failed", err)
+		return report, err
+	}
+	im.log.Info(op, "import finished, total", report.Total, "created", report.Created, "failed", report.Failed)
+	return report, nil
+}
+
+func (im *Importer) importRow(ctx context.Context, row Row, opts ImportOptions) (bool, error) {
+	if row.Err != nil {
+		return false, row.Err
+	}
+	song := row.Song
+	if err := song.Validate(); err != nil {
+		return false, err
+	}
+	if opts.Enrich && (song.Text == "" || song.Link == "" || song.ReleaseDate.IsZero()) {
+		enriched, err := im.enricher.Enrich(ctx, song)
+		if err != nil {
+			return false, err
+		}
+		// Данные из файла важнее данных из API, дополняем только пустые поля
+		if song.Text == "" {
+			song.Text = enriched.Text
+		}
+		if song.Link == "" {
+			song.Link = enriched.Link
+		}
+		if song.ReleaseDate.IsZero() {
+			song.ReleaseDate = enriched.ReleaseDate
+		}
+	}
+	if opts.DryRun {
+		return false, nil
+	}
+	return im.store.UpsertSong(ctx, storage.ToStorage(song))
+}
+
+// WriteErrorReport пишет ошибки импорта в CSV: line, group, song, error
+func WriteErrorReport(w io.Writer, report ImportReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"line", "group", "song", "error"}); err != nil {
+		return err
+	}
+	for _, rowErr := range report.Errors {
+		err := writer.Write([]string{strconv.Itoa(rowErr.Line), string(rowErr.GroupName), string(rowErr.SongName), rowErr.Error})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// FormatFromName угадывает формат по расширению файла
+func FormatFromName(name string) string {
+	switch {
+	case strings.HasSuffix(strings.ToLower(name), ".csv"):
+		return FormatCSV
+	case strings.HasSuffix(strings.ToLower(name), ".ndjson"), strings.HasSuffix(strings.ToLower(name), ".jsonl"):
+		return FormatNDJSON
+	}
+	return formats.FormatFromName(name)
+}
@@ -0,0 +1,88 @@
+package transfer
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/gates/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	songs map[string]storage.Song
+}
+
+func (m *memoryStore) UpsertSong(_ context.Context, song storage.Song) (bool, error) {
+	key := song.GroupKey + "/" + song.SongKey
+	_, exists := m.songs[key]
+	m.songs[key] = song
+	return !exists, nil
+}
+
+type fakeEnricher struct{}
+
+func (fakeEnricher) Enrich(_ context.Context, song domain.Song) (domain.Song, error) {
+	song.Text = "from api"
+	song.Link = "https://example.com"
+	return song, nil
+}
+
+func TestImportCSV(t *testing.T) {
+	csv := "Artist,Title,Release_Date,Lyrics,Link\n" +
+		"Muse,Supermassive Black Hole,16.07.2006,\"Ooh baby, don't you know I suffer?\",https://www.youtube.com/watch?v=Xsp3_a-PMTw\n" +
+		"Buku,Front to Back,30.08.2016,,\n" +
+		",No Group,,,\n" +
+		"Muse,Uprising,2009-09-07,,\n" +
+		"muse,supermassive black hole,,,\n"
+	store := &memoryStore{songs: map[string]storage.Song{}}
+	importer := NewImporter(store, fakeEnricher{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	report, err := importer.Import(context.Background(), strings.NewReader(csv), ImportOptions{Format: FormatCSV, Enrich: true})
+	require.NoError(t, err)
+	require.Equal(t, 5, report.Total)
+	require.Equal(t, 2, report.Created)
+	require.Equal(t, 1, report.Updated)
+	require.Equal(t, 2, report.Failed)
+	require.Equal(t, 4, report.Errors[0].Line)
+	require.Equal(t, 5, report.Errors[1].Line)
+
+	muse := store.songs["muse/supermassive black hole"]
+	require.Equal(t, "from api", muse.Text) //последняя строка без текста дополнена из API
+	buku := store.songs["buku/front to back"]
+	require.Equal(t, time.Date(2016, time.August, 30, 0, 0, 0, 0, time.UTC), buku.ReleaseDate)
+	require.Equal(t, domain.Link("https://example.com"), buku.Link)
+}
+
+func TestImportNDJSONDryRun(t *testing.T) {
+	ndjson := `{"group":"Muse","song":"Hysteria","release_date":"01.12.2003"}
+not json
+
+{"group":"Muse","song":"Starlight"}
+`
+	store := &memoryStore{songs: map[string]storage.Song{}}
+	importer := NewImporter(store, fakeEnricher{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	report, err := importer.Import(context.Background(), strings.NewReader(ndjson), ImportOptions{Format: FormatNDJSON, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Total)
+	require.Equal(t, 1, report.Failed)
+	require.Equal(t, 2, report.Errors[0].Line)
+	require.Empty(t, store.songs)
+
+	var out strings.Builder
+	require.NoError(t, WriteErrorReport(&out, report))
+	require.True(t, strings.HasPrefix(out.String(), "line,group,song,error\n2,,,"))
+}
+
+func TestParseMapping(t *testing.T) {
+	mapping, err := ParseMapping("Artist=group, Track Name=song")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"artist": "group", "track name": "song"}, mapping)
+
+	_, err = ParseMapping("Artist=band")
+	require.Error(t, err)
+}
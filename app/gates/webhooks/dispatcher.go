@@ -0,0 +1,208 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Store очередь доставок вебхуков
+type Store interface {
+	EnqueueDeliveries(ctx context.Context, event domain.Event) (int64, error)
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]domain.PendingDelivery, error)
+	FinishDelivery(ctx context.Context, result domain.DeliveryResult, disableAfter int) error
+}
+
+// Fanout получатель outbox, который раскладывает событие в доставки подходящим подпискам.
+// Сама отправка идёт отдельно в Dispatcher, чтобы медленный партнёр не задерживал остальных получателей outbox
+type Fanout struct {
+	store Store
+}
+
+func NewFanout(store Store) *Fanout {
+	return &Fanout{store: store}
+}
+
+func (f *Fanout) Name() string {
+	return "webhooks"
+}
+
+func (f *Fanout) Publish(ctx context.Context, event domain.Event) error {
+	_, err := f.store.EnqueueDeliveries(ctx, event)
+	return err
+}
+
+// Dispatcher фоновая задача, которая отправляет доставки подписчикам. Неудачная доставка повторяется с растущей паузой,
+// после MaxAttempts попыток помечается failed, а после DisableAfter неудач подряд подписка отключается
+type Dispatcher struct {
+	store        Store
+	client       *http.Client
+	log          *slog.Logger
+	interval     time.Duration
+	batchSize    int
+	lease        time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	maxAttempts  int
+	disableAfter int
+}
+
+func New(store Store, cfg config.Webhooks, log *slog.Logger) *Dispatcher {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Lease <= cfg.Timeout {
+		cfg.Lease = 2 * cfg.Timeout
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 10 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = cfg.MinBackoff
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	return &Dispatcher{
+		store:        store,
+		client:       newClient(cfg),
+		log:          log,
+		interval:     cfg.PollInterval,
+		batchSize:    cfg.BatchSize,
+		lease:        cfg.Lease,
+		minBackoff:   cfg.MinBackoff,
+		maxBackoff:   cfg.MaxBackoff,
+		maxAttempts:  cfg.MaxAttempts,
+		disableAfter: cfg.DisableAfter,
+	}
+}
+
+// newClient http клиент для доставок. Без allow_private он соединяется только с публичными адресами: проверяется
+// адрес, в который имя хоста превратилось при этом соединении, поэтому DNS, который после проверки подписки стал
+// отвечать внутренним адресом, и редиректы во внутреннюю сеть тоже не пройдут. Прокси из окружения не используется,
+// иначе проверялся бы адрес прокси, а не получателя
+func newClient(cfg config.Webhooks) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !domain.PublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", domain.ErrPrivateWebhookTarget, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: cfg.Timeout, Transport: transport}
+}
+
+// Run отправляет доставки, пока не отменён ctx. Полные пачки забираются сразу одна за другой
+func (d *Dispatcher) Run(ctx context.Context) {
+	const op = "gates.webhooks.Run"
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			claimed, err := d.Dispatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				d.log.Error(op, "failed to dispatch webhooks", err)
+			}
+			if err != nil || claimed < d.batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch забирает одну пачку доставок, отправляет их и записывает результат. Возвращает сколько доставок было взято
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	const op = "gates.webhooks.Dispatch"
+
+	deliveries, err := d.store.ClaimDeliveries(ctx, d.batchSize, d.lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, delivery := range deliveries {
+		status, err := d.send(ctx, delivery)
+		if ctx.Err() != nil {
+			break //доставка осталась взятой и уйдёт снова после истечения аренды
+		}
+		result := domain.DeliveryResult{ID: delivery.ID, ResponseStatus: status}
+		if err != nil {
+			result.Error = err.Error()
+			if delivery.Attempts < d.maxAttempts {
+				result.RetryIn = d.backoff(delivery.Attempts)
+			}
+			d.log.Warn(op, fmt.Sprintf("failed to deliver %d to %s, attempt %d, retry in %s", delivery.ID, delivery.URL, delivery.Attempts, result.RetryIn), err)
+		}
+		if err = d.store.FinishDelivery(ctx, result, d.disableAfter); err != nil {
+			return len(deliveries), err
+		}
+	}
+	return len(deliveries), ctx.Err()
+}
+
+// send отправляет одну доставку. Любой ответ кроме 2xx считается ошибкой, код ответа возвращается и при ошибке
+func (d *Dispatcher) send(ctx context.Context, delivery domain.PendingDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mobileSongLibrary-Webhooks")
+	req.Header.Set(HeaderID, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+	req.Header.Set(HeaderEventID, strconv.FormatInt(delivery.EventID, 10))
+	req.Header.Set(HeaderEventType, string(delivery.EventType))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) //дочитываем, чтобы соединение вернулось в пул
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff пауза перед следующей попыткой: MinBackoff, дальше вдвое больше после каждой ошибки, но не больше MaxBackoff
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.minBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
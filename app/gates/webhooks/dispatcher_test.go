@@ -0,0 +1,205 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"mobileSongLibrary/domain"
+	"mobileSongLibrary/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef-secret"
+
+// memStore очередь доставок в памяти. Отключение подписки повторяет поведение хранилища
+type memStore struct {
+	mu       sync.Mutex
+	pending  []domain.PendingDelivery
+	results  []domain.DeliveryResult
+	failures int
+	disabled bool
+}
+
+func (m *memStore) EnqueueDeliveries(_ context.Context, event domain.Event) (int64, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = append(m.pending, domain.PendingDelivery{
+		WebhookDelivery: domain.WebhookDelivery{ID: int64(len(m.pending) + 1), EventID: event.ID, EventType: event.Type},
+		Payload:         payload,
+	})
+	return 1, nil
+}
+
+func (m *memStore) ClaimDeliveries(_ context.Context, limit int, _ time.Duration) ([]domain.PendingDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.disabled {
+		return nil, nil
+	}
+	if limit > len(m.pending) {
+		limit = len(m.pending)
+	}
+	claimed := m.pending[:limit]
+	m.pending = m.pending[limit:]
+	for i := range claimed {
+		claimed[i].Attempts++
+	}
+	return claimed, nil
+}
+
+func (m *memStore) FinishDelivery(_ context.Context, result domain.DeliveryResult, disableAfter int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results = append(m.results, result)
+	if result.Error == "" {
+		m.failures = 0
+		return nil
+	}
+	m.failures++
+	if disableAfter > 0 && m.failures >= disableAfter {
+		m.disabled = true
+	}
+	return nil
+}
+
+func testLog() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+func pending(url string, attempts int) domain.PendingDelivery {
+	return domain.PendingDelivery{
+		WebhookDelivery: domain.WebhookDelivery{ID: 1, EventID: 7, EventType: domain.AuditSongUpdate, Attempts: attempts},
+		URL:             url,
+		Secret:          testSecret,
+		Payload:         []byte(`{"id":7,"type":"song.update"}`),
+	}
+}
+
+func TestDispatchSignsDelivery(t *testing.T) {
+	var verified error
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verified = Verify(testSecret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, time.Minute)
+		require.Equal(t, "7", r.Header.Get(HeaderEventID))
+		require.Equal(t, "song.update", r.Header.Get(HeaderEventType))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	store := &memStore{pending: []domain.PendingDelivery{pending(receiver.URL, 0)}}
+	dispatcher := New(store, config.Webhooks{AllowPrivate: true}, testLog())
+	claimed, err := dispatcher.Dispatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, claimed)
+	require.NoError(t, verified)
+	require.Equal(t, []domain.DeliveryResult{{ID: 1, ResponseStatus: http.StatusNoContent}}, store.results)
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	cfg := config.Webhooks{MinBackoff: time.Second, MaxBackoff: 3 * time.Second, MaxAttempts: 3, AllowPrivate: true}
+	store := &memStore{pending: []domain.PendingDelivery{pending(receiver.URL, 1)}}
+	_, err := New(store, cfg, testLog()).Dispatch(context.Background())
+	require.NoError(t, err)
+	//вторая попытка не удалась, третья через 2s
+	require.Equal(t, http.StatusServiceUnavailable, store.results[0].ResponseStatus)
+	require.NotEmpty(t, store.results[0].Error)
+	require.Equal(t, 2*time.Second, store.results[0].RetryIn)
+
+	store.pending = []domain.PendingDelivery{pending(receiver.URL, 2)}
+	_, err = New(store, cfg, testLog()).Dispatch(context.Background())
+	require.NoError(t, err)
+	//третья попытка последняя
+	require.Zero(t, store.results[1].RetryIn)
+}
+
+func TestDispatchDisablesAfterRepeatedFailures(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	store := &memStore{}
+	for i := 0; i < 3; i++ {
+		delivery := pending(receiver.URL, 0)
+		delivery.ID = int64(i + 1)
+		store.pending = append(store.pending, delivery)
+	}
+	dispatcher := New(store, config.Webhooks{BatchSize: 1, DisableAfter: 3, AllowPrivate: true}, testLog())
+	for i := 0; i < 3; i++ {
+		_, err := dispatcher.Dispatch(context.Background())
+		require.NoError(t, err)
+	}
+	require.True(t, store.disabled)
+
+	//доставки отключённой подписки больше не берутся
+	store.pending = append(store.pending, pending(receiver.URL, 0))
+	claimed, err := dispatcher.Dispatch(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, claimed)
+	require.Len(t, store.results, 3)
+}
+
+func TestDispatchRefusesPrivateTargets(t *testing.T) {
+	var called bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+	// имя, которое резолвится во внутренний адрес, проверяется уже при соединении
+	target := strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)
+
+	store := &memStore{pending: []domain.PendingDelivery{pending(receiver.URL, 0), pending(target, 0)}}
+	_, err := New(store, config.Webhooks{}, testLog()).Dispatch(context.Background())
+	require.NoError(t, err)
+	require.False(t, called)
+	require.Len(t, store.results, 2)
+	for _, result := range store.results {
+		require.Contains(t, result.Error, domain.ErrPrivateWebhookTarget.Error())
+	}
+}
+
+func TestFanoutEnqueuesEvent(t *testing.T) {
+	store := &memStore{}
+	fanout := NewFanout(store)
+	require.NoError(t, fanout.Publish(context.Background(), domain.Event{ID: 3, Type: domain.AuditSongDelete}))
+	require.Len(t, store.pending, 1)
+	require.Equal(t, int64(3), store.pending[0].EventID)
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Now().Unix()
+	signature := Sign(testSecret, now, body)
+	require.NoError(t, Verify(testSecret, itoa(now), signature, body, time.Minute))
+	require.ErrorIs(t, Verify("another-secret-value", itoa(now), signature, body, time.Minute), ErrBadSignature)
+	require.ErrorIs(t, Verify(testSecret, itoa(now), signature, []byte(`{"id":2}`), time.Minute), ErrBadSignature)
+
+	old := now - 3600
+	require.ErrorIs(t, Verify(testSecret, itoa(old), Sign(testSecret, old, body), body, time.Minute), ErrStaleTimestamp)
+
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	require.Greater(t, len(secret), 16)
+}
+
+func itoa(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
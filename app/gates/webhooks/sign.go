@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Заголовки доставки. Получатель проверяет подпись и отбрасывает запросы со старым X-Webhook-Timestamp,
+// чтобы перехваченную доставку нельзя было повторить
+const (
+	HeaderID        = "X-Webhook-Id"        // id доставки, у повторной доставки вручную свой
+	HeaderTimestamp = "X-Webhook-Timestamp" // unix время отправки в секундах
+	HeaderSignature = "X-Webhook-Signature" // sha256=<hex HMAC-SHA256 от "<timestamp>.<тело>">
+	HeaderEventID   = "X-Event-Id"          // id события, по нему получатель отбрасывает повторы
+	HeaderEventType = "X-Event-Type"
+)
+
+const signaturePrefix = "sha256="
+
+var ErrBadSignature = errors.New("webhook signature mismatch")
+var ErrStaleTimestamp = errors.New("webhook timestamp is too old")
+
+// Sign подпись тела body, отправленного в момент timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись доставки и что она отправлена не раньше чем tolerance назад. Получатели на Go могут брать её как есть
+func Verify(secret string, timestamp string, signature string, body []byte, tolerance time.Duration) error {
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if !hmac.Equal([]byte(Sign(secret, sent, body)), []byte(signature)) {
+		return ErrBadSignature
+	}
+	if tolerance > 0 && time.Since(time.Unix(sent, 0)) > tolerance {
+		return ErrStaleTimestamp
+	}
+	return nil
+}
+
+// NewSecret случайный секрет для подписки, которой его не задали
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
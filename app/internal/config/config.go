@@ -4,6 +4,7 @@ import (
 	"github.com/ilyakaznacheev/cleanenv"
 	"log"
 	"os"
+	"time"
 )
 
 type DB struct {
@@ -23,11 +24,103 @@ type Log struct {
 	FilePath string `yaml:"logger_file_path"`
 }
 
+// Batch настройки пакетного добавления песен
+type Batch struct {
+	MaxItems     int   `yaml:"max_items" env-default:"1000"`         // максимум песен в одном запросе
+	Workers      int   `yaml:"workers" env-default:"8"`              // сколько песен одновременно обогащается через внешний API
+	ChunkSize    int   `yaml:"chunk_size" env-default:"500"`         // сколько песен вставляется одной транзакцией
+	MaxBodyBytes int64 `yaml:"max_body_bytes" env-default:"8388608"` // максимальный размер тела запроса, больше - 413 ещё до разбора JSON
+}
+
+// Auth настройки аутентификации. Токены подписываются локальным ключом, внешние сервисы для проверки не нужны
+type Auth struct {
+	Enabled        bool          `yaml:"enabled" env:"AUTH_ENABLED" env-default:"true"`
+	SigningKey     string        `yaml:"signing_key" env:"AUTH_SIGNING_KEY"`           // секрет для HS256
+	PrivateKeyFile string        `yaml:"private_key_file" env:"AUTH_PRIVATE_KEY_FILE"` // PEM с приватным ключом Ed25519, если задан - токены подписываются EdDSA
+	Issuer         string        `yaml:"issuer" env-default:"mobileSongLibrary"`
+	AccessTTL      time.Duration `yaml:"access_ttl" env-default:"15m"`
+	RefreshTTL     time.Duration `yaml:"refresh_ttl" env-default:"720h"`
+	PublicRead     bool          `yaml:"public_read"` // GET запросы без аутентификации
+}
+
+// Plays настройки записи прослушиваний. Прослушивания копятся в памяти и пишутся в бд пачками
+type Plays struct {
+	BatchSize     int           `yaml:"batch_size" env-default:"500"`    // максимум прослушиваний в одной вставке
+	FlushInterval time.Duration `yaml:"flush_interval" env-default:"2s"` // как часто пишется неполная пачка
+	QueueSize     int           `yaml:"queue_size" env-default:"10000"`  // сколько прослушиваний может ждать записи, дальше POST /song/play отвечает 503
+}
+
+// Charts настройки фоновой задачи, которая считает снимки чартов
+type Charts struct {
+	RefreshInterval time.Duration `yaml:"refresh_interval" env-default:"10m"` // как часто пересчитываются чарты
+	Keep            int           `yaml:"keep" env-default:"48"`              // сколько последних снимков каждого периода хранить
+}
+
+// Similar настройки индекса похожих песен
+type Similar struct {
+	RefreshInterval time.Duration `yaml:"refresh_interval" env-default:"30m"` // как часто проверять, не изменилась ли библиотека
+}
+
+// Outbox настройки доставки событий об изменениях библиотеки из таблицы outbox во внешние системы
+type Outbox struct {
+	Enabled      bool          `yaml:"enabled" env:"OUTBOX_ENABLED" env-default:"true"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"1s"` // как часто искать новые события
+	BatchSize    int           `yaml:"batch_size" env-default:"100"`   // сколько событий берётся за раз
+	Lease        time.Duration `yaml:"lease" env-default:"30s"`        // за это время relay должен доставить взятые события, иначе их возьмут снова
+	MinBackoff   time.Duration `yaml:"min_backoff" env-default:"1s"`   // пауза перед первым повтором, дальше удваивается
+	MaxBackoff   time.Duration `yaml:"max_backoff" env-default:"5m"`
+	Retention    time.Duration `yaml:"retention" env-default:"168h"` // сколько хранить доставленные события
+	Sinks        []OutboxSink  `yaml:"sinks"`
+}
+
+// OutboxSink куда доставляются события: webhook (POST на url), file (NDJSON в path, "-" - stdout) или notify (Postgres NOTIFY в channel)
+type OutboxSink struct {
+	Type    string            `yaml:"type"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"` // дополнительные заголовки webhook, например Authorization
+	Timeout time.Duration     `yaml:"timeout"` // таймаут webhook, по умолчанию 10s
+	Path    string            `yaml:"path"`
+	Channel string            `yaml:"channel"`
+}
+
+// Webhooks настройки доставки событий подпискам партнёров. События в подписки раскладывает relay outbox,
+// поэтому без outbox вебхуки не работают
+type Webhooks struct {
+	Enabled      bool          `yaml:"enabled" env:"WEBHOOKS_ENABLED" env-default:"true"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"1s"` // как часто искать доставки, которым пора уйти
+	BatchSize    int           `yaml:"batch_size" env-default:"50"`    // сколько доставок берётся за раз
+	Lease        time.Duration `yaml:"lease" env-default:"1m"`         // за это время доставка должна завершиться, иначе её возьмут снова
+	Timeout      time.Duration `yaml:"timeout" env-default:"10s"`      // таймаут запроса к получателю
+	MinBackoff   time.Duration `yaml:"min_backoff" env-default:"10s"`  // пауза перед первым повтором, дальше удваивается
+	MaxBackoff   time.Duration `yaml:"max_backoff" env-default:"1h"`
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"8"`               // после стольких попыток доставка помечается failed
+	DisableAfter int           `yaml:"disable_after" env-default:"20"`             // после стольких неудач подряд подписка отключается
+	AllowPrivate bool          `yaml:"allow_private" env:"WEBHOOKS_ALLOW_PRIVATE"` // разрешить получателей в localhost и внутренней сети, только для разработки
+}
+
+// Events настройки потока изменений библиотеки по SSE. Поток читает события из outbox, поэтому догнать пропущенное
+// после переподключения можно только за outbox.retention
+type Events struct {
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"500ms"` // как часто искать новые события
+	Heartbeat    time.Duration `yaml:"heartbeat" env-default:"15s"`       // пауза между комментариями, которые держат соединение открытым
+	Buffer       int           `yaml:"buffer" env-default:"256"`          // сколько событий может ждать клиента, дальше клиент отключается
+	WriteTimeout time.Duration `yaml:"write_timeout" env-default:"10s"`   // клиент, который столько не принимает данные, отключается
+	GapGrace     time.Duration `yaml:"gap_grace" env-default:"5s"`        // сколько ждать события, чья транзакция ещё не закоммичена, прежде чем пропустить его id
+}
+
 type Config struct {
-	Env  string `yaml:"env"`
-	DB   DB     `yaml:"postgres_db"`
-	Rest Rest   `yaml:"RestServer"`
-	Log  Log    `yaml:"logger"`
+	Env      string   `yaml:"env"`
+	DB       DB       `yaml:"postgres_db"`
+	Rest     Rest     `yaml:"RestServer"`
+	Log      Log      `yaml:"logger"`
+	Batch    Batch    `yaml:"batch"`
+	Auth     Auth     `yaml:"auth"`
+	Plays    Plays    `yaml:"plays"`
+	Charts   Charts   `yaml:"charts"`
+	Similar  Similar  `yaml:"similar"`
+	Outbox   Outbox   `yaml:"outbox"`
+	Webhooks Webhooks `yaml:"webhooks"`
+	Events   Events   `yaml:"events"`
 }
 
 func MustLoad() *Config {